@@ -65,6 +65,8 @@ type Config struct {
 	UseHostname   bool
 	IsEnterprise  bool
 	UseDevPreview bool
+	// ServiceMemoryQuotas are the quotas of the other services in MB, keyed by the parameter which sets them
+	ServiceMemoryQuotas map[string]int
 }
 
 func (m *Manager) GetMemUsedStats(bucket string) (*helper.MemUsedStats, error) {
@@ -145,6 +147,14 @@ func (m *Manager) StartCluster() (string, error) {
 	}
 	wg.Wait()
 
+	for _, n := range m.Nodes {
+		if n.HasCustomPaths() {
+			if err := n.SetupPaths(); err != nil {
+				return "", err
+			}
+		}
+	}
+
 	glog.Info("Server started. Setting up a cluster")
 	return m.setupNewCluster()
 }
@@ -217,6 +227,12 @@ func (m *Manager) setupNewCluster() (string, error) {
 	if err := epnode.SetupMemoryQuota(memoryQuota); err != nil {
 		return "", err
 	}
+	if len(m.Config.ServiceMemoryQuotas) > 0 {
+		glog.Infof("Set service memory quotas to %v", m.Config.ServiceMemoryQuotas)
+		if err := epnode.SetupServiceMemoryQuotas(m.Config.ServiceMemoryQuotas); err != nil {
+			return "", err
+		}
+	}
 
 	if m.Config.UseHostname {
 		glog.Infof("Set hostname to entry point node")
@@ -241,6 +257,11 @@ func (m *Manager) setupNewCluster() (string, error) {
 		}
 	}
 
+	addNodeURIs, err := m.setupServerGroups(epnode)
+	if err != nil {
+		return "", err
+	}
+
 	// check if rest of nodes are ready to join the cluster
 	if err := m.pollJoinReadyAll(epnode); err != nil {
 		return "", err
@@ -249,12 +270,19 @@ func (m *Manager) setupNewCluster() (string, error) {
 		if i == m.epNode {
 			continue
 		}
+		addNode := func() error {
+			if n.ServerGroup != "" {
+				return epnode.AddNodeToGroup(n, addNodeURIs[n.ServerGroup])
+			}
+			return epnode.AddNode(n, n.Services)
+		}
+
 		glog.Infof("Adding %s to %s", n.HostName, epnode.HostName)
-		if err := epnode.AddNode(n, n.Services); err != nil {
+		if err := addNode(); err != nil {
 			if strings.Contains(err.Error(), "Prepare join failed. Got HTTP status 500 from REST call") {
 				time.Sleep(5 * time.Second)
 				glog.Infof("Adding %s to %s again", n.HostName, epnode.HostName)
-				err = epnode.AddNode(n, n.Services)
+				err = addNode()
 			}
 			if err != nil {
 				return "", err
@@ -282,7 +310,7 @@ func (m *Manager) setupNewCluster() (string, error) {
 
 	// create a bucket
 	if len(m.Config.Bucket.Name) > 0 {
-		if err = m.SetupBucket(m.Config.Bucket.Name, m.Config.Bucket.Type, m.Config.Bucket.Password); err != nil {
+		if err = m.SetupBucket(m.Config.Bucket.Name, m.Config.Bucket.Type, m.Config.Bucket.Password, m.Config.Bucket.Replicas()); err != nil {
 			return "", err
 		}
 	}
@@ -522,7 +550,7 @@ func (m *Manager) ChangeBucketCompression(bucket, mode string) error {
 	return m.Nodes[m.epNode].WaitForBucketReady()
 }
 
-func (m *Manager) SetupBucket(bucketName, bucketType, bucketPassword string) error {
+func (m *Manager) SetupBucket(bucketName, bucketType, bucketPassword string, replicaCount int) error {
 	var bType string
 	switch bucketType {
 	case "memcached":
@@ -536,7 +564,7 @@ func (m *Manager) SetupBucket(bucketName, bucketType, bucketPassword string) err
 		Name:              bucketName,
 		Type:              bType,
 		RamQuotaMB:        "256",
-		ReplicaCount:      1,
+		ReplicaCount:      replicaCount,
 		EphEvictionPolicy: "noEviction",
 	}
 	if err := m.Nodes[m.epNode].CreateBucket(&bc); err != nil {
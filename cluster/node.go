@@ -47,17 +47,21 @@ type RespPoolsNodes struct {
 }
 
 type Node struct {
-	poolsNodes *RespPoolsNodes
-	session    *ssh.Session
-	SshLogin   *helper.Cred
-	RestLogin  *helper.Cred
-	N1qlLogin  *helper.Cred
-	FtsLogin   *helper.Cred
-	HostName   string
-	Port       string
-	Version    string
-	Services   string
-	OtpNode    string
+	poolsNodes    *RespPoolsNodes
+	session       *ssh.Session
+	SshLogin      *helper.Cred
+	RestLogin     *helper.Cred
+	N1qlLogin     *helper.Cred
+	FtsLogin      *helper.Cred
+	HostName      string
+	Port          string
+	Version       string
+	Services      string
+	OtpNode       string
+	DataPath      string
+	IndexPath     string
+	AnalyticsPath string
+	ServerGroup   string
 }
 
 type OsInfo struct {
@@ -114,6 +118,15 @@ func (n *Node) Rebalance(remaining, failedOver, toRemove []Node) error {
 }
 
 func (n *Node) AddNode(newNode *Node, services string) error {
+	return n.addNodeAt(helper.PAddNode, newNode)
+}
+
+// AddNodeToGroup adds a node directly into a server group using the group's addNodeURI
+func (n *Node) AddNodeToGroup(newNode *Node, addNodeURI string) error {
+	return n.addNodeAt(addNodeURI, newNode)
+}
+
+func (n *Node) addNodeAt(addNodePath string, newNode *Node) error {
 	body := fmt.Sprintf("user=%s&password=%s&hostname=%s&services=%s",
 		n.RestLogin.Username, n.RestLogin.Password, newNode.HostName, url.QueryEscape(newNode.Services))
 	glog.Infof("body:%s", body)
@@ -122,7 +135,7 @@ func (n *Node) AddNode(newNode *Node, services string) error {
 		ExpectedCode: 200,
 		RetryOnCode:  400,
 		Method:       "POST",
-		Path:         helper.PAddNode,
+		Path:         addNodePath,
 		Cred:         n.RestLogin,
 		Body:         body,
 		Header:       map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
@@ -134,7 +147,7 @@ func (n *Node) AddNode(newNode *Node, services string) error {
 			// actual server response is Response:400:["user is missing","password is missing","Hostname is required."]
 			return nil
 		}
-		glog.Errorf("restParam:%s\nError:%s", restParam, err)
+		glog.Errorf("restParam:%+v\nError:%s", restParam, err)
 	}
 	return err
 }
@@ -153,6 +166,41 @@ func (n *Node) InitNewCluster(config Config) error {
 	return n.Provision()
 }
 
+func (n *Node) HasCustomPaths() bool {
+	return n.DataPath != "" || n.IndexPath != "" || n.AnalyticsPath != ""
+}
+
+// SetupPaths performs node-init for the data, index and analytics paths, this must happen before the node is
+// provisioned or added to a cluster
+func (n *Node) SetupPaths() error {
+	posts := url.Values{}
+	if n.DataPath != "" {
+		posts.Add("path", n.DataPath)
+	}
+	if n.IndexPath != "" {
+		posts.Add("index_path", n.IndexPath)
+	}
+	if n.AnalyticsPath != "" {
+		posts.Add("cbas_path", n.AnalyticsPath)
+	}
+
+	restParam := &helper.RestCall{
+		ExpectedCode: 200,
+		Method:       "POST",
+		Path:         helper.PNodeSettings,
+		Cred:         n.RestLogin,
+		Body:         posts.Encode(),
+		Header:       map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+	}
+	_, err := helper.RestRetryer(helper.RestRetry, restParam, helper.GetResponse)
+	if err == nil {
+		glog.Infof("Set storage paths for %s", n.HostName)
+	} else {
+		glog.Errorf("Error while setting storage paths for %s:%s", n.HostName, err)
+	}
+	return err
+}
+
 func (n *Node) Provision() error {
 	body := fmt.Sprintf("port=SAME&username=%s&password=%s", n.RestLogin.Username, n.RestLogin.Password)
 
@@ -268,6 +316,29 @@ func (n *Node) SetupMemoryQuota(memoryQuota int) error {
 	return err
 }
 
+// SetupServiceMemoryQuotas sets the memory quotas of services other than data, quotas are keyed by the
+// /pools/default parameter which sets them
+func (n *Node) SetupServiceMemoryQuotas(quotas map[string]int) error {
+	posts := url.Values{}
+	for param, quota := range quotas {
+		posts.Add(param, strconv.Itoa(quota))
+	}
+
+	restParam := &helper.RestCall{
+		ExpectedCode: 200,
+		Method:       "POST",
+		Path:         helper.PPoolsDefault,
+		Cred:         n.RestLogin,
+		Body:         posts.Encode(),
+		Header:       map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+	}
+	_, err := helper.RestRetryer(helper.RestRetry, restParam, helper.GetResponse)
+	if err != nil {
+		glog.Errorf("Error while setting service memory quotas:%s", err)
+	}
+	return err
+}
+
 func (n *Node) SetupInitialService() error {
 	glog.Infof("SetupInitialService for %s", n.HostName)
 	body := fmt.Sprintf("services=%s", url.QueryEscape(n.Services))
@@ -314,8 +385,8 @@ func (n *Node) NetworkReset() error {
 	err := n.RunSsh(&stdoutBuf, &stderrBuf, "tc qdisc del dev eth0 root netem")
 
 	if err != nil {
-		glog.Error("StdOut:%s", stdoutBuf)
-		glog.Error("StdErr:%s", stderrBuf)
+		glog.Errorf("StdOut:%s", stdoutBuf.String())
+		glog.Errorf("StdErr:%s", stderrBuf.String())
 	}
 	return err
 }
@@ -325,8 +396,8 @@ func (n *Node) NetworkDelay() error {
 	err := n.RunSsh(&stdoutBuf, &stderrBuf, "tc qdisc add dev eth0 root netem delay 500ms 200ms loss 10% 25%")
 
 	if err != nil {
-		glog.Error("StdOut:%s", stdoutBuf)
-		glog.Error("StdErr:%s", stderrBuf)
+		glog.Errorf("StdOut:%s", stdoutBuf.String())
+		glog.Errorf("StdErr:%s", stderrBuf.String())
 	}
 	return err
 }
@@ -386,6 +457,27 @@ func (n *Node) CreateBucket(conf *Bucket) error {
 	return err
 }
 
+// UpdateBucket changes the RAM quota of a bucket, and its replica count if one is given.  A changed replica count
+// only takes effect after the cluster is rebalanced.
+func (n *Node) UpdateBucket(name string, ramQuotaMB int, replicaCount *int) error {
+	body := fmt.Sprintf("ramQuotaMB=%d", ramQuotaMB)
+	if replicaCount != nil {
+		body = fmt.Sprintf("%s&replicaNumber=%d", body, *replicaCount)
+	}
+	restParam := &helper.RestCall{
+		ExpectedCode: 200,
+		Method:       "POST",
+		Path:         helper.PBuckets + "/" + name,
+		Cred:         n.RestLogin,
+		Body:         body,
+		Header:       map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+	}
+
+	_, err := helper.RestRetryer(helper.RestRetry, restParam, helper.GetResponse)
+
+	return err
+}
+
 func (n *Node) LoadSample(s string) error {
 	body := fmt.Sprintf("[\"%s\"]", s)
 	restParam := &helper.RestCall{
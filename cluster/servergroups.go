@@ -0,0 +1,123 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+	"github.com/golang/glog"
+)
+
+type RespServerGroup struct {
+	Name       string `json:"name"`
+	URI        string `json:"uri"`
+	AddNodeURI string `json:"addNodeURI"`
+}
+
+type RespServerGroups struct {
+	Groups []RespServerGroup `json:"groups"`
+}
+
+func (n *Node) GetServerGroups() (*RespServerGroups, error) {
+	restParam := &helper.RestCall{
+		ExpectedCode: 200,
+		Method:       "GET",
+		Path:         helper.PServerGroups,
+		Cred:         n.RestLogin,
+	}
+	resp, err := helper.RestRetryer(helper.RestRetry, restParam, helper.GetResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := &RespServerGroups{}
+	if err := json.Unmarshal([]byte(resp), groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (n *Node) CreateServerGroup(name string) error {
+	restParam := &helper.RestCall{
+		ExpectedCode: 200,
+		Method:       "POST",
+		Path:         helper.PServerGroups,
+		Cred:         n.RestLogin,
+		Body:         fmt.Sprintf("name=%s", url.QueryEscape(name)),
+		Header:       map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+	}
+	_, err := helper.RestRetryer(helper.RestRetry, restParam, helper.GetResponse)
+	return err
+}
+
+func (n *Node) RenameServerGroup(groupURI, name string) error {
+	restParam := &helper.RestCall{
+		ExpectedCode: 200,
+		Method:       "PUT",
+		Path:         groupURI,
+		Cred:         n.RestLogin,
+		Body:         fmt.Sprintf("name=%s", url.QueryEscape(name)),
+		Header:       map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+	}
+	_, err := helper.RestRetryer(helper.RestRetry, restParam, helper.GetResponse)
+	return err
+}
+
+// setupServerGroups creates the server groups requested by the nodes and returns the URI to add nodes to each
+// group.  The entry point node is already in the default group, so that group is renamed to the entry point's.
+func (m *Manager) setupServerGroups(epnode *Node) (map[string]string, error) {
+	var hasGroups bool
+	for _, n := range m.Nodes {
+		if n.ServerGroup != "" {
+			hasGroups = true
+		}
+	}
+	if !hasGroups {
+		return nil, nil
+	}
+
+	groups, err := epnode.GetServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	if len(groups.Groups) == 0 {
+		return nil, fmt.Errorf("no default server group found on %s", epnode.HostName)
+	}
+
+	existing := make(map[string]bool)
+	for _, group := range groups.Groups {
+		existing[group.Name] = true
+	}
+
+	defaultGroup := groups.Groups[0]
+	if epnode.ServerGroup != "" && !existing[epnode.ServerGroup] {
+		glog.Infof("Renaming server group %s to %s", defaultGroup.Name, epnode.ServerGroup)
+		if err := epnode.RenameServerGroup(defaultGroup.URI, epnode.ServerGroup); err != nil {
+			return nil, err
+		}
+		existing[epnode.ServerGroup] = true
+	}
+
+	for _, n := range m.Nodes {
+		if n.ServerGroup == "" || existing[n.ServerGroup] {
+			continue
+		}
+		glog.Infof("Creating server group %s", n.ServerGroup)
+		if err := epnode.CreateServerGroup(n.ServerGroup); err != nil {
+			return nil, err
+		}
+		existing[n.ServerGroup] = true
+	}
+
+	groups, err = epnode.GetServerGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	addNodeURIs := make(map[string]string)
+	for _, group := range groups.Groups {
+		addNodeURIs[group.Name] = group.AddNodeURI
+	}
+	return addNodeURIs, nil
+}
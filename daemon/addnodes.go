@@ -0,0 +1,257 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/couchbaselabs/cbdynclusterd/cluster"
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+	"github.com/pkg/errors"
+)
+
+type AddNodesOptions struct {
+	Nodes       []NodeOptions
+	UseHostname bool
+}
+
+func validateAddNodesOptions(existing *Cluster, opts AddNodesOptions) error {
+	if len(opts.Nodes) == 0 {
+		return badRequestf("must specify at least a single node to add")
+	}
+	if len(existing.Nodes)+len(opts.Nodes) > getConfig().maxClusterNodes {
+		return badRequestf("cannot grow clusters beyond %d nodes", getConfig().maxClusterNodes)
+	}
+
+	names := make(map[string]bool)
+	for _, node := range existing.Nodes {
+		names[node.Name] = true
+	}
+	for _, node := range opts.Nodes {
+		if names[node.Name] {
+			return badRequestf("cluster already has a node named %s", node.Name)
+		}
+		names[node.Name] = true
+
+		if err := validateNodePaths(node); err != nil {
+			return err
+		}
+		if err := validateNodeMemory(node); err != nil {
+			return err
+		}
+		if err := validateNodeCPUs(node); err != nil {
+			return err
+		}
+		if err := validateNodeConfigFile(node); err != nil {
+			return err
+		}
+		if err := validateNodeServices(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeAddedNodes kills the containers of a cluster which were not part of it before nodes were added, including
+// any which were created but failed to start.  Nodes which already joined the couchbase cluster are ejected first
+// so that it is not left with members which no longer exist.
+func removeAddedNodes(ctx context.Context, existing *Cluster) {
+	originalNodes := make(map[string]bool)
+	var epnode *Node
+	for _, node := range existing.Nodes {
+		originalNodes[node.ContainerID] = true
+		if node.State == "running" && (epnode == nil || node.ContainerID == existing.Orchestrator) {
+			epnode = node
+		}
+	}
+
+	current, err := getCluster(ctx, existing.ID)
+	if err != nil {
+		log.Printf("Failed to find the added nodes of cluster %s: %s", existing.ID, err)
+		return
+	}
+
+	for _, node := range current.Nodes {
+		if originalNodes[node.ContainerID] {
+			continue
+		}
+		if epnode != nil {
+			if err := ejectClusterNode(epnode, node); err != nil {
+				log.Printf("Failed to eject added node %s of cluster %s: %s", node.ContainerID, existing.ID, err)
+			}
+		}
+		if err := killNode(ctx, node.ContainerID); err != nil {
+			log.Printf("Failed to kill added node %s of cluster %s: %s", node.ContainerID, existing.ID, err)
+		}
+		deregisterNodeHostname(node)
+		forgetRegisteredHostname(existing.ID, node)
+	}
+}
+
+func toClusterNode(node *Node, useHostname bool) *cluster.Node {
+	ipv4 := node.IPv4Address
+	hostname := ipv4
+	if useHostname {
+		hostname = node.ContainerName[1:] + helper.DomainPostfix
+	}
+
+	return &cluster.Node{
+		HostName:  hostname,
+		Port:      strconv.Itoa(helper.RestPort),
+		SshLogin:  &helper.Cred{Username: helper.SshUser, Password: helper.SshPass, Hostname: ipv4, Port: helper.SshPort},
+		RestLogin: &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: ipv4, Port: helper.RestPort},
+	}
+}
+
+// joinNode adds a started node to the cluster through epnode, once the node is ready to join
+func joinNode(epnode *cluster.Node, node *Node, opts NodeOptions, useHostname bool) error {
+	newNode := toClusterNode(node, useHostname)
+	newNode.Services = strings.Join(opts.Services, ",")
+	if newNode.Services == "" {
+		newNode.Services = "kv"
+	}
+
+	chErr := make(chan error, 1)
+	go newNode.PollJoinReady(chErr)
+	if err := <-chErr; err != nil {
+		return errors.Wrapf(err, "node %s was not ready to join", node.Name)
+	}
+
+	if opts.ServerGroup == "" {
+		return epnode.AddNode(newNode, newNode.Services)
+	}
+
+	groups, err := epnode.GetServerGroups()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups.Groups {
+		if group.Name == opts.ServerGroup {
+			return epnode.AddNodeToGroup(newNode, group.AddNodeURI)
+		}
+	}
+	return badRequestf("cluster has no server group named %s", opts.ServerGroup)
+}
+
+// addClusterNodes creates new nodes for an existing cluster and joins them to it, returning the container IDs of
+// the new nodes.  The nodes take on the owner and timeout of the cluster.  They are not rebalanced in, so that
+// several changes to a cluster can share a single rebalance.  Every new container is removed again if any of the
+// nodes fails to be created or to join.
+func addClusterNodes(ctx context.Context, clusterID string, opts AddNodesOptions) ([]string, error) {
+	log.Printf("Adding %d nodes to cluster %s (requested by: %s)", len(opts.Nodes), clusterID, ContextRequester(ctx))
+
+	existing, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, existing); err != nil {
+		return nil, err
+	}
+
+	epnodeHost, err := clusterTargetNode(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unnamed nodes carry on the numbering of the nodes the cluster was allocated with
+	var nodes []NodeOptions
+	for nodeIdx, node := range opts.Nodes {
+		if node.Name == "" {
+			node.Name = fmt.Sprintf("node_%d", len(existing.Nodes)+nodeIdx+1)
+		}
+		if len(existing.Nodes) > 0 {
+			node.Init = existing.Nodes[0].Init
+			node.StopSignal = existing.Nodes[0].StopSignal
+		}
+		nodes = append(nodes, node)
+	}
+	opts.Nodes = nodes
+
+	if err := validateAddNodesOptions(existing, opts); err != nil {
+		return nil, err
+	}
+	opts.Nodes = applyClusterRegistry(ClusterOptions{Registry: existing.Registry, Nodes: opts.Nodes}).Nodes
+
+	if err := checkNodeResourceSupport(ctx, opts.Nodes); err != nil {
+		return nil, err
+	}
+
+	// The nodes count against the namespace of the cluster and are created as its owner
+	ownerCtx := WithNamespace(NewContext(ctx, existing.Owner, ContextIgnoreOwnership(ctx)), existing.Namespace)
+	if err := checkNamespaceCapacity(ownerCtx, len(opts.Nodes)); err != nil {
+		return nil, err
+	}
+
+	preserveData := false
+	for _, node := range existing.Nodes {
+		preserveData = preserveData || node.PreserveData
+	}
+
+	images := distinctNodeImages(opts.Nodes)
+	err = runPhase(ctx, AllocationPhasePull, getConfig().pullTimeout, func(ctx context.Context) error {
+		return forEachParallel(len(images), func(i int) error {
+			return ensureImageExists(ctx, images[i], clusterID)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	containerIDs := make([]string, len(opts.Nodes))
+	err = runPhase(ctx, AllocationPhaseStart, getConfig().containerStartTimeout, func(phaseCtx context.Context) error {
+		ownerPhaseCtx := NewContext(phaseCtx, existing.Owner, ContextIgnoreOwnership(ctx))
+		return forEachParallel(len(opts.Nodes), func(i int) error {
+			node := opts.Nodes[i]
+			allocLogf(clusterID, "Adding node %s running %s from %s", node.Name, node.ServerVersion, node.VersionInfo.toImageName())
+			containerID, err := allocateNode(ownerPhaseCtx, clusterID, existing.Timeout, node, preserveData)
+			if err != nil {
+				return err
+			}
+			containerIDs[i] = containerID[0:12]
+			return nil
+		})
+	})
+	if err != nil {
+		allocLogf(clusterID, "Failed to add nodes, removing them: %s", err)
+		removeAddedNodes(ctx, existing)
+		return nil, err
+	}
+
+	current, err := getCluster(ctx, clusterID)
+	if err != nil {
+		removeAddedNodes(ctx, existing)
+		return nil, err
+	}
+
+	epnode := toClusterNode(epnodeHost, opts.UseHostname)
+	for i, containerID := range containerIDs {
+		var added *Node
+		for _, node := range current.Nodes {
+			if node.ContainerID == containerID {
+				added = node
+			}
+		}
+		if added == nil {
+			removeAddedNodes(ctx, existing)
+			return nil, fmt.Errorf("added node %s is missing from the cluster", containerID)
+		}
+
+		if err := joinNode(epnode, added, opts.Nodes[i], opts.UseHostname); err != nil {
+			allocLogf(clusterID, "Failed to join node %s to the cluster, removing the added nodes: %s", added.Name, err)
+			removeAddedNodes(ctx, existing)
+			return nil, errors.Wrapf(err, "failed to join node %s to the cluster", added.Name)
+		}
+	}
+
+	var names []string
+	for _, node := range opts.Nodes {
+		names = append(names, node.Name)
+	}
+	recordClusterHistory(ctx, clusterID, HistoryEventNodesAdded, "", strings.Join(names, ","))
+	allocLogf(clusterID, "Added nodes %s", strings.Join(names, ", "))
+
+	return containerIDs, nil
+}
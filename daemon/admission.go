@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+type AdmissionNodeJSON struct {
+	Name          string `json:"name"`
+	ServerVersion string `json:"server_version"`
+	Edition       string `json:"edition"`
+}
+
+type AdmissionRequestJSON struct {
+	Owner   string              `json:"owner"`
+	Timeout string              `json:"timeout"`
+	Nodes   []AdmissionNodeJSON `json:"nodes"`
+}
+
+type AdmissionResponseJSON struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+func callAdmissionWebhook(ctx context.Context, opts ClusterOptions) (*AdmissionResponseJSON, error) {
+	reqData := AdmissionRequestJSON{
+		Owner:   ContextUser(ctx),
+		Timeout: opts.Timeout.String(),
+	}
+	for _, node := range opts.Nodes {
+		jsonNode := AdmissionNodeJSON{
+			Name:          node.Name,
+			ServerVersion: node.ServerVersion,
+		}
+		if node.VersionInfo != nil {
+			jsonNode.Edition = string(node.VersionInfo.Edition)
+		}
+		reqData.Nodes = append(reqData.Nodes, jsonNode)
+	}
+
+	body, err := json.Marshal(reqData)
+	if err != nil {
+		return nil, err
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, getConfig().admissionWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest("POST", getConfig().admissionWebhook, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(reqCtx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("admission webhook returned %d", resp.StatusCode)
+	}
+
+	var respData AdmissionResponseJSON
+	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+		return nil, errors.Wrap(err, "could not decode admission webhook response")
+	}
+
+	return &respData, nil
+}
+
+// checkAdmission asks the configured admission webhook whether an allocation may proceed
+func checkAdmission(ctx context.Context, opts ClusterOptions) error {
+	if getConfig().admissionWebhook == "" {
+		return nil
+	}
+
+	resp, err := callAdmissionWebhook(ctx, opts)
+	if err != nil {
+		if getConfig().admissionWebhookFailOpen {
+			log.Printf("Admission webhook failed, allowing allocation (requested by: %s): %s", ContextRequester(ctx), err)
+			return nil
+		}
+		return errors.Wrap(err, "admission webhook failed")
+	}
+
+	if !resp.Allowed {
+		if resp.Reason == "" {
+			return forbiddenf("allocation denied by admission webhook")
+		}
+		return forbiddenf("allocation denied by admission webhook: %s", resp.Reason)
+	}
+
+	return nil
+}
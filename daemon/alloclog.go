@@ -0,0 +1,140 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+const allocLogSuffix = ".log"
+
+// allocLogLock serializes writes to allocation logs, nodes of a cluster are allocated concurrently
+var allocLogLock sync.Mutex
+
+func allocLogPath(clusterID string) string {
+	return filepath.Join(getConfig().allocLogDir, clusterID+allocLogSuffix)
+}
+
+// allocLogf appends a step of a cluster's allocation or setup to its allocation log.  Allocation logs are kept
+// after the cluster is killed, for as long as its tombstone, so failed allocations can be diagnosed later.
+// Failing to write the log never fails the allocation itself.
+func allocLogf(clusterID string, format string, args ...interface{}) {
+	if getConfig().allocLogDir == "" || clusterID == "" {
+		return
+	}
+
+	allocLogLock.Lock()
+	defer allocLogLock.Unlock()
+
+	if err := os.MkdirAll(getConfig().allocLogDir, 0755); err != nil {
+		log.Printf("Failed to create allocation log directory %s: %s", getConfig().allocLogDir, err)
+		return
+	}
+
+	file, err := os.OpenFile(allocLogPath(clusterID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Failed to open allocation log of cluster %s: %s", clusterID, err)
+		return
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "%s %s\n", time.Now().Format(time.RFC3339Nano), fmt.Sprintf(format, args...))
+}
+
+// allocLogTrace appends the REST calls made while setting up a cluster to its allocation log.  Request bodies
+// are left out as they include credentials.
+func allocLogTrace(clusterID string, trace *helper.RestTrace) {
+	if trace == nil {
+		return
+	}
+	for _, entry := range trace.Entries() {
+		if entry.Error != "" {
+			allocLogf(clusterID, "Setup call %s %s returned %d: %s", entry.Method, entry.URL, entry.Status, entry.Error)
+		} else {
+			allocLogf(clusterID, "Setup call %s %s returned %d", entry.Method, entry.URL, entry.Status)
+		}
+	}
+}
+
+// getAllocLog returns the allocation log of a cluster.  The owner of a cluster which has been killed is taken
+// from its tombstone.
+func getAllocLog(ctx context.Context, clusterID string) ([]byte, error) {
+	if getConfig().allocLogDir == "" {
+		return nil, badRequestf("allocation logs are not enabled, alloc-log-dir must be configured")
+	}
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err == nil {
+		if err := checkClusterOwnership(ctx, cluster); err != nil {
+			return nil, err
+		}
+	} else {
+		tombstone, err := getClusterTombstone(clusterID)
+		if err != nil {
+			return nil, err
+		}
+		if tombstone == nil {
+			return nil, notFoundf("no allocation log exists for cluster %s", clusterID)
+		}
+		if !ContextIgnoreOwnership(ctx) && tombstone.Owner != ContextUser(ctx) {
+			return nil, forbiddenf("cluster %s was owned by %s", clusterID, tombstone.Owner)
+		}
+	}
+
+	data, err := ioutil.ReadFile(allocLogPath(clusterID))
+	if os.IsNotExist(err) {
+		return nil, notFoundf("no allocation log exists for cluster %s", clusterID)
+	}
+	return data, err
+}
+
+// sweepAllocLogs removes the allocation logs of clusters which no longer exist once they are older than the
+// tombstone retention.  A zero retention keeps them forever.
+func sweepAllocLogs() error {
+	if getConfig().allocLogDir == "" || getConfig().tombstoneRetention <= 0 {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(getConfig().allocLogDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	clusters, err := getAllClusters(systemCtx)
+	if err != nil {
+		return err
+	}
+	liveClusters := make(map[string]bool)
+	for _, cluster := range clusters {
+		liveClusters[cluster.ID] = true
+	}
+
+	cutoff := time.Now().Add(-getConfig().tombstoneRetention)
+	swept := 0
+	for _, file := range files {
+		clusterID := strings.TrimSuffix(file.Name(), allocLogSuffix)
+		if file.IsDir() || clusterID == file.Name() || liveClusters[clusterID] || !file.ModTime().Before(cutoff) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(getConfig().allocLogDir, file.Name())); err != nil {
+			return err
+		}
+		swept++
+	}
+
+	if swept > 0 {
+		log.Printf("Swept %d expired allocation logs", swept)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/client"
+)
+
+// Error codes included in REST API errors, so that clients can tell failures apart without matching messages
+const (
+	ErrorCodeBadRequest       = "bad_request"
+	ErrorCodeInternal         = "internal_error"
+	ErrorCodeClusterNotFound  = "cluster_not_found"
+	ErrorCodeNodeNotFound     = "node_not_found"
+	ErrorCodeForbidden        = "forbidden"
+	ErrorCodeNameConflict     = "name_conflict"
+	ErrorCodeDraining         = "draining"
+	ErrorCodeDocker           = "docker_error"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeNotAllowed       = "method_not_allowed"
+	ErrorCodeBucketExists     = "bucket_exists"
+	ErrorCodeRebalanceRunning = "rebalance_running"
+	ErrorCodeRebalanceFailed  = "rebalance_failed"
+	ErrorCodeUnauthenticated  = "unauthenticated"
+	ErrorCodeTooLarge         = "response_too_large"
+	ErrorCodeNotReady         = "cluster_not_ready"
+)
+
+type ClusterNotFoundError struct {
+	ClusterID string
+}
+
+func (e *ClusterNotFoundError) Error() string {
+	return "cluster not found"
+}
+
+type NodeNotFoundError struct {
+	ClusterID string
+	NodeID    string
+}
+
+func (e *NodeNotFoundError) Error() string {
+	return "node not found"
+}
+
+// ClusterOwnershipError is returned when the requester tries to act on a cluster they are not an owner of
+type ClusterOwnershipError struct {
+	ClusterID string
+	Action    string
+}
+
+func (e *ClusterOwnershipError) Error() string {
+	return fmt.Sprintf("cannot %s clusters you don't own", e.Action)
+}
+
+type BucketExistsError struct {
+	ClusterID string
+	Bucket    string
+}
+
+func (e *BucketExistsError) Error() string {
+	return fmt.Sprintf("bucket %s already exists", e.Bucket)
+}
+
+type RebalanceRunningError struct {
+	ClusterID string
+}
+
+func (e *RebalanceRunningError) Error() string {
+	return "a rebalance is already running"
+}
+
+// RebalanceFailedError is returned when couchbase refuses to rebalance a cluster, Reason is the explanation it gave
+type RebalanceFailedError struct {
+	ClusterID string
+	Reason    string
+}
+
+func (e *RebalanceFailedError) Error() string {
+	return fmt.Sprintf("rebalance failed: %s", e.Reason)
+}
+
+// ClusterNotReadyError is returned when a cluster was allocated but its nodes did not become ready while waiting
+// on them.  The cluster is left allocated, so the error carries its ID for the client to inspect or kill it.
+type ClusterNotReadyError struct {
+	ClusterID string
+	Err       error
+}
+
+func (e *ClusterNotReadyError) Error() string {
+	return fmt.Sprintf("cluster %s was allocated but is not ready: %s", e.ClusterID, e.Err)
+}
+
+func (e *ClusterNotReadyError) Unwrap() error {
+	return e.Err
+}
+
+// AllocatedClusterError is a failure after a cluster was allocated, it is reported like the error it wraps but
+// with the ID of the cluster so that the client can still find the cluster
+type AllocatedClusterError struct {
+	ClusterID string
+	Err       error
+}
+
+func (e *AllocatedClusterError) Error() string {
+	return fmt.Sprintf("cluster %s was allocated but: %s", e.ClusterID, e.Err)
+}
+
+func (e *AllocatedClusterError) Unwrap() error {
+	return e.Err
+}
+
+// BadRequestError is a request the daemon refused because of what was asked for, rather than because the daemon
+// failed to carry it out
+type BadRequestError struct {
+	Err error
+}
+
+func (e *BadRequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BadRequestError) Unwrap() error {
+	return e.Err
+}
+
+// badRequest marks an error as caused by the request, nil is returned as is
+func badRequest(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &BadRequestError{Err: err}
+}
+
+func badRequestf(format string, args ...interface{}) error {
+	return &BadRequestError{Err: fmt.Errorf(format, args...)}
+}
+
+// ForbiddenError is a request the requester is not allowed to make, such as one only admins can make
+type ForbiddenError struct {
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Reason
+}
+
+func forbiddenf(format string, args ...interface{}) error {
+	return &ForbiddenError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// NotFoundError is something other than a cluster or node which a request asked for but does not exist
+type NotFoundError struct {
+	Reason string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Reason
+}
+
+func notFoundf(format string, args ...interface{}) error {
+	return &NotFoundError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// AllocationFailedError is a failed allocation of a cluster, it is reported like the error it wraps but with the
+// ID of the cluster so that the client can fetch its allocation log
+type AllocationFailedError struct {
+	ClusterID string
+	Err       error
+}
+
+func (e *AllocationFailedError) Error() string {
+	return fmt.Sprintf("allocation of cluster %s failed: %s", e.ClusterID, e.Err)
+}
+
+func (e *AllocationFailedError) Cause() error {
+	return e.Err
+}
+
+func (e *AllocationFailedError) Unwrap() error {
+	return e.Err
+}
+
+// ResponseTooLargeError is returned instead of a response which can't be truncated, such as a JSON document,
+// when it exceeds max-response-size
+type ResponseTooLargeError struct {
+	Size  int
+	Limit int
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response of %d bytes exceeds the maximum response size of %d bytes", e.Size, e.Limit)
+}
+
+// DockerError is a failed docker API call, its message is that of the docker error
+type DockerError struct {
+	Operation string
+	Err       error
+}
+
+func (e *DockerError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DockerError) Cause() error {
+	return e.Err
+}
+
+func (e *DockerError) Unwrap() error {
+	return e.Err
+}
+
+// classifyError maps an error to the HTTP status and error code the REST API reports it with, along with the
+// cluster it concerns if known
+func classifyError(err error) (int, string, string) {
+	var clusterNotFound *ClusterNotFoundError
+	var nodeNotFound *NodeNotFoundError
+	var ownership *ClusterOwnershipError
+	var nameConflict *ClusterNameConflictError
+	var bucketExists *BucketExistsError
+	var rebalanceRunning *RebalanceRunningError
+	var rebalanceFailed *RebalanceFailedError
+	var unauthenticated *UnauthenticatedError
+	var tooLarge *ResponseTooLargeError
+	var dockerErr *DockerError
+	var notReady *ClusterNotReadyError
+	var allocated *AllocatedClusterError
+	var allocationFailed *AllocationFailedError
+	var forbidden *ForbiddenError
+	var notFound *NotFoundError
+	var badReq *BadRequestError
+
+	if errors.As(err, &allocated) {
+		status, code, _ := classifyError(allocated.Err)
+		return status, code, allocated.ClusterID
+	}
+	if errors.As(err, &allocationFailed) {
+		status, code, _ := classifyError(allocationFailed.Err)
+		return status, code, allocationFailed.ClusterID
+	}
+
+	switch {
+	case errors.As(err, &unauthenticated):
+		return 401, ErrorCodeUnauthenticated, ""
+	case errors.As(err, &clusterNotFound):
+		return 404, ErrorCodeClusterNotFound, clusterNotFound.ClusterID
+	case errors.As(err, &nodeNotFound):
+		return 404, ErrorCodeNodeNotFound, nodeNotFound.ClusterID
+	case errors.As(err, &ownership):
+		return 403, ErrorCodeForbidden, ownership.ClusterID
+	case errors.As(err, &forbidden):
+		return 403, ErrorCodeForbidden, ""
+	case errors.As(err, &notFound):
+		return 404, ErrorCodeNotFound, ""
+	case errors.As(err, &nameConflict):
+		return 409, ErrorCodeNameConflict, nameConflict.ClusterID
+	case errors.As(err, &bucketExists):
+		return 409, ErrorCodeBucketExists, bucketExists.ClusterID
+	case errors.As(err, &rebalanceRunning):
+		return 409, ErrorCodeRebalanceRunning, rebalanceRunning.ClusterID
+	case errors.As(err, &rebalanceFailed):
+		return 502, ErrorCodeRebalanceFailed, rebalanceFailed.ClusterID
+	case errors.As(err, &notReady):
+		return 504, ErrorCodeNotReady, notReady.ClusterID
+	case errors.As(err, &tooLarge):
+		return 413, ErrorCodeTooLarge, ""
+	case errors.Is(err, errDraining):
+		return 503, ErrorCodeDraining, ""
+	case errors.As(err, &dockerErr):
+		if client.IsErrNotFound(dockerErr.Err) {
+			return 404, ErrorCodeNotFound, ""
+		}
+		return 500, ErrorCodeDocker, ""
+	case errors.As(err, &badReq):
+		return 400, ErrorCodeBadRequest, ""
+	}
+
+	// Anything else is a failure of the daemon rather than of the request
+	return 500, ErrorCodeInternal, ""
+}
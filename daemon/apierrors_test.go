@@ -0,0 +1,30 @@
+package daemon
+
+import (
+	"errors"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestClassifyErrorOnlyReportsRequestErrorsAsBadRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"unclassified", errors.New("meta-data store is not open"), 500, ErrorCodeInternal},
+		{"bad request", badRequestf("must specify a bucket name"), 400, ErrorCodeBadRequest},
+		{"wrapped bad request", pkgerrors.Wrap(badRequestf("invalid stop signal"), "node node_1"), 400, ErrorCodeBadRequest},
+		{"forbidden", forbiddenf("only admins can freeze clusters"), 403, ErrorCodeForbidden},
+		{"not found", notFoundf("no allocation log exists for cluster %s", "abc"), 404, ErrorCodeNotFound},
+	}
+
+	for _, test := range tests {
+		status, code, _ := classifyError(test.err)
+		if status != test.status || code != test.code {
+			t.Errorf("%s: expected %d %s, got %d %s", test.name, test.status, test.code, status, code)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+type AuditedCluster struct {
+	ID        string `json:"id"`
+	Owner     string `json:"owner"`
+	CreatedAt string `json:"created_at"`
+	Age       string `json:"age"`
+	Timeout   string `json:"timeout"`
+}
+
+// AuditReport lists the clusters which have been alive for longer than max-cluster-timeout.  Auditing only
+// reports these clusters, it never kills them, as some may have been kept alive deliberately.
+type AuditReport struct {
+	AuditedAt  string           `json:"audited_at"`
+	MaxTimeout string           `json:"max_timeout"`
+	Clusters   []AuditedCluster `json:"clusters"`
+}
+
+var lastAuditReportLock sync.Mutex
+var lastAuditReport *AuditReport
+
+func auditClusters() (*AuditReport, error) {
+	clusters, err := getAllClusters(systemCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &AuditReport{
+		AuditedAt:  now.Format(time.RFC3339),
+		MaxTimeout: getConfig().maxClusterTimeout.String(),
+		Clusters:   make([]AuditedCluster, 0),
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].CreatedAt.Before(clusters[j].CreatedAt)
+	})
+
+	for _, cluster := range clusters {
+		age := now.Sub(cluster.CreatedAt)
+		if age <= getConfig().maxClusterTimeout {
+			continue
+		}
+
+		log.Printf("Audit: cluster %s owned by %s has been alive for %s, longer than the maximum of %s",
+			cluster.ID, cluster.Owner, age.Round(time.Second), getConfig().maxClusterTimeout)
+		report.Clusters = append(report.Clusters, AuditedCluster{
+			ID:        cluster.ID,
+			Owner:     cluster.Owner,
+			CreatedAt: cluster.CreatedAt.Format(time.RFC3339),
+			Age:       age.Round(time.Second).String(),
+			Timeout:   cluster.Timeout.Format(time.RFC3339),
+		})
+	}
+
+	lastAuditReportLock.Lock()
+	lastAuditReport = report
+	lastAuditReportLock.Unlock()
+
+	return report, nil
+}
+
+// getAuditReport returns the report of the most recent audit, auditing now if none has run yet
+func getAuditReport(ctx context.Context) (*AuditReport, error) {
+	if !ContextIgnoreOwnership(ctx) {
+		return nil, forbiddenf("only admins can view the audit report")
+	}
+
+	lastAuditReportLock.Lock()
+	report := lastAuditReport
+	lastAuditReportLock.Unlock()
+
+	if report != nil {
+		return report, nil
+	}
+	return auditClusters()
+}
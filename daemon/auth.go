@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// APITokenConfig is a bearer token configured in the config file under [[api-tokens]], requests authenticated
+// with Token act as Owner, and as an admin if Admin is set
+type APITokenConfig struct {
+	Token string `mapstructure:"token"`
+	Owner string `mapstructure:"owner"`
+	Admin bool   `mapstructure:"admin"`
+}
+
+// authIdentity is who a request was authenticated as
+type authIdentity struct {
+	User  string
+	Admin bool
+}
+
+// UnauthenticatedError is returned when a request needs a valid bearer token and did not present one
+type UnauthenticatedError struct {
+	Reason string
+}
+
+func (e *UnauthenticatedError) Error() string {
+	return e.Reason
+}
+
+// unauthenticatedPaths are left open even when tokens are configured, so that they can be scraped and probed
+var unauthenticatedPaths = map[string]bool{
+	"/metrics": true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+func loadAPITokens() ([]APITokenConfig, error) {
+	var configured []APITokenConfig
+	if err := viper.UnmarshalKey("api-tokens", &configured); err != nil {
+		return nil, err
+	}
+
+	tokens := make([]APITokenConfig, 0, len(configured))
+	for i, config := range configured {
+		if config.Token == "" {
+			return nil, fmt.Errorf("api token %d has no token", i)
+		}
+		if !strings.HasSuffix(config.Owner, "@couchbase.com") {
+			return nil, fmt.Errorf("api token %d must have an @couchbase.com owner", i)
+		}
+		tokens = append(tokens, config)
+	}
+	return tokens, nil
+}
+
+// lookupAPIToken returns the identity a token maps to, comparing against every token in constant time
+func lookupAPIToken(token string) (authIdentity, bool) {
+	var identity authIdentity
+	found := false
+	for _, config := range getConfig().apiTokens {
+		if subtle.ConstantTimeCompare([]byte(config.Token), []byte(token)) == 1 {
+			identity = authIdentity{User: config.Owner, Admin: config.Admin}
+			found = true
+		}
+	}
+	return identity, found
+}
+
+// authMiddleware authenticates requests with the bearer token in their Authorization header.  Authentication is
+// disabled until tokens are configured, after which every request other than to unauthenticatedPaths must
+// present a known token.  The cbdn-user and cbdn-admin headers are only trusted while authentication is disabled.
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(getConfig().apiTokens) == 0 || unauthenticatedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			writeJSONError(w, &UnauthenticatedError{Reason: "must authenticate with a bearer token"})
+			return
+		}
+
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if token == authHeader {
+			writeJSONError(w, &UnauthenticatedError{Reason: "authorization must be a bearer token"})
+			return
+		}
+
+		identity, ok := lookupAPIToken(token)
+		if !ok {
+			writeJSONError(w, &UnauthenticatedError{Reason: "invalid bearer token"})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withAuthIdentity(r.Context(), identity)))
+	})
+}
+
+func withAuthIdentity(parent context.Context, identity authIdentity) context.Context {
+	return context.WithValue(parent, ContextKeyAuthIdentity, identity)
+}
+
+func contextAuthIdentity(ctx context.Context) (authIdentity, bool) {
+	identity, ok := ctx.Value(ContextKeyAuthIdentity).(authIdentity)
+	return identity, ok
+}
@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func withTestAPITokens(t *testing.T, tokens []APITokenConfig) {
+	withTestConfig(t, func(config *reloadableConfig) {
+		config.apiTokens = tokens
+	})
+}
+
+func TestAuthMiddlewareRejectsRequestsWithoutToken(t *testing.T) {
+	withTestAPITokens(t, []APITokenConfig{{Token: "secret", Owner: "user@couchbase.com"}})
+
+	handler := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header map[string]string
+		status int
+	}{
+		{"anonymous admin read", "GET", "/admin/audit", map[string]string{"cbdn-user": "a@couchbase.com", "cbdn-admin": "true"}, 401},
+		{"anonymous read", "GET", "/clusters", map[string]string{"cbdn-user": "a@couchbase.com"}, 401},
+		{"anonymous write", "POST", "/clusters", nil, 401},
+		{"unknown token", "GET", "/clusters", map[string]string{"Authorization": "Bearer wrong"}, 401},
+		{"not a bearer token", "GET", "/clusters", map[string]string{"Authorization": "secret"}, 401},
+		{"valid token", "GET", "/clusters", map[string]string{"Authorization": "Bearer secret"}, 200},
+		{"unauthenticated path", "GET", "/healthz", nil, 200},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		for key, value := range test.header {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, rec.Code)
+		}
+	}
+}
+
+func TestAuthMiddlewareDisabledWithoutTokens(t *testing.T) {
+	withTestAPITokens(t, nil)
+
+	handler := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	req := httptest.NewRequest("GET", "/clusters", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != 200 {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+}
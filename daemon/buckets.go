@@ -8,8 +8,6 @@ import (
 	"github.com/couchbaselabs/cbdynclusterd/helper"
 
 	"github.com/couchbaselabs/cbdynclusterd/cluster"
-
-	"github.com/pkg/errors"
 )
 
 type AddBucketOptions struct {
@@ -20,19 +18,79 @@ type AddSampleOptions struct {
 	Conf AddSampleBucketJSON
 }
 
+// bucketTypes maps the bucket types the API accepts to those couchbase server expects
+var bucketTypes = map[string]string{
+	"":                     helper.BucketCouchbase,
+	"couchbase":            helper.BucketCouchbase,
+	helper.BucketCouchbase: helper.BucketCouchbase,
+	helper.BucketEphemeral: helper.BucketEphemeral,
+	helper.BucketMemcached: helper.BucketMemcached,
+}
+
+// clusterTargetNode picks the node which cluster wide requests, such as bucket operations, are sent to, preferring
+// the cluster's orchestrator
+func clusterTargetNode(c *Cluster) (*Node, error) {
+	var target *Node
+	for _, node := range c.Nodes {
+		if node.State != "running" {
+			continue
+		}
+		if node.ContainerID == c.Orchestrator {
+			return node, nil
+		}
+		if target == nil {
+			target = node
+		}
+	}
+	if target == nil {
+		return nil, badRequestf("cluster has no running nodes")
+	}
+	return target, nil
+}
+
 func addBucket(ctx context.Context, clusterID string, opts AddBucketOptions) error {
-	log.Printf("Adding bucket %s to cluster %s (requested by: %s)", opts.Conf.Name, clusterID, ContextUser(ctx))
+	log.Printf("Adding bucket %s to cluster %s (requested by: %s)", opts.Conf.Name, clusterID, ContextRequester(ctx))
+
+	if opts.Conf.Name == "" {
+		return badRequestf("must specify a bucket name")
+	}
+	bucketType, ok := bucketTypes[opts.Conf.BucketType]
+	if !ok {
+		return badRequestf("unknown bucket type `%s`, must be couchbase, ephemeral or memcached", opts.Conf.BucketType)
+	}
+	if opts.Conf.RamQuota < minBucketRamQuotaMB {
+		return badRequestf("ram quota must be at least %dMB", minBucketRamQuotaMB)
+	}
+	if opts.Conf.ReplicaCount < 0 || opts.Conf.ReplicaCount > 3 {
+		return badRequestf("replica count must be between 0 and 3")
+	}
 
 	c, err := getCluster(ctx, clusterID)
 	if err != nil {
 		return err
 	}
 
-	if len(c.Nodes) == 0 {
-		return errors.New("no nodes available")
+	if err := checkClusterOwnership(ctx, c); err != nil {
+		return err
+	}
+
+	n, err := clusterTargetNode(c)
+	if err != nil {
+		return err
+	}
+
+	available, exists, err := availableBucketQuota(n, opts.Conf.Name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return &BucketExistsError{ClusterID: clusterID, Bucket: opts.Conf.Name}
+	}
+	if opts.Conf.RamQuota > available {
+		return badRequestf("ram quota of %dMB exceeds the %dMB available to bucket %s", opts.Conf.RamQuota, available,
+			opts.Conf.Name)
 	}
 
-	n := c.Nodes[0]
 	ipv4 := n.IPv4Address
 	hostname := ipv4
 	if opts.Conf.UseHostname {
@@ -47,18 +105,19 @@ func addBucket(ctx context.Context, clusterID string, opts AddBucketOptions) err
 	}
 
 	return node.CreateBucket(&cluster.Bucket{
-		Name:         opts.Conf.Name,
-		Type:         opts.Conf.BucketType,
-		ReplicaCount: opts.Conf.ReplicaCount,
-		RamQuotaMB:   strconv.Itoa(opts.Conf.RamQuota),
+		Name:              opts.Conf.Name,
+		Type:              bucketType,
+		ReplicaCount:      opts.Conf.ReplicaCount,
+		RamQuotaMB:        strconv.Itoa(opts.Conf.RamQuota),
+		EphEvictionPolicy: "noEviction",
 	})
 }
 
 func addSampleBucket(ctx context.Context, clusterID string, opts AddSampleOptions) error {
-	log.Printf("Loading sample bucket %s to cluster %s (requested by: %s)", opts.Conf.SampleBucket, clusterID, ContextUser(ctx))
+	log.Printf("Loading sample bucket %s to cluster %s (requested by: %s)", opts.Conf.SampleBucket, clusterID, ContextRequester(ctx))
 
 	if helper.SampleBucketsCount[opts.Conf.SampleBucket] == 0 {
-		return errors.New("Unknown sample bucket")
+		return badRequestf("Unknown sample bucket")
 	}
 
 	c, err := getCluster(ctx, clusterID)
@@ -67,7 +126,7 @@ func addSampleBucket(ctx context.Context, clusterID string, opts AddSampleOption
 	}
 
 	if len(c.Nodes) == 0 {
-		return errors.New("no nodes available")
+		return badRequestf("no nodes available")
 	}
 
 	n := c.Nodes[0]
@@ -86,3 +145,130 @@ func addSampleBucket(ctx context.Context, clusterID string, opts AddSampleOption
 
 	return node.LoadSample(opts.Conf.SampleBucket)
 }
+
+// minBucketRamQuotaMB is the smallest RAM quota couchbase server accepts for a bucket
+const minBucketRamQuotaMB = 100
+
+type ResizeBucketOptions struct {
+	RamQuota     int
+	ReplicaCount *int
+}
+
+type BucketSettings struct {
+	Name         string
+	RamQuota     int
+	ReplicaCount int
+}
+
+type bucketQuotaJSON struct {
+	Name          string `json:"name"`
+	ReplicaNumber int    `json:"replicaNumber"`
+	Quota         struct {
+		RawRAM int64 `json:"rawRAM"`
+	} `json:"quota"`
+}
+
+type memoryQuotaJSON struct {
+	MemoryQuota int `json:"memoryQuota"`
+}
+
+func getBucketSettings(node *Node, bucketName string) (*BucketSettings, error) {
+	var bucket bucketQuotaJSON
+	if err := getClusterRest(node, helper.PBuckets+"/"+bucketName, &bucket); err != nil {
+		return nil, err
+	}
+
+	return &BucketSettings{
+		Name:         bucket.Name,
+		RamQuota:     int(bucket.Quota.RawRAM / 1024 / 1024),
+		ReplicaCount: bucket.ReplicaNumber,
+	}, nil
+}
+
+// availableBucketQuota returns how much of the cluster's memory quota is left for a bucket once the quotas of
+// every other bucket are taken out, along with whether the bucket exists.  Bucket quotas are per node, as is the
+// cluster's memory quota.
+func availableBucketQuota(node *Node, bucketName string) (int, bool, error) {
+	var pools memoryQuotaJSON
+	if err := getClusterRest(node, helper.PPoolsDefault, &pools); err != nil {
+		return 0, false, err
+	}
+
+	var buckets []bucketQuotaJSON
+	if err := getClusterRest(node, helper.PBuckets, &buckets); err != nil {
+		return 0, false, err
+	}
+
+	found := false
+	otherQuota := 0
+	for _, bucket := range buckets {
+		if bucket.Name == bucketName {
+			found = true
+			continue
+		}
+		otherQuota += int(bucket.Quota.RawRAM / 1024 / 1024)
+	}
+
+	return pools.MemoryQuota - otherQuota, found, nil
+}
+
+// checkBucketQuota verifies that the cluster's memory quota can fit the new quota of an existing bucket
+// alongside the quotas of every other bucket
+func checkBucketQuota(node *Node, bucketName string, ramQuota int) error {
+	available, found, err := availableBucketQuota(node, bucketName)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return badRequestf("bucket %s does not exist", bucketName)
+	}
+
+	if ramQuota > available {
+		return badRequestf("ram quota of %dMB exceeds the %dMB available to bucket %s", ramQuota, available, bucketName)
+	}
+
+	return nil
+}
+
+func resizeBucket(ctx context.Context, clusterID string, bucketName string, opts ResizeBucketOptions) (*BucketSettings, error) {
+	log.Printf("Resizing bucket %s of cluster %s to %dMB (requested by: %s)", bucketName, clusterID, opts.RamQuota, ContextRequester(ctx))
+
+	if opts.RamQuota < minBucketRamQuotaMB {
+		return nil, badRequestf("ram quota must be at least %dMB", minBucketRamQuotaMB)
+	}
+	if opts.ReplicaCount != nil && (*opts.ReplicaCount < 0 || *opts.ReplicaCount > 3) {
+		return nil, badRequestf("replica count must be between 0 and 3")
+	}
+
+	c, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, c); err != nil {
+		return nil, err
+	}
+
+	n, err := clusterTargetNode(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBucketQuota(n, bucketName, opts.RamQuota); err != nil {
+		return nil, err
+	}
+
+	ipv4 := n.IPv4Address
+	node := &cluster.Node{
+		HostName:  ipv4,
+		Port:      strconv.Itoa(helper.RestPort),
+		SshLogin:  &helper.Cred{Username: helper.SshUser, Password: helper.SshPass, Hostname: ipv4, Port: helper.SshPort},
+		RestLogin: &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: ipv4, Port: helper.RestPort},
+	}
+
+	if err := node.UpdateBucket(bucketName, opts.RamQuota, opts.ReplicaCount); err != nil {
+		return nil, err
+	}
+
+	return getBucketSettings(n, bucketName)
+}
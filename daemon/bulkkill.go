@@ -0,0 +1,133 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	BulkKillStatusKilled      = "killed"
+	BulkKillStatusTerminating = "terminating"
+	BulkKillStatusFailed      = "failed"
+)
+
+type BulkKillOptions struct {
+	// Owner only matches clusters owned by this user
+	Owner string
+	// Tags are key=value filters which must all match, as for listing clusters
+	Tags []string
+	// OlderThan only matches clusters created at least this long ago
+	OlderThan time.Duration
+	// Force kills the clusters immediately and forcefully, rather than leaving them revivable for
+	// termination-grace
+	Force bool
+}
+
+type BulkKillResult struct {
+	ID          string `json:"id"`
+	Owner       string `json:"owner"`
+	Status      string `json:"status"`
+	TerminateAt string `json:"terminate_at,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type BulkKillSummary struct {
+	Results []BulkKillResult `json:"results"`
+	Killed  int              `json:"killed"`
+	Failed  int              `json:"failed"`
+}
+
+func (opts *BulkKillOptions) matches(cluster *Cluster) bool {
+	if opts.Owner != "" && cluster.Owner != opts.Owner {
+		return false
+	}
+	if opts.OlderThan > 0 && time.Since(cluster.CreatedAt) < opts.OlderThan {
+		return false
+	}
+	return matchesTagFilter(cluster.Tags, opts.Tags)
+}
+
+// killClusters kills every cluster the requester can see which matches the filters, in parallel.  Clusters are
+// killed on the requester's behalf so each one is only killed if they own it or are an admin, a cluster which
+// fails to be killed is reported in the summary rather than stopping the others from being killed.
+func killClusters(ctx context.Context, opts BulkKillOptions) (*BulkKillSummary, error) {
+	log.Printf("Killing clusters matching owner `%s`, tags %v and older than %s (requested by: %s)", opts.Owner,
+		opts.Tags, opts.OlderThan, ContextRequester(ctx))
+
+	if opts.Owner == "" && len(opts.Tags) == 0 && opts.OlderThan <= 0 {
+		return nil, badRequestf("must filter the clusters to kill by owner, tag or age")
+	}
+
+	clusters, err := getAllClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var clustersToKill []*Cluster
+	for _, cluster := range clusters {
+		if opts.matches(cluster) {
+			clustersToKill = append(clustersToKill, cluster)
+		}
+	}
+
+	results := make([]BulkKillResult, len(clustersToKill))
+	signal := make(chan struct{})
+
+	for i, cluster := range clustersToKill {
+		go func(i int, cluster *Cluster) {
+			results[i] = killClusterForBulk(ctx, cluster, opts.Force)
+			signal <- struct{}{}
+		}(i, cluster)
+	}
+
+	for range clustersToKill {
+		<-signal
+	}
+
+	summary := &BulkKillSummary{Results: results}
+	for _, result := range results {
+		if result.Status == BulkKillStatusFailed {
+			summary.Failed++
+		} else {
+			summary.Killed++
+		}
+	}
+	return summary, nil
+}
+
+func killClusterForBulk(ctx context.Context, cluster *Cluster, force bool) BulkKillResult {
+	result := BulkKillResult{
+		ID:    cluster.ID,
+		Owner: cluster.Owner,
+	}
+
+	var err error
+	switch {
+	case cluster.Pending:
+		err = errors.New("cluster is still being allocated")
+	case force:
+		err = forceKillClusterWithReason(ctx, cluster.ID, KillReasonRequested)
+		result.Status = BulkKillStatusKilled
+	case getConfig().terminationGrace > 0:
+		var terminateAt time.Time
+		terminateAt, err = terminateCluster(ctx, cluster.ID)
+		result.Status = BulkKillStatusTerminating
+		result.TerminateAt = terminateAt.Format(time.RFC3339)
+	default:
+		err = killCluster(ctx, cluster.ID)
+		result.Status = BulkKillStatusKilled
+	}
+
+	if err != nil {
+		log.Printf("Failed to kill cluster %s in bulk: %s", cluster.ID, err)
+		return BulkKillResult{
+			ID:     cluster.ID,
+			Owner:  cluster.Owner,
+			Status: BulkKillStatusFailed,
+			Error:  err.Error(),
+		}
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"context"
+	"log"
+)
+
+func validateMinNodes(opts ClusterOptions) error {
+	if opts.MinNodes < 0 {
+		return badRequestf("minimum node count cannot be negative")
+	}
+	if opts.MinNodes > len(opts.Nodes) {
+		return badRequestf("minimum node count of %d is more than the %d nodes requested", opts.MinNodes, len(opts.Nodes))
+	}
+	// Without max-host-nodes there is nothing to fit the cluster to, so the minimum could never be applied
+	if opts.MinNodes > 0 && getConfig().maxHostNodes == 0 {
+		return badRequestf("minimum node count requires max-host-nodes to be configured")
+	}
+	return nil
+}
+
+// getFreeHostNodes returns the number of node slots, out of max-host-nodes, which are not used by any cluster
+func getFreeHostNodes(ctx context.Context) (int, error) {
+	// Every cluster on the host uses capacity, not only those the requester owns
+	clusters, err := getAllClusters(NewContext(ctx, ContextUser(ctx), true))
+	if err != nil {
+		return 0, err
+	}
+
+	return getConfig().maxHostNodes - countNodes(clusters), nil
+}
+
+// fitClusterToCapacity trims the nodes of a cluster which has a minimum node count down to the node slots which
+// are free on the docker host.  The returned options record how many nodes were originally requested if any were
+// left out.  A minimum node count is only accepted when max-host-nodes is configured, as that is the host's capacity.
+func fitClusterToCapacity(ctx context.Context, opts ClusterOptions) (ClusterOptions, error) {
+	if opts.MinNodes == 0 || getConfig().maxHostNodes == 0 {
+		return opts, nil
+	}
+
+	freeNodes, err := getFreeHostNodes(ctx)
+	if err != nil {
+		return opts, err
+	}
+
+	if freeNodes >= len(opts.Nodes) {
+		return opts, nil
+	}
+	if freeNodes < opts.MinNodes {
+		return opts, badRequestf("only %d nodes can fit on the docker host, less than the minimum of %d", freeNodes, opts.MinNodes)
+	}
+
+	log.Printf("Allocating %d of %d requested nodes to fit the docker host (requested by: %s)", freeNodes, len(opts.Nodes), ContextRequester(ctx))
+
+	opts.RequestedNodes = len(opts.Nodes)
+	opts.Nodes = opts.Nodes[:freeNodes]
+	return opts, nil
+}
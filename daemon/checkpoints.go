@@ -0,0 +1,208 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+var checkpointLabelRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+type CheckpointNode struct {
+	Name          string   `json:"name"`
+	ContainerID   string   `json:"container_id"`
+	ServerVersion string   `json:"server_version"`
+	Services      []string `json:"services,omitempty"`
+}
+
+// ClusterCheckpoint is a snapshot of a cluster's topology, it does not include any of the cluster's data
+type ClusterCheckpoint struct {
+	ClusterID string           `json:"cluster_id"`
+	Label     string           `json:"label"`
+	CreatedAt time.Time        `json:"created_at"`
+	Nodes     []CheckpointNode `json:"nodes"`
+	Buckets   []string         `json:"buckets,omitempty"`
+}
+
+type CheckpointDiff struct {
+	AddedNodes      []string `json:"added_nodes,omitempty"`
+	RemovedNodes    []string `json:"removed_nodes,omitempty"`
+	ChangedServices []string `json:"changed_services,omitempty"`
+	AddedBuckets    []string `json:"added_buckets,omitempty"`
+	RemovedBuckets  []string `json:"removed_buckets,omitempty"`
+}
+
+type poolsDefaultJSON struct {
+	Nodes []struct {
+		Hostname string   `json:"hostname"`
+		Services []string `json:"services"`
+	} `json:"nodes"`
+}
+
+type bucketNameJSON struct {
+	Name string `json:"name"`
+}
+
+func getClusterRest(node *Node, path string, data interface{}) error {
+	resp, err := helper.GetResponse(&helper.RestCall{
+		ExpectedCode: 200,
+		Method:       "GET",
+		Path:         path,
+		Cred:         &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: node.IPv4Address, Port: helper.RestPort},
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(resp), data)
+}
+
+// snapshotCluster captures the current topology of a cluster.  Services and buckets are only known once the
+// cluster has been set up, so they are left empty if the cluster cannot be queried.
+func snapshotCluster(cluster *Cluster) ClusterCheckpoint {
+	checkpoint := ClusterCheckpoint{
+		ClusterID: cluster.ID,
+		CreatedAt: time.Now(),
+	}
+
+	servicesByHost := make(map[string][]string)
+	if len(cluster.Nodes) > 0 {
+		var pools poolsDefaultJSON
+		if err := getClusterRest(cluster.Nodes[0], helper.PPoolsDefault, &pools); err == nil {
+			for _, poolNode := range pools.Nodes {
+				host, _, err := net.SplitHostPort(poolNode.Hostname)
+				if err != nil {
+					host = poolNode.Hostname
+				}
+				services := append([]string{}, poolNode.Services...)
+				sort.Strings(services)
+				servicesByHost[host] = services
+			}
+		}
+
+		var buckets []bucketNameJSON
+		if err := getClusterRest(cluster.Nodes[0], helper.PBuckets, &buckets); err == nil {
+			for _, bucket := range buckets {
+				checkpoint.Buckets = append(checkpoint.Buckets, bucket.Name)
+			}
+			sort.Strings(checkpoint.Buckets)
+		}
+	}
+
+	for _, node := range cluster.Nodes {
+		services, ok := servicesByHost[node.IPv4Address]
+		if !ok {
+			services = servicesByHost[strings.TrimPrefix(node.ContainerName, "/")+helper.DomainPostfix]
+		}
+
+		checkpoint.Nodes = append(checkpoint.Nodes, CheckpointNode{
+			Name:          node.Name,
+			ContainerID:   node.ContainerID,
+			ServerVersion: node.InitialServerVersion,
+			Services:      services,
+		})
+	}
+
+	return checkpoint
+}
+
+func diffStrings(before, after []string) (added []string, removed []string) {
+	beforeSet := make(map[string]bool)
+	for _, s := range before {
+		beforeSet[s] = true
+	}
+	afterSet := make(map[string]bool)
+	for _, s := range after {
+		afterSet[s] = true
+		if !beforeSet[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range before {
+		if !afterSet[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+func diffCheckpoints(before, after ClusterCheckpoint) CheckpointDiff {
+	var diff CheckpointDiff
+
+	beforeNodes := make(map[string]CheckpointNode)
+	var beforeIDs []string
+	for _, node := range before.Nodes {
+		beforeNodes[node.ContainerID] = node
+		beforeIDs = append(beforeIDs, node.ContainerID)
+	}
+
+	var afterIDs []string
+	for _, node := range after.Nodes {
+		afterIDs = append(afterIDs, node.ContainerID)
+
+		if beforeNode, ok := beforeNodes[node.ContainerID]; ok {
+			if strings.Join(beforeNode.Services, ",") != strings.Join(node.Services, ",") {
+				diff.ChangedServices = append(diff.ChangedServices, node.ContainerID)
+			}
+		}
+	}
+
+	diff.AddedNodes, diff.RemovedNodes = diffStrings(beforeIDs, afterIDs)
+	diff.AddedBuckets, diff.RemovedBuckets = diffStrings(before.Buckets, after.Buckets)
+	return diff
+}
+
+func createCheckpoint(ctx context.Context, clusterID string, label string) (*ClusterCheckpoint, error) {
+	log.Printf("Creating checkpoint %s of cluster %s (requested by: %s)", label, clusterID, ContextRequester(ctx))
+
+	if !checkpointLabelRegexp.MatchString(label) {
+		return nil, badRequestf("checkpoint label must only contain letters, numbers, '_', '.' and '-'")
+	}
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	checkpoint := snapshotCluster(cluster)
+	checkpoint.Label = label
+
+	if err := metaStore.PutCheckpoint(checkpoint); err != nil {
+		return nil, err
+	}
+
+	return &checkpoint, nil
+}
+
+// getCheckpoints returns the checkpoints of a cluster and the current state of the cluster to diff them against
+func getCheckpoints(ctx context.Context, clusterID string) ([]ClusterCheckpoint, ClusterCheckpoint, error) {
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, ClusterCheckpoint{}, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, ClusterCheckpoint{}, err
+	}
+
+	checkpoints, err := metaStore.GetCheckpoints(clusterID)
+	if err != nil {
+		return nil, ClusterCheckpoint{}, err
+	}
+
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].CreatedAt.Before(checkpoints[j].CreatedAt)
+	})
+
+	return checkpoints, snapshotCluster(cluster), nil
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/couchbaselabs/cbdynclusterd/helper"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -20,8 +22,30 @@ func newRandomClusterID() string {
 }
 
 type ClusterOptions struct {
-	Timeout time.Duration
-	Nodes   []NodeOptions
+	Timeout          time.Duration
+	Nodes            []NodeOptions
+	SyncGateway      *SyncGatewayOptions
+	PreserveData     bool
+	StartDelay       time.Duration
+	GenerationID     string
+	AuthorizedOwners []string
+	Name             string
+	Placement        *PlacementConstraints
+	// Init overrides whether nodes run with an init process, by default only long lived clusters do
+	Init *bool
+	// StopSignal overrides the stop-signal sent to nodes when they are stopped
+	StopSignal string
+	// DNS overrides the DNS servers, search domains and options of the cluster's containers
+	DNS *DNSOptions
+	// MinNodes allows fewer nodes than requested to be allocated when the docker host is short of capacity
+	MinNodes int
+	// RequestedNodes is how many nodes were requested when the cluster was trimmed to fit the docker host
+	RequestedNodes int
+	Tags           map[string]string
+	// Registry overrides the docker-registry server images are pulled from
+	Registry string
+	// MemoryQuotas are the service memory quotas the cluster is set up with
+	MemoryQuotas *MemoryQuotas
 }
 
 type Node struct {
@@ -30,44 +54,157 @@ type Node struct {
 	State                string
 	Name                 string
 	InitialServerVersion string
+	Edition              string
 	IPv4Address          string
 	IPv6Address          string
+	DataPath             string
+	IndexPath            string
+	AnalyticsPath        string
+	ServerGroup          string
+	Role                 string
+	Services             []string
+	SeccompProfile       string
+	ApparmorProfile      string
+	ConfigFile           string
+	Init                 bool
+	StopSignal           string
+	PreserveData         bool
+	Hostname             string
+	// Imported is set for nodes whose containers were created outside the daemon and imported
+	Imported bool
+	// InstanceID is the instance ID of the daemon which created the node's container
+	InstanceID string
+	// Image is the image the node's container was created from
+	Image string
 }
 
 type Cluster struct {
-	ID         string
-	Creator    string
-	Owner      string
-	Timeout    time.Time
-	Nodes      []*Node
-	EntryPoint string
+	ID                string
+	Creator           string
+	Owner             string
+	Timeout           time.Time
+	Nodes             []*Node
+	EntryPoint        string
+	SyncGateway       *SyncGateway
+	StartDelay        time.Duration
+	StartOrder        []string
+	GenerationID      string
+	AuthorizedOwners  []string
+	Name              string
+	Placement         *PlacementConstraints
+	ResolvedPlacement map[string][]string
+	// RequestedNodes is set when fewer nodes than requested were allocated
+	RequestedNodes int
+	Tags           map[string]string
+	Orchestrator   string
+	Registry       string
+	Namespace      string
+	Pending        bool
+	MemoryQuotas   *MemoryQuotas
+	// TerminateAt is when a terminating cluster will be killed, zero if the cluster is not terminating
+	TerminateAt time.Time
+	// CreatedAt is when the cluster was allocated, or when the oldest of its containers was created for clusters
+	// allocated before allocation times were recorded
+	CreatedAt time.Time
+	// Frozen clusters are never killed automatically
+	Frozen bool
 }
 
-func checkBuildExists(url string) error {
-	resp, err := http.Head(url)
+// isAuthorizedOwner returns whether user is the cluster's owner or one of its additional authorized owners
+func (cluster *Cluster) isAuthorizedOwner(user string) bool {
+	if cluster.Owner == user {
+		return true
+	}
+	for _, owner := range cluster.AuthorizedOwners {
+		if owner == user {
+			return true
+		}
+	}
+	return false
+}
+
+func checkBuildExists(ctx context.Context, url string) error {
+	req, err := http.NewRequest("HEAD", url, nil)
 	if err != nil {
 		return errors.Wrap(err, "Could not locate build")
 	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "Could not locate build")
+	}
+	resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return errors.New("Could not locate build")
+		return badRequestf("Could not locate build")
 	}
 
 	return nil
 }
 
+// getCluster fetches a single cluster, only listing the containers labelled with its ID rather than every cluster
 func getCluster(ctx context.Context, clusterID string) (*Cluster, error) {
-	clusters, err := getAllClusters(ctx)
+	clusterFilter := filters.NewArgs()
+	clusterFilter.Add("label", fmt.Sprintf("com.couchbase.dyncluster.cluster_id=%s", clusterID))
+
+	containers, err := docker.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: clusterFilter,
+	})
+	if err != nil {
+		return nil, countDockerError("container_list", err)
+	}
+
+	// Imported containers have no cluster label, so they are listed by their IDs instead
+	importedClusterIDs, err := getImportedClusterIDs()
 	if err != nil {
 		return nil, err
 	}
+	importFilter := filters.NewArgs()
+	for containerID, importedClusterID := range importedClusterIDs {
+		if importedClusterID == clusterID {
+			importFilter.Add("id", containerID)
+		}
+	}
+	if importFilter.Len() > 0 {
+		importedContainers, err := docker.ContainerList(ctx, types.ContainerListOptions{
+			All:     true,
+			Filters: importFilter,
+		})
+		if err != nil {
+			return nil, countDockerError("container_list", err)
+		}
+		containers = append(containers, importedContainers...)
+	}
 
-	for _, cluster := range clusters {
+	for _, cluster := range buildClusters(ctx, containers) {
 		if cluster.ID == clusterID {
 			return cluster, nil
 		}
 	}
 
-	return nil, errors.New("cluster not found")
+	return nil, &ClusterNotFoundError{ClusterID: clusterID}
+}
+
+// getClusterNode finds a node of a cluster by either its container ID or its node name
+func getClusterNode(ctx context.Context, clusterID string, nodeID string) (*Cluster, *Node, error) {
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, node := range cluster.Nodes {
+		if node.ContainerID == nodeID || node.Name == nodeID {
+			return cluster, node, nil
+		}
+	}
+
+	return nil, nil, &NodeNotFoundError{ClusterID: clusterID, NodeID: nodeID}
+}
+
+func checkClusterOwnership(ctx context.Context, cluster *Cluster) error {
+	if !ContextIgnoreOwnership(ctx) && !cluster.isAuthorizedOwner(ContextUser(ctx)) {
+		return &ClusterOwnershipError{ClusterID: cluster.ID, Action: "modify"}
+	}
+	return nil
 }
 
 func getAllClusters(ctx context.Context) ([]*Cluster, error) {
@@ -75,13 +212,27 @@ func getAllClusters(ctx context.Context) ([]*Cluster, error) {
 		All: true,
 	})
 	if err != nil {
-		return nil, err
+		return nil, countDockerError("container_list", err)
 	}
 
+	return buildClusters(ctx, containers), nil
+}
+
+// buildClusters groups containers into the clusters they belong to along with their meta-data, leaving out the
+// clusters the requester may not see
+func buildClusters(ctx context.Context, containers []types.Container) []*Cluster {
 	clusterMap := make(map[string][]types.Container)
 
+	importedClusterIDs, err := getImportedClusterIDs()
+	if err != nil {
+		log.Printf("Failed to fetch imported containers: %s", err)
+	}
+
 	for _, container := range containers {
 		clusterID := container.Labels["com.couchbase.dyncluster.cluster_id"]
+		if clusterID == "" {
+			clusterID = importedClusterIDs[container.ID]
+		}
 		if clusterID != "" {
 			clusterMap[clusterID] = append(clusterMap[clusterID], container)
 		}
@@ -95,8 +246,10 @@ func getAllClusters(ctx context.Context) ([]*Cluster, error) {
 		}
 
 		clusterCreator := ""
+		var createdAt int64
 
 		var nodes []*Node
+		var syncGateway *SyncGateway
 		for _, container := range containers {
 			eth0Net := container.NetworkSettings.Networks[NetworkName]
 			if eth0Net == nil {
@@ -106,19 +259,60 @@ func getAllClusters(ctx context.Context) ([]*Cluster, error) {
 				eth0Net = &fakeNet
 			}
 
+			if createdAt == 0 || container.Created < createdAt {
+				createdAt = container.Created
+			}
+
 			containerCreator := container.Labels["com.couchbase.dyncluster.creator"]
 			if clusterCreator == "" {
 				clusterCreator = containerCreator
 			}
 
+			// Sidecars share the cluster label but are not couchbase nodes
+			if container.Labels["com.couchbase.dyncluster.sidecar"] == "sync_gateway" {
+				syncGateway = &SyncGateway{
+					ContainerID: container.ID[0:12],
+					Version:     container.Labels["com.couchbase.dyncluster.sync_gateway_version"],
+					Bucket:      container.Labels["com.couchbase.dyncluster.sync_gateway_bucket"],
+					IPv4Address: eth0Net.IPAddress,
+				}
+				continue
+			}
+
+			// Imported containers were never registered with the DNS service either
+			imported := container.Labels["com.couchbase.dyncluster.cluster_id"] == ""
+			nodeName := container.Labels["com.couchbase.dyncluster.node_name"]
+			hostname := registeredHostname(meta, container.Names[0])
+			if imported {
+				nodeName = strings.TrimPrefix(container.Names[0], "/")
+				hostname = ""
+			}
+
 			nodes = append(nodes, &Node{
 				ContainerID:          container.ID[0:12],
 				ContainerName:        container.Names[0],
 				State:                container.State,
-				Name:                 container.Labels["com.couchbase.dyncluster.node_name"],
+				Name:                 nodeName,
 				InitialServerVersion: container.Labels["com.couchbase.dyncluster.initial_server_version"],
+				Edition:              container.Labels["com.couchbase.dyncluster.edition"],
 				IPv4Address:          eth0Net.IPAddress,
 				IPv6Address:          eth0Net.GlobalIPv6Address,
+				DataPath:             container.Labels["com.couchbase.dyncluster.data_path"],
+				IndexPath:            container.Labels["com.couchbase.dyncluster.index_path"],
+				AnalyticsPath:        container.Labels["com.couchbase.dyncluster.analytics_path"],
+				Image:                container.Image,
+				ServerGroup:          container.Labels["com.couchbase.dyncluster.server_group"],
+				Role:                 container.Labels["com.couchbase.dyncluster.role"],
+				Services:             splitServices(container.Labels["com.couchbase.dyncluster.services"]),
+				SeccompProfile:       container.Labels["com.couchbase.dyncluster.seccomp_profile"],
+				ApparmorProfile:      container.Labels["com.couchbase.dyncluster.apparmor_profile"],
+				ConfigFile:           container.Labels["com.couchbase.dyncluster.config_file"],
+				Init:                 container.Labels["com.couchbase.dyncluster.init"] == "true",
+				StopSignal:           container.Labels["com.couchbase.dyncluster.stop_signal"],
+				PreserveData:         container.Labels["com.couchbase.dyncluster.preserve_data"] == "true",
+				Hostname:             hostname,
+				Imported:             imported,
+				InstanceID:           container.Labels["com.couchbase.dyncluster.daemon_instance_id"],
 			})
 		}
 
@@ -126,130 +320,574 @@ func getAllClusters(ctx context.Context) ([]*Cluster, error) {
 			clusterCreator = "unknown"
 		}
 
+		cluster := &Cluster{
+			ID:                clusterID,
+			Creator:           clusterCreator,
+			Owner:             meta.Owner,
+			Timeout:           meta.Timeout,
+			Nodes:             nodes,
+			SyncGateway:       syncGateway,
+			StartDelay:        meta.StartDelay,
+			StartOrder:        meta.StartOrder,
+			GenerationID:      meta.GenerationID,
+			AuthorizedOwners:  meta.AuthorizedOwners,
+			Name:              meta.Name,
+			Placement:         meta.Placement,
+			ResolvedPlacement: meta.ResolvedPlacement,
+			RequestedNodes:    meta.RequestedNodes,
+			Tags:              meta.Tags,
+			Orchestrator:      meta.Orchestrator,
+			Registry:          meta.Registry,
+			Namespace:         meta.Namespace,
+			CreatedAt:         meta.CreatedAt,
+			Pending:           meta.Pending,
+			MemoryQuotas:      meta.MemoryQuotas,
+			TerminateAt:       meta.TerminateAt,
+			Frozen:            meta.Frozen,
+		}
+		if cluster.CreatedAt.IsZero() {
+			cluster.CreatedAt = time.Unix(createdAt, 0)
+		}
+
 		// Don't include clusters that we don't actually own
-		if !ContextIgnoreOwnership(ctx) && clusterCreator != ContextUser(ctx) {
+		if !ContextIgnoreOwnership(ctx) && clusterCreator != ContextUser(ctx) && !cluster.isAuthorizedOwner(ContextUser(ctx)) {
+			continue
+		}
+		// Nor clusters of other namespaces, even those we are an owner of.  Clusters created before their owner
+		// was put in a namespace have none, and stay visible to their owners.
+		if !ContextIgnoreOwnership(ctx) && cluster.Namespace != "" && cluster.Namespace != ContextNamespace(ctx) {
 			continue
 		}
 
-		clusters = append(clusters, &Cluster{
-			ID:      clusterID,
-			Creator: clusterCreator,
-			Owner:   meta.Owner,
-			Timeout: meta.Timeout,
-			Nodes:   nodes,
-		})
+		clusters = append(clusters, cluster)
 	}
 
-	return clusters, nil
+	return clusters
 }
 
-func allocateCluster(ctx context.Context, opts ClusterOptions) (string, error) {
-	log.Printf("Allocating cluster (requested by: %s)", ContextUser(ctx))
-
+func validateClusterOptions(ctx context.Context, opts ClusterOptions) error {
 	if opts.Timeout < 0 {
-		return "", errors.New("must specify a valid timeout for the cluster")
+		return badRequestf("must specify a valid timeout for the cluster")
 	}
-	if opts.Timeout > 2*7*24*time.Hour {
-		return "", errors.New("cannot allocate clusters for longer than 2 weeks")
+	if err := checkClusterTimeout(ContextUser(ctx), opts.Timeout); err != nil {
+		return err
 	}
 	if len(opts.Nodes) == 0 {
-		return "", errors.New("must specify at least a single node for the cluster")
+		return badRequestf("must specify at least a single node for the cluster")
+	}
+	if len(opts.Nodes) > getConfig().maxClusterNodes {
+		return badRequestf("cannot allocate clusters with more than %d nodes", getConfig().maxClusterNodes)
+	}
+	if opts.StartDelay < 0 {
+		return badRequestf("start delay cannot be negative")
+	}
+	if err := validateMinNodes(opts); err != nil {
+		return err
+	}
+	if err := validateStopSignal(opts.StopSignal); err != nil {
+		return err
+	}
+	if err := validateDNSOptions(opts.DNS); err != nil {
+		return err
 	}
-	if len(opts.Nodes) > 10 {
-		return "", errors.New("cannot allocate clusters with more than 10 nodes")
+	if err := validateTags(opts.Tags); err != nil {
+		return err
 	}
+	for _, node := range opts.Nodes {
+		if err := validateNodePaths(node); err != nil {
+			return err
+		}
+		if err := validateNodeMemory(node); err != nil {
+			return err
+		}
+		if err := validateNodeCPUs(node); err != nil {
+			return err
+		}
+		if err := validateNodeConfigFile(node); err != nil {
+			return err
+		}
+		if err := validateNodeServices(node); err != nil {
+			return err
+		}
+	}
+	if err := validateServerGroups(opts.Nodes); err != nil {
+		return err
+	}
+	if err := validateOwners(opts.AuthorizedOwners); err != nil {
+		return err
+	}
+	if err := validatePlacementConstraints(opts.Placement); err != nil {
+		return err
+	}
+	if err := validateRegistry(opts.Registry); err != nil {
+		return err
+	}
+	if err := validateMemoryQuotas(opts.MemoryQuotas, opts.Nodes); err != nil {
+		return err
+	}
+	if opts.SyncGateway != nil && opts.SyncGateway.Bucket == "" {
+		return badRequestf("must specify a bucket for sync gateway")
+	}
+	return nil
+}
 
-	clusterID := newRandomClusterID()
-	timeoutTime := time.Now().Add(1 * time.Hour) // TODO: use the opts.Timeout
+// admitCluster runs every check a cluster must pass before it is allocated, returning the options fitted to the
+// host's capacity.  Both allocations and dry runs are admitted here so that a dry run fails whenever the allocation
+// would.
+func admitCluster(ctx context.Context, opts ClusterOptions) (ClusterOptions, error) {
+	if err := validateClusterOptions(ctx, opts); err != nil {
+		return opts, err
+	}
+	opts = applyClusterRegistry(opts)
 
-	meta := ClusterMeta{
-		Owner:   ContextUser(ctx),
-		Timeout: timeoutTime,
+	if err := checkNodeResourceSupport(ctx, opts.Nodes); err != nil {
+		return opts, err
+	}
+
+	if err := checkClusterName(ctx, opts.Name); err != nil {
+		return opts, err
+	}
+
+	if err := checkNamespaceCapacity(ctx, len(opts.Nodes)); err != nil {
+		return opts, err
+	}
+
+	if err := checkAdmission(ctx, opts); err != nil {
+		return opts, err
+	}
+
+	return fitClusterToCapacity(ctx, opts)
+}
+
+// previewCluster runs the same checks as allocateCluster without creating anything, returning the options
+// as they would be allocated along with the plan of what would be created and any warnings about the allocation.
+func previewCluster(ctx context.Context, opts ClusterOptions) (ClusterOptions, *AllocationPlan, []string, error) {
+	log.Printf("Previewing cluster allocation (requested by: %s)", ContextRequester(ctx))
+
+	var warnings []string
+
+	opts, err := admitCluster(ctx, opts)
+	if err != nil {
+		return opts, nil, nil, err
+	}
+	warnings = append(warnings, allocationWarnings(opts)...)
+
+	plan := &AllocationPlan{
+		Network: NetworkName,
+		IPRange: getConfig().ipRange,
+	}
+	var resolvedNodes []NodeOptions
+	for nodeIdx, node := range opts.Nodes {
+		if node.Name == "" {
+			node.Name = fmt.Sprintf("node_%d", nodeIdx+1)
+		}
+
+		containerImage := node.VersionInfo.toImageName()
+		imageSource, err := resolveImageSource(ctx, node.VersionInfo)
+		if err != nil {
+			return opts, nil, nil, errors.Wrapf(err, "node %s", node.Name)
+		}
+		if imageSource == ImageSourceBuild {
+			warnings = append(warnings, fmt.Sprintf("image %s for node %s is not available and will need to be built", containerImage, node.Name))
+		} else if imageSource == ImageSourceRegistry {
+			warnings = append(warnings, fmt.Sprintf("image %s for node %s is not available locally and will need to be pulled", containerImage, node.Name))
+		} else if imageSource == ImageSourceUnknown {
+			warnings = append(warnings, fmt.Sprintf("image %s for node %s is not available locally and registry %s requires credentials to check whether it can be pulled", containerImage, node.Name, node.VersionInfo.registry()))
+		}
+
+		plan.Nodes = append(plan.Nodes, NodePlan{
+			Name:        node.Name,
+			Image:       containerImage,
+			ImageSource: imageSource,
+			Services:    node.Services,
+		})
+		resolvedNodes = append(resolvedNodes, node)
 	}
+	opts.Nodes = resolvedNodes
+
+	if opts.SyncGateway != nil && opts.SyncGateway.Version == "" {
+		syncGatewayOpts := *opts.SyncGateway
+		syncGatewayOpts.Version = syncGatewayDefaultVersion
+		opts.SyncGateway = &syncGatewayOpts
+	}
+
+	return opts, plan, warnings, nil
+}
+
+// validateRegistry checks that a cluster's registry is the daemon's docker-registry or one of allowed-registries,
+// so that clusters cannot be pointed at arbitrary registries
+func validateRegistry(registry string) error {
+	if registry == "" {
+		return nil
+	}
+	if strings.Contains(registry, "://") || strings.ContainsAny(registry, " \t\n") {
+		return badRequestf("registry %s must be a host name, optionally with a port", registry)
+	}
+
+	config := getConfig()
+	if registry == config.dockerRegistry {
+		return nil
+	}
+	for _, allowed := range strings.Split(config.allowedRegistries, ",") {
+		if strings.TrimSpace(allowed) == registry {
+			return nil
+		}
+	}
+	return badRequestf("registry %s is not one of the allowed registries", registry)
+}
+
+// applyClusterRegistry points the images of every node at the cluster's registry, if it has one
+func applyClusterRegistry(opts ClusterOptions) ClusterOptions {
+	if opts.Registry == "" {
+		return opts
+	}
+
+	var nodes []NodeOptions
+	for _, node := range opts.Nodes {
+		if node.VersionInfo != nil {
+			versionInfo := *node.VersionInfo
+			versionInfo.Registry = opts.Registry
+			node.VersionInfo = &versionInfo
+		}
+		nodes = append(nodes, node)
+	}
+	opts.Nodes = nodes
+	return opts
+}
+
+// maxClusterIDAttempts is how many cluster IDs are generated before giving up on finding one which is unused
+const maxClusterIDAttempts = 5
+
+// createUniqueClusterMeta creates the meta-data of a new cluster, returning the ID it was created under.  Cluster
+// IDs are short enough to collide on rare occasions, so a new one is generated if clusterID is already in use
+// rather than failing or overwriting the meta-data of the existing cluster.
+func createUniqueClusterMeta(clusterID string, meta ClusterMeta) (string, error) {
 	err := metaStore.CreateClusterMeta(clusterID, meta)
+	for attempt := 1; err == errClusterMetaExists && attempt < maxClusterIDAttempts; attempt++ {
+		log.Printf("Cluster ID %s is already in use, generating another", clusterID)
+		clusterID = newRandomClusterID()
+		err = metaStore.CreateClusterMeta(clusterID, meta)
+	}
 	if err != nil {
 		return "", err
 	}
+	return clusterID, nil
+}
+
+// allocateCluster allocates a cluster, returning its ID along with any warnings about the allocation.  Named
+// clusters hold the lock on their name until they are allocated, so concurrent requests for the same name of
+// the same owner cannot both be allocated.
+func allocateCluster(ctx context.Context, opts ClusterOptions) (string, []string, error) {
+	if opts.Name != "" {
+		unlock := lockClusterName(ContextUser(ctx), opts.Name)
+		defer unlock()
+	}
+
+	return allocateClusterLocked(ctx, opts)
+}
+
+// allocateClusterLocked allocates a cluster whose name, if it has one, is already locked by the caller
+func allocateClusterLocked(ctx context.Context, opts ClusterOptions) (string, []string, error) {
+	log.Printf("Allocating cluster (requested by: %s)", ContextRequester(ctx))
+
+	opts, err := admitCluster(ctx, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if opts.Registry != "" {
+		if err := connectRegistry(ctx, opts.Registry); err != nil {
+			return "", nil, errors.Wrapf(err, "could not connect to registry %s", opts.Registry)
+		}
+	}
+
+	allocationStart := time.Now()
+	backoff := getConfig().allocationRetryBackoff
+	for attempt := 0; ; attempt++ {
+		clusterID, err := allocateClusterAttempt(ctx, opts)
+		if err == nil {
+			allocationDurationSeconds.WithLabelValues("success").Observe(time.Since(allocationStart).Seconds())
+			return clusterID, allocationWarnings(opts), nil
+		}
+
+		if attempt >= getConfig().allocationRetries || !isTransientError(err) {
+			allocationDurationSeconds.WithLabelValues("failure").Observe(time.Since(allocationStart).Seconds())
+			return "", nil, err
+		}
+
+		log.Printf("Allocation failed with a transient error, retrying in %s (requested by: %s): %s", backoff, ContextRequester(ctx), err)
+
+		select {
+		case <-ctx.Done():
+			allocationDurationSeconds.WithLabelValues("failure").Observe(time.Since(allocationStart).Seconds())
+			return "", nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// allocateClusterAttempt performs a single allocation of an already validated cluster, anything it created is
+// removed again if it fails
+func allocateClusterAttempt(ctx context.Context, opts ClusterOptions) (string, error) {
+	clusterID := newRandomClusterID()
+	clusterTimeout := opts.Timeout
+	if clusterTimeout == 0 {
+		clusterTimeout = getConfig().defaultClusterTimeout
+	}
+	timeoutTime := time.Now().Add(clusterTimeout)
+
+	useInit := opts.Timeout >= getConfig().longLivedClusterTimeout
+	if opts.Init != nil {
+		useInit = *opts.Init
+	}
+	stopSignal := getConfig().defaultStopSignal
+	if opts.StopSignal != "" {
+		stopSignal = opts.StopSignal
+	}
 
 	var nodesToAllocate []NodeOptions
+	var startOrder []string
 	for nodeIdx, node := range opts.Nodes {
 		if node.Name == "" {
 			node.Name = fmt.Sprintf("node_%d", nodeIdx+1)
 		}
+		node.Init = useInit
+		node.StopSignal = stopSignal
+		node.DNS = opts.DNS
 
 		nodesToAllocate = append(nodesToAllocate, node)
+		startOrder = append(startOrder, node.Name)
 	}
 
-	if len(nodesToAllocate) > 0 {
-		// We assume that all nodes are using the same server version.
-		node := nodesToAllocate[0]
+	meta := ClusterMeta{
+		Owner:            ContextUser(ctx),
+		Timeout:          timeoutTime,
+		GenerationID:     opts.GenerationID,
+		AuthorizedOwners: opts.AuthorizedOwners,
+		Name:             opts.Name,
+		Placement:        opts.Placement,
+		RequestedNodes:   opts.RequestedNodes,
+		Tags:             opts.Tags,
+		Registry:         opts.Registry,
+		Namespace:        ContextNamespace(ctx),
+		CreatedAt:        time.Now(),
+		Pending:          true,
+		MemoryQuotas:     opts.MemoryQuotas,
+	}
+	if opts.StartDelay > 0 {
+		meta.StartDelay = opts.StartDelay
+		meta.StartOrder = startOrder
+	}
+	if opts.SyncGateway != nil {
+		// The sync gateway is started by setup, as it can't connect to its bucket until setup has created it
+		syncGatewayOpts := *opts.SyncGateway
+		syncGatewayOpts.DNS = opts.DNS
+		meta.SyncGateway = &syncGatewayOpts
+	}
+	clusterID, err := createUniqueClusterMeta(clusterID, meta)
+	if err != nil {
+		return "", err
+	}
+	defer trackPendingAllocation(clusterID)()
+	recordClusterHistory(ctx, clusterID, HistoryEventCreated, "", timeoutTime.Format(time.RFC3339))
 
-		err := ensureImageExists(ctx, node.VersionInfo, clusterID)
+	allocationStart := time.Now()
+	allocLogf(clusterID, "Allocating cluster with %d nodes (requested by: %s)", len(nodesToAllocate), ContextRequester(ctx))
+	for _, node := range nodesToAllocate {
+		allocLogf(clusterID, "Node %s will run %s from %s", node.Name, node.ServerVersion, node.VersionInfo.toImageName())
+	}
+
+	if len(nodesToAllocate) > 0 {
+		images := distinctNodeImages(nodesToAllocate)
+		err := runPhase(ctx, AllocationPhasePull, getConfig().pullTimeout, func(ctx context.Context) error {
+			return forEachParallel(len(images), func(i int) error {
+				if err := ensureImageExists(ctx, images[i], clusterID); err != nil {
+					allocLogf(clusterID, "Failed to prepare image %s: %s", images[i].toImageName(), err)
+					return err
+				}
+				return nil
+			})
+		})
 		if err != nil {
-			return "", err
+			return "", cleanUpFailedAllocation(ctx, clusterID, err)
 		}
 	}
 
+	createError := runPhase(ctx, AllocationPhaseStart, getConfig().containerStartTimeout, func(ctx context.Context) error {
+		return allocateNodes(ctx, clusterID, timeoutTime, nodesToAllocate, opts)
+	})
+	if createError != nil {
+		allocLogf(clusterID, "Failed to allocate nodes, killing cluster: %s", createError)
+		return "", cleanUpFailedAllocation(ctx, clusterID, createError)
+	}
+
+	// Every container is up and recorded, so the cluster is no longer at risk of being left behind
+	err = metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		meta.Pending = false
+		return meta, nil
+	})
+	if err != nil {
+		return "", cleanUpFailedAllocation(ctx, clusterID, err)
+	}
+
+	allocLogf(clusterID, "Allocation completed in %s", time.Since(allocationStart))
+	return clusterID, nil
+}
+
+// cleanUpFailedAllocation kills whatever was allocated of a cluster which failed to allocate, returning the
+// allocation's error along with the cluster's ID.  The kill leaves a tombstone, so the allocation log of the
+// cluster can still be fetched to find out why it failed.  The allocation may have failed because its ctx is
+// done, so the cluster is killed regardless of it, forcefully if it can't be killed normally.
+func cleanUpFailedAllocation(ctx context.Context, clusterID string, err error) error {
+	killCtx := context.WithoutCancel(ctx)
+	if killErr := killClusterWithReason(killCtx, clusterID, KillReasonAllocationFailed); killErr != nil {
+		log.Printf("Failed to kill cluster %s after its allocation failed, killing it forcefully: %s", clusterID, killErr)
+		if killErr := forceKillClusterWithReason(killCtx, clusterID, KillReasonAllocationFailed); killErr != nil {
+			log.Printf("Failed to forcefully kill cluster %s after its allocation failed: %s", clusterID, killErr)
+		}
+	}
+	return &AllocationFailedError{ClusterID: clusterID, Err: err}
+}
+
+// allocateNodes creates and starts the containers of a cluster, staggering them if a start delay was requested
+func allocateNodes(ctx context.Context, clusterID string, timeoutTime time.Time, nodesToAllocate []NodeOptions, opts ClusterOptions) error {
+	if opts.StartDelay > 0 {
+		// Staggered starts are done one at a time in the requested order so the timing is reproducible
+		for nodeIdx, node := range nodesToAllocate {
+			if nodeIdx > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(opts.StartDelay):
+				}
+			}
+
+			_, err := allocateNode(ctx, clusterID, timeoutTime, node, opts.PreserveData)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Every node is waited for even once one has failed, so that the caller can remove all of the containers
+	return forEachParallel(len(nodesToAllocate), func(i int) error {
+		_, err := allocateNode(ctx, clusterID, timeoutTime, nodesToAllocate[i], opts.PreserveData)
+		return err
+	})
+}
+
+// distinctNodeImages returns the images the nodes run, nodes usually share an image so it is only pulled once
+func distinctNodeImages(nodes []NodeOptions) []*NodeVersion {
+	var images []*NodeVersion
+	seen := make(map[string]bool)
+	for _, node := range nodes {
+		if !seen[node.VersionInfo.toImageName()] {
+			seen[node.VersionInfo.toImageName()] = true
+			images = append(images, node.VersionInfo)
+		}
+	}
+	return images
+}
+
+// forEachParallel calls fn for each of n items, running at most max-parallel-nodes calls at a time.  It returns
+// the first error once every call has completed.
+func forEachParallel(n int, fn func(i int) error) error {
+	limit := make(chan struct{}, getConfig().maxParallelNodes)
 	signal := make(chan error)
 
-	for _, node := range nodesToAllocate {
-		go func(clusterID string, node NodeOptions) {
-			_, err := allocateNode(ctx, clusterID, timeoutTime, node)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			limit <- struct{}{}
+			err := fn(i)
+			<-limit
 			signal <- err
-		}(clusterID, node)
+		}(i)
 	}
 
-	var createError error
-	for range nodesToAllocate {
+	var firstError error
+	for i := 0; i < n; i++ {
 		err := <-signal
-		if err != nil && createError == nil {
-			createError = err
+		if err != nil && firstError == nil {
+			firstError = err
 		}
 	}
-	if createError != nil {
-		killCluster(ctx, clusterID)
-		return "", createError
+	return firstError
+}
+
+// ensureImageExists makes sure a node image is on the docker host, pulling or building it only if it is not
+// already cached.  Concurrent allocations needing the same image share a single pull.
+func ensureImageExists(ctx context.Context, versionInfo *NodeVersion, clusterID string) error {
+	containerImage := versionInfo.toImageName()
+
+	cached, err := isImageCached(ctx, containerImage)
+	if err != nil {
+		return err
+	}
+	if cached {
+		log.Printf("Using cached %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextRequester(ctx))
+		allocLogf(clusterID, "Using cached image %s", containerImage)
+		return nil
 	}
 
-	return clusterID, nil
+	waited, err := coalesceImagePull(ctx, containerImage, func(ctx context.Context) error {
+		return prepareImage(ctx, versionInfo, clusterID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if waited {
+		log.Printf("Shared an in-flight pull of %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextRequester(ctx))
+		allocLogf(clusterID, "Shared an in-flight pull of image %s", containerImage)
+	} else {
+		log.Printf("Freshly pulled %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextRequester(ctx))
+		allocLogf(clusterID, "Freshly pulled image %s", containerImage)
+	}
+	return nil
 }
 
-func ensureImageExists(ctx context.Context, versionInfo *NodeVersion, clusterID string) error {
+// prepareImage pulls a node image from the registry, or builds it if there is no registry or the registry does
+// not have it
+func prepareImage(ctx context.Context, versionInfo *NodeVersion, clusterID string) error {
 	containerImage := versionInfo.toImageName()
-	if dockerRegistry == "" {
-		err := checkBuildExists(fmt.Sprintf("%s/%s", versionInfo.toURL(), versionInfo.toPkgName()))
+	if versionInfo.registry() == "" {
+		err := checkBuildExists(ctx, fmt.Sprintf("%s/%s", versionInfo.toURL(), versionInfo.toPkgName()))
 		if err != nil {
 			return err
 		}
 
 		// If the image is already built then this will won't rebuild
 		if clusterID == "" {
-			log.Printf("Building %s image (requested by: %s)", containerImage, ContextUser(ctx))
+			log.Printf("Building %s image (requested by: %s)", containerImage, ContextRequester(ctx))
 		} else {
-			log.Printf("Building %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextUser(ctx))
+			log.Printf("Building %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextRequester(ctx))
 		}
 		err = imageBuild(ctx, versionInfo, helper.DockerFilePath+"couchbase/centos7") // TODO: might want this to be a config too
 		if err != nil {
 			return err
 		}
 	} else {
-		log.Printf("Pulling %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextUser(ctx))
-		err := imagePull(ctx, containerImage)
+		log.Printf("Pulling %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextRequester(ctx))
+		allocLogf(clusterID, "Pulling image %s", containerImage)
+		err := imagePull(ctx, containerImage, versionInfo.registry())
 		if err != nil {
+			allocLogf(clusterID, "Failed to pull image %s, building it instead: %s", containerImage, err)
 			// assume that pull failed because the image didn't exist on the registry
 			// check the build exists and then build the image
-			err = checkBuildExists(fmt.Sprintf("%s/%s", versionInfo.toURL(), versionInfo.toPkgName()))
+			err = checkBuildExists(ctx, fmt.Sprintf("%s/%s", versionInfo.toURL(), versionInfo.toPkgName()))
 			if err != nil {
 				return err
 			}
 
-			log.Printf("Building %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextUser(ctx))
+			log.Printf("Building %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextRequester(ctx))
 			err = imageBuild(ctx, versionInfo, helper.DockerFilePath+"couchbase/centos7") // TODO: might want this to be a config too
 			if err != nil {
 				return err
 			}
 
-			log.Printf("Pushing %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextUser(ctx))
+			log.Printf("Pushing %s image for cluster %s (requested by: %s)", containerImage, clusterID, ContextRequester(ctx))
 			err = imagePush(ctx, versionInfo)
 			if err != nil {
 				return err
@@ -260,10 +898,14 @@ func ensureImageExists(ctx context.Context, versionInfo *NodeVersion, clusterID
 }
 
 func refreshCluster(ctx context.Context, clusterID string, newTimeout time.Duration) error {
-	log.Printf("Refreshing cluster %s (requested by: %s)", clusterID, ContextUser(ctx))
+	log.Printf("Refreshing cluster %s (requested by: %s)", clusterID, ContextRequester(ctx))
+
+	if err := checkClusterTimeout(ContextUser(ctx), newTimeout); err != nil {
+		return err
+	}
 
 	// Check the cluster actuall exists
-	_, err := getCluster(ctx, clusterID)
+	cluster, err := getCluster(ctx, clusterID)
 	if err != nil {
 		return err
 	}
@@ -273,43 +915,146 @@ func refreshCluster(ctx context.Context, clusterID string, newTimeout time.Durat
 		Timeout: time.Now().Add(newTimeout),
 	}
 
+	unlock := lockClusterExpiry(clusterID)
+	defer unlock()
+
 	_, err = metaStore.GetClusterMeta(clusterID)
 	if err != nil {
 		// If we failed to fetch the cluster metadata, just insert some instead
 		return metaStore.CreateClusterMeta(clusterID, newMeta)
 	}
 
-	return metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
-		meta.Owner = newMeta.Owner
+	var oldMeta ClusterMeta
+	err = metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		oldMeta = meta
+		// Authorized owners can refresh a shared cluster without taking it over
+		if !cluster.isAuthorizedOwner(newMeta.Owner) {
+			meta.Owner = newMeta.Owner
+		}
 		if meta.Timeout.Before(newMeta.Timeout) {
 			meta.Timeout = newMeta.Timeout
 		}
 		return meta, nil
 	})
+	if err != nil {
+		return err
+	}
+
+	if !cluster.isAuthorizedOwner(newMeta.Owner) {
+		recordClusterHistory(ctx, clusterID, HistoryEventOwnerTransferred, oldMeta.Owner, newMeta.Owner)
+	}
+	if oldMeta.Timeout.Before(newMeta.Timeout) {
+		recordClusterHistory(ctx, clusterID, HistoryEventTimeoutExtended, oldMeta.Timeout.Format(time.RFC3339),
+			newMeta.Timeout.Format(time.RFC3339))
+	}
+
+	return nil
 }
 
-func killCluster(ctx context.Context, clusterID string) error {
-	log.Printf("Killing cluster %s (requested by: %s)", clusterID, ContextUser(ctx))
+func validateOwners(owners []string) error {
+	for _, owner := range owners {
+		if !strings.HasSuffix(owner, "@couchbase.com") {
+			return badRequestf("owner %s must be a @couchbase.com email", owner)
+		}
+	}
+	return nil
+}
+
+// setClusterOwners replaces the additional authorized owners of a cluster, only admins and the cluster's
+// creator or owner can do this.
+func setClusterOwners(ctx context.Context, clusterID string, owners []string) error {
+	log.Printf("Setting authorized owners of cluster %s to %v (requested by: %s)", clusterID, owners, ContextRequester(ctx))
 
 	cluster, err := getCluster(ctx, clusterID)
 	if err != nil {
 		return err
 	}
 
-	if !ContextIgnoreOwnership(ctx) && cluster.Owner != ContextUser(ctx) {
-		return errors.New("cannot kill clusters you don't own")
+	user := ContextUser(ctx)
+	if !ContextIgnoreOwnership(ctx) && cluster.Creator != user && cluster.Owner != user {
+		return forbiddenf("only the cluster creator or owner can manage its owners")
+	}
+
+	if err := validateOwners(owners); err != nil {
+		return err
+	}
+
+	err = metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		meta.AuthorizedOwners = owners
+		return meta, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	recordClusterHistory(ctx, clusterID, HistoryEventAuthorizedOwnersChanged, formatHistoryOwners(cluster.AuthorizedOwners),
+		formatHistoryOwners(owners))
+	return nil
+}
+
+func killCluster(ctx context.Context, clusterID string) error {
+	return killClusterWithReason(ctx, clusterID, KillReasonRequested)
+}
+
+func killClusterWithReason(ctx context.Context, clusterID string, reason string) error {
+	return killClusterWithOptions(ctx, clusterID, reason, false)
+}
+
+// forceKillClusterWithReason kills a cluster whose containers may be wedged, killing and removing them rather
+// than stopping them.  The cluster's meta-data is removed even if its containers are already gone.
+func forceKillClusterWithReason(ctx context.Context, clusterID string, reason string) error {
+	return killClusterWithOptions(ctx, clusterID, reason, true)
+}
+
+func killClusterWithOptions(ctx context.Context, clusterID string, reason string, force bool) error {
+	log.Printf("Killing cluster %s (requested by: %s, reason: %s, force: %t)", clusterID, ContextRequester(ctx), reason, force)
+	allocLogf(clusterID, "Killing cluster (requested by: %s, reason: %s, force: %t)", ContextRequester(ctx), reason, force)
+
+	cluster, err := getCluster(ctx, clusterID)
+	var notFound *ClusterNotFoundError
+	if force && errors.As(err, &notFound) {
+		// The containers are already gone, but the meta-data of the cluster still needs cleaning up
+		meta, metaErr := metaStore.GetClusterMeta(clusterID)
+		if metaErr != nil {
+			return err
+		}
+		cluster = &Cluster{
+			ID:               clusterID,
+			Owner:            meta.Owner,
+			AuthorizedOwners: meta.AuthorizedOwners,
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if !ContextIgnoreOwnership(ctx) && !cluster.isAuthorizedOwner(ContextUser(ctx)) {
+		return &ClusterOwnershipError{ClusterID: clusterID, Action: "kill"}
 	}
 
 	var nodesToKill []string
+	// Imported containers were not created to remove themselves once stopped
+	importedNodes := make(map[string]bool)
 	for _, node := range cluster.Nodes {
+		if node.Imported {
+			importedNodes[node.ContainerID] = true
+		}
 		nodesToKill = append(nodesToKill, node.ContainerID)
 	}
+	if cluster.SyncGateway != nil {
+		nodesToKill = append(nodesToKill, cluster.SyncGateway.ContainerID)
+	}
 
 	signal := make(chan error)
 
 	for _, nodeID := range nodesToKill {
 		go func(nodeID string) {
-			signal <- killNode(ctx, nodeID)
+			if force {
+				signal <- forceKillNode(ctx, nodeID)
+			} else if err := killNode(ctx, nodeID); err != nil || !importedNodes[nodeID] {
+				signal <- err
+			} else {
+				signal <- removeNodeContainer(ctx, nodeID)
+			}
 		}(nodeID)
 	}
 
@@ -324,6 +1069,33 @@ func killCluster(ctx context.Context, clusterID string) error {
 		return killError
 	}
 
+	for _, node := range cluster.Nodes {
+		if !node.PreserveData {
+			if err := wipeNodeData(ctx, node); err != nil {
+				log.Printf("Failed to wipe storage paths of node %s: %s", node.ContainerID, err)
+			}
+		}
+		deregisterNodeHostname(node)
+	}
+	deleteSetupTrace(clusterID)
+	if err := metaStore.DeleteCheckpoints(clusterID); err != nil {
+		log.Printf("Failed to delete checkpoints of cluster %s: %s", clusterID, err)
+	}
+	if err := metaStore.DeletePartitions(clusterID); err != nil {
+		log.Printf("Failed to delete partitions of cluster %s: %s", clusterID, err)
+	}
+	if err := metaStore.DeleteThrottles(clusterID); err != nil {
+		log.Printf("Failed to delete throttles of cluster %s: %s", clusterID, err)
+	}
+	if err := metaStore.DeleteImportedContainers(clusterID); err != nil {
+		log.Printf("Failed to delete imported containers of cluster %s: %s", clusterID, err)
+	}
+	if err := metaStore.DeleteClusterMeta(clusterID); err != nil {
+		log.Printf("Failed to delete meta-data of cluster %s: %s", clusterID, err)
+	}
+	recordTombstone(cluster, ContextUser(ctx), reason)
+	recordClusterHistory(ctx, clusterID, HistoryEventKilled, "", reason)
+
 	return nil
 }
 
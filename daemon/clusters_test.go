@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCreateUniqueClusterMetaRegeneratesCollidingID(t *testing.T) {
+	withTestMetaStore(t)
+
+	existing := ClusterMeta{Owner: "existing@couchbase.com"}
+	if err := metaStore.CreateClusterMeta("deadbeef", existing); err != nil {
+		t.Fatalf("failed to create existing cluster: %s", err)
+	}
+
+	clusterID, err := createUniqueClusterMeta("deadbeef", ClusterMeta{Owner: "new@couchbase.com"})
+	if err != nil {
+		t.Fatalf("expected a new cluster ID to be generated, got %s", err)
+	}
+	if clusterID == "deadbeef" {
+		t.Fatalf("expected a new cluster ID to be generated for the colliding ID")
+	}
+
+	meta, err := metaStore.GetClusterMeta("deadbeef")
+	if err != nil || meta.Owner != existing.Owner {
+		t.Errorf("expected the existing cluster to be left alone, got %+v (%v)", meta, err)
+	}
+	meta, err = metaStore.GetClusterMeta(clusterID)
+	if err != nil || meta.Owner != "new@couchbase.com" {
+		t.Errorf("expected the new cluster under %s, got %+v (%v)", clusterID, meta, err)
+	}
+}
+
+func TestCheckClusterNameRejectsOwnersDuplicateName(t *testing.T) {
+	withTestMetaStore(t)
+	withTestDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/containers/json") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{
+			"Id": "0123456789abcdef",
+			"Names": ["/deadbeef_node_1"],
+			"State": "running",
+			"NetworkSettings": {"Networks": {}},
+			"Labels": {
+				"com.couchbase.dyncluster.cluster_id": "deadbeef",
+				"com.couchbase.dyncluster.creator": "owner@couchbase.com"
+			}
+		}]`))
+	}))
+
+	err := metaStore.CreateClusterMeta("deadbeef", ClusterMeta{Owner: "owner@couchbase.com", Name: "ci"})
+	if err != nil {
+		t.Fatalf("failed to create existing cluster: %s", err)
+	}
+
+	err = checkClusterName(NewContext(context.Background(), "owner@couchbase.com", false), "ci")
+	var conflict *ClusterNameConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a name conflict, got %v", err)
+	}
+	status, code, clusterID := classifyError(err)
+	if status != 409 || code != ErrorCodeNameConflict || clusterID != "deadbeef" {
+		t.Errorf("expected 409 %s for cluster deadbeef, got %d %s for cluster %s", ErrorCodeNameConflict, status,
+			code, clusterID)
+	}
+
+	// Names are scoped to their owner, so another user may use the same name
+	err = checkClusterName(NewContext(context.Background(), "other@couchbase.com", false), "ci")
+	if err != nil {
+		t.Errorf("expected another owner to be allowed the same name, got %s", err)
+	}
+}
@@ -0,0 +1,212 @@
+package daemon
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	cbcollectInfoPath = "/opt/couchbase/bin/cbcollect_info"
+	// collectTimeout bounds the whole collection, cbcollect_info alone can take several minutes per node
+	collectTimeout = 20 * time.Minute
+)
+
+var errDiagnosticsTooLarge = errors.New("diagnostics exceed the maximum response size")
+
+// diagnosticsArchive writes node files into a tarball, keeping count of how much it has written so that it stays
+// within max-response-size
+type diagnosticsArchive struct {
+	tarWriter *tar.Writer
+	written   int64
+}
+
+func (archive *diagnosticsArchive) writeFile(name string, modTime time.Time, size int64, content io.Reader) error {
+	if archive.written+size > int64(getConfig().maxResponseSize) {
+		return errDiagnosticsTooLarge
+	}
+
+	err := archive.tarWriter.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(archive.tarWriter, content)
+	archive.written += n
+	return err
+}
+
+func (archive *diagnosticsArchive) writeBytes(name string, data []byte) error {
+	return archive.writeFile(name, time.Now(), int64(len(data)), bytes.NewReader(data))
+}
+
+// copyFromNode copies a file or directory out of a node into the archive under dir
+func (archive *diagnosticsArchive) copyFromNode(ctx context.Context, node *Node, srcPath string, dir string) error {
+	reader, _, err := docker.CopyFromContainer(ctx, node.ContainerID, srcPath)
+	if err != nil {
+		return countDockerError("copy_from_container", err)
+	}
+	defer reader.Close()
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := archive.writeFile(path.Join(dir, header.Name), header.ModTime, header.Size, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+func nodeDiagnosticsDir(node *Node) string {
+	if node.Name != "" {
+		return node.Name
+	}
+	return node.ContainerID
+}
+
+func nodeCollectPath(node *Node) string {
+	return fmt.Sprintf("/tmp/cbcollect-%s.zip", node.ContainerID)
+}
+
+// readNodeContainerLogs reads the whole of a node's container logs, with stdout and stderr interleaved
+func readNodeContainerLogs(ctx context.Context, node *Node) ([]byte, error) {
+	logs, err := docker.ContainerLogs(ctx, node.ContainerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return nil, countDockerError("container_logs", err)
+	}
+	defer logs.Close()
+
+	var logsBuf bytes.Buffer
+	if _, err := stdcopy.StdCopy(&logsBuf, &logsBuf, logs); err != nil {
+		return nil, err
+	}
+	return logsBuf.Bytes(), nil
+}
+
+// writeNodeDiagnostics adds a node's details, container logs and cbcollect_info output to the archive.  When
+// cbcollect_info failed the node's couchbase logs are included instead, along with why it failed.
+func writeNodeDiagnostics(ctx context.Context, archive *diagnosticsArchive, node *Node, collectErr error) error {
+	dir := nodeDiagnosticsDir(node)
+
+	nodeBytes, err := json.MarshalIndent(jsonifyNode(node), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := archive.writeBytes(path.Join(dir, "node.json"), nodeBytes); err != nil {
+		return err
+	}
+
+	containerLogs, err := readNodeContainerLogs(ctx, node)
+	if err != nil {
+		containerLogs = []byte(fmt.Sprintf("Failed to read container logs: %s\n", err))
+	}
+	if err := archive.writeBytes(path.Join(dir, "container.log"), containerLogs); err != nil {
+		return err
+	}
+
+	if collectErr == nil {
+		return archive.copyFromNode(ctx, node, nodeCollectPath(node), dir)
+	}
+
+	collectErrMsg := fmt.Sprintf("cbcollect_info failed, the couchbase logs were collected instead: %s\n", collectErr)
+	if err := archive.writeBytes(path.Join(dir, "cbcollect_info-error.txt"), []byte(collectErrMsg)); err != nil {
+		return err
+	}
+	return archive.copyFromNode(ctx, node, couchbaseLogsPath, dir)
+}
+
+// writeClusterDiagnostics runs cbcollect_info on every node of a cluster concurrently, then writes a gzipped
+// tarball to w with a directory per node holding its details, container logs and cbcollect_info output.  The
+// tarball is streamed, so callers must verify access to the cluster before calling this.
+func writeClusterDiagnostics(ctx context.Context, w io.Writer, cluster *Cluster) error {
+	log.Printf("Collecting diagnostics for cluster %s (requested by: %s)", cluster.ID, ContextRequester(ctx))
+
+	ctx, cancel := context.WithTimeout(ctx, collectTimeout)
+	defer cancel()
+
+	collectErrs := make([]error, len(cluster.Nodes))
+	forEachParallel(len(cluster.Nodes), func(i int) error {
+		node := cluster.Nodes[i]
+		if node.State != "running" {
+			collectErrs[i] = fmt.Errorf("node is %s", node.State)
+			return nil
+		}
+		_, collectErrs[i] = execInContainer(ctx, node.ContainerID, []string{cbcollectInfoPath, nodeCollectPath(node)})
+		return nil
+	})
+
+	// The output of cbcollect_info is large, so it is not left behind in the containers
+	defer func() {
+		for i, node := range cluster.Nodes {
+			if collectErrs[i] != nil {
+				continue
+			}
+			_, err := execInContainer(context.Background(), node.ContainerID, []string{"rm", "-f", nodeCollectPath(node)})
+			if err != nil {
+				log.Printf("Failed to remove cbcollect_info output from node %s: %s", node.ContainerID, err)
+			}
+		}
+	}()
+
+	gzipWriter := gzip.NewWriter(w)
+	archive := &diagnosticsArchive{tarWriter: tar.NewWriter(gzipWriter)}
+	closeArchive := func() error {
+		if err := archive.tarWriter.Close(); err != nil {
+			return err
+		}
+		return gzipWriter.Close()
+	}
+
+	for i, node := range cluster.Nodes {
+		err := writeNodeDiagnostics(ctx, archive, node, collectErrs[i])
+		if err == errDiagnosticsTooLarge {
+			// Finish the tarball so the diagnostics which fit are still usable, and say why the rest are missing
+			log.Printf("Truncating diagnostics for cluster %s at %d bytes", cluster.ID, archive.written)
+			truncatedMsg := fmt.Sprintf("Diagnostics were truncated at node %s as they exceeded the maximum response size of %d bytes\n",
+				node.Name, getConfig().maxResponseSize)
+			archive.tarWriter.WriteHeader(&tar.Header{
+				Name:    couchbaseLogsTruncatedFile,
+				Mode:    0644,
+				Size:    int64(len(truncatedMsg)),
+				ModTime: time.Now(),
+			})
+			io.WriteString(archive.tarWriter, truncatedMsg)
+			return closeArchive()
+		}
+		if err != nil {
+			closeArchive()
+			return fmt.Errorf("failed to collect diagnostics from node %s: %s", node.Name, err)
+		}
+	}
+
+	return closeArchive()
+}
@@ -8,8 +8,6 @@ import (
 	"github.com/couchbaselabs/cbdynclusterd/helper"
 
 	"github.com/couchbaselabs/cbdynclusterd/cluster"
-
-	"github.com/pkg/errors"
 )
 
 type AddCollectionOptions struct {
@@ -18,7 +16,7 @@ type AddCollectionOptions struct {
 
 func addCollection(ctx context.Context, clusterID string, opts AddCollectionOptions) error {
 	log.Printf("Adding collection %s to bucket %s on cluster %s (requested by: %s)", opts.Conf.Name,
-		opts.Conf.BucketName, clusterID, ContextUser(ctx))
+		opts.Conf.BucketName, clusterID, ContextRequester(ctx))
 
 	c, err := getCluster(ctx, clusterID)
 	if err != nil {
@@ -26,7 +24,7 @@ func addCollection(ctx context.Context, clusterID string, opts AddCollectionOpti
 	}
 
 	if len(c.Nodes) == 0 {
-		return errors.New("no nodes available")
+		return badRequestf("no nodes available")
 	}
 
 	n := c.Nodes[0]
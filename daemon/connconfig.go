@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+const (
+	ConnectionConfigFormatEnv  = "env"
+	ConnectionConfigFormatJSON = "json"
+	ConnectionConfigFormatIni  = "ini"
+)
+
+type ConnectionConfig struct {
+	ConnectionString string   `json:"connection_string"`
+	Username         string   `json:"username"`
+	Password         string   `json:"password"`
+	Buckets          []string `json:"buckets"`
+	CACert           string   `json:"ca_cert,omitempty"`
+}
+
+// getConnectionConfig collects what an SDK needs to connect to a cluster.  Only running nodes are included in the
+// connection string.  Buckets and the CA certificate can only be read once the cluster has been set up, so they
+// are left empty if the cluster cannot be queried.
+func getConnectionConfig(ctx context.Context, clusterID string) (*ConnectionConfig, error) {
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, node := range cluster.Nodes {
+		if node.State == "running" {
+			hosts = append(hosts, node.IPv4Address)
+		}
+	}
+
+	config := &ConnectionConfig{
+		ConnectionString: "couchbase://" + strings.Join(hosts, ","),
+		Username:         helper.RestUser,
+		Password:         helper.RestPass,
+		Buckets:          make([]string, 0),
+	}
+
+	if node, err := clusterTargetNode(cluster); err == nil {
+		var buckets []bucketNameJSON
+		if err := getClusterRest(node, helper.PBuckets, &buckets); err == nil {
+			for _, bucket := range buckets {
+				config.Buckets = append(config.Buckets, bucket.Name)
+			}
+			sort.Strings(config.Buckets)
+		}
+
+		caCert, err := helper.GetResponse(&helper.RestCall{
+			ExpectedCode: 200,
+			Method:       "GET",
+			Path:         helper.PCertificate,
+			Cred:         &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: node.IPv4Address, Port: helper.RestPort},
+		})
+		if err == nil {
+			config.CACert = strings.TrimSpace(caCert)
+		}
+	}
+
+	return config, nil
+}
+
+// formatConnectionConfig renders the config in one of the connection config formats, returning the rendered
+// config and its content type
+func formatConnectionConfig(config *ConnectionConfig, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	switch format {
+	case "", ConnectionConfigFormatJSON:
+		jsonBytes, err := json.Marshal(config)
+		if err != nil {
+			return nil, "", err
+		}
+		return jsonBytes, "application/json", nil
+	case ConnectionConfigFormatEnv:
+		fmt.Fprintf(&buf, "CB_CONNECTION_STRING=%s\n", config.ConnectionString)
+		fmt.Fprintf(&buf, "CB_USERNAME=%s\n", config.Username)
+		fmt.Fprintf(&buf, "CB_PASSWORD=%s\n", config.Password)
+		fmt.Fprintf(&buf, "CB_BUCKETS=%s\n", strings.Join(config.Buckets, ","))
+		if config.CACert != "" {
+			fmt.Fprintf(&buf, "CB_CA_CERT=\"%s\"\n", config.CACert)
+		}
+		return buf.Bytes(), "text/plain", nil
+	case ConnectionConfigFormatIni:
+		fmt.Fprintf(&buf, "[couchbase]\n")
+		fmt.Fprintf(&buf, "connection_string = %s\n", config.ConnectionString)
+		fmt.Fprintf(&buf, "username = %s\n", config.Username)
+		fmt.Fprintf(&buf, "password = %s\n", config.Password)
+		fmt.Fprintf(&buf, "buckets = %s\n", strings.Join(config.Buckets, ","))
+		if config.CACert != "" {
+			// Multi-line values are written as indented continuation lines
+			fmt.Fprintf(&buf, "ca_cert = %s\n", strings.Replace(config.CACert, "\n", "\n    ", -1))
+		}
+		return buf.Bytes(), "text/plain", nil
+	}
+
+	return nil, "", badRequestf("unknown config format `%s`", format)
+}
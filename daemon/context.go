@@ -1,12 +1,18 @@
 package daemon
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
 type cbdcContextKey string
 
 const (
 	ContexKeyUser             = cbdcContextKey("user")
 	ContextKeyIgnoreOwnership = cbdcContextKey("ignore_ownership")
+	ContextKeyRequestID       = cbdcContextKey("request_id")
+	ContextKeyNamespace       = cbdcContextKey("namespace")
+	ContextKeyAuthIdentity    = cbdcContextKey("auth_identity")
 )
 
 func NewContext(parent context.Context, user string, ignoreOwnership bool) context.Context {
@@ -16,6 +22,16 @@ func NewContext(parent context.Context, user string, ignoreOwnership bool) conte
 	return ctx
 }
 
+// WithRequestID attaches the ID used to correlate the work done for a single request
+func WithRequestID(parent context.Context, requestID string) context.Context {
+	return context.WithValue(parent, ContextKeyRequestID, requestID)
+}
+
+// WithNamespace attaches the namespace the request is scoped to
+func WithNamespace(parent context.Context, namespace string) context.Context {
+	return context.WithValue(parent, ContextKeyNamespace, namespace)
+}
+
 func ContextUser(ctx context.Context) string {
 	if user, ok := ctx.Value(ContexKeyUser).(string); ok {
 		return user
@@ -29,3 +45,25 @@ func ContextIgnoreOwnership(ctx context.Context) bool {
 	}
 	return false
 }
+
+func ContextNamespace(ctx context.Context) string {
+	if namespace, ok := ctx.Value(ContextKeyNamespace).(string); ok {
+		return namespace
+	}
+	return ""
+}
+
+func ContextRequestID(ctx context.Context) string {
+	if requestID, ok := ctx.Value(ContextKeyRequestID).(string); ok {
+		return requestID
+	}
+	return ""
+}
+
+// ContextRequester describes who made a request for use in log lines, including the request ID if there is one
+func ContextRequester(ctx context.Context) string {
+	if requestID := ContextRequestID(ctx); requestID != "" {
+		return fmt.Sprintf("%s, request: %s", ContextUser(ctx), requestID)
+	}
+	return ContextUser(ctx)
+}
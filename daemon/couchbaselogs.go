@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"time"
+)
+
+const (
+	couchbaseLogsPath    = "/opt/couchbase/var/lib/couchbase/logs"
+	couchbaseLogsTimeout = 5 * time.Minute
+	// couchbaseLogsTruncatedFile is added to the zip in place of any logs left out because of max-response-size
+	couchbaseLogsTruncatedFile = "TRUNCATED.txt"
+)
+
+var errCouchbaseLogsTooLarge = errors.New("couchbase logs exceed the maximum response size")
+
+// writeNodeCouchbaseLogs copies the couchbase log directory out of a node and writes each file into the zip
+// under the node's name, returning the number of bytes which were written.
+func writeNodeCouchbaseLogs(ctx context.Context, zipWriter *zip.Writer, node *Node, remaining int64) (int64, error) {
+	reader, _, err := docker.CopyFromContainer(ctx, node.ContainerID, couchbaseLogsPath)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var written int64
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if written+header.Size > remaining {
+			return written, errCouchbaseLogsTooLarge
+		}
+
+		fileHeader := &zip.FileHeader{
+			Name:   path.Join(node.Name, header.Name),
+			Method: zip.Deflate,
+		}
+		fileHeader.SetModTime(header.ModTime)
+
+		fileWriter, err := zipWriter.CreateHeader(fileHeader)
+		if err != nil {
+			return written, err
+		}
+
+		n, err := io.Copy(fileWriter, tarReader)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// writeClusterCouchbaseLogs writes a zip of the couchbase logs of every node in a cluster to w.  The zip is
+// streamed, so callers must verify access to the cluster before calling this.
+func writeClusterCouchbaseLogs(ctx context.Context, w io.Writer, cluster *Cluster) error {
+	log.Printf("Collecting couchbase logs for cluster %s (requested by: %s)", cluster.ID, ContextRequester(ctx))
+
+	ctx, cancel := context.WithTimeout(ctx, couchbaseLogsTimeout)
+	defer cancel()
+
+	zipWriter := zip.NewWriter(w)
+
+	limit := int64(getConfig().maxResponseSize)
+	var written int64
+	for _, node := range cluster.Nodes {
+		n, err := writeNodeCouchbaseLogs(ctx, zipWriter, node, limit-written)
+		written += n
+		if err == errCouchbaseLogsTooLarge {
+			// Finish the zip so the logs which fit are still usable, and say why the rest are missing
+			log.Printf("Truncating couchbase logs for cluster %s at %d bytes", cluster.ID, written)
+			if fileWriter, err := zipWriter.Create(couchbaseLogsTruncatedFile); err == nil {
+				fmt.Fprintf(fileWriter, "Logs were truncated at node %s as they exceeded the maximum response size of %d bytes\n",
+					node.Name, limit)
+			}
+			return zipWriter.Close()
+		}
+		if err != nil {
+			zipWriter.Close()
+			return fmt.Errorf("failed to collect logs from node %s: %s", node.Name, err)
+		}
+	}
+
+	return zipWriter.Close()
+}
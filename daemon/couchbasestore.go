@@ -0,0 +1,412 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/couchbase/gocb"
+)
+
+// CouchbaseStore keeps cluster meta-data in a couchbase bucket so that several daemons can share it.  Documents
+// use the same keys as MetaDataStore does.  Listing documents goes through N1QL, so the bucket needs a primary
+// index.
+type CouchbaseStore struct {
+	bucketName string
+	cluster    *gocb.Cluster
+	bucket     *gocb.Bucket
+}
+
+func (store *CouchbaseStore) Open(connStr, bucketName, username, password string) error {
+	if bucketName == "" {
+		return errors.New("a bucket must be configured for the couchbase meta-data store")
+	}
+
+	cluster, err := gocb.Connect(connStr)
+	if err != nil {
+		return err
+	}
+
+	if username != "" {
+		err = cluster.Authenticate(gocb.PasswordAuthenticator{
+			Username: username,
+			Password: password,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	bucket, err := cluster.OpenBucket(bucketName, "")
+	if err != nil {
+		cluster.Close()
+		return err
+	}
+
+	store.bucketName = bucketName
+	store.cluster = cluster
+	store.bucket = bucket
+	return nil
+}
+
+func (store *CouchbaseStore) Close() error {
+	if err := store.bucket.Close(); err != nil {
+		return err
+	}
+	return store.cluster.Close()
+}
+
+func (store *CouchbaseStore) Ping() error {
+	report, err := store.bucket.Ping([]gocb.ServiceType{gocb.MemdService})
+	if err != nil {
+		return err
+	}
+
+	for _, service := range report.Services {
+		if !service.Success {
+			return fmt.Errorf("could not reach %s", service.Endpoint)
+		}
+	}
+	return nil
+}
+
+// scanPrefix calls docFunc with every document whose key starts with prefix, in key order
+func (store *CouchbaseStore) scanPrefix(prefix string, docFunc func([]byte) error) error {
+	query := gocb.NewN1qlQuery(fmt.Sprintf(
+		"SELECT RAW b FROM `%s` b WHERE POSITION(META(b).id, $1) = 0 ORDER BY META(b).id", store.bucketName))
+	query.Consistency(gocb.RequestPlus)
+
+	results, err := store.bucket.ExecuteN1qlQuery(query, []interface{}{prefix})
+	if err != nil {
+		return err
+	}
+
+	for docBytes := results.NextBytes(); docBytes != nil; docBytes = results.NextBytes() {
+		if err := docFunc(docBytes); err != nil {
+			results.Close()
+			return err
+		}
+	}
+
+	return results.Close()
+}
+
+// removePrefix removes every document whose key starts with prefix
+func (store *CouchbaseStore) removePrefix(prefix string) error {
+	query := gocb.NewN1qlQuery(fmt.Sprintf(
+		"SELECT RAW META(b).id FROM `%s` b WHERE POSITION(META(b).id, $1) = 0", store.bucketName))
+	query.Consistency(gocb.RequestPlus)
+
+	results, err := store.bucket.ExecuteN1qlQuery(query, []interface{}{prefix})
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	var key string
+	for results.Next(&key) {
+		keys = append(keys, key)
+	}
+	if err := results.Close(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := store.remove(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove removes a document, removing a document which does not exist is not an error
+func (store *CouchbaseStore) remove(key string) error {
+	_, err := store.bucket.Remove(key, 0)
+	if err != nil && !gocb.IsKeyNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+func (store *CouchbaseStore) CreateClusterMeta(clusterID string, meta ClusterMeta) error {
+	clusterKey := fmt.Sprintf("cluster-%s", clusterID)
+
+	metaBytes, err := serializeMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.bucket.Insert(clusterKey, json.RawMessage(metaBytes), 0)
+	if gocb.IsKeyExistsError(err) {
+		return errClusterMetaExists
+	}
+	return err
+}
+
+func (store *CouchbaseStore) DeleteClusterMeta(clusterID string) error {
+	return store.remove(fmt.Sprintf("cluster-%s", clusterID))
+}
+
+// UpdateClusterMeta retries the update whenever another daemon changed the meta-data in the meantime
+func (store *CouchbaseStore) UpdateClusterMeta(clusterID string, updateFunc UpdateClusterMetaFunc) error {
+	clusterKey := fmt.Sprintf("cluster-%s", clusterID)
+
+	for {
+		var metaBytes json.RawMessage
+		cas, err := store.bucket.Get(clusterKey, &metaBytes)
+		if err != nil {
+			return err
+		}
+
+		meta, err := deserializeMeta(metaBytes)
+		if err != nil {
+			return err
+		}
+
+		meta, err = updateFunc(meta)
+		if err != nil {
+			return err
+		}
+
+		metaBytes, err = serializeMeta(meta)
+		if err != nil {
+			return err
+		}
+
+		_, err = store.bucket.Replace(clusterKey, metaBytes, cas, 0)
+		if gocb.IsKeyExistsError(err) {
+			continue
+		}
+		return err
+	}
+}
+
+func (store *CouchbaseStore) GetClusterMeta(clusterID string) (ClusterMeta, error) {
+	clusterKey := fmt.Sprintf("cluster-%s", clusterID)
+
+	var metaBytes json.RawMessage
+	_, err := store.bucket.Get(clusterKey, &metaBytes)
+	if gocb.IsKeyNotFoundError(err) {
+		return DEFAULT_CLUSTER_META, errClusterMetaNotFound
+	} else if err != nil {
+		return DEFAULT_CLUSTER_META, err
+	}
+
+	meta, err := deserializeMeta(metaBytes)
+	if err != nil {
+		return DEFAULT_CLUSTER_META, err
+	}
+
+	return meta, nil
+}
+
+func (store *CouchbaseStore) PutTombstone(tombstone ClusterTombstone) error {
+	_, err := store.bucket.Upsert(fmt.Sprintf("tombstone-%s", tombstone.ClusterID), tombstone, 0)
+	return err
+}
+
+func (store *CouchbaseStore) GetTombstones() ([]ClusterTombstone, error) {
+	var tombstones []ClusterTombstone
+	err := store.scanPrefix("tombstone-", func(tombstoneBytes []byte) error {
+		var tombstone ClusterTombstone
+		if err := json.Unmarshal(tombstoneBytes, &tombstone); err != nil {
+			return err
+		}
+		tombstones = append(tombstones, tombstone)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tombstones, nil
+}
+
+func (store *CouchbaseStore) DeleteTombstone(clusterID string) error {
+	return store.remove(fmt.Sprintf("tombstone-%s", clusterID))
+}
+
+func (store *CouchbaseStore) PutCheckpoint(checkpoint ClusterCheckpoint) error {
+	checkpointKey := fmt.Sprintf("checkpoint-%s-%s", checkpoint.ClusterID, checkpoint.Label)
+
+	_, err := store.bucket.Insert(checkpointKey, checkpoint, 0)
+	if gocb.IsKeyExistsError(err) {
+		return badRequestf("checkpoint %s already exists", checkpoint.Label)
+	}
+	return err
+}
+
+func (store *CouchbaseStore) GetCheckpoints(clusterID string) ([]ClusterCheckpoint, error) {
+	var checkpoints []ClusterCheckpoint
+	err := store.scanPrefix(fmt.Sprintf("checkpoint-%s-", clusterID), func(checkpointBytes []byte) error {
+		var checkpoint ClusterCheckpoint
+		if err := json.Unmarshal(checkpointBytes, &checkpoint); err != nil {
+			return err
+		}
+		checkpoints = append(checkpoints, checkpoint)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
+
+func (store *CouchbaseStore) DeleteCheckpoints(clusterID string) error {
+	return store.removePrefix(fmt.Sprintf("checkpoint-%s-", clusterID))
+}
+
+func (store *CouchbaseStore) PutPartition(partition NodePartition) error {
+	partitionKey := fmt.Sprintf("partition-%s-%s", partition.ClusterID, partition.NodeID)
+	_, err := store.bucket.Upsert(partitionKey, partition, 0)
+	return err
+}
+
+func (store *CouchbaseStore) GetPartitions(clusterID string) ([]NodePartition, error) {
+	var partitions []NodePartition
+	err := store.scanPrefix(fmt.Sprintf("partition-%s-", clusterID), func(partitionBytes []byte) error {
+		var partition NodePartition
+		if err := json.Unmarshal(partitionBytes, &partition); err != nil {
+			return err
+		}
+		partitions = append(partitions, partition)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return partitions, nil
+}
+
+func (store *CouchbaseStore) DeletePartition(clusterID string, nodeID string) error {
+	return store.remove(fmt.Sprintf("partition-%s-%s", clusterID, nodeID))
+}
+
+func (store *CouchbaseStore) DeletePartitions(clusterID string) error {
+	return store.removePrefix(fmt.Sprintf("partition-%s-", clusterID))
+}
+
+func (store *CouchbaseStore) PutThrottle(throttle NodeThrottle) error {
+	throttleKey := fmt.Sprintf("throttle-%s-%s", throttle.ClusterID, throttle.NodeID)
+	_, err := store.bucket.Upsert(throttleKey, throttle, 0)
+	return err
+}
+
+func (store *CouchbaseStore) GetThrottles(clusterID string) ([]NodeThrottle, error) {
+	var throttles []NodeThrottle
+	err := store.scanPrefix(fmt.Sprintf("throttle-%s-", clusterID), func(throttleBytes []byte) error {
+		var throttle NodeThrottle
+		if err := json.Unmarshal(throttleBytes, &throttle); err != nil {
+			return err
+		}
+		throttles = append(throttles, throttle)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return throttles, nil
+}
+
+func (store *CouchbaseStore) DeleteThrottle(clusterID string, nodeID string) error {
+	return store.remove(fmt.Sprintf("throttle-%s-%s", clusterID, nodeID))
+}
+
+func (store *CouchbaseStore) DeleteThrottles(clusterID string) error {
+	return store.removePrefix(fmt.Sprintf("throttle-%s-", clusterID))
+}
+
+func (store *CouchbaseStore) AppendClusterHistory(entry ClusterHistoryEntry) error {
+	historyKey := fmt.Sprintf("history-%s-%020d", entry.ClusterID, entry.Time.UnixNano())
+	_, err := store.bucket.Upsert(historyKey, entry, 0)
+	return err
+}
+
+func (store *CouchbaseStore) GetClusterHistory(clusterID string) ([]ClusterHistoryEntry, error) {
+	var history []ClusterHistoryEntry
+	err := store.scanPrefix(fmt.Sprintf("history-%s-", clusterID), func(entryBytes []byte) error {
+		var entry ClusterHistoryEntry
+		if err := json.Unmarshal(entryBytes, &entry); err != nil {
+			return err
+		}
+		history = append(history, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+func (store *CouchbaseStore) DeleteClusterHistory(clusterID string) error {
+	return store.removePrefix(fmt.Sprintf("history-%s-", clusterID))
+}
+
+func (store *CouchbaseStore) PutScheduledAllocation(schedule ScheduledAllocation) error {
+	_, err := store.bucket.Upsert(fmt.Sprintf("schedule-%s", schedule.ID), schedule, 0)
+	return err
+}
+
+func (store *CouchbaseStore) GetScheduledAllocation(scheduleID string) (ScheduledAllocation, error) {
+	var schedule ScheduledAllocation
+	_, err := store.bucket.Get(fmt.Sprintf("schedule-%s", scheduleID), &schedule)
+	if gocb.IsKeyNotFoundError(err) {
+		return ScheduledAllocation{}, notFoundf("scheduled allocation %s does not exist", scheduleID)
+	} else if err != nil {
+		return ScheduledAllocation{}, err
+	}
+
+	return schedule, nil
+}
+
+func (store *CouchbaseStore) GetScheduledAllocations() ([]ScheduledAllocation, error) {
+	var schedules []ScheduledAllocation
+	err := store.scanPrefix("schedule-", func(scheduleBytes []byte) error {
+		var schedule ScheduledAllocation
+		if err := json.Unmarshal(scheduleBytes, &schedule); err != nil {
+			return err
+		}
+		schedules = append(schedules, schedule)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (store *CouchbaseStore) DeleteScheduledAllocation(scheduleID string) error {
+	return store.remove(fmt.Sprintf("schedule-%s", scheduleID))
+}
+
+func (store *CouchbaseStore) PutImportedContainer(imported ImportedContainer) error {
+	importKey := fmt.Sprintf("import-%s-%s", imported.ClusterID, imported.ContainerID)
+	_, err := store.bucket.Upsert(importKey, imported, 0)
+	return err
+}
+
+func (store *CouchbaseStore) GetImportedContainers() ([]ImportedContainer, error) {
+	var imports []ImportedContainer
+	err := store.scanPrefix("import-", func(importBytes []byte) error {
+		var imported ImportedContainer
+		if err := json.Unmarshal(importBytes, &imported); err != nil {
+			return err
+		}
+		imports = append(imports, imported)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return imports, nil
+}
+
+func (store *CouchbaseStore) DeleteImportedContainers(clusterID string) error {
+	return store.removePrefix(fmt.Sprintf("import-%s-", clusterID))
+}
@@ -0,0 +1,51 @@
+package daemon
+
+import (
+	"strings"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+type clusterTaskJSON struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+func parseCriticalTasks(list string) []string {
+	var tasks []string
+	for _, task := range strings.Split(list, ",") {
+		if task = strings.TrimSpace(task); task != "" {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// runningCriticalTask returns the type of a critical-tasks task which is running on the cluster, or an empty
+// string if there is none.  A cluster which cannot be queried, such as one which was never set up, has none.
+func runningCriticalTask(cluster *Cluster) string {
+	taskTypes := parseCriticalTasks(getConfig().criticalTasks)
+	if len(taskTypes) == 0 {
+		return ""
+	}
+
+	for _, node := range cluster.Nodes {
+		if node.State != "running" {
+			continue
+		}
+
+		var tasks []clusterTaskJSON
+		if err := getClusterRest(node, helper.PTasks, &tasks); err != nil {
+			continue
+		}
+
+		for _, task := range tasks {
+			if task.Status == "running" && containsString(taskTypes, task.Type) {
+				return task.Type
+			}
+		}
+		return ""
+	}
+
+	return ""
+}
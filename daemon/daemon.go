@@ -3,9 +3,13 @@ package daemon
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	goflag "flag"
@@ -25,16 +29,181 @@ import (
 var defaultCfgFileName = ".cbdynclusterd.toml"
 
 var docker *client.Client
-var metaStore *MetaDataStore
+var metaStore Store
 var systemCtx context.Context
 
-var dockerRegistry = "dockerhub.build.couchbase.com"
+// defaultCleanupInterval is used when cleanup-interval is zero or unset
+const defaultCleanupInterval = 5 * time.Minute
+
 var dockerHost = "/var/run/docker.sock"
-var dnsSvcHost = ""
+var seccompProfile = ""
+var apparmorProfile = ""
+var instanceID = ""
+var metaStoreBackend = ""
+var metaStoreConnStr = ""
+var metaStoreBucket = ""
+var metaStoreUsername = ""
+var metaStorePassword = ""
+
+// reloadableConfig holds the settings which can be changed while the daemon is running.  A new one is built each
+// time the configuration is reloaded and swapped in whole, so readers always see a consistent set of settings
+// rather than one which is part way through being reloaded.
+type reloadableConfig struct {
+	dockerRegistry           string
+	dnsSvcHost               string
+	tombstoneRetention       time.Duration
+	tombstoneArchivePath     string
+	admissionWebhook         string
+	admissionWebhookTimeout  time.Duration
+	admissionWebhookFailOpen bool
+	cleanupInterval          time.Duration
+	maxClusterNodes          int
+	maxClusterTimeout        time.Duration
+	readinessProbe           string
+	readinessProbeInterval   time.Duration
+	readinessProbeTimeout    time.Duration
+	allocationRetries        int
+	allocationRetryBackoff   time.Duration
+	maxResponseSize          int
+	pullTimeout              time.Duration
+	containerStartTimeout    time.Duration
+	setupTimeout             time.Duration
+	maxHostNodes             int
+	configFileDir            string
+	longLivedClusterTimeout  time.Duration
+	defaultStopSignal        string
+	dnsServers               string
+	allocLogDir              string
+	auditInterval            time.Duration
+	drainTimeout             time.Duration
+	ipRange                  string
+	startupAttempts          int
+	startupRetryDelay        time.Duration
+	detectSystemdResolved    bool
+	reapOrphans              bool
+	dockerRetries            int
+	transientErrors          string
+	permanentErrors          string
+	cleanupGrace             time.Duration
+	stopTimeout              time.Duration
+	forceKillAfter           time.Duration
+	criticalTasks            string
+	allowedRegistries        string
+	nodeMemoryMB             int
+	nodeCPUs                 float64
+	nodeCPUShares            int
+	logFormat                string
+	logLevel                 string
+	terminationGrace         time.Duration
+	maxParallelNodes         int
+	defaultClusterTimeout    time.Duration
+
+	// These are loaded from the tables of the config file rather than from flags
+	ownerDefaults           map[string]OwnerDefaults
+	ownerMaxClusterTimeouts map[string]time.Duration
+	namespaces              map[string]NamespaceConfig
+	ownerNamespaces         map[string]string
+	apiTokens               []APITokenConfig
+	envTags                 map[string]string
+}
+
+// defaultConfig is the configuration used for any setting which is not configured
+var defaultConfig = reloadableConfig{
+	dockerRegistry:          "dockerhub.build.couchbase.com",
+	tombstoneRetention:      30 * 24 * time.Hour,
+	admissionWebhookTimeout: 5 * time.Second,
+	cleanupInterval:         defaultCleanupInterval,
+	maxClusterNodes:         10,
+	maxClusterTimeout:       2 * 7 * 24 * time.Hour,
+	readinessProbe:          ReadinessProbeHTTP,
+	readinessProbeInterval:  1 * time.Second,
+	readinessProbeTimeout:   5 * time.Minute,
+	allocationRetryBackoff:  10 * time.Second,
+	maxResponseSize:         512 * 1024 * 1024,
+	pullTimeout:             30 * time.Minute,
+	containerStartTimeout:   5 * time.Minute,
+	setupTimeout:            15 * time.Minute,
+	longLivedClusterTimeout: 24 * time.Hour,
+	allocLogDir:             "./alloc-logs",
+	auditInterval:           1 * time.Hour,
+	drainTimeout:            10 * time.Minute,
+	startupAttempts:         5,
+	startupRetryDelay:       2 * time.Second,
+	detectSystemdResolved:   true,
+	reapOrphans:             true,
+	dockerRetries:           2,
+	cleanupGrace:            10 * time.Minute,
+	stopTimeout:             30 * time.Second,
+	forceKillAfter:          1 * time.Hour,
+	criticalTasks:           "rebalance,bucket_compaction,view_compaction",
+	logFormat:               LogFormatText,
+	logLevel:                "info",
+	maxParallelNodes:        8,
+	defaultClusterTimeout:   1 * time.Hour,
+}
+
+// liveConfig holds the *reloadableConfig in effect, it is only read through getConfig
+var liveConfig atomic.Value
+
+func getConfig() *reloadableConfig {
+	return liveConfig.Load().(*reloadableConfig)
+}
+
+// configLock serializes configuration reloads
+var configLock sync.Mutex
+
+// configFlags are the flags the configuration is resolved against, these are kept so the configuration can be
+// resolved again when it is reloaded
+var configFlags *pflag.FlagSet
 
 var cfgFileFlag string
 var dockerRegistryFlag, dockerHostFlag, dnsSvcHostFlag string
 var dockerPortFlag int32
+var tombstoneRetentionFlag time.Duration
+var tombstoneArchivePathFlag string
+var admissionWebhookFlag string
+var admissionWebhookTimeoutFlag time.Duration
+var admissionWebhookFailOpenFlag bool
+var cleanupIntervalFlag time.Duration
+var maxClusterNodesFlag int
+var maxClusterTimeoutFlag time.Duration
+var readinessProbeFlag string
+var readinessProbeIntervalFlag, readinessProbeTimeoutFlag time.Duration
+var seccompProfileFlag, apparmorProfileFlag string
+var allocationRetriesFlag int
+var allocationRetryBackoffFlag time.Duration
+var instanceIDFlag string
+var maxResponseSizeFlag int
+var pullTimeoutFlag, containerStartTimeoutFlag, setupTimeoutFlag time.Duration
+var maxHostNodesFlag int
+var configFileDirFlag string
+var longLivedClusterTimeoutFlag time.Duration
+var defaultStopSignalFlag string
+var dnsServersFlag string
+var allocLogDirFlag string
+var auditIntervalFlag time.Duration
+var drainTimeoutFlag time.Duration
+var ipRangeFlag string
+var startupAttemptsFlag int
+var startupRetryDelayFlag time.Duration
+var detectSystemdResolvedFlag bool
+var reapOrphansFlag bool
+var dockerRetriesFlag int
+var transientErrorsFlag, permanentErrorsFlag string
+var cleanupGraceFlag time.Duration
+var stopTimeoutFlag, forceKillAfterFlag time.Duration
+var criticalTasksFlag string
+var allowedRegistriesFlag string
+var nodeMemoryMBFlag int
+var nodeCPUsFlag float64
+var nodeCPUSharesFlag int
+var logFormatFlag, logLevelFlag string
+var terminationGraceFlag time.Duration
+var maxParallelNodesFlag int
+var defaultClusterTimeoutFlag time.Duration
+var networkNameFlag string
+var metaStoreBackendFlag, metaStoreConnStrFlag, metaStoreBucketFlag string
+var metaStoreUsernameFlag, metaStorePasswordFlag string
 
 var rootCmd = &cobra.Command{
 	Use:   "cbdynclusterd",
@@ -54,14 +223,72 @@ func Execute() {
 }
 
 func init() {
+	initialConfig := defaultConfig
+	liveConfig.Store(&initialConfig)
+
 	cobra.OnInitialize(initConfig)
 
 	pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
 	goflag.CommandLine.Parse([]string{})
 	rootCmd.PersistentFlags().StringVar(&cfgFileFlag, "config", "", "config file (default is $HOME/"+defaultCfgFileName+")")
-	rootCmd.PersistentFlags().StringVar(&dockerRegistryFlag, "docker-registry", dockerRegistry, "docker registry to pull/push images")
+	rootCmd.PersistentFlags().StringVar(&dockerRegistryFlag, "docker-registry", defaultConfig.dockerRegistry, "docker registry to pull/push images")
 	rootCmd.PersistentFlags().StringVar(&dockerHostFlag, "docker-host", dockerHost, "docker host where containers are running (i.e. tcp://127.0.0.1:2376)")
-	rootCmd.PersistentFlags().StringVar(&dnsSvcHostFlag, "dns-host", dnsSvcHost, "Restful DNS server IP")
+	rootCmd.PersistentFlags().StringVar(&dnsSvcHostFlag, "dns-host", defaultConfig.dnsSvcHost, "Restful DNS server IP")
+	rootCmd.PersistentFlags().DurationVar(&tombstoneRetentionFlag, "tombstone-retention", defaultConfig.tombstoneRetention, "how long to keep tombstones of killed clusters (0 keeps them forever)")
+	rootCmd.PersistentFlags().StringVar(&tombstoneArchivePathFlag, "tombstone-archive", defaultConfig.tombstoneArchivePath, "JSONL file to archive tombstones to before they are swept")
+	rootCmd.PersistentFlags().StringVar(&admissionWebhookFlag, "admission-webhook", defaultConfig.admissionWebhook, "URL which must approve every cluster allocation")
+	rootCmd.PersistentFlags().DurationVar(&admissionWebhookTimeoutFlag, "admission-webhook-timeout", defaultConfig.admissionWebhookTimeout, "how long to wait for the admission webhook")
+	rootCmd.PersistentFlags().BoolVar(&admissionWebhookFailOpenFlag, "admission-webhook-fail-open", defaultConfig.admissionWebhookFailOpen, "allow allocations when the admission webhook cannot be reached")
+	rootCmd.PersistentFlags().DurationVar(&cleanupIntervalFlag, "cleanup-interval", defaultConfig.cleanupInterval, "how often to clean up expired clusters")
+	rootCmd.PersistentFlags().IntVar(&maxClusterNodesFlag, "max-cluster-nodes", defaultConfig.maxClusterNodes, "maximum number of nodes in a single cluster")
+	rootCmd.PersistentFlags().DurationVar(&maxClusterTimeoutFlag, "max-cluster-timeout", defaultConfig.maxClusterTimeout, "maximum timeout a cluster can be allocated for")
+	rootCmd.PersistentFlags().DurationVar(&defaultClusterTimeoutFlag, "default-timeout", defaultConfig.defaultClusterTimeout, "timeout of clusters whose request and owner defaults do not give one, at most max-cluster-timeout")
+	rootCmd.PersistentFlags().StringVar(&readinessProbeFlag, "readiness-probe", defaultConfig.readinessProbe, "how to decide a node is ready when waiting for a cluster (tcp or http)")
+	rootCmd.PersistentFlags().DurationVar(&readinessProbeIntervalFlag, "readiness-probe-interval", defaultConfig.readinessProbeInterval, "how often to probe nodes when waiting for a cluster")
+	rootCmd.PersistentFlags().DurationVar(&readinessProbeTimeoutFlag, "readiness-probe-timeout", defaultConfig.readinessProbeTimeout, "how long to wait for a cluster to become ready")
+	rootCmd.PersistentFlags().IntVar(&allocationRetriesFlag, "allocation-retries", defaultConfig.allocationRetries, "how many times to retry an allocation which failed for a transient reason")
+	rootCmd.PersistentFlags().DurationVar(&allocationRetryBackoffFlag, "allocation-retry-backoff", defaultConfig.allocationRetryBackoff, "how long to wait before the first allocation retry, this doubles with each retry")
+	rootCmd.PersistentFlags().StringVar(&seccompProfileFlag, "seccomp-profile", seccompProfile, "path to a seccomp profile to apply to node containers")
+	rootCmd.PersistentFlags().StringVar(&apparmorProfileFlag, "apparmor-profile", apparmorProfile, "name of an apparmor profile to apply to node containers")
+	rootCmd.PersistentFlags().IntVar(&maxResponseSizeFlag, "max-response-size", defaultConfig.maxResponseSize, "maximum number of bytes returned by the log and inspect endpoints")
+	rootCmd.PersistentFlags().DurationVar(&pullTimeoutFlag, "pull-timeout", defaultConfig.pullTimeout, "how long pulling or building the image for a cluster may take")
+	rootCmd.PersistentFlags().DurationVar(&containerStartTimeoutFlag, "container-start-timeout", defaultConfig.containerStartTimeout, "how long creating and starting the containers of a cluster may take")
+	rootCmd.PersistentFlags().DurationVar(&setupTimeoutFlag, "setup-timeout", defaultConfig.setupTimeout, "how long setting up couchbase server on a cluster may take")
+	rootCmd.PersistentFlags().IntVar(&maxHostNodesFlag, "max-host-nodes", defaultConfig.maxHostNodes, "number of nodes the docker host has capacity for, used to measure free node slots when reclaiming (0 for unknown)")
+	rootCmd.PersistentFlags().StringVar(&configFileDirFlag, "config-file-dir", defaultConfig.configFileDir, "directory node config files must be in, node config files are disabled if empty")
+	rootCmd.PersistentFlags().DurationVar(&longLivedClusterTimeoutFlag, "long-lived-cluster-timeout", defaultConfig.longLivedClusterTimeout, "clusters allocated for at least this long run their nodes with an init process by default")
+	rootCmd.PersistentFlags().StringVar(&defaultStopSignalFlag, "stop-signal", defaultConfig.defaultStopSignal, "signal sent to node containers when they are stopped, the image's default is used if empty")
+	rootCmd.PersistentFlags().StringVar(&dnsServersFlag, "dns-servers", defaultConfig.dnsServers, "comma separated DNS servers given to containers in place of those inherited from the docker host")
+	rootCmd.PersistentFlags().BoolVar(&detectSystemdResolvedFlag, "detect-systemd-resolved", defaultConfig.detectSystemdResolved, "give containers systemd-resolved's upstream DNS servers when the docker host's resolv.conf only points at its loopback stub")
+	rootCmd.PersistentFlags().StringVar(&allocLogDirFlag, "alloc-log-dir", defaultConfig.allocLogDir, "directory each cluster's allocation log is written to, allocation logs are disabled if empty")
+	rootCmd.PersistentFlags().DurationVar(&auditIntervalFlag, "audit-interval", defaultConfig.auditInterval, "how often to audit for clusters alive for longer than max-cluster-timeout")
+	rootCmd.PersistentFlags().DurationVar(&drainTimeoutFlag, "drain-timeout", defaultConfig.drainTimeout, "how long shutdown waits for in-flight allocations to complete before closing the server")
+	rootCmd.PersistentFlags().StringVar(&ipRangeFlag, "ip-range", defaultConfig.ipRange, "CIDR range of the node network the daemon assigns container addresses from itself, docker assigns them if empty")
+	rootCmd.PersistentFlags().IntVar(&startupAttemptsFlag, "startup-attempts", defaultConfig.startupAttempts, "how many times to try reaching docker and the node network at startup")
+	rootCmd.PersistentFlags().DurationVar(&startupRetryDelayFlag, "startup-retry-delay", defaultConfig.startupRetryDelay, "how long to wait before retrying to reach docker at startup, this doubles with each retry")
+	rootCmd.PersistentFlags().IntVar(&dockerRetriesFlag, "docker-retries", defaultConfig.dockerRetries, "how many times to retry a docker call which failed for a transient reason when killing and cleaning up clusters")
+	rootCmd.PersistentFlags().StringVar(&transientErrorsFlag, "transient-errors", defaultConfig.transientErrors, "comma separated error message fragments to retry, in addition to the built in ones")
+	rootCmd.PersistentFlags().StringVar(&permanentErrorsFlag, "permanent-errors", defaultConfig.permanentErrors, "comma separated error message fragments to never retry, these take precedence over transient-errors")
+	rootCmd.PersistentFlags().DurationVar(&cleanupGraceFlag, "cleanup-grace", defaultConfig.cleanupGrace, "how long past its timeout cleanup waits for an expired cluster's critical tasks to finish, 0 kills it regardless")
+	rootCmd.PersistentFlags().DurationVar(&stopTimeoutFlag, "stop-timeout", defaultConfig.stopTimeout, "how long a node is given to stop gracefully before it is killed and removed forcefully")
+	rootCmd.PersistentFlags().DurationVar(&forceKillAfterFlag, "force-kill-after", defaultConfig.forceKillAfter, "how long past its timeout cleanup kills an expired cluster forcefully rather than stopping it, 0 never forces")
+	rootCmd.PersistentFlags().StringVar(&criticalTasksFlag, "critical-tasks", defaultConfig.criticalTasks, "comma separated couchbase task types which defer killing an expired cluster while they are running")
+	rootCmd.PersistentFlags().StringVar(&allowedRegistriesFlag, "allowed-registries", defaultConfig.allowedRegistries, "comma separated registries clusters may pull their images from, in addition to docker-registry")
+	rootCmd.PersistentFlags().BoolVar(&reapOrphansFlag, "reap-orphans", defaultConfig.reapOrphans, "remove containers this daemon created for clusters the meta-data store has no record of during cleanup")
+	rootCmd.PersistentFlags().IntVar(&nodeMemoryMBFlag, "node-memory-mb", defaultConfig.nodeMemoryMB, "memory limit in megabytes of nodes which do not request their own, 0 is unlimited")
+	rootCmd.PersistentFlags().Float64Var(&nodeCPUsFlag, "node-cpus", defaultConfig.nodeCPUs, "how many CPUs nodes which do not request their own limit may use, such as 1.5, 0 is unlimited")
+	rootCmd.PersistentFlags().IntVar(&nodeCPUSharesFlag, "node-cpu-shares", defaultConfig.nodeCPUShares, "relative CPU weight of nodes which do not request their own, 0 is docker's default of 1024")
+	rootCmd.PersistentFlags().StringVar(&logFormatFlag, "log-format", defaultConfig.logFormat, "format of the daemon's logs, text for human-readable logs or json for structured logs")
+	rootCmd.PersistentFlags().StringVar(&logLevelFlag, "log-level", defaultConfig.logLevel, "lowest level of messages which are logged, one of debug, info, warn or error")
+	rootCmd.PersistentFlags().DurationVar(&terminationGraceFlag, "termination-grace", defaultConfig.terminationGrace, "how long deleted clusters keep running and can be revived before they are killed, 0 kills them immediately")
+	rootCmd.PersistentFlags().IntVar(&maxParallelNodesFlag, "max-parallel-nodes", defaultConfig.maxParallelNodes, "how many node images are pulled and containers started at once while allocating a cluster")
+	rootCmd.PersistentFlags().StringVar(&networkNameFlag, "network", NetworkName, "docker network node containers are attached to, such as a macvlan network or a bridge network for local testing")
+	rootCmd.PersistentFlags().StringVar(&metaStoreBackendFlag, "meta-store", metaStoreBackend, "where cluster meta-data is kept, local (in ./data) or couchbase to share it between daemons")
+	rootCmd.PersistentFlags().StringVar(&metaStoreConnStrFlag, "meta-store-connstr", metaStoreConnStr, "connection string of the couchbase cluster meta-data is kept in (i.e. couchbase://10.0.0.1)")
+	rootCmd.PersistentFlags().StringVar(&metaStoreBucketFlag, "meta-store-bucket", metaStoreBucket, "bucket meta-data is kept in, it must have a primary index")
+	rootCmd.PersistentFlags().StringVar(&metaStoreUsernameFlag, "meta-store-username", metaStoreUsername, "username to authenticate to the couchbase meta-data store with")
+	rootCmd.PersistentFlags().StringVar(&metaStorePasswordFlag, "meta-store-password", metaStorePassword, "password to authenticate to the couchbase meta-data store with")
+	rootCmd.PersistentFlags().StringVar(&instanceIDFlag, "instance-id", instanceID, "identifier labelled onto every container this daemon creates, generated at startup if empty")
 
 	rootCmd.PersistentFlags().Int32Var(&dockerPortFlag, "docker-port", 0, "")
 	rootCmd.PersistentFlags().MarkDeprecated("docker-port", "Deprecated flag to specify the port of the docker host")
@@ -96,34 +323,443 @@ func initConfig() {
 	viper.AutomaticEnv()
 	viper.ReadInConfig()
 
+	configFlags = rootCmd.PersistentFlags()
+	readConfigArgs()
+
+	dockerHost = dockerHostFlag
+	if dockerPortFlag > 0 {
+		dockerHost = fmt.Sprintf("tcp://%s:%d", dockerHostFlag, dockerPortFlag)
+	}
+	seccompProfile = seccompProfileFlag
+	apparmorProfile = apparmorProfileFlag
+	instanceID = instanceIDFlag
+	if networkNameFlag != "" {
+		NetworkName = networkNameFlag
+	}
+	metaStoreBackend = metaStoreBackendFlag
+	metaStoreConnStr = metaStoreConnStrFlag
+	metaStoreBucket = metaStoreBucketFlag
+	metaStoreUsername = metaStoreUsernameFlag
+	metaStorePassword = metaStorePasswordFlag
+
+	applyReloadableConfig(false)
+}
+
+// readConfigArgs resolves every setting from the command line flags and the config file into the flag variables,
+// flags which were explicitly passed take priority over the config file.
+func readConfigArgs() {
+	// Settings missing from the config file, such as those added since it was created, keep their flag default
 	getStringArg := func(arg string) string {
-		if rootCmd.PersistentFlags().Changed(arg) {
-			val, _ := rootCmd.PersistentFlags().GetString(arg)
+		if configFlags.Changed(arg) || !viper.IsSet(arg) {
+			val, _ := configFlags.GetString(arg)
 			return val
 		}
 		return viper.GetString(arg)
 	}
 
 	getInt32Arg := func(arg string) int32 {
-		if rootCmd.PersistentFlags().Changed(arg) {
-			val, _ := rootCmd.PersistentFlags().GetInt32(arg)
+		if configFlags.Changed(arg) || !viper.IsSet(arg) {
+			val, _ := configFlags.GetInt32(arg)
 			return val
 		}
 		return viper.GetInt32(arg)
 	}
 
+	getIntArg := func(arg string) int {
+		if configFlags.Changed(arg) || !viper.IsSet(arg) {
+			val, _ := configFlags.GetInt(arg)
+			return val
+		}
+		return viper.GetInt(arg)
+	}
+
+	getBoolArg := func(arg string) bool {
+		if configFlags.Changed(arg) || !viper.IsSet(arg) {
+			val, _ := configFlags.GetBool(arg)
+			return val
+		}
+		return viper.GetBool(arg)
+	}
+
+	getFloat64Arg := func(arg string) float64 {
+		if configFlags.Changed(arg) || !viper.IsSet(arg) {
+			val, _ := configFlags.GetFloat64(arg)
+			return val
+		}
+		return viper.GetFloat64(arg)
+	}
+
+	getDurationArg := func(arg string) time.Duration {
+		if configFlags.Changed(arg) || !viper.IsSet(arg) {
+			val, _ := configFlags.GetDuration(arg)
+			return val
+		}
+		return viper.GetDuration(arg)
+	}
+
 	dockerRegistryFlag = getStringArg("docker-registry")
 	dockerHostFlag = getStringArg("docker-host")
 	dockerPortFlag = getInt32Arg("docker-port")
 	dnsSvcHostFlag = getStringArg("dns-host")
+	tombstoneRetentionFlag = getDurationArg("tombstone-retention")
+	tombstoneArchivePathFlag = getStringArg("tombstone-archive")
+	admissionWebhookFlag = getStringArg("admission-webhook")
+	admissionWebhookTimeoutFlag = getDurationArg("admission-webhook-timeout")
+	admissionWebhookFailOpenFlag = getBoolArg("admission-webhook-fail-open")
+	cleanupIntervalFlag = getDurationArg("cleanup-interval")
+	maxClusterNodesFlag = getIntArg("max-cluster-nodes")
+	maxClusterTimeoutFlag = getDurationArg("max-cluster-timeout")
+	defaultClusterTimeoutFlag = getDurationArg("default-timeout")
+	readinessProbeFlag = getStringArg("readiness-probe")
+	if readinessProbeFlag == "" {
+		readinessProbeFlag = ReadinessProbeHTTP
+	}
+	readinessProbeIntervalFlag = getDurationArg("readiness-probe-interval")
+	readinessProbeTimeoutFlag = getDurationArg("readiness-probe-timeout")
+	allocationRetriesFlag = getIntArg("allocation-retries")
+	allocationRetryBackoffFlag = getDurationArg("allocation-retry-backoff")
+	seccompProfileFlag = getStringArg("seccomp-profile")
+	apparmorProfileFlag = getStringArg("apparmor-profile")
+	instanceIDFlag = getStringArg("instance-id")
+	maxResponseSizeFlag = getIntArg("max-response-size")
+	pullTimeoutFlag = getDurationArg("pull-timeout")
+	containerStartTimeoutFlag = getDurationArg("container-start-timeout")
+	setupTimeoutFlag = getDurationArg("setup-timeout")
+	maxHostNodesFlag = getIntArg("max-host-nodes")
+	configFileDirFlag = getStringArg("config-file-dir")
+	longLivedClusterTimeoutFlag = getDurationArg("long-lived-cluster-timeout")
+	defaultStopSignalFlag = getStringArg("stop-signal")
+	dnsServersFlag = getStringArg("dns-servers")
+	allocLogDirFlag = getStringArg("alloc-log-dir")
+	auditIntervalFlag = getDurationArg("audit-interval")
+	drainTimeoutFlag = getDurationArg("drain-timeout")
+	ipRangeFlag = getStringArg("ip-range")
+	startupAttemptsFlag = getIntArg("startup-attempts")
+	startupRetryDelayFlag = getDurationArg("startup-retry-delay")
+	detectSystemdResolvedFlag = getBoolArg("detect-systemd-resolved")
+	reapOrphansFlag = getBoolArg("reap-orphans")
+	dockerRetriesFlag = getIntArg("docker-retries")
+	transientErrorsFlag = getStringArg("transient-errors")
+	permanentErrorsFlag = getStringArg("permanent-errors")
+	cleanupGraceFlag = getDurationArg("cleanup-grace")
+	stopTimeoutFlag = getDurationArg("stop-timeout")
+	forceKillAfterFlag = getDurationArg("force-kill-after")
+	criticalTasksFlag = getStringArg("critical-tasks")
+	allowedRegistriesFlag = getStringArg("allowed-registries")
+	nodeMemoryMBFlag = getIntArg("node-memory-mb")
+	nodeCPUsFlag = getFloat64Arg("node-cpus")
+	nodeCPUSharesFlag = getIntArg("node-cpu-shares")
+	logFormatFlag = getStringArg("log-format")
+	logLevelFlag = getStringArg("log-level")
+	terminationGraceFlag = getDurationArg("termination-grace")
+	maxParallelNodesFlag = getIntArg("max-parallel-nodes")
+	networkNameFlag = getStringArg("network")
+	metaStoreBackendFlag = getStringArg("meta-store")
+	metaStoreConnStrFlag = getStringArg("meta-store-connstr")
+	metaStoreBucketFlag = getStringArg("meta-store-bucket")
+	metaStoreUsernameFlag = getStringArg("meta-store-username")
+	metaStorePasswordFlag = getStringArg("meta-store-password")
+}
 
-	dockerRegistry = dockerRegistryFlag
-	dockerHost = dockerHostFlag
-	dnsSvcHost = dnsSvcHostFlag
+// applyReloadableConfig builds the settings which can be changed while the daemon is running from the flag
+// variables and swaps them in, logging any values which changed.  Invalid values keep their current setting.
+func applyReloadableConfig(logChanges bool) {
+	current := getConfig()
 
+	if cleanupIntervalFlag == 0 {
+		cleanupIntervalFlag = defaultCleanupInterval
+	} else if cleanupIntervalFlag < 0 {
+		log.Printf("Ignoring invalid cleanup-interval `%s`", cleanupIntervalFlag)
+		cleanupIntervalFlag = current.cleanupInterval
+	}
+	if auditIntervalFlag <= 0 {
+		log.Printf("Ignoring invalid audit-interval `%s`", auditIntervalFlag)
+		auditIntervalFlag = current.auditInterval
+	}
+	if drainTimeoutFlag <= 0 {
+		log.Printf("Ignoring invalid drain-timeout `%s`", drainTimeoutFlag)
+		drainTimeoutFlag = current.drainTimeout
+	}
+	if err := validateIPRange(ipRangeFlag); err != nil {
+		log.Printf("Ignoring invalid ip-range `%s`: %s", ipRangeFlag, err)
+		ipRangeFlag = current.ipRange
+	}
+	if startupAttemptsFlag < 1 {
+		log.Printf("Ignoring invalid startup-attempts `%d`", startupAttemptsFlag)
+		startupAttemptsFlag = current.startupAttempts
+	}
+	if startupRetryDelayFlag <= 0 {
+		log.Printf("Ignoring invalid startup-retry-delay `%s`", startupRetryDelayFlag)
+		startupRetryDelayFlag = current.startupRetryDelay
+	}
+	if dockerRetriesFlag < 0 {
+		log.Printf("Ignoring invalid docker-retries `%d`", dockerRetriesFlag)
+		dockerRetriesFlag = current.dockerRetries
+	}
+	if cleanupGraceFlag < 0 {
+		log.Printf("Ignoring invalid cleanup-grace `%s`", cleanupGraceFlag)
+		cleanupGraceFlag = current.cleanupGrace
+	}
+	if stopTimeoutFlag <= 0 {
+		log.Printf("Ignoring invalid stop-timeout `%s`, it must be positive", stopTimeoutFlag)
+		stopTimeoutFlag = current.stopTimeout
+	}
+	if forceKillAfterFlag < 0 {
+		log.Printf("Ignoring invalid force-kill-after `%s`", forceKillAfterFlag)
+		forceKillAfterFlag = current.forceKillAfter
+	}
+	if nodeMemoryMBFlag < 0 {
+		log.Printf("Ignoring invalid node-memory-mb `%d`, it must be a positive number of megabytes", nodeMemoryMBFlag)
+		nodeMemoryMBFlag = current.nodeMemoryMB
+	}
+	if err := validateNodeCPUs(NodeOptions{CPUs: nodeCPUsFlag, CPUShares: int64(nodeCPUSharesFlag)}); err != nil {
+		log.Printf("Ignoring invalid node-cpus `%.2f` and node-cpu-shares `%d`: %s", nodeCPUsFlag, nodeCPUSharesFlag, err)
+		nodeCPUsFlag = current.nodeCPUs
+		nodeCPUSharesFlag = current.nodeCPUShares
+	}
+	if terminationGraceFlag < 0 {
+		log.Printf("Ignoring invalid termination-grace `%s`", terminationGraceFlag)
+		terminationGraceFlag = current.terminationGrace
+	}
+	if defaultClusterTimeoutFlag <= 0 || defaultClusterTimeoutFlag > maxClusterTimeoutFlag {
+		log.Printf("Ignoring invalid default-timeout `%s`, it must be positive and at most max-cluster-timeout", defaultClusterTimeoutFlag)
+		defaultClusterTimeoutFlag = current.defaultClusterTimeout
+	}
+	if maxParallelNodesFlag <= 0 {
+		log.Printf("Ignoring invalid max-parallel-nodes `%d`", maxParallelNodesFlag)
+		maxParallelNodesFlag = current.maxParallelNodes
+	}
+	if err := validateLogFormat(logFormatFlag); err != nil {
+		log.Printf("Ignoring invalid log-format `%s`: %s", logFormatFlag, err)
+		logFormatFlag = current.logFormat
+	}
+	parsedLogLevel, err := parseLogLevel(logLevelFlag)
+	if err != nil {
+		log.Printf("Ignoring invalid log-level `%s`: %s", logLevelFlag, err)
+		logLevelFlag = current.logLevel
+		parsedLogLevel, _ = parseLogLevel(current.logLevel)
+	}
+
+	readinessOpts := ReadinessOptions{
+		Probe:    readinessProbeFlag,
+		Interval: readinessProbeIntervalFlag,
+		Timeout:  readinessProbeTimeoutFlag,
+	}
+	if err := validateReadinessOptions(readinessOpts); err != nil {
+		log.Printf("Ignoring invalid readiness probe config: %s", err)
+		readinessProbeFlag = current.readinessProbe
+		readinessProbeIntervalFlag = current.readinessProbeInterval
+		readinessProbeTimeoutFlag = current.readinessProbeTimeout
+	}
+
+	if maxResponseSizeFlag <= 0 {
+		log.Printf("Ignoring invalid max-response-size `%d`", maxResponseSizeFlag)
+		maxResponseSizeFlag = current.maxResponseSize
+	}
+
+	if pullTimeoutFlag <= 0 {
+		log.Printf("Ignoring invalid pull-timeout `%s`", pullTimeoutFlag)
+		pullTimeoutFlag = current.pullTimeout
+	}
+	if containerStartTimeoutFlag <= 0 {
+		log.Printf("Ignoring invalid container-start-timeout `%s`", containerStartTimeoutFlag)
+		containerStartTimeoutFlag = current.containerStartTimeout
+	}
+	if setupTimeoutFlag <= 0 {
+		log.Printf("Ignoring invalid setup-timeout `%s`", setupTimeoutFlag)
+		setupTimeoutFlag = current.setupTimeout
+	}
+	if maxHostNodesFlag < 0 {
+		log.Printf("Ignoring invalid max-host-nodes `%d`", maxHostNodesFlag)
+		maxHostNodesFlag = current.maxHostNodes
+	}
+	if err := validateStopSignal(defaultStopSignalFlag); err != nil {
+		log.Printf("Ignoring invalid stop-signal `%s`", defaultStopSignalFlag)
+		defaultStopSignalFlag = current.defaultStopSignal
+	}
+	if err := validateDNSOptions(&DNSOptions{Servers: parseDNSServers(dnsServersFlag)}); err != nil {
+		log.Printf("Ignoring invalid dns-servers `%s`: %s", dnsServersFlag, err)
+		dnsServersFlag = current.dnsServers
+	}
+
+	logChange := func(key string, oldVal, newVal interface{}) {
+		if logChanges && fmt.Sprint(oldVal) != fmt.Sprint(newVal) {
+			log.Printf("Config %s changed from `%v` to `%v`", key, oldVal, newVal)
+		}
+	}
+
+	logChange("docker-registry", current.dockerRegistry, dockerRegistryFlag)
+	logChange("dns-host", current.dnsSvcHost, dnsSvcHostFlag)
+	logChange("tombstone-retention", current.tombstoneRetention, tombstoneRetentionFlag)
+	logChange("tombstone-archive", current.tombstoneArchivePath, tombstoneArchivePathFlag)
+	logChange("admission-webhook", current.admissionWebhook, admissionWebhookFlag)
+	logChange("admission-webhook-timeout", current.admissionWebhookTimeout, admissionWebhookTimeoutFlag)
+	logChange("admission-webhook-fail-open", current.admissionWebhookFailOpen, admissionWebhookFailOpenFlag)
+	logChange("cleanup-interval", current.cleanupInterval, cleanupIntervalFlag)
+	logChange("max-cluster-nodes", current.maxClusterNodes, maxClusterNodesFlag)
+	logChange("max-cluster-timeout", current.maxClusterTimeout, maxClusterTimeoutFlag)
+	logChange("default-timeout", current.defaultClusterTimeout, defaultClusterTimeoutFlag)
+	logChange("readiness-probe", current.readinessProbe, readinessProbeFlag)
+	logChange("readiness-probe-interval", current.readinessProbeInterval, readinessProbeIntervalFlag)
+	logChange("readiness-probe-timeout", current.readinessProbeTimeout, readinessProbeTimeoutFlag)
+	logChange("allocation-retries", current.allocationRetries, allocationRetriesFlag)
+	logChange("allocation-retry-backoff", current.allocationRetryBackoff, allocationRetryBackoffFlag)
+	logChange("max-response-size", current.maxResponseSize, maxResponseSizeFlag)
+	logChange("pull-timeout", current.pullTimeout, pullTimeoutFlag)
+	logChange("container-start-timeout", current.containerStartTimeout, containerStartTimeoutFlag)
+	logChange("setup-timeout", current.setupTimeout, setupTimeoutFlag)
+	logChange("max-host-nodes", current.maxHostNodes, maxHostNodesFlag)
+	logChange("config-file-dir", current.configFileDir, configFileDirFlag)
+	logChange("long-lived-cluster-timeout", current.longLivedClusterTimeout, longLivedClusterTimeoutFlag)
+	logChange("stop-signal", current.defaultStopSignal, defaultStopSignalFlag)
+	logChange("dns-servers", current.dnsServers, dnsServersFlag)
+	logChange("alloc-log-dir", current.allocLogDir, allocLogDirFlag)
+	logChange("audit-interval", current.auditInterval, auditIntervalFlag)
+	logChange("drain-timeout", current.drainTimeout, drainTimeoutFlag)
+	logChange("ip-range", current.ipRange, ipRangeFlag)
+	logChange("startup-attempts", current.startupAttempts, startupAttemptsFlag)
+	logChange("startup-retry-delay", current.startupRetryDelay, startupRetryDelayFlag)
+	logChange("detect-systemd-resolved", current.detectSystemdResolved, detectSystemdResolvedFlag)
+	logChange("reap-orphans", current.reapOrphans, reapOrphansFlag)
+	logChange("docker-retries", current.dockerRetries, dockerRetriesFlag)
+	logChange("transient-errors", current.transientErrors, transientErrorsFlag)
+	logChange("permanent-errors", current.permanentErrors, permanentErrorsFlag)
+	logChange("cleanup-grace", current.cleanupGrace, cleanupGraceFlag)
+	logChange("stop-timeout", current.stopTimeout, stopTimeoutFlag)
+	logChange("force-kill-after", current.forceKillAfter, forceKillAfterFlag)
+	logChange("critical-tasks", current.criticalTasks, criticalTasksFlag)
+	logChange("allowed-registries", current.allowedRegistries, allowedRegistriesFlag)
+	logChange("node-memory-mb", current.nodeMemoryMB, nodeMemoryMBFlag)
+	logChange("node-cpus", current.nodeCPUs, nodeCPUsFlag)
+	logChange("node-cpu-shares", current.nodeCPUShares, nodeCPUSharesFlag)
+	logChange("log-format", current.logFormat, logFormatFlag)
+	logChange("log-level", current.logLevel, logLevelFlag)
+	logChange("termination-grace", current.terminationGrace, terminationGraceFlag)
+	logChange("max-parallel-nodes", current.maxParallelNodes, maxParallelNodesFlag)
+
+	next := *current
+	next.dockerRegistry = dockerRegistryFlag
+	next.dnsSvcHost = dnsSvcHostFlag
+	next.tombstoneRetention = tombstoneRetentionFlag
+	next.tombstoneArchivePath = tombstoneArchivePathFlag
+	next.admissionWebhook = admissionWebhookFlag
+	next.admissionWebhookTimeout = admissionWebhookTimeoutFlag
+	next.admissionWebhookFailOpen = admissionWebhookFailOpenFlag
+	next.cleanupInterval = cleanupIntervalFlag
+	next.maxClusterNodes = maxClusterNodesFlag
+	next.maxClusterTimeout = maxClusterTimeoutFlag
+	next.defaultClusterTimeout = defaultClusterTimeoutFlag
+	next.readinessProbe = readinessProbeFlag
+	next.readinessProbeInterval = readinessProbeIntervalFlag
+	next.readinessProbeTimeout = readinessProbeTimeoutFlag
+	next.allocationRetries = allocationRetriesFlag
+	next.allocationRetryBackoff = allocationRetryBackoffFlag
+	next.maxResponseSize = maxResponseSizeFlag
+	next.pullTimeout = pullTimeoutFlag
+	next.containerStartTimeout = containerStartTimeoutFlag
+	next.setupTimeout = setupTimeoutFlag
+	next.maxHostNodes = maxHostNodesFlag
+	next.configFileDir = configFileDirFlag
+	next.longLivedClusterTimeout = longLivedClusterTimeoutFlag
+	next.defaultStopSignal = defaultStopSignalFlag
+	next.dnsServers = dnsServersFlag
+	next.allocLogDir = allocLogDirFlag
+	next.auditInterval = auditIntervalFlag
+	next.drainTimeout = drainTimeoutFlag
+	next.ipRange = ipRangeFlag
+	next.startupAttempts = startupAttemptsFlag
+	next.startupRetryDelay = startupRetryDelayFlag
+	next.detectSystemdResolved = detectSystemdResolvedFlag
+	next.reapOrphans = reapOrphansFlag
+	next.dockerRetries = dockerRetriesFlag
+	next.transientErrors = transientErrorsFlag
+	next.permanentErrors = permanentErrorsFlag
+	next.cleanupGrace = cleanupGraceFlag
+	next.stopTimeout = stopTimeoutFlag
+	next.forceKillAfter = forceKillAfterFlag
+	next.criticalTasks = criticalTasksFlag
+	next.allowedRegistries = allowedRegistriesFlag
+	next.nodeMemoryMB = nodeMemoryMBFlag
+	next.nodeCPUs = nodeCPUsFlag
+	next.nodeCPUShares = nodeCPUSharesFlag
+	next.logFormat = logFormatFlag
+	next.logLevel = logLevelFlag
+	next.terminationGrace = terminationGraceFlag
+	next.maxParallelNodes = maxParallelNodesFlag
+
+	// Tables which fail to load keep their current values, as with the settings above
+	if ownerDefaults, err := loadOwnerDefaults(); err != nil {
+		log.Printf("Failed to load owner defaults: %s", err)
+	} else {
+		next.ownerDefaults = ownerDefaults
+	}
+	if ownerMaxClusterTimeouts, err := loadOwnerLimits(); err != nil {
+		log.Printf("Failed to load owner limits: %s", err)
+	} else {
+		next.ownerMaxClusterTimeouts = ownerMaxClusterTimeouts
+	}
+	if namespaces, ownerNamespaces, err := loadNamespaces(); err != nil {
+		log.Printf("Failed to load namespaces: %s", err)
+	} else {
+		next.namespaces = namespaces
+		next.ownerNamespaces = ownerNamespaces
+	}
+	if apiTokens, err := loadAPITokens(); err != nil {
+		log.Printf("Failed to load api tokens: %s", err)
+	} else {
+		next.apiTokens = apiTokens
+	}
+	if envTags, err := loadEnvTags(); err != nil {
+		log.Printf("Failed to load env tags: %s", err)
+	} else {
+		next.envTags = envTags
+	}
+
+	liveConfig.Store(&next)
+	configureLogging(next.logFormat, parsedLogLevel)
+}
+
+// reloadConfig re-reads the config file and applies the settings which can be changed without a restart.  The
+// docker-host and docker-port settings are only read at startup since the docker connection is not re-created.
+func reloadConfig() error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	if err := viper.ReadInConfig(); err != nil {
+		log.Printf("Failed to reload config: %s", err)
+		return err
+	}
+
+	readConfigArgs()
+
+	newDockerHost := dockerHostFlag
 	if dockerPortFlag > 0 {
-		dockerHost = fmt.Sprintf("tcp://%s:%d", dockerHostFlag, dockerPortFlag)
+		newDockerHost = fmt.Sprintf("tcp://%s:%d", dockerHostFlag, dockerPortFlag)
 	}
+	if newDockerHost != dockerHost {
+		log.Printf("Config docker-host changed to `%s`, this requires a restart to take effect", newDockerHost)
+	}
+	if seccompProfileFlag != seccompProfile {
+		log.Printf("Config seccomp-profile changed to `%s`, this requires a restart to take effect", seccompProfileFlag)
+	}
+	if apparmorProfileFlag != apparmorProfile {
+		log.Printf("Config apparmor-profile changed to `%s`, this requires a restart to take effect", apparmorProfileFlag)
+	}
+	if instanceIDFlag != "" && instanceIDFlag != instanceID {
+		log.Printf("Config instance-id changed to `%s`, this requires a restart to take effect", instanceIDFlag)
+	}
+	if networkNameFlag != "" && networkNameFlag != NetworkName {
+		log.Printf("Config network changed to `%s`, this requires a restart to take effect", networkNameFlag)
+	}
+	if metaStoreBackendFlag != metaStoreBackend || metaStoreConnStrFlag != metaStoreConnStr || metaStoreBucketFlag != metaStoreBucket ||
+		metaStoreUsernameFlag != metaStoreUsername || metaStorePasswordFlag != metaStorePassword {
+		log.Printf("Config meta-store changed, this requires a restart to take effect")
+	}
+
+	applyReloadableConfig(true)
+
+	log.Printf("Configuration reloaded")
+	return nil
 }
 
 func createConfigFile(configFile string) error {
@@ -135,6 +771,61 @@ func createConfigFile(configFile string) error {
 	tmap.Set("docker-registry", dockerRegistryFlag)
 	tmap.Set("docker-host", dockerHostFlag)
 	tmap.Set("dns-host", dnsSvcHostFlag)
+	tmap.Set("tombstone-retention", tombstoneRetentionFlag.String())
+	tmap.Set("tombstone-archive", tombstoneArchivePathFlag)
+	tmap.Set("admission-webhook", admissionWebhookFlag)
+	tmap.Set("admission-webhook-timeout", admissionWebhookTimeoutFlag.String())
+	tmap.Set("admission-webhook-fail-open", admissionWebhookFailOpenFlag)
+	tmap.Set("cleanup-interval", cleanupIntervalFlag.String())
+	tmap.Set("max-cluster-nodes", maxClusterNodesFlag)
+	tmap.Set("max-cluster-timeout", maxClusterTimeoutFlag.String())
+	tmap.Set("default-timeout", defaultClusterTimeoutFlag.String())
+	tmap.Set("readiness-probe", readinessProbeFlag)
+	tmap.Set("readiness-probe-interval", readinessProbeIntervalFlag.String())
+	tmap.Set("readiness-probe-timeout", readinessProbeTimeoutFlag.String())
+	tmap.Set("allocation-retries", allocationRetriesFlag)
+	tmap.Set("allocation-retry-backoff", allocationRetryBackoffFlag.String())
+	tmap.Set("seccomp-profile", seccompProfileFlag)
+	tmap.Set("apparmor-profile", apparmorProfileFlag)
+	tmap.Set("instance-id", instanceIDFlag)
+	tmap.Set("max-response-size", maxResponseSizeFlag)
+	tmap.Set("pull-timeout", pullTimeoutFlag.String())
+	tmap.Set("container-start-timeout", containerStartTimeoutFlag.String())
+	tmap.Set("setup-timeout", setupTimeoutFlag.String())
+	tmap.Set("max-host-nodes", maxHostNodesFlag)
+	tmap.Set("config-file-dir", configFileDirFlag)
+	tmap.Set("long-lived-cluster-timeout", longLivedClusterTimeoutFlag.String())
+	tmap.Set("stop-signal", defaultStopSignalFlag)
+	tmap.Set("dns-servers", dnsServersFlag)
+	tmap.Set("alloc-log-dir", allocLogDirFlag)
+	tmap.Set("audit-interval", auditIntervalFlag.String())
+	tmap.Set("drain-timeout", drainTimeoutFlag.String())
+	tmap.Set("ip-range", ipRangeFlag)
+	tmap.Set("startup-attempts", startupAttemptsFlag)
+	tmap.Set("startup-retry-delay", startupRetryDelayFlag.String())
+	tmap.Set("detect-systemd-resolved", detectSystemdResolvedFlag)
+	tmap.Set("reap-orphans", reapOrphansFlag)
+	tmap.Set("docker-retries", dockerRetriesFlag)
+	tmap.Set("transient-errors", transientErrorsFlag)
+	tmap.Set("permanent-errors", permanentErrorsFlag)
+	tmap.Set("cleanup-grace", cleanupGraceFlag.String())
+	tmap.Set("stop-timeout", stopTimeoutFlag.String())
+	tmap.Set("force-kill-after", forceKillAfterFlag.String())
+	tmap.Set("critical-tasks", criticalTasksFlag)
+	tmap.Set("allowed-registries", allowedRegistriesFlag)
+	tmap.Set("node-memory-mb", nodeMemoryMBFlag)
+	tmap.Set("node-cpus", nodeCPUsFlag)
+	tmap.Set("node-cpu-shares", nodeCPUSharesFlag)
+	tmap.Set("log-format", logFormatFlag)
+	tmap.Set("log-level", logLevelFlag)
+	tmap.Set("termination-grace", terminationGraceFlag.String())
+	tmap.Set("max-parallel-nodes", maxParallelNodesFlag)
+	tmap.Set("network", networkNameFlag)
+	tmap.Set("meta-store", metaStoreBackendFlag)
+	tmap.Set("meta-store-connstr", metaStoreConnStrFlag)
+	tmap.Set("meta-store-bucket", metaStoreBucketFlag)
+	tmap.Set("meta-store-username", metaStoreUsernameFlag)
+	tmap.Set("meta-store-password", metaStorePasswordFlag)
 
 	if dockerPortFlag > 0 {
 		tmap.Set("docker-port", dockerPortFlag)
@@ -144,14 +835,24 @@ func createConfigFile(configFile string) error {
 }
 
 func openMeta() error {
-	meta := &MetaDataStore{}
-
-	err := meta.Open("./data")
-	if err != nil {
-		return err
+	switch metaStoreBackend {
+	case "", "local":
+		meta := &MetaDataStore{}
+		if err := meta.Open("./data"); err != nil {
+			return err
+		}
+		metaStore = meta
+	case "couchbase":
+		meta := &CouchbaseStore{}
+		if err := meta.Open(metaStoreConnStr, metaStoreBucket, metaStoreUsername, metaStorePassword); err != nil {
+			return err
+		}
+		log.Printf("Keeping meta-data in bucket %s of %s", metaStoreBucket, metaStoreConnStr)
+		metaStore = meta
+	default:
+		return fmt.Errorf("unknown meta-store `%s`, must be local or couchbase", metaStoreBackend)
 	}
 
-	metaStore = meta
 	return nil
 }
 
@@ -161,6 +862,11 @@ func connectDocker() error {
 		return err
 	}
 
+	// Creating the client does not contact docker, so make sure it is actually reachable
+	if _, err := cli.Ping(context.Background()); err != nil {
+		return err
+	}
+
 	docker = cli
 	return nil
 }
@@ -176,42 +882,127 @@ func connectRegistry(ctx context.Context, uri string) error {
 	return nil
 }
 
-func hasMacvlan0() bool {
+// hasNetwork returns whether the network node containers are attached to exists on the docker host
+func hasNetwork() (bool, error) {
 	networks, err := docker.NetworkList(context.Background(), types.NetworkListOptions{})
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 
 	for _, network := range networks {
-		if network.Name == "macvlan0" {
-			return true
+		if network.Name == NetworkName {
+			return true, nil
 		}
 	}
 
-	return false
+	return false, nil
 }
 
-func cleanupClusters() error {
-	log.Printf("Cleaning up dead clusters")
+// waitForDocker connects to docker and checks the node network exists, retrying with backoff since docker
+// may still be starting when the daemon is started on boot
+func waitForDocker() error {
+	backoff := getConfig().startupRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := connectDocker()
+		if err == nil {
+			// The node network is neccessary for the server instances we create to be available, normally this
+			// is a macvlan network which makes them available on the public network.
+			var found bool
+			found, err = hasNetwork()
+			if err == nil && !found {
+				err = fmt.Errorf("failed to locate `%s` network on docker host, configure the network to attach nodes to with network", NetworkName)
+			}
+		}
+		if err == nil {
+			return nil
+		}
 
-	clusters, err := getAllClusters(systemCtx)
+		if attempt >= getConfig().startupAttempts {
+			return fmt.Errorf("docker is not ready after %d attempts: %s", attempt, err)
+		}
+
+		slog.Warn("Docker is not ready, retrying", "operation", "startup", "retry_in", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func cleanupClusters() error {
+	slog.Info("Cleaning up dead clusters", "operation", "cleanup")
+	cleanupRunsTotal.Inc()
+	cleanupStart := time.Now()
+
+	var clusters []*Cluster
+	err := retryTransient(systemCtx, "list clusters for cleanup", func() error {
+		var err error
+		clusters, err = getAllClusters(systemCtx)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
-	var clustersToKill []string
+	if err := reconcilePendingClusters(clusters); err != nil {
+		slog.Error("Failed to kill incomplete clusters", "operation", "cleanup", "error", err)
+	}
+	if err := finalizeTerminatedClusters(clusters); err != nil {
+		slog.Error("Failed to kill terminated clusters", "operation", "cleanup", "error", err)
+	}
+
+	var clustersToKill []*Cluster
 	for _, cluster := range clusters {
+		// Pending clusters have either just been reconciled or are still being allocated, while terminating
+		// clusters are killed once their grace period is over.  Frozen clusters are never expired.
+		if cluster.Pending || !cluster.TerminateAt.IsZero() || cluster.Frozen {
+			continue
+		}
 		if cluster.Timeout.Before(time.Now()) {
-			clustersToKill = append(clustersToKill, cluster.ID)
+			clustersToKill = append(clustersToKill, cluster)
 		}
 	}
 
 	signal := make(chan error)
 
-	for _, clusterID := range clustersToKill {
-		go func(clusterID string) {
-			signal <- killCluster(systemCtx, clusterID)
-		}(clusterID)
+	for _, cluster := range clustersToKill {
+		go func(cluster *Cluster) {
+			clusterID := cluster.ID
+			unlock := lockClusterExpiry(clusterID)
+			defer unlock()
+
+			// The cluster may have been extended since the cluster list was fetched
+			meta, err := metaStore.GetClusterMeta(clusterID)
+			if err == nil && !meta.Timeout.Before(time.Now()) {
+				slog.Info("Not killing cluster as it was extended during cleanup", "operation", "cleanup",
+					"cluster_id", clusterID, "owner", cluster.Owner)
+				signal <- nil
+				return
+			}
+
+			// Killing a cluster mid-rebalance can leave it corrupted, so it is given until the grace period
+			// is over for its critical tasks to finish
+			if time.Now().Before(cluster.Timeout.Add(getConfig().cleanupGrace)) {
+				if task := runningCriticalTask(cluster); task != "" {
+					slog.Info("Deferring killing cluster until its critical task completes", "operation", "cleanup",
+						"cluster_id", clusterID, "owner", cluster.Owner, "task", task)
+					signal <- nil
+					return
+				}
+			}
+
+			// A cluster left running long past its timeout is likely stuck stopping, so it is forced this time
+			if getConfig().forceKillAfter > 0 && time.Now().After(cluster.Timeout.Add(getConfig().forceKillAfter)) {
+				slog.Info("Forcefully killing cluster long past its timeout", "operation", "cleanup",
+					"cluster_id", clusterID, "owner", cluster.Owner, "expired_for", time.Since(cluster.Timeout).Round(time.Second))
+				err = forceKillClusterWithReason(systemCtx, clusterID, KillReasonExpired)
+			} else {
+				err = killClusterWithReason(systemCtx, clusterID, KillReasonExpired)
+			}
+			if err == nil {
+				forgetClusterExpiryLock(clusterID)
+				cleanupKilledClustersTotal.WithLabelValues(cluster.Owner).Inc()
+			}
+			signal <- err
+		}(cluster)
 	}
 
 	var killError error
@@ -225,21 +1016,35 @@ func cleanupClusters() error {
 		return killError
 	}
 
+	slog.Info("Cleaned up dead clusters", "operation", "cleanup", "killed_clusters", len(clustersToKill),
+		"duration", time.Since(cleanupStart))
 	return nil
 }
 
 func getAndPrintClusters(ctx context.Context) {
 	clusters, err := getAllClusters(ctx)
 	if err != nil {
-		log.Printf("Failed to fetch all clusters: %+v", err)
-	} else {
+		slog.Error("Failed to fetch all clusters", "operation", "list_clusters", "error", err)
+	} else if getConfig().logFormat == LogFormatText {
+		// The text format keeps the aligned table, which is easier to read than a record per node
 		log.Printf("Clusters:")
 		for _, cluster := range clusters {
-			log.Printf("  %s [Owner: %s, Creator: %s, Timeout: %s]", cluster.ID, cluster.Owner, cluster.Creator, cluster.Timeout.Sub(time.Now()).Round(time.Second))
+			log.Printf("  %s [Owner: %s, Creator: %s, Created: %s, Timeout: %s]", cluster.ID, cluster.Owner, cluster.Creator,
+				cluster.CreatedAt.Format(time.RFC3339), cluster.Timeout.Sub(time.Now()).Round(time.Second))
 			for _, node := range cluster.Nodes {
 				log.Printf("    %-16s  %-20s %-10s %-20s", node.ContainerID, node.Name, node.InitialServerVersion, node.IPv4Address)
 			}
 		}
+	} else {
+		slog.Info("Clusters", "operation", "list_clusters", "count", len(clusters))
+		for _, cluster := range clusters {
+			slog.Info("Cluster", "cluster_id", cluster.ID, "owner", cluster.Owner, "creator", cluster.Creator,
+				"created_at", cluster.CreatedAt.Format(time.RFC3339), "expires_in", cluster.Timeout.Sub(time.Now()).Round(time.Second))
+			for _, node := range cluster.Nodes {
+				slog.Info("Cluster node", "cluster_id", cluster.ID, "node_id", node.ContainerID, "name", node.Name,
+					"version", node.InitialServerVersion, "ipv4_address", node.IPv4Address)
+			}
+		}
 	}
 }
 
@@ -247,45 +1052,121 @@ func startDaemon() {
 	// Open the meta-data database used to tracker ownership and expiry of clusters
 	err := openMeta()
 	if err != nil {
-		log.Printf("Failed to open meta db: %s", err)
+		slog.Error("Failed to open meta db", "operation", "startup", "error", err)
 		return
 	}
 
-	// Connect to docker
-	err = connectDocker()
+	// Make sure any configured security profiles are usable before we allocate anything with them
+	err = loadSecurityProfiles()
 	if err != nil {
-		log.Printf("Failed to connect to docker: %s", err)
+		slog.Error("Failed to load security profiles", "operation", "startup", "error", err)
 		return
 	}
 
-	// Check to make sure that the macvlan0 network is available in docker,
-	// this is neccessary for the server instances we create to be available
-	// on the public network.
-	if !hasMacvlan0() {
-		log.Printf("Failed to locate `macvlan0` network on docker host")
+	initDaemonIdentity()
+
+	// Connect to docker and make sure the node network is available
+	err = waitForDocker()
+	if err != nil {
+		slog.Error("Failed to connect to docker", "operation", "startup", "error", err)
 		return
 	}
 
 	// Create a system context to use for system actions (like cleanups)
 	systemCtx = NewContext(context.Background(), "system", true)
 
+	// Nothing is being allocated yet, so any pending cluster was left behind by a crash
+	clusters, err := getAllClusters(systemCtx)
+	if err == nil {
+		err = reconcilePendingClusters(clusters)
+	}
+	if err != nil {
+		slog.Error("Failed to kill incomplete clusters", "operation", "startup", "error", err)
+	}
+
 	shutdownSig := make(chan struct{})
 	cleanupClosedSig := make(chan struct{})
-
-	// Start our cleanup routine which automatically cleans up clusters every 5 minutes
+	schedulerShutdownSig := make(chan struct{})
+	schedulerClosedSig := make(chan struct{})
+	auditShutdownSig := make(chan struct{})
+	auditClosedSig := make(chan struct{})
+
+	// Start our cleanup routine which automatically cleans up clusters every cleanup interval
+	slog.Info("Allocating clusters with timeouts", "operation", "startup", "default_timeout", getConfig().defaultClusterTimeout,
+		"max_timeout", getConfig().maxClusterTimeout)
+	slog.Info("Cleaning up expired clusters periodically", "operation", "cleanup", "interval", getConfig().cleanupInterval)
 	go func() {
 		for {
 			select {
 			case <-shutdownSig:
 				cleanupClosedSig <- struct{}{}
 				return
-			case <-time.After(5 * time.Minute):
+			case <-time.After(getConfig().cleanupInterval):
+			}
+
+			cleanupRoutine.beginRun()
+			err := cleanupRoutine.track("cleaning up clusters", cleanupClusters)
+			if err != nil {
+				slog.Error("Failed to cleanup old clusters", "operation", "cleanup", "error", err)
 			}
 
-			err := cleanupClusters()
+			err = cleanupRoutine.track("reaping orphaned containers", reapOrphanedContainers)
 			if err != nil {
-				log.Printf("Failed to cleanup old clusters: %s", err)
+				slog.Error("Failed to reap orphaned containers", "operation", "reap_orphans", "error", err)
 			}
+
+			err = cleanupRoutine.track("sweeping tombstones", sweepTombstones)
+			if err != nil {
+				slog.Error("Failed to sweep tombstones", "operation", "sweep_tombstones", "error", err)
+			}
+
+			err = cleanupRoutine.track("sweeping allocation logs", sweepAllocLogs)
+			if err != nil {
+				slog.Error("Failed to sweep allocation logs", "operation", "sweep_alloc_logs", "error", err)
+			}
+			cleanupRoutine.endRun()
+		}
+	}()
+
+	// Start our scheduler which allocates scheduled clusters once they are due
+	go func() {
+		for {
+			select {
+			case <-schedulerShutdownSig:
+				schedulerClosedSig <- struct{}{}
+				return
+			case <-time.After(scheduleCheckInterval):
+			}
+
+			schedulerRoutine.beginRun()
+			err := schedulerRoutine.track("running scheduled allocations", runDueScheduledAllocations)
+			if err != nil {
+				slog.Error("Failed to run scheduled allocations", "operation", "schedule", "error", err)
+			}
+			schedulerRoutine.endRun()
+		}
+	}()
+
+	// Start our audit routine which reports clusters that have outlived the maximum timeout, separately from
+	// cleanup since these clusters are reported rather than killed
+	go func() {
+		for {
+			select {
+			case <-auditShutdownSig:
+				auditClosedSig <- struct{}{}
+				return
+			case <-time.After(getConfig().auditInterval):
+			}
+
+			auditRoutine.beginRun()
+			err := auditRoutine.track("auditing clusters", func() error {
+				_, err := auditClusters()
+				return err
+			})
+			if err != nil {
+				slog.Error("Failed to audit clusters", "operation", "audit", "error", err)
+			}
+			auditRoutine.endRun()
 		}
 	}()
 
@@ -335,35 +1216,64 @@ func startDaemon() {
 		Handler: createRESTRouter(),
 	}
 
-	// Set up a signal watcher for graceful shutdown
+	// Set up a signal watcher for graceful shutdown.  The first signal drains the daemon, letting in-flight
+	// allocations complete, while a second signal shuts it down immediately.
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-c
-		log.Printf("")
-		log.Printf("Received shutdown signal.  Shutting down daemon.")
+		sig := <-c
+		slog.Info("Received signal.  Draining daemon, signal again to shut down immediately.", "operation", "shutdown",
+			"signal", sig.String(), "drain_timeout", getConfig().drainTimeout)
+
+		drainStart := time.Now()
+		drained := startDrain()
+		select {
+		case <-drained:
+			slog.Info("In-flight operations completed.  Shutting down daemon.", "operation", "shutdown",
+				"duration", time.Since(drainStart))
+		case <-time.After(getConfig().drainTimeout):
+			slog.Warn("Timed out waiting for in-flight operations.  Shutting down daemon.", "operation", "shutdown",
+				"duration", time.Since(drainStart))
+		case sig := <-c:
+			slog.Warn("Received signal.  Shutting down daemon immediately.", "operation", "shutdown",
+				"signal", sig.String())
+		}
 
 		restServer.Close()
 	}()
 
+	// Set up a signal watcher for reloading the configuration
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			slog.Info("Received hangup signal.  Reloading configuration.", "operation", "reload_config")
+			reloadConfig()
+		}
+	}()
+
 	// Start listening now
-	log.Printf("Daemon is starting on %s", restServer.Addr)
+	slog.Info("Daemon is starting", "operation", "startup", "address", restServer.Addr)
 	if err = restServer.ListenAndServe(); err != nil {
-		log.Printf("Error:%s", err)
+		slog.Info("REST server stopped", "operation", "shutdown", "error", err)
 	}
 
 	// Signal all our running goroutines to shut down
 	shutdownSig <- struct{}{}
+	schedulerShutdownSig <- struct{}{}
+	auditShutdownSig <- struct{}{}
 
-	// Wait for the periodic cleanup routine to finish
+	// Wait for the periodic cleanup, scheduler and audit routines to finish
 	<-cleanupClosedSig
+	<-schedulerClosedSig
+	<-auditClosedSig
 
 	// Close the meta-data database
 	err = metaStore.Close()
 	if err != nil {
-		log.Printf("Failed to close meta db: %s", err)
+		slog.Error("Failed to close meta db", "operation", "shutdown", "error", err)
 	}
 
 	// Let everyone know everything worked good
-	log.Printf("Graceful shutdown completed.")
+	slog.Info("Graceful shutdown completed.", "operation", "shutdown")
 }
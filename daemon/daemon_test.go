@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/viper"
+)
+
+// withTestConfig swaps in a copy of the live configuration changed by update for the duration of a test
+func withTestConfig(t *testing.T, update func(config *reloadableConfig)) {
+	previous := getConfig()
+	next := *previous
+	update(&next)
+	liveConfig.Store(&next)
+
+	t.Cleanup(func() {
+		liveConfig.Store(previous)
+	})
+}
+
+// memoryStore keeps cluster meta-data in memory for tests, the rest of Store is left unimplemented
+type memoryStore struct {
+	Store
+	lock     sync.Mutex
+	clusters map[string]ClusterMeta
+}
+
+func (store *memoryStore) CreateClusterMeta(clusterID string, meta ClusterMeta) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if _, ok := store.clusters[clusterID]; ok {
+		return errClusterMetaExists
+	}
+	store.clusters[clusterID] = meta
+	return nil
+}
+
+func (store *memoryStore) GetClusterMeta(clusterID string) (ClusterMeta, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	meta, ok := store.clusters[clusterID]
+	if !ok {
+		return ClusterMeta{}, errClusterMetaNotFound
+	}
+	return meta, nil
+}
+
+func (store *memoryStore) GetImportedContainers() ([]ImportedContainer, error) {
+	return nil, nil
+}
+
+// withTestMetaStore swaps in an empty in-memory meta-data store for the duration of a test
+func withTestMetaStore(t *testing.T) {
+	previous := metaStore
+	metaStore = &memoryStore{clusters: make(map[string]ClusterMeta)}
+	t.Cleanup(func() {
+		metaStore = previous
+	})
+}
+
+// withTestDocker points the docker client at a fake docker API served by handler for the duration of a test
+func withTestDocker(t *testing.T, handler http.Handler) {
+	server := httptest.NewServer(handler)
+	cli, err := client.NewClient("tcp://"+server.Listener.Addr().String(), "1.25", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create docker client: %s", err)
+	}
+
+	previous := docker
+	docker = cli
+	t.Cleanup(func() {
+		docker = previous
+		server.Close()
+	})
+}
+
+func TestReadConfigArgsKeepsDefaultsMissingFromConfigFile(t *testing.T) {
+	// A config file written before the log and critical task settings were added
+	configFile := filepath.Join(t.TempDir(), "cbdynclusterd.toml")
+	err := os.WriteFile(configFile, []byte("docker-host = \"/var/run/docker.sock\"\ndns-host = \"\"\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %s", err)
+	}
+
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("failed to read config file: %s", err)
+	}
+	previousFlags := configFlags
+	configFlags = rootCmd.PersistentFlags()
+	t.Cleanup(func() {
+		viper.Reset()
+		configFlags = previousFlags
+	})
+
+	readConfigArgs()
+
+	if logFormatFlag != defaultConfig.logFormat {
+		t.Errorf("expected log-format %q, got %q", defaultConfig.logFormat, logFormatFlag)
+	}
+	if logLevelFlag != defaultConfig.logLevel {
+		t.Errorf("expected log-level %q, got %q", defaultConfig.logLevel, logLevelFlag)
+	}
+	if criticalTasksFlag != defaultConfig.criticalTasks {
+		t.Errorf("expected critical-tasks %q, got %q", defaultConfig.criticalTasks, criticalTasksFlag)
+	}
+	if allocLogDirFlag != defaultConfig.allocLogDir {
+		t.Errorf("expected alloc-log-dir %q, got %q", defaultConfig.allocLogDir, allocLogDirFlag)
+	}
+}
@@ -0,0 +1,219 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+const (
+	hostResolvConf = "/etc/resolv.conf"
+	// systemdResolvConf lists the upstream servers which systemd-resolved's stub listener forwards to
+	systemdResolvConf = "/run/systemd/resolve/resolv.conf"
+)
+
+// DNSOptions replaces the name resolution configuration containers would otherwise inherit from the docker host
+type DNSOptions struct {
+	Servers []string `json:"servers"`
+	Search  []string `json:"search"`
+	Options []string `json:"options"`
+}
+
+func validateDNSOptions(opts *DNSOptions) error {
+	if opts == nil {
+		return nil
+	}
+	for _, server := range opts.Servers {
+		if net.ParseIP(server) == nil {
+			return badRequestf("dns server `%s` must be an IP address", server)
+		}
+	}
+	return nil
+}
+
+// parseDNSServers splits the comma separated dns-servers config
+func parseDNSServers(list string) []string {
+	var servers []string
+	for _, server := range strings.Split(list, ",") {
+		server = strings.TrimSpace(server)
+		if server != "" {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+func readResolvConfNameservers(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers, scanner.Err()
+}
+
+// detectSystemdResolvedServers returns the upstream servers of systemd-resolved when the host's resolv.conf only
+// points at its loopback stub listener, which is unreachable from inside a container.  Nothing is returned if the
+// host's resolv.conf is usable as it is.
+func detectSystemdResolvedServers() []string {
+	hostServers, err := readResolvConfNameservers(hostResolvConf)
+	if err != nil || len(hostServers) == 0 {
+		return nil
+	}
+	for _, server := range hostServers {
+		if ip := net.ParseIP(server); ip == nil || !ip.IsLoopback() {
+			return nil
+		}
+	}
+
+	upstreamServers, err := readResolvConfNameservers(systemdResolvConf)
+	if err != nil {
+		log.Printf("Host resolv.conf only lists loopback nameservers but %s could not be read: %s", systemdResolvConf, err)
+		return nil
+	}
+	return upstreamServers
+}
+
+// containerDNS builds the DNS configuration for a cluster's containers.  The restful DNS server always comes
+// first so that container host names resolve, followed by the cluster's own servers, the dns-servers config or
+// the servers detected behind systemd-resolved, in that order of preference.
+func containerDNS(opts *DNSOptions) (servers []string, search []string, options []string) {
+	if getConfig().dnsSvcHost != "" {
+		servers = append(servers, getConfig().dnsSvcHost)
+	}
+
+	if opts != nil {
+		search = opts.Search
+		options = opts.Options
+	}
+
+	if opts != nil && len(opts.Servers) > 0 {
+		servers = append(servers, opts.Servers...)
+	} else if configured := parseDNSServers(getConfig().dnsServers); len(configured) > 0 {
+		servers = append(servers, configured...)
+	} else if getConfig().detectSystemdResolved {
+		servers = append(servers, detectSystemdResolvedServers()...)
+	}
+
+	return servers, search, options
+}
+
+// nodeHostname is the predictable host name a node is registered under on the restful DNS server
+func nodeHostname(containerName string) string {
+	return strings.TrimPrefix(containerName, "/") + helper.DomainPostfix
+}
+
+func dnsRestCall(method string, hostname string, body string) *helper.RestCall {
+	return &helper.RestCall{
+		ExpectedCode: 200,
+		ContentType:  "application/json",
+		Method:       method,
+		Cred: &helper.Cred{
+			Hostname: getConfig().dnsSvcHost,
+			Port:     80,
+		},
+		Path: helper.Domain + "/" + hostname,
+		Body: body,
+	}
+}
+
+// registerNodeHostname points a node's host name at its addresses on the restful DNS server.  A node which could
+// not be registered is still usable through its IP addresses, so failures are logged rather than returned.  Nodes
+// which were registered are recorded in the cluster's meta-data, so only their host names are reported.
+func registerNodeHostname(clusterID string, containerName string, ipv4 string, ipv6 string) {
+	if getConfig().dnsSvcHost == "" {
+		return
+	}
+
+	var ips []string
+	for _, ip := range []string{ipv4, ipv6} {
+		if ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return
+	}
+
+	hostname := nodeHostname(containerName)
+	body, err := json.Marshal(map[string][]string{"ips": ips})
+	if err != nil {
+		allocLogf(clusterID, "Failed to register host name %s: %s", hostname, err)
+		return
+	}
+
+	allocLogf(clusterID, "Registering host name %s => %s on %s", hostname, strings.Join(ips, ", "), getConfig().dnsSvcHost)
+	respBody, err := helper.RestRetryer(helper.RestRetry, dnsRestCall("PUT", hostname, string(body)), helper.GetResponse)
+	if err != nil {
+		allocLogf(clusterID, "Failed to register host name %s: %s %s", hostname, err, respBody)
+		return
+	}
+
+	err = metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		if !containsString(meta.DNSNodes, containerName) {
+			meta.DNSNodes = append(meta.DNSNodes, containerName)
+		}
+		return meta, nil
+	})
+	if err != nil {
+		allocLogf(clusterID, "Failed to record the registration of host name %s: %s", hostname, err)
+	}
+}
+
+// deregisterNodeHostname removes a node's host name from the restful DNS server, failures are logged as a stale
+// record does no harm until the host name is registered again
+func deregisterNodeHostname(node *Node) {
+	if getConfig().dnsSvcHost == "" || node.Hostname == "" {
+		return
+	}
+
+	hostname := nodeHostname(node.ContainerName)
+	_, err := helper.RestRetryer(helper.RestRetry, dnsRestCall("DELETE", hostname, ""), helper.GetResponse)
+	if err != nil {
+		log.Printf("Failed to deregister host name %s from %s: %s", hostname, getConfig().dnsSvcHost, err)
+	}
+}
+
+// forgetRegisteredHostname removes a node which is being removed from its cluster's registered host names
+func forgetRegisteredHostname(clusterID string, node *Node) {
+	if node.Hostname == "" {
+		return
+	}
+
+	err := metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		var registered []string
+		for _, containerName := range meta.DNSNodes {
+			if containerName != node.ContainerName {
+				registered = append(registered, containerName)
+			}
+		}
+		meta.DNSNodes = registered
+		return meta, nil
+	})
+	if err != nil {
+		log.Printf("Failed to forget the host name of node %s of cluster %s: %s", node.ContainerID, clusterID, err)
+	}
+}
+
+// registeredHostname is the host name a node is registered under, or empty if it was never successfully
+// registered on the restful DNS server
+func registeredHostname(meta ClusterMeta, containerName string) string {
+	if !containsString(meta.DNSNodes, containerName) {
+		return ""
+	}
+	return nodeHostname(containerName)
+}
@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+var errDraining = errors.New("daemon is draining for shutdown, not accepting new clusters")
+
+// drainLock guards draining, so that no operation can begin once waiting for in-flight operations has started
+var drainLock sync.Mutex
+var draining bool
+var inFlightOperations sync.WaitGroup
+
+// inFlightCount mirrors inFlightOperations, which cannot report its count, and is also guarded by drainLock
+var inFlightCount int
+
+// beginClusterOperation registers an operation which creates containers, so that shutdown waits for it rather
+// than leaving half created clusters behind.  It fails once the daemon is draining.
+func beginClusterOperation() (func(), error) {
+	drainLock.Lock()
+	defer drainLock.Unlock()
+
+	if draining {
+		return nil, errDraining
+	}
+
+	inFlightOperations.Add(1)
+	inFlightCount++
+	return func() {
+		drainLock.Lock()
+		inFlightCount--
+		drainLock.Unlock()
+		inFlightOperations.Done()
+	}, nil
+}
+
+// startDrain stops new cluster operations from beginning and returns a channel which is closed once the
+// operations already in flight have completed
+func startDrain() <-chan struct{} {
+	drainLock.Lock()
+	draining = true
+	drainLock.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		inFlightOperations.Wait()
+		close(drained)
+	}()
+	return drained
+}
+
+// drainableHandler rejects requests with 503 while the daemon is draining and otherwise tracks them as in-flight
+// cluster operations
+func drainableHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		done, err := beginClusterOperation()
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+		defer done()
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,157 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+type ServiceDrift struct {
+	Node     string   `json:"node"`
+	Expected []string `json:"expected"`
+	Actual   []string `json:"actual"`
+}
+
+// ClusterDrift lists where the daemon's view of a cluster disagrees with what the cluster itself reports
+type ClusterDrift struct {
+	Drifted bool `json:"drifted"`
+	// MissingNodes are nodes the daemon has containers for which are not part of the cluster
+	MissingNodes []string `json:"missing_nodes,omitempty"`
+	// UnknownNodes are hosts in the cluster which the daemon has no container for
+	UnknownNodes []string `json:"unknown_nodes,omitempty"`
+	// StoppedNodes are nodes whose containers are not running
+	StoppedNodes    []string       `json:"stopped_nodes,omitempty"`
+	ChangedServices []ServiceDrift `json:"changed_services,omitempty"`
+	// Buckets are compared against the most recent checkpoint, since the daemon does not otherwise track them
+	BucketCheckpoint  string   `json:"bucket_checkpoint,omitempty"`
+	MissingBuckets    []string `json:"missing_buckets,omitempty"`
+	UnexpectedBuckets []string `json:"unexpected_buckets,omitempty"`
+}
+
+func (drift *ClusterDrift) hasDrifted() bool {
+	return len(drift.MissingNodes) > 0 || len(drift.UnknownNodes) > 0 || len(drift.StoppedNodes) > 0 ||
+		len(drift.ChangedServices) > 0 || len(drift.MissingBuckets) > 0 || len(drift.UnexpectedBuckets) > 0
+}
+
+// expectedNodeServices inverts a cluster's resolved placement into the sorted services of each node
+func expectedNodeServices(placement map[string][]string) map[string][]string {
+	nodeServices := make(map[string][]string)
+	for service, nodeNames := range placement {
+		for _, nodeName := range nodeNames {
+			nodeServices[nodeName] = append(nodeServices[nodeName], service)
+		}
+	}
+	for _, services := range nodeServices {
+		sort.Strings(services)
+	}
+	return nodeServices
+}
+
+func getClusterDrift(ctx context.Context, clusterID string) (*ClusterDrift, error) {
+	log.Printf("Checking cluster %s for drift (requested by: %s)", clusterID, ContextRequester(ctx))
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	drift := &ClusterDrift{}
+
+	var queryNode *Node
+	for _, node := range cluster.Nodes {
+		if node.State != "running" {
+			drift.StoppedNodes = append(drift.StoppedNodes, node.Name)
+		} else if queryNode == nil {
+			queryNode = node
+		}
+	}
+	if queryNode == nil {
+		return nil, badRequestf("cluster has no running nodes to query")
+	}
+
+	var pools poolsDefaultJSON
+	if err := getClusterRest(queryNode, helper.PPoolsDefault, &pools); err != nil {
+		return nil, fmt.Errorf("failed to query cluster through node %s: %s", queryNode.Name, err)
+	}
+
+	nodesByHost := make(map[string]*Node)
+	for _, node := range cluster.Nodes {
+		nodesByHost[node.IPv4Address] = node
+		nodesByHost[strings.TrimPrefix(node.ContainerName, "/")+helper.DomainPostfix] = node
+	}
+
+	liveServices := make(map[string][]string)
+	for _, poolNode := range pools.Nodes {
+		host, _, err := net.SplitHostPort(poolNode.Hostname)
+		if err != nil {
+			host = poolNode.Hostname
+		}
+
+		node, ok := nodesByHost[host]
+		if !ok {
+			drift.UnknownNodes = append(drift.UnknownNodes, host)
+			continue
+		}
+
+		services := append([]string{}, poolNode.Services...)
+		sort.Strings(services)
+		liveServices[node.Name] = services
+	}
+
+	// Services are only known to the daemon once the cluster has been set up through it
+	expectedServices := expectedNodeServices(cluster.ResolvedPlacement)
+	for _, node := range cluster.Nodes {
+		actual, ok := liveServices[node.Name]
+		if !ok {
+			drift.MissingNodes = append(drift.MissingNodes, node.Name)
+			continue
+		}
+
+		if cluster.ResolvedPlacement == nil {
+			continue
+		}
+		expected := expectedServices[node.Name]
+		if strings.Join(expected, ",") != strings.Join(actual, ",") {
+			drift.ChangedServices = append(drift.ChangedServices, ServiceDrift{
+				Node:     node.Name,
+				Expected: expected,
+				Actual:   actual,
+			})
+		}
+	}
+
+	checkpoints, err := metaStore.GetCheckpoints(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	if len(checkpoints) > 0 {
+		sort.Slice(checkpoints, func(i, j int) bool {
+			return checkpoints[i].CreatedAt.Before(checkpoints[j].CreatedAt)
+		})
+		latest := checkpoints[len(checkpoints)-1]
+
+		var buckets []bucketNameJSON
+		if err := getClusterRest(queryNode, helper.PBuckets, &buckets); err != nil {
+			return nil, fmt.Errorf("failed to query buckets through node %s: %s", queryNode.Name, err)
+		}
+		var bucketNames []string
+		for _, bucket := range buckets {
+			bucketNames = append(bucketNames, bucket.Name)
+		}
+
+		drift.BucketCheckpoint = latest.Label
+		drift.UnexpectedBuckets, drift.MissingBuckets = diffStrings(latest.Buckets, bucketNames)
+	}
+
+	drift.Drifted = drift.hasDrifted()
+	return drift, nil
+}
@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Where the image of a node comes from when its cluster is allocated
+const (
+	ImageSourceLocal    = "local"
+	ImageSourceRegistry = "registry"
+	ImageSourceBuild    = "build"
+	// ImageSourceUnknown is used when the registry would not let the image be looked up without credentials
+	ImageSourceUnknown = "unknown"
+)
+
+// errRegistryUnauthorized is returned when a registry refuses to look up a manifest without credentials
+var errRegistryUnauthorized = errors.New("registry requires credentials to look up images")
+
+// registryManifestTimeout bounds looking up an image's manifest in its registry
+const registryManifestTimeout = 10 * time.Second
+
+// NodePlan is how a single node would be allocated
+type NodePlan struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+	// ImageSource is local, registry, build or unknown
+	ImageSource string `json:"image_source"`
+	// Services is empty if the services are left to be chosen during setup
+	Services []string `json:"services,omitempty"`
+}
+
+// AllocationPlan is what allocating a cluster would create, computed without creating anything
+type AllocationPlan struct {
+	Network string     `json:"network"`
+	IPRange string     `json:"ip_range,omitempty"`
+	Nodes   []NodePlan `json:"nodes"`
+}
+
+// registryHasImage looks up the manifest of an image in its registry.  Registries are tried over HTTPS first, then
+// over plain HTTP as internal registries often do not use TLS.
+func registryHasImage(ctx context.Context, versionInfo *NodeVersion) (bool, error) {
+	registry := versionInfo.registry()
+	repository := strings.TrimPrefix(versionInfo.toImageName(), registry+"/")
+
+	client := &http.Client{Timeout: registryManifestTimeout}
+	var lastErr error
+	for _, scheme := range []string{"https", "http"} {
+		req, err := http.NewRequest("HEAD", fmt.Sprintf("%s://%s/v2/%s/manifests/latest", scheme, registry, repository), nil)
+		if err != nil {
+			return false, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case 200:
+			return true, nil
+		case 404:
+			return false, nil
+		case 401, 403:
+			return false, errRegistryUnauthorized
+		}
+		return false, fmt.Errorf("registry %s returned %d for the manifest of %s", registry, resp.StatusCode, repository)
+	}
+	return false, lastErr
+}
+
+// resolveImageSource works out where the image of a node would come from, failing if it is neither available nor
+// can be built.  The source is unknown if the image's registry needs credentials the daemon doesn't have.
+func resolveImageSource(ctx context.Context, versionInfo *NodeVersion) (string, error) {
+	if _, _, err := docker.ImageInspectWithRaw(ctx, versionInfo.toImageName()); err == nil {
+		return ImageSourceLocal, nil
+	}
+
+	if versionInfo.registry() != "" {
+		found, err := registryHasImage(ctx, versionInfo)
+		if err == errRegistryUnauthorized {
+			log.Printf("Could not look up image %s in registry %s: %s", versionInfo.toImageName(), versionInfo.registry(), err)
+			return ImageSourceUnknown, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return ImageSourceRegistry, nil
+		}
+	}
+
+	err := checkBuildExists(ctx, fmt.Sprintf("%s/%s", versionInfo.toURL(), versionInfo.toPkgName()))
+	if err != nil {
+		return "", err
+	}
+	return ImageSourceBuild, nil
+}
@@ -0,0 +1,151 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+)
+
+var clusterNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// clusterNameLock is the lock on a cluster name, along with how many requests are holding or waiting on it
+type clusterNameLock struct {
+	sync.Mutex
+	refs int
+}
+
+// clusterNameLocks serializes ensure requests for the same cluster name of the same owner, so that concurrent
+// requests cannot both decide the cluster is missing and allocate it twice.  A lock is removed once the last
+// request holding or waiting on it releases it, so names which are no longer in use don't build up.
+var clusterNameLocks = make(map[string]*clusterNameLock)
+var clusterNameLocksLock sync.Mutex
+
+func lockClusterName(owner string, name string) func() {
+	key := owner + "/" + name
+
+	clusterNameLocksLock.Lock()
+	lock, ok := clusterNameLocks[key]
+	if !ok {
+		lock = &clusterNameLock{}
+		clusterNameLocks[key] = lock
+	}
+	lock.refs++
+	clusterNameLocksLock.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		clusterNameLocksLock.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(clusterNameLocks, key)
+		}
+		clusterNameLocksLock.Unlock()
+	}
+}
+
+// ClusterNameConflictError is returned when the requester already has a cluster with the name being allocated
+type ClusterNameConflictError struct {
+	Name      string
+	ClusterID string
+}
+
+func (e *ClusterNameConflictError) Error() string {
+	return fmt.Sprintf("cluster %s is already named %s", e.ClusterID, e.Name)
+}
+
+// findNamedCluster returns the cluster with the given name which the requester owns or is an authorized owner of,
+// or nil if they have no such cluster
+func findNamedCluster(ctx context.Context, name string) (*Cluster, error) {
+	clusters, err := getAllClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cluster := range clusters {
+		if cluster.Name == name && cluster.isAuthorizedOwner(ContextUser(ctx)) {
+			return cluster, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// checkClusterName verifies that a name is valid and not already used by another of the requester's clusters.
+// Unnamed clusters are always allowed.
+func checkClusterName(ctx context.Context, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	if !clusterNameRegexp.MatchString(name) {
+		return badRequestf("cluster name must only contain letters, numbers, '_', '.' and '-'")
+	}
+
+	existing, err := findNamedCluster(ctx, name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return &ClusterNameConflictError{Name: name, ClusterID: existing.ID}
+	}
+
+	return nil
+}
+
+func isClusterHealthy(cluster *Cluster) bool {
+	if len(cluster.Nodes) == 0 {
+		return false
+	}
+	for _, node := range cluster.Nodes {
+		if node.State != "running" {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureCluster returns the requester's cluster with the name in opts if it exists and is healthy, otherwise it
+// allocates it.  An unhealthy cluster with the name is killed and replaced.  The returned bool reports whether
+// a new cluster was allocated, any warnings are about that allocation.
+func ensureCluster(ctx context.Context, opts ClusterOptions) (*Cluster, bool, []string, error) {
+	log.Printf("Ensuring cluster %s exists (requested by: %s)", opts.Name, ContextRequester(ctx))
+
+	if opts.Name == "" {
+		return nil, false, nil, badRequestf("must specify a name for the cluster")
+	}
+
+	unlock := lockClusterName(ContextUser(ctx), opts.Name)
+	defer unlock()
+
+	existing, err := findNamedCluster(ctx, opts.Name)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	if existing != nil {
+		if isClusterHealthy(existing) {
+			return existing, false, nil, nil
+		}
+
+		log.Printf("Replacing unhealthy cluster %s named %s (requested by: %s)", existing.ID, opts.Name, ContextRequester(ctx))
+		if err := killCluster(ctx, existing.ID); err != nil {
+			return nil, false, nil, err
+		}
+	}
+
+	clusterID, warnings, err := allocateClusterLocked(ctx, opts)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	return cluster, true, warnings, nil
+}
@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pkg/errors"
+)
+
+// execInContainer runs a command inside a node container and returns its stdout
+func execInContainer(ctx context.Context, containerID string, cmd []string) (string, error) {
+	execConfig := types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	}
+
+	execResp, err := docker.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		return "", errors.Wrapf(countDockerError("exec_create", err), "could not create exec on %s", containerID)
+	}
+
+	attachResp, err := docker.ContainerExecAttach(ctx, execResp.ID, execConfig)
+	if err != nil {
+		return "", errors.Wrapf(countDockerError("exec_attach", err), "could not attach exec on %s", containerID)
+	}
+	defer attachResp.Close()
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	_, err = stdcopy.StdCopy(&stdoutBuf, &stderrBuf, attachResp.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	inspect, err := docker.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return "", countDockerError("exec_inspect", err)
+	}
+	if inspect.ExitCode != 0 {
+		return stdoutBuf.String(), fmt.Errorf("`%s` exited with %d: %s", strings.Join(cmd, " "), inspect.ExitCode,
+			strings.TrimSpace(stderrBuf.String()))
+	}
+
+	return stdoutBuf.String(), nil
+}
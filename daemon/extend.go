@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// clusterExpiryLocks serialize changes to a cluster's timeout with the cleanup routine's decision to kill it, so
+// that a cluster which was just extended cannot be killed by a cleanup pass that saw its old timeout
+var clusterExpiryLocks = make(map[string]*sync.Mutex)
+var clusterExpiryLocksLock sync.Mutex
+
+func lockClusterExpiry(clusterID string) func() {
+	clusterExpiryLocksLock.Lock()
+	lock, ok := clusterExpiryLocks[clusterID]
+	if !ok {
+		lock = &sync.Mutex{}
+		clusterExpiryLocks[clusterID] = lock
+	}
+	clusterExpiryLocksLock.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+func forgetClusterExpiryLock(clusterID string) {
+	clusterExpiryLocksLock.Lock()
+	delete(clusterExpiryLocks, clusterID)
+	clusterExpiryLocksLock.Unlock()
+}
+
+// extendCluster pushes the timeout of a cluster out by extension, returning the new timeout.  The new timeout
+// may be no further from now than the owner's maximum cluster timeout.
+func extendCluster(ctx context.Context, clusterID string, extension time.Duration) (time.Time, error) {
+	log.Printf("Extending cluster %s by %s (requested by: %s)", clusterID, extension, ContextRequester(ctx))
+
+	if extension <= 0 {
+		return time.Time{}, badRequestf("extension must be positive")
+	}
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return time.Time{}, err
+	}
+
+	unlock := lockClusterExpiry(clusterID)
+	defer unlock()
+
+	var oldTimeout, newTimeout time.Time
+	err = metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		oldTimeout = meta.Timeout
+		newTimeout = meta.Timeout.Add(extension)
+
+		maxTimeout := getMaxClusterTimeout(ContextUser(ctx))
+		if newTimeout.After(time.Now().Add(maxTimeout)) {
+			return meta, badRequestf("cannot extend clusters to expire more than %s from now", maxTimeout)
+		}
+
+		meta.Timeout = newTimeout
+		return meta, nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	recordClusterHistory(ctx, clusterID, HistoryEventTimeoutExtended, oldTimeout.Format(time.RFC3339),
+		newTimeout.Format(time.RFC3339))
+
+	return newTimeout, nil
+}
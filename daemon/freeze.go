@@ -0,0 +1,43 @@
+package daemon
+
+import (
+	"context"
+	"log"
+)
+
+// setClusterFrozen freezes or unfreezes a cluster.  A frozen cluster is never killed automatically, neither when
+// it expires nor to reclaim capacity, so only admins can freeze clusters as it lifts every limit on their lifetime.
+func setClusterFrozen(ctx context.Context, clusterID string, frozen bool) error {
+	log.Printf("Setting cluster %s frozen to %t (requested by: %s)", clusterID, frozen, ContextRequester(ctx))
+
+	if !ContextIgnoreOwnership(ctx) {
+		return forbiddenf("only admins can freeze clusters")
+	}
+
+	if _, err := getCluster(ctx, clusterID); err != nil {
+		return err
+	}
+
+	unlock := lockClusterExpiry(clusterID)
+	defer unlock()
+
+	changed := false
+	err := metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		changed = meta.Frozen != frozen
+		meta.Frozen = frozen
+		return meta, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !changed {
+		return nil
+	}
+	if frozen {
+		recordClusterHistory(ctx, clusterID, HistoryEventFrozen, "", "")
+	} else {
+		recordClusterHistory(ctx, clusterID, HistoryEventUnfrozen, "", "")
+	}
+	return nil
+}
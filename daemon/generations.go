@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+func getGenerationClusters(ctx context.Context, generationID string) ([]*Cluster, error) {
+	if generationID == "" {
+		return nil, badRequestf("must specify a generation")
+	}
+
+	clusters, err := getAllClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var generationClusters []*Cluster
+	for _, cluster := range clusters {
+		if cluster.GenerationID == generationID {
+			generationClusters = append(generationClusters, cluster)
+		}
+	}
+
+	return generationClusters, nil
+}
+
+// forEachGenerationCluster runs fn against every cluster in a generation concurrently, returning the first error
+func forEachGenerationCluster(ctx context.Context, generationID string, fn func(clusterID string) error) error {
+	clusters, err := getGenerationClusters(ctx, generationID)
+	if err != nil {
+		return err
+	}
+
+	signal := make(chan error)
+
+	for _, cluster := range clusters {
+		go func(clusterID string) {
+			signal <- fn(clusterID)
+		}(cluster.ID)
+	}
+
+	var firstError error
+	for range clusters {
+		err := <-signal
+		if err != nil && firstError == nil {
+			firstError = err
+		}
+	}
+
+	return firstError
+}
+
+func refreshGeneration(ctx context.Context, generationID string, newTimeout time.Duration) error {
+	log.Printf("Refreshing generation %s (requested by: %s)", generationID, ContextRequester(ctx))
+
+	return forEachGenerationCluster(ctx, generationID, func(clusterID string) error {
+		return refreshCluster(ctx, clusterID, newTimeout)
+	})
+}
+
+func killGeneration(ctx context.Context, generationID string) error {
+	log.Printf("Killing generation %s (requested by: %s)", generationID, ContextRequester(ctx))
+
+	return forEachGenerationCluster(ctx, generationID, func(clusterID string) error {
+		return killCluster(ctx, clusterID)
+	})
+}
@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipResponseWriter only starts compressing once there is a body to compress, so that responses without one,
+// such as 204 and 304 responses, are sent without a gzip stream or Content-Encoding
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+	// status is the status of a response whose header has not been written yet
+	status int
+	// passthrough is set for responses which must not have a body, these are written uncompressed
+	passthrough bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.gz != nil || w.passthrough || w.status != 0 {
+		return
+	}
+	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+}
+
+// start writes the header of the response as a compressed one and starts its gzip stream
+func (w *gzipResponseWriter) start() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.gz == nil {
+		if len(data) == 0 {
+			return 0, nil
+		}
+		w.start()
+	}
+	return w.gz.Write(data)
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if !w.passthrough {
+		if w.gz == nil {
+			w.start()
+		}
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close finishes the gzip stream, or writes the header of a response which never had a body
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+	} else if !w.passthrough && w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		encoding = strings.TrimSpace(strings.SplitN(encoding, ";", 2)[0])
+		if strings.EqualFold(encoding, "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipMiddleware compresses responses for clients which send Accept-Encoding: gzip, other clients receive
+// the response unchanged.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gzw := &gzipResponseWriter{ResponseWriter: w}
+		defer gzw.close()
+
+		next.ServeHTTP(gzw, r)
+	})
+}
@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveGzip(handler http.HandlerFunc) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/clusters", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	gzipMiddleware(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGzipMiddlewareCompressesBodies(t *testing.T) {
+	rec := serveGzip(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzip response, got Content-Encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to read gzip response: %s", err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil || string(body) != "hello" {
+		t.Errorf("expected body hello, got %q (%v)", body, err)
+	}
+}
+
+func TestGzipMiddlewareLeavesEmptyResponsesUncompressed(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{"no content", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) }, 204},
+		{"not modified", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(304) }, 304},
+		{"empty ok", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) }, 200},
+		{"nothing written", func(w http.ResponseWriter, r *http.Request) {}, 200},
+	}
+
+	for _, test := range tests {
+		rec := serveGzip(test.handler)
+		if rec.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, rec.Code)
+		}
+		if encoding := rec.Header().Get("Content-Encoding"); encoding != "" {
+			t.Errorf("%s: expected no Content-Encoding, got %q", test.name, encoding)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("%s: expected an empty body, got %d bytes", test.name, rec.Body.Len())
+		}
+	}
+}
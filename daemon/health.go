@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// healthCheckTimeout bounds each readiness check, so a hung docker socket fails readiness rather than the probe
+const healthCheckTimeout = 5 * time.Second
+
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+)
+
+type HealthJSON struct {
+	Status string `json:"status"`
+	// Checks holds the status of each subsystem, either ok or the reason it is unavailable
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func checkDockerHealth(ctx context.Context) error {
+	if docker == nil {
+		return errors.New("docker is not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	_, err := docker.Ping(ctx)
+	return err
+}
+
+func checkNetworkHealth() error {
+	if docker == nil {
+		return errors.New("docker is not connected")
+	}
+
+	found, err := hasNetwork()
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s network does not exist", NetworkName)
+	}
+	return nil
+}
+
+func checkMetaStoreHealth() error {
+	if metaStore == nil {
+		return errors.New("meta-data store is not open")
+	}
+	return metaStore.Ping()
+}
+
+// HttpLiveness reports that the daemon is serving requests, without checking anything it depends on
+func HttpLiveness(w http.ResponseWriter, r *http.Request) {
+	writeJsonResponse(w, HealthJSON{Status: HealthStatusOK})
+}
+
+// HttpReadiness reports whether the daemon is able to manage clusters, responding with 503 if any of the
+// subsystems it depends on is unavailable
+func HttpReadiness(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]func() error{
+		"meta_store": checkMetaStoreHealth,
+		"docker": func() error {
+			return checkDockerHealth(r.Context())
+		},
+		"network": checkNetworkHealth,
+	}
+
+	health := HealthJSON{
+		Status: HealthStatusOK,
+		Checks: make(map[string]string),
+	}
+	for name, check := range checks {
+		if err := check(); err != nil {
+			health.Status = HealthStatusUnavailable
+			health.Checks[name] = err.Error()
+		} else {
+			health.Checks[name] = HealthStatusOK
+		}
+	}
+
+	status := 200
+	if health.Status != HealthStatusOK {
+		status = 503
+	}
+	writeJsonResponseWithStatus(w, status, health)
+}
@@ -0,0 +1,81 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	HistoryEventCreated                 = "created"
+	HistoryEventOwnerTransferred        = "owner_transferred"
+	HistoryEventTimeoutExtended         = "timeout_extended"
+	HistoryEventAuthorizedOwnersChanged = "authorized_owners_changed"
+	HistoryEventNodesAdded              = "nodes_added"
+	HistoryEventNodeRemoved             = "node_removed"
+	HistoryEventTerminating             = "terminating"
+	HistoryEventRevived                 = "revived"
+	HistoryEventImported                = "imported"
+	HistoryEventFrozen                  = "frozen"
+	HistoryEventUnfrozen                = "unfrozen"
+	HistoryEventKilled                  = "killed"
+)
+
+// ClusterHistoryEntry is a single change to a cluster's ownership or lifetime
+type ClusterHistoryEntry struct {
+	ClusterID string    `json:"cluster_id"`
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	By        string    `json:"by"`
+	OldValue  string    `json:"old_value,omitempty"`
+	NewValue  string    `json:"new_value,omitempty"`
+}
+
+// recordClusterHistory appends a change to a cluster's history.  The history is informational, so failing to
+// record it is logged rather than failing the change itself.
+func recordClusterHistory(ctx context.Context, clusterID string, event string, oldValue string, newValue string) {
+	entry := ClusterHistoryEntry{
+		ClusterID: clusterID,
+		Time:      time.Now(),
+		Event:     event,
+		By:        ContextUser(ctx),
+		OldValue:  oldValue,
+		NewValue:  newValue,
+	}
+
+	if err := metaStore.AppendClusterHistory(entry); err != nil {
+		log.Printf("Failed to record %s history of cluster %s: %s", event, clusterID, err)
+	}
+}
+
+func formatHistoryOwners(owners []string) string {
+	return strings.Join(owners, ",")
+}
+
+// getClusterHistory returns the history of a cluster.  The history of a killed cluster is kept along with its
+// tombstone, so it can still be fetched by the owner it had when it was killed until the tombstone is swept.
+func getClusterHistory(ctx context.Context, clusterID string) ([]ClusterHistoryEntry, error) {
+	cluster, err := getCluster(ctx, clusterID)
+	var notFound *ClusterNotFoundError
+	if errors.As(err, &notFound) {
+		tombstone, tombstoneErr := getClusterTombstone(clusterID)
+		if tombstoneErr != nil || tombstone == nil {
+			return nil, err
+		}
+		if !ContextIgnoreOwnership(ctx) && tombstone.Owner != ContextUser(ctx) {
+			return nil, &ClusterOwnershipError{ClusterID: clusterID, Action: "view"}
+		}
+		return metaStore.GetClusterHistory(clusterID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	return metaStore.GetClusterHistory(clusterID)
+}
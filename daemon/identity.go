@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// daemonHostName is the host name of the machine the daemon is running on
+var daemonHostName string
+
+// initDaemonIdentity resolves the identity which is labelled onto every container the daemon creates.  When no
+// instance ID is configured one is generated, which means it will change whenever the daemon restarts.
+func initDaemonIdentity() {
+	if instanceID == "" {
+		instanceID = uuid.New().String()
+		log.Printf("No instance-id configured, using generated instance ID %s", instanceID)
+	}
+
+	hostName, err := os.Hostname()
+	if err != nil {
+		log.Printf("Failed to determine host name: %s", err)
+	}
+	daemonHostName = hostName
+}
+
+// clusterLabels are the labels attributing a container to its cluster, so that containers can be traced back to
+// their cluster with `docker ps --filter` even when the meta-data store disagrees.  Labels cannot be changed once
+// a container is created, so the owner and expiry are those the cluster had when the container was created.
+func clusterLabels(ctx context.Context, clusterID string, expiry time.Time) map[string]string {
+	return map[string]string{
+		"com.couchbase.dyncluster.creator":    ContextUser(ctx),
+		"com.couchbase.dyncluster.owner":      ContextUser(ctx),
+		"com.couchbase.dyncluster.cluster_id": clusterID,
+		"com.couchbase.dyncluster.expiry":     expiry.Format(time.RFC3339),
+	}
+}
+
+// addDaemonLabels adds the labels identifying this daemon to a container's labels
+func addDaemonLabels(labels map[string]string) {
+	labels["com.couchbase.dyncluster.daemon_instance_id"] = instanceID
+	labels["com.couchbase.dyncluster.daemon_version"] = Version
+	if daemonHostName != "" {
+		labels["com.couchbase.dyncluster.daemon_host"] = daemonHostName
+	}
+}
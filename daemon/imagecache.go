@@ -0,0 +1,146 @@
+package daemon
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// serverImageTagRegexp matches the repositories produced by NodeVersion.toImageName, capturing the edition and
+// version
+var serverImageTagRegexp = regexp.MustCompile(`dynclsr-couchbase_(enterprise|community)_(.+)\.centos7$`)
+
+// parseServerImageTag returns the edition and version of a node image from its repository, or from one of its
+// RepoTags which always end in `:<tag>`.  Registries may have a port, so only a colon after the last slash starts
+// the tag.
+func parseServerImageTag(tag string) (Edition, string, bool) {
+	repository := tag
+	if colonIdx := strings.LastIndex(tag, ":"); colonIdx > strings.LastIndex(tag, "/") {
+		repository = tag[:colonIdx]
+	}
+
+	matches := serverImageTagRegexp.FindStringSubmatch(repository)
+	if matches == nil {
+		return "", "", false
+	}
+	return Edition(matches[1]), matches[2], true
+}
+
+type CachedImage struct {
+	Edition string `json:"edition"`
+	Image   string `json:"image"`
+	SizeMB  int64  `json:"size_mb"`
+}
+
+// dockerHostName returns the host name of the docker host this daemon manages
+func dockerHostName() string {
+	if hostURI, err := url.Parse(dockerHost); err == nil && hostURI.Hostname() != "" {
+		return hostURI.Hostname()
+	}
+	return dockerHost
+}
+
+// getCachedServerVersions reports which couchbase server versions have images cached on each docker host, keyed
+// by host and then by version.  Versions which include a build are keyed as `version-build`.  This daemon only
+// manages a single docker host, but the result is keyed by host so that schedulers can compare daemons.
+func getCachedServerVersions(ctx context.Context) (map[string]map[string][]CachedImage, error) {
+	images, err := docker.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, countDockerError("image_list", err)
+	}
+
+	versions := make(map[string][]CachedImage)
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			edition, version, ok := parseServerImageTag(tag)
+			if !ok {
+				continue
+			}
+
+			versions[version] = append(versions[version], CachedImage{
+				Edition: string(edition),
+				Image:   tag,
+				SizeMB:  image.Size / 1024 / 1024,
+			})
+		}
+	}
+
+	for _, cachedImages := range versions {
+		sort.Slice(cachedImages, func(i, j int) bool {
+			return cachedImages[i].Edition < cachedImages[j].Edition
+		})
+	}
+
+	return map[string]map[string][]CachedImage{
+		dockerHostName(): versions,
+	}, nil
+}
+
+// inFlightImagePull is an ongoing pull or build of an image, which allocations needing the same image wait on
+type inFlightImagePull struct {
+	done chan struct{}
+	err  error
+}
+
+var imagePulls = make(map[string]*inFlightImagePull)
+var imagePullsLock sync.Mutex
+
+// isImageCached returns whether an image is already present on the docker host
+func isImageCached(ctx context.Context, image string) (bool, error) {
+	referenceFilter := filters.NewArgs()
+	referenceFilter.Add("reference", image)
+
+	images, err := docker.ImageList(ctx, types.ImageListOptions{
+		Filters: referenceFilter,
+	})
+	if err != nil {
+		return false, countDockerError("image_list", err)
+	}
+
+	for _, cached := range images {
+		for _, tag := range cached.RepoTags {
+			if tag == image || tag == image+":latest" {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// coalesceImagePull runs pullFunc unless a pull of the same image is already in flight, in which case it waits
+// for that pull and returns its result instead.  It returns whether this call waited on another's pull.  The pull
+// is shared, so it runs detached from the ctx of the allocation which started it and is bounded by pull-timeout
+// instead, while each allocation stops waiting on it as soon as its own ctx is done.
+func coalesceImagePull(ctx context.Context, image string, pullFunc func(ctx context.Context) error) (bool, error) {
+	imagePullsLock.Lock()
+	pull, waited := imagePulls[image]
+	if !waited {
+		pull = &inFlightImagePull{done: make(chan struct{})}
+		imagePulls[image] = pull
+
+		pullCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), getConfig().pullTimeout)
+		go func() {
+			defer cancel()
+			pull.err = pullFunc(pullCtx)
+
+			imagePullsLock.Lock()
+			delete(imagePulls, image)
+			imagePullsLock.Unlock()
+			close(pull.done)
+		}()
+	}
+	imagePullsLock.Unlock()
+
+	select {
+	case <-pull.done:
+		return waited, pull.err
+	case <-ctx.Done():
+		return waited, ctx.Err()
+	}
+}
@@ -0,0 +1,28 @@
+package daemon
+
+import "testing"
+
+func TestParseServerImageTag(t *testing.T) {
+	tests := []struct {
+		tag     string
+		edition Edition
+		version string
+		ok      bool
+	}{
+		{"registry.example.com:5000/dynclsr-couchbase_enterprise_7.2.0.centos7:latest", Enterprise, "7.2.0", true},
+		{"registry.example.com:5000/dynclsr-couchbase_enterprise_7.2.0-5325.centos7:latest", Enterprise, "7.2.0-5325", true},
+		{"localhost/dynclsr-couchbase_community_7.1.1.centos7:latest", Community, "7.1.1", true},
+		{"dynclsr-couchbase_enterprise_6.6.0.centos7", Enterprise, "6.6.0", true},
+		{"registry.example.com:5000/dynclsr-couchbase_enterprise_7.2.0.centos7", Enterprise, "7.2.0", true},
+		{"registry.example.com:5000/couchbase/server:7.2.0", "", "", false},
+		{"registry:2", "", "", false},
+	}
+
+	for _, test := range tests {
+		edition, version, ok := parseServerImageTag(test.tag)
+		if ok != test.ok || edition != test.edition || version != test.version {
+			t.Errorf("parseServerImageTag(%q) = %q, %q, %t, expected %q, %q, %t", test.tag, edition, version, ok,
+				test.edition, test.version, test.ok)
+		}
+	}
+}
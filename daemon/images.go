@@ -29,10 +29,10 @@ type imageBuildArgs struct {
 
 func imagePush(ctx context.Context, nodeVersion *NodeVersion) error {
 	eventReader, err := docker.ImagePush(ctx, nodeVersion.toImageName(), types.ImagePushOptions{
-		RegistryAuth: dockerRegistry,
+		RegistryAuth: nodeVersion.registry(),
 	})
 	if err != nil {
-		return err
+		return countDockerError("image_push", err)
 	}
 
 	defer eventReader.Close()
@@ -79,7 +79,7 @@ func imageBuild(ctx context.Context, nodeVersion *NodeVersion, dockerfilePath st
 		SuppressOutput: false,
 	})
 	if err != nil {
-		return err
+		return countDockerError("image_build", err)
 	}
 	defer resp.Body.Close()
 	err = parseImageEvent(resp.Body)
@@ -90,13 +90,13 @@ func imageBuild(ctx context.Context, nodeVersion *NodeVersion, dockerfilePath st
 	return nil
 }
 
-func imagePull(ctx context.Context, imageRef string) error {
+func imagePull(ctx context.Context, imageRef string, registry string) error {
 	eventReader, err := docker.ImagePull(ctx, imageRef, types.ImagePullOptions{
 		All:          false,
-		RegistryAuth: dockerRegistry,
+		RegistryAuth: registry,
 	})
 	if err != nil {
-		return err
+		return countDockerError("image_pull", err)
 	}
 
 	defer eventReader.Close()
@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// ImportedContainer records that a container created outside the daemon belongs to a cluster.  Docker can't
+// label an existing container, so these stand in for the cluster_id label of the containers the daemon created.
+type ImportedContainer struct {
+	ClusterID   string    `json:"cluster_id"`
+	ContainerID string    `json:"container_id"`
+	ImportedAt  time.Time `json:"imported_at"`
+}
+
+type ImportClusterOptions struct {
+	ContainerIDs []string
+	// Owner is who the cluster is imported for, the requester if empty
+	Owner   string
+	Timeout time.Duration
+	Tags    map[string]string
+}
+
+// getImportedClusterIDs maps the full container IDs of every imported container to the cluster it belongs to
+func getImportedClusterIDs() (map[string]string, error) {
+	imports, err := metaStore.GetImportedContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterIDs := make(map[string]string)
+	for _, imported := range imports {
+		clusterIDs[imported.ContainerID] = imported.ClusterID
+	}
+	return clusterIDs, nil
+}
+
+// importCluster takes over a set of containers which were created outside the daemon as a new cluster, so that
+// they are owned, listed and expired like the clusters it allocates.  The containers must be on the configured
+// network and must not already belong to a cluster.  Killing the cluster removes its containers, so only admins
+// can import as any container on the docker host could otherwise be taken over and removed.
+func importCluster(ctx context.Context, opts ImportClusterOptions) (string, error) {
+	log.Printf("Importing containers %s as a cluster (requested by: %s)", strings.Join(opts.ContainerIDs, ", "),
+		ContextRequester(ctx))
+
+	if !ContextIgnoreOwnership(ctx) {
+		return "", forbiddenf("only admins can import clusters")
+	}
+
+	owner := opts.Owner
+	if owner == "" {
+		owner = ContextUser(ctx)
+	}
+	if !strings.HasSuffix(owner, "@couchbase.com") {
+		return "", badRequestf("the owner must be an @couchbase.com email")
+	}
+
+	if len(opts.ContainerIDs) == 0 {
+		return "", badRequestf("must specify at least a single container to import")
+	}
+	if len(opts.ContainerIDs) > getConfig().maxClusterNodes {
+		return "", badRequestf("cannot import clusters with more than %d nodes", getConfig().maxClusterNodes)
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = getConfig().defaultClusterTimeout
+	}
+	if timeout < 0 {
+		return "", badRequestf("must specify a valid timeout for the cluster")
+	}
+	if err := checkClusterTimeout(owner, timeout); err != nil {
+		return "", err
+	}
+	if err := validateTags(opts.Tags); err != nil {
+		return "", err
+	}
+
+	importedClusterIDs, err := getImportedClusterIDs()
+	if err != nil {
+		return "", err
+	}
+
+	var containerIDs []string
+	seen := make(map[string]bool)
+	for _, requestedID := range opts.ContainerIDs {
+		containerJSON, err := docker.ContainerInspect(ctx, requestedID)
+		if err != nil {
+			return "", countDockerError("container_inspect", err)
+		}
+
+		if clusterID := containerJSON.Config.Labels["com.couchbase.dyncluster.cluster_id"]; clusterID != "" {
+			return "", badRequestf("container %s already belongs to cluster %s", requestedID, clusterID)
+		}
+		if clusterID, ok := importedClusterIDs[containerJSON.ID]; ok {
+			return "", badRequestf("container %s was already imported into cluster %s", requestedID, clusterID)
+		}
+		if seen[containerJSON.ID] {
+			return "", badRequestf("container %s is listed more than once", requestedID)
+		}
+		if containerJSON.NetworkSettings == nil || containerJSON.NetworkSettings.Networks[NetworkName] == nil {
+			return "", badRequestf("container %s is not on the %s network", requestedID, NetworkName)
+		}
+
+		seen[containerJSON.ID] = true
+		containerIDs = append(containerIDs, containerJSON.ID)
+	}
+
+	clusterID := newRandomClusterID()
+	timeoutTime := time.Now().Add(timeout)
+	meta := ClusterMeta{
+		Owner:     owner,
+		Timeout:   timeoutTime,
+		Tags:      opts.Tags,
+		Namespace: ContextNamespace(ctx),
+		CreatedAt: time.Now(),
+	}
+	clusterID, err = createUniqueClusterMeta(clusterID, meta)
+	if err != nil {
+		return "", err
+	}
+
+	for _, containerID := range containerIDs {
+		err := metaStore.PutImportedContainer(ImportedContainer{
+			ClusterID:   clusterID,
+			ContainerID: containerID,
+			ImportedAt:  time.Now(),
+		})
+		if err != nil {
+			// Leave the containers as they were rather than half imported
+			if err := metaStore.DeleteImportedContainers(clusterID); err != nil {
+				log.Printf("Failed to remove imported containers of cluster %s: %s", clusterID, err)
+			}
+			if err := metaStore.DeleteClusterMeta(clusterID); err != nil {
+				log.Printf("Failed to remove meta-data of cluster %s: %s", clusterID, err)
+			}
+			return "", err
+		}
+	}
+
+	recordClusterHistory(ctx, clusterID, HistoryEventImported, "", timeoutTime.Format(time.RFC3339))
+	return clusterID, nil
+}
@@ -0,0 +1,171 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// backgroundRoutine tracks a periodic routine of the daemon, so that one which is stuck or keeps failing can be
+// spotted before it causes user visible failures
+type backgroundRoutine struct {
+	lock         sync.Mutex
+	name         string
+	interval     func() time.Duration
+	runs         int
+	errors       int
+	lastRunAt    time.Time
+	runStartedAt time.Time
+	activity     string
+	lastError    string
+	lastErrorAt  time.Time
+}
+
+var cleanupRoutine = &backgroundRoutine{name: "cleanup", interval: func() time.Duration { return getConfig().cleanupInterval }}
+var schedulerRoutine = &backgroundRoutine{name: "scheduler", interval: func() time.Duration { return scheduleCheckInterval }}
+var auditRoutine = &backgroundRoutine{name: "audit", interval: func() time.Duration { return getConfig().auditInterval }}
+
+var backgroundRoutines = []*backgroundRoutine{cleanupRoutine, schedulerRoutine, auditRoutine}
+
+func (routine *backgroundRoutine) beginRun() {
+	routine.lock.Lock()
+	defer routine.lock.Unlock()
+
+	routine.runs++
+	routine.runStartedAt = time.Now()
+}
+
+func (routine *backgroundRoutine) endRun() {
+	routine.lock.Lock()
+	defer routine.lock.Unlock()
+
+	routine.lastRunAt = routine.runStartedAt
+	routine.runStartedAt = time.Time{}
+	routine.activity = ""
+}
+
+// track records what the routine is doing while fn runs, counting the error fn returns if any
+func (routine *backgroundRoutine) track(activity string, fn func() error) error {
+	routine.lock.Lock()
+	routine.activity = activity
+	routine.lock.Unlock()
+
+	err := fn()
+
+	routine.lock.Lock()
+	routine.activity = ""
+	if err != nil {
+		routine.errors++
+		routine.lastError = err.Error()
+		routine.lastErrorAt = time.Now()
+	}
+	routine.lock.Unlock()
+
+	return err
+}
+
+type RoutineState struct {
+	Name            string     `json:"name"`
+	Interval        string     `json:"interval"`
+	Running         bool       `json:"running"`
+	CurrentActivity string     `json:"current_activity,omitempty"`
+	RunningSince    *time.Time `json:"running_since,omitempty"`
+	LastRunAt       *time.Time `json:"last_run_at,omitempty"`
+	Runs            int        `json:"runs"`
+	Errors          int        `json:"errors"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+}
+
+func (routine *backgroundRoutine) state() RoutineState {
+	routine.lock.Lock()
+	defer routine.lock.Unlock()
+
+	optionalTime := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+
+	return RoutineState{
+		Name:            routine.name,
+		Interval:        routine.interval().String(),
+		Running:         !routine.runStartedAt.IsZero(),
+		CurrentActivity: routine.activity,
+		RunningSince:    optionalTime(routine.runStartedAt),
+		LastRunAt:       optionalTime(routine.lastRunAt),
+		Runs:            routine.runs,
+		Errors:          routine.errors,
+		LastError:       routine.lastError,
+		LastErrorAt:     optionalTime(routine.lastErrorAt),
+	}
+}
+
+type QueueDepths struct {
+	// InFlightOperations are the requests creating containers which shutdown waits for
+	InFlightOperations int `json:"in_flight_operations"`
+	PendingAllocations int `json:"pending_allocations"`
+	// ScheduledAllocations are waiting for their start, those which are due have yet to be picked up
+	ScheduledAllocations    int `json:"scheduled_allocations"`
+	DueScheduledAllocations int `json:"due_scheduled_allocations"`
+	IPReservations          int `json:"ip_reservations"`
+}
+
+type HostNodeUtilization struct {
+	UsedNodes int `json:"used_nodes"`
+	// MaxNodes is max-host-nodes, 0 when the host's capacity is not limited
+	MaxNodes int `json:"max_nodes"`
+}
+
+type DaemonInternals struct {
+	Draining  bool                `json:"draining"`
+	Routines  []RoutineState      `json:"routines"`
+	Queues    QueueDepths         `json:"queues"`
+	HostNodes HostNodeUtilization `json:"host_nodes"`
+}
+
+func getDaemonInternals(ctx context.Context) (*DaemonInternals, error) {
+	if !ContextIgnoreOwnership(ctx) {
+		return nil, forbiddenf("only admins can view the daemon internals")
+	}
+
+	internals := &DaemonInternals{}
+	for _, routine := range backgroundRoutines {
+		internals.Routines = append(internals.Routines, routine.state())
+	}
+
+	drainLock.Lock()
+	internals.Draining = draining
+	internals.Queues.InFlightOperations = inFlightCount
+	drainLock.Unlock()
+
+	pendingAllocationsLock.Lock()
+	internals.Queues.PendingAllocations = len(pendingAllocations)
+	pendingAllocationsLock.Unlock()
+
+	ipReservationsLock.Lock()
+	internals.Queues.IPReservations = len(ipReservations)
+	ipReservationsLock.Unlock()
+
+	schedules, err := metaStore.GetScheduledAllocations()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, schedule := range schedules {
+		internals.Queues.ScheduledAllocations++
+		if !schedule.StartAt.After(now) {
+			internals.Queues.DueScheduledAllocations++
+		}
+	}
+
+	clusters, err := getAllClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	internals.HostNodes.UsedNodes = countNodes(clusters)
+	internals.HostNodes.MaxNodes = getConfig().maxHostNodes
+
+	return internals, nil
+}
@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+)
+
+// ipReservations are the addresses handed to containers which have not started yet.  Docker only reports an
+// address as in use once its container is connected to the network, so without these two allocations in flight
+// could pick the same address.
+var ipReservations = make(map[string]bool)
+var ipReservationsLock sync.Mutex
+
+func validateIPRange(ipRange string) error {
+	if ipRange == "" {
+		return nil
+	}
+
+	ip, _, err := net.ParseCIDR(ipRange)
+	if err != nil {
+		return err
+	}
+	if ip.To4() == nil {
+		return errors.New("ip-range must be an IPv4 range")
+	}
+	return nil
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// checkIPRangeInNetwork makes sure ip-range lies within one of the subnets of the node network, as docker
+// refuses to create containers with addresses outside of them
+func checkIPRangeInNetwork(resource types.NetworkResource, ipNet *net.IPNet) error {
+	rangeSize, _ := ipNet.Mask.Size()
+	for _, config := range resource.IPAM.Config {
+		_, subnet, err := net.ParseCIDR(config.Subnet)
+		if err != nil {
+			continue
+		}
+		subnetSize, _ := subnet.Mask.Size()
+		if subnet.Contains(ipNet.IP) && subnetSize <= rangeSize {
+			return nil
+		}
+	}
+	return fmt.Errorf("ip-range %s is not within a subnet of the %s network", ipNet, NetworkName)
+}
+
+// usedNetworkIPs returns the addresses of the containers connected to the node network, along with its gateways.
+// Stopped containers are not connected to the network, but they keep the address they were created with, so
+// the addresses assigned to every container are included as well.
+func usedNetworkIPs(ctx context.Context, resource types.NetworkResource) (map[string]bool, error) {
+	used := make(map[string]bool)
+	for _, endpoint := range resource.Containers {
+		if ip, _, err := net.ParseCIDR(endpoint.IPv4Address); err == nil {
+			used[ip.String()] = true
+		}
+	}
+	for _, config := range resource.IPAM.Config {
+		if config.Gateway != "" {
+			used[config.Gateway] = true
+		}
+	}
+
+	containers, err := docker.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, countDockerError("container_list", err)
+	}
+	for _, container := range containers {
+		if container.NetworkSettings == nil {
+			continue
+		}
+		endpoint := container.NetworkSettings.Networks[NetworkName]
+		if endpoint == nil {
+			continue
+		}
+		if endpoint.IPAddress != "" {
+			used[endpoint.IPAddress] = true
+		}
+		if endpoint.IPAMConfig != nil && endpoint.IPAMConfig.IPv4Address != "" {
+			used[endpoint.IPAMConfig.IPv4Address] = true
+		}
+	}
+	return used, nil
+}
+
+// reserveContainerIP picks an address from ip-range which is neither in use nor reserved by another allocation,
+// returning the networking config to create the container with and a func which releases the reservation.  The
+// reservation must be held until the container has started.  Addresses are left to docker if ip-range is empty.
+func reserveContainerIP(ctx context.Context) (*network.NetworkingConfig, func(), error) {
+	ipRange := getConfig().ipRange
+	if ipRange == "" {
+		return nil, func() {}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(ipRange)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ipReservationsLock.Lock()
+	defer ipReservationsLock.Unlock()
+
+	resource, err := docker.NetworkInspect(ctx, NetworkName)
+	if err != nil {
+		return nil, nil, countDockerError("network_inspect", err)
+	}
+	if err := checkIPRangeInNetwork(resource, ipNet); err != nil {
+		return nil, nil, err
+	}
+
+	used, err := usedNetworkIPs(ctx, resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	networkIP := ipNet.IP.To4()
+	for ip := nextIP(networkIP); ipNet.Contains(ip); ip = nextIP(ip) {
+		address := ip.String()
+		// The last address of the range is its broadcast address
+		if !ipNet.Contains(nextIP(ip)) {
+			break
+		}
+		if used[address] || ipReservations[address] {
+			continue
+		}
+
+		ipReservations[address] = true
+		release := func() {
+			ipReservationsLock.Lock()
+			delete(ipReservations, address)
+			ipReservationsLock.Unlock()
+		}
+
+		return &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				NetworkName: {
+					IPAMConfig: &network.EndpointIPAMConfig{
+						IPv4Address: address,
+					},
+				},
+			},
+		}, release, nil
+	}
+
+	return nil, nil, fmt.Errorf("no free addresses left in ip-range %s", ipRange)
+}
@@ -0,0 +1,96 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ipPoolDocker fakes a node network with a running container and a stopped one with a static address
+func ipPoolDocker(subnet string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/networks/"+NetworkName):
+			w.Write([]byte(`{
+				"Name": "` + NetworkName + `",
+				"IPAM": {"Config": [{"Subnet": "` + subnet + `", "Gateway": "10.0.0.1"}]},
+				"Containers": {"running": {"IPv4Address": "10.0.0.2/24"}}
+			}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			w.Write([]byte(`[
+				{"Id": "running", "NetworkSettings": {"Networks": {"` + NetworkName + `": {"IPAddress": "10.0.0.2"}}}},
+				{"Id": "stopped", "NetworkSettings": {"Networks": {"` + NetworkName + `": {"IPAMConfig": {"IPv4Address": "10.0.0.3"}}}}}
+			]`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func TestReserveContainerIPConcurrently(t *testing.T) {
+	withTestConfig(t, func(config *reloadableConfig) {
+		config.ipRange = "10.0.0.0/28"
+	})
+	withTestDocker(t, ipPoolDocker("10.0.0.0/24"))
+
+	// 10.0.0.1 to 10.0.0.14 are usable, less the gateway, the running container and the stopped container
+	const free = 11
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	reserved := make(map[string]bool)
+	var releases []func()
+	var errs []error
+	for i := 0; i < free+2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			config, release, err := reserveContainerIP(context.Background())
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			address := config.EndpointsConfig[NetworkName].IPAMConfig.IPv4Address
+			if reserved[address] {
+				t.Errorf("address %s was reserved more than once", address)
+			}
+			reserved[address] = true
+			releases = append(releases, release)
+		}()
+	}
+	wg.Wait()
+
+	if len(reserved) != free {
+		t.Errorf("expected %d addresses to be reserved, got %d", free, len(reserved))
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected 2 reservations to fail once ip-range was exhausted, got %d", len(errs))
+	}
+	for _, used := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if reserved[used] {
+			t.Errorf("address %s is in use but was reserved", used)
+		}
+	}
+
+	for _, release := range releases {
+		release()
+	}
+}
+
+func TestReserveContainerIPOutsideNetwork(t *testing.T) {
+	withTestConfig(t, func(config *reloadableConfig) {
+		config.ipRange = "10.1.0.0/28"
+	})
+	withTestDocker(t, ipPoolDocker("10.0.0.0/24"))
+
+	_, _, err := reserveContainerIP(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "not within a subnet") {
+		t.Errorf("expected ip-range outside of the network to be rejected, got %v", err)
+	}
+}
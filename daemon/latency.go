@@ -0,0 +1,160 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var pingRttPattern = regexp.MustCompile(`rtt min/avg/max/mdev = ([0-9.]+)/([0-9.]+)/([0-9.]+)/([0-9.]+) ms`)
+
+type LatencyMeasurement struct {
+	From string
+	To   string
+	Min  time.Duration
+	Avg  time.Duration
+	Max  time.Duration
+	Err  error
+}
+
+type InjectLatencyOptions struct {
+	NodeID string
+	Delay  time.Duration
+	Jitter time.Duration
+}
+
+func parsePingMillis(value string) time.Duration {
+	ms, _ := strconv.ParseFloat(value, 64)
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+func pingNode(ctx context.Context, from *Node, to *Node) LatencyMeasurement {
+	measurement := LatencyMeasurement{
+		From: from.ContainerID,
+		To:   to.ContainerID,
+	}
+
+	out, err := execInContainer(ctx, from.ContainerID, []string{"ping", "-c", "3", "-i", "0.2", "-q", to.IPv4Address})
+	if err != nil {
+		measurement.Err = err
+		return measurement
+	}
+
+	matched := pingRttPattern.FindStringSubmatch(out)
+	if matched == nil {
+		measurement.Err = errors.New("could not parse ping output")
+		return measurement
+	}
+
+	measurement.Min = parsePingMillis(matched[1])
+	measurement.Avg = parsePingMillis(matched[2])
+	measurement.Max = parsePingMillis(matched[3])
+	return measurement
+}
+
+func getClusterLatency(ctx context.Context, clusterID string) ([]LatencyMeasurement, error) {
+	log.Printf("Measuring latency for cluster %s (requested by: %s)", clusterID, ContextRequester(ctx))
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	signal := make(chan LatencyMeasurement)
+
+	numPairs := 0
+	for _, from := range cluster.Nodes {
+		for _, to := range cluster.Nodes {
+			if from == to {
+				continue
+			}
+			numPairs++
+			go func(from, to *Node) {
+				signal <- pingNode(ctx, from, to)
+			}(from, to)
+		}
+	}
+
+	var measurements []LatencyMeasurement
+	for i := 0; i < numPairs; i++ {
+		measurements = append(measurements, <-signal)
+	}
+
+	return measurements, nil
+}
+
+func injectClusterLatency(ctx context.Context, clusterID string, opts InjectLatencyOptions) error {
+	log.Printf("Injecting %s latency into cluster %s (requested by: %s)", opts.Delay, clusterID, ContextRequester(ctx))
+
+	if opts.Delay <= 0 {
+		return badRequestf("must specify a positive delay")
+	}
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return err
+	}
+
+	cmd := []string{"tc", "qdisc", "replace", "dev", "eth0", "root", "netem", "delay",
+		strconv.FormatInt(opts.Delay.Milliseconds(), 10) + "ms"}
+	if opts.Jitter > 0 {
+		cmd = append(cmd, strconv.FormatInt(opts.Jitter.Milliseconds(), 10)+"ms")
+	}
+
+	return execOnClusterNodes(ctx, cluster, opts.NodeID, cmd)
+}
+
+func resetClusterLatency(ctx context.Context, clusterID string, nodeID string) error {
+	log.Printf("Resetting latency for cluster %s (requested by: %s)", clusterID, ContextRequester(ctx))
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return err
+	}
+
+	return execOnClusterNodes(ctx, cluster, nodeID, []string{"tc", "qdisc", "del", "dev", "eth0", "root", "netem"})
+}
+
+// execOnClusterNodes runs the command on a single node when nodeID is set, or every node otherwise
+func execOnClusterNodes(ctx context.Context, cluster *Cluster, nodeID string, cmd []string) error {
+	var nodes []*Node
+	for _, node := range cluster.Nodes {
+		if nodeID == "" || node.ContainerID == nodeID {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return &NodeNotFoundError{ClusterID: cluster.ID, NodeID: nodeID}
+	}
+
+	signal := make(chan error)
+
+	for _, node := range nodes {
+		go func(node *Node) {
+			_, err := execInContainer(ctx, node.ContainerID, cmd)
+			signal <- err
+		}(node)
+	}
+
+	var execError error
+	for range nodes {
+		err := <-signal
+		if err != nil && execError == nil {
+			execError = err
+		}
+	}
+
+	return execError
+}
@@ -0,0 +1,50 @@
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// textLogger is slog's own default logger, which writes through the log package in the daemon's usual format
+var textLogger = slog.Default()
+
+var jsonLogLevel = new(slog.LevelVar)
+
+func parseLogLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("log level must be one of debug, info, warn or error")
+	}
+	return parsed, nil
+}
+
+func validateLogFormat(format string) error {
+	if format != LogFormatText && format != LogFormatJSON {
+		return fmt.Errorf("log format must be %s or %s", LogFormatText, LogFormatJSON)
+	}
+	return nil
+}
+
+// configureLogging switches the daemon's logs between the human-readable text format and JSON.  Messages still
+// logged through the log package are included in JSON output at the info level.
+func configureLogging(format string, level slog.Level) {
+	if format == LogFormatJSON {
+		jsonLogLevel.Set(level)
+		slog.SetLogLoggerLevel(slog.LevelInfo)
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: jsonLogLevel})))
+		return
+	}
+
+	// Setting the JSON logger as the default redirected the log package into it
+	log.SetOutput(os.Stderr)
+	log.SetFlags(log.LstdFlags)
+	slog.SetDefault(textLogger)
+	slog.SetLogLoggerLevel(level)
+}
@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"fmt"
+)
+
+// MemoryQuotas are the per-service memory quotas of a cluster in MB, they are applied when the cluster is set up.
+// A quota of 0 leaves the service with couchbase's default quota.
+type MemoryQuotas struct {
+	Data      int `json:"data,omitempty"`
+	Index     int `json:"index,omitempty"`
+	Search    int `json:"search,omitempty"`
+	Eventing  int `json:"eventing,omitempty"`
+	Analytics int `json:"analytics,omitempty"`
+}
+
+var memoryQuotaServices = []string{"data", "index", "search", "eventing", "analytics"}
+
+// minMemoryQuotas are the smallest quotas couchbase accepts for each service, in MB
+var minMemoryQuotas = map[string]int{
+	"data":      256,
+	"index":     256,
+	"search":    256,
+	"eventing":  256,
+	"analytics": 1024,
+}
+
+func (quotas *MemoryQuotas) byService() map[string]int {
+	return map[string]int{
+		"data":      quotas.Data,
+		"index":     quotas.Index,
+		"search":    quotas.Search,
+		"eventing":  quotas.Eventing,
+		"analytics": quotas.Analytics,
+	}
+}
+
+func (quotas *MemoryQuotas) total() int {
+	return quotas.Data + quotas.Index + quotas.Search + quotas.Eventing + quotas.Analytics
+}
+
+// restParams returns the non-data quotas keyed by the /pools/default parameter which sets them, the data quota
+// is set separately as the cluster's memoryQuota
+func (quotas *MemoryQuotas) restParams() map[string]int {
+	if quotas == nil {
+		return nil
+	}
+
+	params := make(map[string]int)
+	for param, quota := range map[string]int{
+		"indexMemoryQuota":    quotas.Index,
+		"ftsMemoryQuota":      quotas.Search,
+		"eventingMemoryQuota": quotas.Eventing,
+		"cbasMemoryQuota":     quotas.Analytics,
+	} {
+		if quota > 0 {
+			params[param] = quota
+		}
+	}
+	return params
+}
+
+// validateMemoryQuotas makes sure each quota is one couchbase accepts and that the quotas combined fit within the
+// memory limit of every node which has one, as every node of a cluster shares the same quotas
+func validateMemoryQuotas(quotas *MemoryQuotas, nodes []NodeOptions) error {
+	if quotas == nil {
+		return nil
+	}
+
+	quotasByService := quotas.byService()
+	for _, service := range memoryQuotaServices {
+		quota := quotasByService[service]
+		if quota < 0 {
+			return badRequestf("%s memory quota cannot be negative", service)
+		}
+		if quota > 0 && quota < minMemoryQuotas[service] {
+			return badRequestf("%s memory quota must be at least %dMB", service, minMemoryQuotas[service])
+		}
+	}
+
+	total := quotas.total()
+	if total == 0 {
+		return badRequestf("memory quotas must set the quota of at least one service")
+	}
+
+	for nodeIdx, node := range nodes {
+		if node.MemoryMB > 0 && int64(total) > node.MemoryMB {
+			nodeName := node.Name
+			if nodeName == "" {
+				nodeName = fmt.Sprintf("node_%d", nodeIdx+1)
+			}
+			return badRequestf("memory quotas total %dMB which does not fit within the %dMB memory limit of %s",
+				total, node.MemoryMB, nodeName)
+		}
+	}
+	return nil
+}
@@ -11,28 +11,157 @@ import (
 )
 
 type ClusterMetaJSON struct {
-	Owner   string `json:"owner,omitempty"`
-	Timeout string `json:"timeout,omitempty"`
+	Owner             string                `json:"owner,omitempty"`
+	Timeout           string                `json:"timeout,omitempty"`
+	SyncGatewayID     string                `json:"sync_gateway_id,omitempty"`
+	SyncGateway       *SyncGatewayOptions   `json:"sync_gateway,omitempty"`
+	StartDelay        string                `json:"start_delay,omitempty"`
+	StartOrder        []string              `json:"start_order,omitempty"`
+	GenerationID      string                `json:"generation_id,omitempty"`
+	AuthorizedOwners  []string              `json:"authorized_owners,omitempty"`
+	Name              string                `json:"name,omitempty"`
+	Placement         *PlacementConstraints `json:"placement,omitempty"`
+	ResolvedPlacement map[string][]string   `json:"resolved_placement,omitempty"`
+	RequestedNodes    int                   `json:"requested_nodes,omitempty"`
+	Tags              map[string]string     `json:"tags,omitempty"`
+	Orchestrator      string                `json:"orchestrator,omitempty"`
+	Registry          string                `json:"registry,omitempty"`
+	Namespace         string                `json:"namespace,omitempty"`
+	CreatedAt         string                `json:"created_at,omitempty"`
+	Pending           bool                  `json:"pending,omitempty"`
+	MemoryQuotas      *MemoryQuotas         `json:"memory_quotas,omitempty"`
+	TerminateAt       string                `json:"terminate_at,omitempty"`
+	TerminatedBy      string                `json:"terminated_by,omitempty"`
+	DNSNodes          []string              `json:"dns_nodes,omitempty"`
+	Frozen            bool                  `json:"frozen,omitempty"`
 }
 
 type ClusterMeta struct {
-	Owner   string
-	Timeout time.Time
+	Owner             string
+	Timeout           time.Time
+	SyncGatewayID     string
+	StartDelay        time.Duration
+	StartOrder        []string
+	GenerationID      string
+	AuthorizedOwners  []string
+	Name              string
+	Placement         *PlacementConstraints
+	ResolvedPlacement map[string][]string
+	RequestedNodes    int
+	Tags              map[string]string
+	// Orchestrator is the ID of the node which was initialized first during setup
+	Orchestrator string
+	// Registry is where the images of the cluster's nodes were pulled from, if not the daemon's docker-registry
+	Registry string
+	// Namespace scopes the cluster to the requesters of the same namespace
+	Namespace string
+	CreatedAt time.Time
+	// Pending is set until all of the cluster's containers have been started
+	Pending bool
+	// MemoryQuotas are the service memory quotas the cluster was allocated with
+	MemoryQuotas *MemoryQuotas
+	// TerminateAt is when a cluster which was deleted during termination-grace is killed, zero if it was not
+	TerminateAt  time.Time
+	TerminatedBy string
+	// Frozen clusters are never killed automatically, neither when they expire nor to reclaim capacity
+	Frozen bool
+	// DNSNodes are the container names of the nodes which were registered on the restful DNS server
+	DNSNodes []string
+	// SyncGateway is the sync gateway which setup starts once it has created its bucket
+	SyncGateway *SyncGatewayOptions
+}
+
+// Store is where the daemon keeps the meta-data of its clusters.  MetaDataStore keeps it on local disk, while
+// CouchbaseStore keeps it in a bucket so that several daemons can share it.
+type Store interface {
+	Close() error
+	// Ping checks the store is open and reachable
+	Ping() error
+
+	CreateClusterMeta(clusterID string, meta ClusterMeta) error
+	DeleteClusterMeta(clusterID string) error
+	UpdateClusterMeta(clusterID string, updateFunc UpdateClusterMetaFunc) error
+	GetClusterMeta(clusterID string) (ClusterMeta, error)
+
+	PutTombstone(tombstone ClusterTombstone) error
+	GetTombstones() ([]ClusterTombstone, error)
+	DeleteTombstone(clusterID string) error
+
+	PutCheckpoint(checkpoint ClusterCheckpoint) error
+	GetCheckpoints(clusterID string) ([]ClusterCheckpoint, error)
+	DeleteCheckpoints(clusterID string) error
+
+	PutPartition(partition NodePartition) error
+	GetPartitions(clusterID string) ([]NodePartition, error)
+	DeletePartition(clusterID string, nodeID string) error
+	DeletePartitions(clusterID string) error
+
+	PutThrottle(throttle NodeThrottle) error
+	GetThrottles(clusterID string) ([]NodeThrottle, error)
+	DeleteThrottle(clusterID string, nodeID string) error
+	DeleteThrottles(clusterID string) error
+
+	AppendClusterHistory(entry ClusterHistoryEntry) error
+	GetClusterHistory(clusterID string) ([]ClusterHistoryEntry, error)
+	DeleteClusterHistory(clusterID string) error
+
+	PutScheduledAllocation(schedule ScheduledAllocation) error
+	GetScheduledAllocation(scheduleID string) (ScheduledAllocation, error)
+	GetScheduledAllocations() ([]ScheduledAllocation, error)
+	DeleteScheduledAllocation(scheduleID string) error
+
+	PutImportedContainer(imported ImportedContainer) error
+	GetImportedContainers() ([]ImportedContainer, error)
+	DeleteImportedContainers(clusterID string) error
 }
 
 type MetaDataStore struct {
-	db *badger.DB
+	db     *badger.DB
+	closed bool
 }
 
+// errClusterMetaExists is returned when creating the meta-data of a cluster ID which is already in use
+var errClusterMetaExists = errors.New("cluster meta-data already existed")
+
+// errClusterMetaNotFound is returned when getting the meta-data of a cluster the store has no record of
+var errClusterMetaNotFound = errors.New("cluster meta-data does not exist")
+
 var DEFAULT_CLUSTER_META ClusterMeta = ClusterMeta{
 	Owner:   "unknown",
 	Timeout: DEFAULT_CLUSTER_TIMEOUT,
 }
 
-func (store *MetaDataStore) serializeMeta(meta ClusterMeta) ([]byte, error) {
+func serializeMeta(meta ClusterMeta) ([]byte, error) {
 	metaJSON := ClusterMetaJSON{
-		Owner:   meta.Owner,
-		Timeout: meta.Timeout.Format(time.RFC3339),
+		Owner:             meta.Owner,
+		Timeout:           meta.Timeout.Format(time.RFC3339),
+		SyncGatewayID:     meta.SyncGatewayID,
+		SyncGateway:       meta.SyncGateway,
+		StartOrder:        meta.StartOrder,
+		GenerationID:      meta.GenerationID,
+		AuthorizedOwners:  meta.AuthorizedOwners,
+		Name:              meta.Name,
+		Placement:         meta.Placement,
+		ResolvedPlacement: meta.ResolvedPlacement,
+		RequestedNodes:    meta.RequestedNodes,
+		Tags:              meta.Tags,
+		Orchestrator:      meta.Orchestrator,
+		Registry:          meta.Registry,
+		Namespace:         meta.Namespace,
+		Pending:           meta.Pending,
+		MemoryQuotas:      meta.MemoryQuotas,
+		DNSNodes:          meta.DNSNodes,
+		Frozen:            meta.Frozen,
+	}
+	if meta.StartDelay > 0 {
+		metaJSON.StartDelay = meta.StartDelay.String()
+	}
+	if !meta.CreatedAt.IsZero() {
+		metaJSON.CreatedAt = meta.CreatedAt.Format(time.RFC3339Nano)
+	}
+	if !meta.TerminateAt.IsZero() {
+		metaJSON.TerminateAt = meta.TerminateAt.Format(time.RFC3339Nano)
+		metaJSON.TerminatedBy = meta.TerminatedBy
 	}
 
 	metaBytes, err := json.Marshal(metaJSON)
@@ -43,7 +172,7 @@ func (store *MetaDataStore) serializeMeta(meta ClusterMeta) ([]byte, error) {
 	return metaBytes, nil
 }
 
-func (store *MetaDataStore) deserializeMeta(bytes []byte) (ClusterMeta, error) {
+func deserializeMeta(bytes []byte) (ClusterMeta, error) {
 	var metaJSON ClusterMetaJSON
 	err := json.Unmarshal(bytes, &metaJSON)
 	if err != nil {
@@ -55,9 +184,46 @@ func (store *MetaDataStore) deserializeMeta(bytes []byte) (ClusterMeta, error) {
 		parsedTimeout = DEFAULT_CLUSTER_TIMEOUT
 	}
 
+	var parsedStartDelay time.Duration
+	if metaJSON.StartDelay != "" {
+		parsedStartDelay, _ = time.ParseDuration(metaJSON.StartDelay)
+	}
+
+	// Clusters allocated before creation times were recorded have none
+	var parsedCreatedAt time.Time
+	if metaJSON.CreatedAt != "" {
+		parsedCreatedAt, _ = time.Parse(time.RFC3339Nano, metaJSON.CreatedAt)
+	}
+
+	var parsedTerminateAt time.Time
+	if metaJSON.TerminateAt != "" {
+		parsedTerminateAt, _ = time.Parse(time.RFC3339Nano, metaJSON.TerminateAt)
+	}
+
 	return ClusterMeta{
-		Owner:   metaJSON.Owner,
-		Timeout: parsedTimeout,
+		Owner:             metaJSON.Owner,
+		Timeout:           parsedTimeout,
+		SyncGatewayID:     metaJSON.SyncGatewayID,
+		SyncGateway:       metaJSON.SyncGateway,
+		StartDelay:        parsedStartDelay,
+		StartOrder:        metaJSON.StartOrder,
+		GenerationID:      metaJSON.GenerationID,
+		AuthorizedOwners:  metaJSON.AuthorizedOwners,
+		Name:              metaJSON.Name,
+		Placement:         metaJSON.Placement,
+		ResolvedPlacement: metaJSON.ResolvedPlacement,
+		RequestedNodes:    metaJSON.RequestedNodes,
+		Tags:              metaJSON.Tags,
+		Orchestrator:      metaJSON.Orchestrator,
+		Registry:          metaJSON.Registry,
+		Namespace:         metaJSON.Namespace,
+		CreatedAt:         parsedCreatedAt,
+		Pending:           metaJSON.Pending,
+		MemoryQuotas:      metaJSON.MemoryQuotas,
+		TerminateAt:       parsedTerminateAt,
+		TerminatedBy:      metaJSON.TerminatedBy,
+		DNSNodes:          metaJSON.DNSNodes,
+		Frozen:            metaJSON.Frozen,
 	}, nil
 }
 
@@ -73,13 +239,26 @@ func (store *MetaDataStore) Open(dir string) error {
 }
 
 func (store *MetaDataStore) Close() error {
-	return store.db.Close()
+	if err := store.db.Close(); err != nil {
+		return err
+	}
+	store.closed = true
+	return nil
+}
+
+func (store *MetaDataStore) Ping() error {
+	if store.db == nil || store.closed {
+		return errors.New("meta-data store is not open")
+	}
+	return store.db.View(func(txn *badger.Txn) error {
+		return nil
+	})
 }
 
 func (store *MetaDataStore) CreateClusterMeta(clusterID string, meta ClusterMeta) error {
 	clusterKey := []byte(fmt.Sprintf("cluster-%s", clusterID))
 
-	metaBytes, err := store.serializeMeta(meta)
+	metaBytes, err := serializeMeta(meta)
 	if err != nil {
 		return err
 	}
@@ -87,7 +266,7 @@ func (store *MetaDataStore) CreateClusterMeta(clusterID string, meta ClusterMeta
 	err = store.db.Update(func(txn *badger.Txn) error {
 		_, err := txn.Get(clusterKey)
 		if err == nil {
-			return errors.New("cluster meta-data already existed")
+			return errClusterMetaExists
 		}
 
 		err = txn.Set(clusterKey, metaBytes)
@@ -100,6 +279,13 @@ func (store *MetaDataStore) CreateClusterMeta(clusterID string, meta ClusterMeta
 	return nil
 }
 
+func (store *MetaDataStore) DeleteClusterMeta(clusterID string) error {
+	clusterKey := []byte(fmt.Sprintf("cluster-%s", clusterID))
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(clusterKey)
+	})
+}
+
 type UpdateClusterMetaFunc func(ClusterMeta) (ClusterMeta, error)
 
 func (store *MetaDataStore) UpdateClusterMeta(clusterID string, updateFunc UpdateClusterMetaFunc) error {
@@ -115,7 +301,7 @@ func (store *MetaDataStore) UpdateClusterMeta(clusterID string, updateFunc Updat
 			return err
 		}
 
-		meta, err := store.deserializeMeta(metaBytes)
+		meta, err := deserializeMeta(metaBytes)
 		if err != nil {
 			return err
 		}
@@ -125,7 +311,7 @@ func (store *MetaDataStore) UpdateClusterMeta(clusterID string, updateFunc Updat
 			return err
 		}
 
-		metaBytes, err = store.serializeMeta(meta)
+		metaBytes, err = serializeMeta(meta)
 		if err != nil {
 			return err
 		}
@@ -152,7 +338,9 @@ func (store *MetaDataStore) GetClusterMeta(clusterID string) (ClusterMeta, error
 	}()
 	err := store.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(clusterKey)
-		if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return errClusterMetaNotFound
+		} else if err != nil {
 			return err
 		}
 
@@ -161,7 +349,7 @@ func (store *MetaDataStore) GetClusterMeta(clusterID string) (ClusterMeta, error
 			return err
 		}
 
-		meta, err = store.deserializeMeta(metaBytes)
+		meta, err = deserializeMeta(metaBytes)
 		if err != nil {
 			return err
 		}
@@ -174,3 +362,466 @@ func (store *MetaDataStore) GetClusterMeta(clusterID string) (ClusterMeta, error
 
 	return meta, nil
 }
+
+func (store *MetaDataStore) PutTombstone(tombstone ClusterTombstone) error {
+	tombstoneKey := []byte(fmt.Sprintf("tombstone-%s", tombstone.ClusterID))
+
+	tombstoneBytes, err := json.Marshal(tombstone)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(tombstoneKey, tombstoneBytes)
+	})
+}
+
+func (store *MetaDataStore) GetTombstones() ([]ClusterTombstone, error) {
+	prefix := []byte("tombstone-")
+
+	var tombstones []ClusterTombstone
+	err := store.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			tombstoneBytes, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var tombstone ClusterTombstone
+			if err := json.Unmarshal(tombstoneBytes, &tombstone); err != nil {
+				return err
+			}
+			tombstones = append(tombstones, tombstone)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tombstones, nil
+}
+
+func (store *MetaDataStore) DeleteTombstone(clusterID string) error {
+	tombstoneKey := []byte(fmt.Sprintf("tombstone-%s", clusterID))
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(tombstoneKey)
+	})
+}
+
+func (store *MetaDataStore) PutCheckpoint(checkpoint ClusterCheckpoint) error {
+	checkpointKey := []byte(fmt.Sprintf("checkpoint-%s-%s", checkpoint.ClusterID, checkpoint.Label))
+
+	checkpointBytes, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		_, err := txn.Get(checkpointKey)
+		if err == nil {
+			return badRequestf("checkpoint %s already exists", checkpoint.Label)
+		}
+
+		return txn.Set(checkpointKey, checkpointBytes)
+	})
+}
+
+func (store *MetaDataStore) GetCheckpoints(clusterID string) ([]ClusterCheckpoint, error) {
+	prefix := []byte(fmt.Sprintf("checkpoint-%s-", clusterID))
+
+	var checkpoints []ClusterCheckpoint
+	err := store.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			checkpointBytes, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var checkpoint ClusterCheckpoint
+			if err := json.Unmarshal(checkpointBytes, &checkpoint); err != nil {
+				return err
+			}
+			checkpoints = append(checkpoints, checkpoint)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
+
+func (store *MetaDataStore) DeleteCheckpoints(clusterID string) error {
+	prefix := []byte(fmt.Sprintf("checkpoint-%s-", clusterID))
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		var keys [][]byte
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *MetaDataStore) PutPartition(partition NodePartition) error {
+	partitionKey := []byte(fmt.Sprintf("partition-%s-%s", partition.ClusterID, partition.NodeID))
+
+	partitionBytes, err := json.Marshal(partition)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(partitionKey, partitionBytes)
+	})
+}
+
+func (store *MetaDataStore) GetPartitions(clusterID string) ([]NodePartition, error) {
+	prefix := []byte(fmt.Sprintf("partition-%s-", clusterID))
+
+	var partitions []NodePartition
+	err := store.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			partitionBytes, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var partition NodePartition
+			if err := json.Unmarshal(partitionBytes, &partition); err != nil {
+				return err
+			}
+			partitions = append(partitions, partition)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return partitions, nil
+}
+
+func (store *MetaDataStore) DeletePartition(clusterID string, nodeID string) error {
+	partitionKey := []byte(fmt.Sprintf("partition-%s-%s", clusterID, nodeID))
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(partitionKey)
+	})
+}
+
+func (store *MetaDataStore) DeletePartitions(clusterID string) error {
+	prefix := []byte(fmt.Sprintf("partition-%s-", clusterID))
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		var keys [][]byte
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *MetaDataStore) PutThrottle(throttle NodeThrottle) error {
+	throttleKey := []byte(fmt.Sprintf("throttle-%s-%s", throttle.ClusterID, throttle.NodeID))
+
+	throttleBytes, err := json.Marshal(throttle)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(throttleKey, throttleBytes)
+	})
+}
+
+func (store *MetaDataStore) GetThrottles(clusterID string) ([]NodeThrottle, error) {
+	prefix := []byte(fmt.Sprintf("throttle-%s-", clusterID))
+
+	var throttles []NodeThrottle
+	err := store.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			throttleBytes, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var throttle NodeThrottle
+			if err := json.Unmarshal(throttleBytes, &throttle); err != nil {
+				return err
+			}
+			throttles = append(throttles, throttle)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return throttles, nil
+}
+
+func (store *MetaDataStore) DeleteThrottle(clusterID string, nodeID string) error {
+	throttleKey := []byte(fmt.Sprintf("throttle-%s-%s", clusterID, nodeID))
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(throttleKey)
+	})
+}
+
+func (store *MetaDataStore) DeleteThrottles(clusterID string) error {
+	prefix := []byte(fmt.Sprintf("throttle-%s-", clusterID))
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		var keys [][]byte
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *MetaDataStore) AppendClusterHistory(entry ClusterHistoryEntry) error {
+	// Keys are ordered by time so that iterating the prefix returns the history in order
+	historyKey := []byte(fmt.Sprintf("history-%s-%020d", entry.ClusterID, entry.Time.UnixNano()))
+
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(historyKey, entryBytes)
+	})
+}
+
+func (store *MetaDataStore) GetClusterHistory(clusterID string) ([]ClusterHistoryEntry, error) {
+	prefix := []byte(fmt.Sprintf("history-%s-", clusterID))
+
+	var history []ClusterHistoryEntry
+	err := store.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			entryBytes, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var entry ClusterHistoryEntry
+			if err := json.Unmarshal(entryBytes, &entry); err != nil {
+				return err
+			}
+			history = append(history, entry)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+func (store *MetaDataStore) DeleteClusterHistory(clusterID string) error {
+	prefix := []byte(fmt.Sprintf("history-%s-", clusterID))
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		var keys [][]byte
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *MetaDataStore) PutScheduledAllocation(schedule ScheduledAllocation) error {
+	scheduleKey := []byte(fmt.Sprintf("schedule-%s", schedule.ID))
+
+	scheduleBytes, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(scheduleKey, scheduleBytes)
+	})
+}
+
+func (store *MetaDataStore) GetScheduledAllocation(scheduleID string) (ScheduledAllocation, error) {
+	scheduleKey := []byte(fmt.Sprintf("schedule-%s", scheduleID))
+
+	var schedule ScheduledAllocation
+	err := store.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(scheduleKey)
+		if err == badger.ErrKeyNotFound {
+			return notFoundf("scheduled allocation %s does not exist", scheduleID)
+		} else if err != nil {
+			return err
+		}
+
+		scheduleBytes, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		return json.Unmarshal(scheduleBytes, &schedule)
+	})
+	if err != nil {
+		return ScheduledAllocation{}, err
+	}
+
+	return schedule, nil
+}
+
+func (store *MetaDataStore) GetScheduledAllocations() ([]ScheduledAllocation, error) {
+	prefix := []byte("schedule-")
+
+	var schedules []ScheduledAllocation
+	err := store.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			scheduleBytes, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var schedule ScheduledAllocation
+			if err := json.Unmarshal(scheduleBytes, &schedule); err != nil {
+				return err
+			}
+			schedules = append(schedules, schedule)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (store *MetaDataStore) DeleteScheduledAllocation(scheduleID string) error {
+	scheduleKey := []byte(fmt.Sprintf("schedule-%s", scheduleID))
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(scheduleKey)
+	})
+}
+
+func (store *MetaDataStore) PutImportedContainer(imported ImportedContainer) error {
+	importKey := []byte(fmt.Sprintf("import-%s-%s", imported.ClusterID, imported.ContainerID))
+
+	importBytes, err := json.Marshal(imported)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(importKey, importBytes)
+	})
+}
+
+func (store *MetaDataStore) GetImportedContainers() ([]ImportedContainer, error) {
+	prefix := []byte("import-")
+
+	var imports []ImportedContainer
+	err := store.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			importBytes, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var imported ImportedContainer
+			if err := json.Unmarshal(importBytes, &imported); err != nil {
+				return err
+			}
+			imports = append(imports, imported)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return imports, nil
+}
+
+func (store *MetaDataStore) DeleteImportedContainers(clusterID string) error {
+	prefix := []byte(fmt.Sprintf("import-%s-", clusterID))
+
+	return store.db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		var keys [][]byte
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
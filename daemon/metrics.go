@@ -0,0 +1,86 @@
+package daemon
+
+import (
+	"log"
+
+	"github.com/docker/docker/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cleanupRunsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cbdynclusterd_cleanup_runs_total",
+		Help: "Number of times expired clusters have been cleaned up.",
+	})
+	cleanupKilledClustersTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cbdynclusterd_cleanup_killed_clusters_total",
+		Help: "Number of expired clusters killed by cleanup.",
+	}, []string{"owner"})
+	allocationDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cbdynclusterd_allocation_duration_seconds",
+		Help:    "How long allocating a cluster took, including any retries.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"result"})
+	dockerAPIErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cbdynclusterd_docker_api_errors_total",
+		Help: "Number of docker API calls which failed.",
+	}, []string{"operation"})
+)
+
+var (
+	activeClustersDesc = prometheus.NewDesc("cbdynclusterd_active_clusters",
+		"Number of clusters which currently exist.", []string{"owner"}, nil)
+	activeNodesDesc = prometheus.NewDesc("cbdynclusterd_active_nodes",
+		"Number of nodes across the clusters which currently exist.", []string{"owner"}, nil)
+)
+
+// clusterCollector reports the clusters which exist when scraped, rather than tracking them as they come and go
+type clusterCollector struct{}
+
+func (c clusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeClustersDesc
+	ch <- activeNodesDesc
+}
+
+func (c clusterCollector) Collect(ch chan<- prometheus.Metric) {
+	clusters, err := getAllClusters(systemCtx)
+	if err != nil {
+		log.Printf("Failed to fetch clusters for metrics: %s", err)
+		return
+	}
+
+	clusterCounts := make(map[string]int)
+	nodeCounts := make(map[string]int)
+	for _, cluster := range clusters {
+		clusterCounts[cluster.Owner]++
+		nodeCounts[cluster.Owner] += len(cluster.Nodes)
+	}
+
+	for owner, count := range clusterCounts {
+		ch <- prometheus.MustNewConstMetric(activeClustersDesc, prometheus.GaugeValue, float64(count), owner)
+		ch <- prometheus.MustNewConstMetric(activeNodesDesc, prometheus.GaugeValue, float64(nodeCounts[owner]), owner)
+	}
+}
+
+func init() {
+	prometheus.MustRegister(
+		cleanupRunsTotal,
+		cleanupKilledClustersTotal,
+		allocationDurationSeconds,
+		dockerAPIErrorsTotal,
+		clusterCollector{},
+	)
+}
+
+// countDockerError counts a failed docker API call, returning the error wrapped as a DockerError so the REST API
+// reports it as a docker failure.  Objects which are not found are often expected by the caller, so they are not
+// counted.
+func countDockerError(operation string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		dockerAPIErrorsTotal.WithLabelValues(operation).Inc()
+	}
+	return &DockerError{Operation: operation, Err: err}
+}
@@ -0,0 +1,95 @@
+package daemon
+
+import (
+	"context"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// NamespaceConfig is a namespace configured in the config file under [namespaces."team-a"].  Owners lists the
+// owners whose requests default to the namespace, which may be an email domain such as "@couchbase.com" to
+// include a whole team.  MaxNodes limits the nodes of all the namespace's clusters combined, 0 is unlimited.
+type NamespaceConfig struct {
+	Owners   []string `mapstructure:"owners"`
+	MaxNodes int      `mapstructure:"max_nodes"`
+}
+
+// loadNamespaces returns the configured namespaces, along with the namespace of each of their owners
+func loadNamespaces() (map[string]NamespaceConfig, map[string]string, error) {
+	configured := make(map[string]NamespaceConfig)
+	if err := viper.UnmarshalKey("namespaces", &configured); err != nil {
+		return nil, nil, err
+	}
+
+	namespaces := make(map[string]NamespaceConfig)
+	ownerNamespaces := make(map[string]string)
+	for namespace, config := range configured {
+		namespace = strings.ToLower(namespace)
+		namespaces[namespace] = config
+		for _, owner := range config.Owners {
+			ownerNamespaces[strings.ToLower(owner)] = namespace
+		}
+	}
+	return namespaces, ownerNamespaces, nil
+}
+
+// getOwnerNamespace returns the namespace an owner belongs to, an owner's own namespace takes precedence over
+// their team's.  Owners which are in no namespace share the default empty namespace.
+func getOwnerNamespace(owner string) string {
+	ownerNamespaces := getConfig().ownerNamespaces
+	owner = strings.ToLower(owner)
+	if namespace, ok := ownerNamespaces[owner]; ok {
+		return namespace
+	}
+	if atIdx := strings.LastIndex(owner, "@"); atIdx >= 0 {
+		return ownerNamespaces[owner[atIdx:]]
+	}
+	return ""
+}
+
+// resolveNamespace picks the namespace of a request, which is the requested namespace if there is one and the
+// owner's namespace otherwise.  Only admins can use a namespace other than their own, or a configured namespace
+// they are not a member of.
+func resolveNamespace(owner string, requested string, isAdmin bool) (string, error) {
+	ownNamespace := getOwnerNamespace(owner)
+	requested = strings.ToLower(requested)
+	if requested == "" || requested == ownNamespace || isAdmin {
+		if requested == "" {
+			return ownNamespace, nil
+		}
+		return requested, nil
+	}
+
+	if _, configured := getConfig().namespaces[requested]; ownNamespace != "" || configured {
+		return "", forbiddenf("%s is not a member of namespace %s", owner, requested)
+	}
+	return requested, nil
+}
+
+// checkNamespaceCapacity makes sure allocating this many more nodes stays within the max_nodes of the requester's
+// namespace
+func checkNamespaceCapacity(ctx context.Context, nodes int) error {
+	namespace := ContextNamespace(ctx)
+	maxNodes := getConfig().namespaces[namespace].MaxNodes
+	if namespace == "" || maxNodes == 0 {
+		return nil
+	}
+
+	clusters, err := getAllClusters(NewContext(ctx, ContextUser(ctx), true))
+	if err != nil {
+		return err
+	}
+
+	var usedNodes int
+	for _, cluster := range clusters {
+		if cluster.Namespace == namespace {
+			usedNodes += len(cluster.Nodes)
+		}
+	}
+
+	if usedNodes+nodes > maxNodes {
+		return badRequestf("namespace %s is limited to %d nodes and already has %d", namespace, maxNodes, usedNodes)
+	}
+	return nil
+}
@@ -4,20 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/couchbaselabs/cbdynclusterd/cluster"
-	"github.com/couchbaselabs/cbdynclusterd/helper"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
-	"github.com/golang/glog"
+	"github.com/docker/docker/client"
 )
 
 var NetworkName = "macvlan0"
 
+var stopSignalRegexp = regexp.MustCompile(`^((SIG)?[A-Z][A-Z0-9+-]*|[1-9][0-9]*)$`)
+
 type Edition string
 
 const (
@@ -30,6 +36,285 @@ type NodeOptions struct {
 	Platform      string
 	ServerVersion string
 	VersionInfo   *NodeVersion
+	// Edition is the edition of the server image the node runs
+	Edition       Edition
+	DataPath      string
+	IndexPath     string
+	AnalyticsPath string
+	ServerGroup   string
+	// Role is a free-form label for the client's own orchestration, such as "failover-target"
+	Role string
+	// Services are the services the node is initialized with during setup, such as "kv" or "index"
+	Services []string
+	// MemoryMB limits the memory of the node's container, 0 is unlimited
+	MemoryMB int64
+	// MemorySwapMB is the total memory and swap the node may use, -1 allows unlimited swap
+	MemorySwapMB     int64
+	MemorySwappiness *int64
+	// CPUs limits how many of the docker host's CPUs the node may use, such as 1.5, 0 is unlimited
+	CPUs float64
+	// CPUShares is the node's weight relative to other containers when CPUs are contended, 0 is docker's default
+	CPUShares int64
+	// ConfigFile is a static couchbase config on the docker host which replaces the node's default static_config
+	ConfigFile string
+	// Init runs docker's init process as the container's entrypoint so that zombie processes are reaped
+	Init bool
+	// StopSignal is sent to the container when it is stopped, the image's default is used if empty
+	StopSignal string
+	// DNS overrides the name resolution configuration of the container
+	DNS *DNSOptions
+}
+
+// Locations inside the container that the optional host data/index/analytics paths are mounted to
+const (
+	containerDataPath      = "/mnt/cb-data"
+	containerIndexPath     = "/mnt/cb-index"
+	containerAnalyticsPath = "/mnt/cb-analytics"
+	// containerStaticConfigPath is read by couchbase server when it starts, so a config file mounted over it is in
+	// place before the server is running
+	containerStaticConfigPath = "/opt/couchbase/etc/couchbase/static_config"
+)
+
+type nodeMount struct {
+	hostPath      string
+	containerPath string
+	label         string
+}
+
+func (opts *NodeOptions) mounts() []nodeMount {
+	var mounts []nodeMount
+	if opts.DataPath != "" {
+		mounts = append(mounts, nodeMount{opts.DataPath, containerDataPath, "com.couchbase.dyncluster.data_path"})
+	}
+	if opts.IndexPath != "" {
+		mounts = append(mounts, nodeMount{opts.IndexPath, containerIndexPath, "com.couchbase.dyncluster.index_path"})
+	}
+	if opts.AnalyticsPath != "" {
+		mounts = append(mounts, nodeMount{opts.AnalyticsPath, containerAnalyticsPath, "com.couchbase.dyncluster.analytics_path"})
+	}
+	return mounts
+}
+
+func validateNodePaths(opts NodeOptions) error {
+	seen := make(map[string]bool)
+	for _, mount := range opts.mounts() {
+		if !path.IsAbs(mount.hostPath) {
+			return badRequestf("storage path %s must be absolute", mount.hostPath)
+		}
+
+		cleanPath := path.Clean(mount.hostPath)
+		if cleanPath == "/" {
+			return badRequestf("storage path cannot be the root directory")
+		}
+		if seen[cleanPath] {
+			return badRequestf("storage path %s is used more than once", cleanPath)
+		}
+		seen[cleanPath] = true
+	}
+	return nil
+}
+
+// validateStopSignal checks a signal is either a signal name, such as SIGUSR1, or number as docker expects
+func validateStopSignal(signal string) error {
+	if signal != "" && !stopSignalRegexp.MatchString(signal) {
+		return badRequestf("invalid stop signal `%s`", signal)
+	}
+	return nil
+}
+
+// resolveNodeConfigFile resolves the symlinks of a node's config file, returning the path of the regular file it
+// refers to.  Both the file and config-file-dir are resolved before checking the file is within the dir, so that
+// a symlink in config-file-dir can't be used to mount another file on the host.
+func resolveNodeConfigFile(configFile string) (string, error) {
+	if getConfig().configFileDir == "" {
+		return "", badRequestf("custom config files are not enabled, config-file-dir must be configured")
+	}
+	if !filepath.IsAbs(configFile) {
+		return "", badRequestf("config file %s must be absolute", configFile)
+	}
+
+	resolvedDir, err := filepath.EvalSymlinks(getConfig().configFileDir)
+	if err != nil {
+		return "", fmt.Errorf("config-file-dir %s is not readable: %s", getConfig().configFileDir, err)
+	}
+	resolvedFile, err := filepath.EvalSymlinks(configFile)
+	if err != nil {
+		return "", badRequestf("config file %s is not readable: %s", configFile, err)
+	}
+
+	relPath, err := filepath.Rel(resolvedDir, resolvedFile)
+	if err != nil || relPath == "." || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", badRequestf("config file %s must be within %s", configFile, getConfig().configFileDir)
+	}
+
+	info, err := os.Lstat(resolvedFile)
+	if err != nil {
+		return "", badRequestf("config file %s is not readable: %s", configFile, err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", badRequestf("config file %s must be a regular file", configFile)
+	}
+
+	file, err := os.Open(resolvedFile)
+	if err != nil {
+		return "", badRequestf("config file %s is not readable: %s", configFile, err)
+	}
+	file.Close()
+
+	return resolvedFile, nil
+}
+
+// validateNodeConfigFile makes sure a node's config file is a readable regular file within config-file-dir
+func validateNodeConfigFile(opts NodeOptions) error {
+	if opts.ConfigFile == "" {
+		return nil
+	}
+	_, err := resolveNodeConfigFile(opts.ConfigFile)
+	return err
+}
+
+func validateNodeMemory(opts NodeOptions) error {
+	if opts.MemoryMB < 0 {
+		return badRequestf("memory limit must be a positive number of megabytes")
+	}
+	if opts.MemorySwapMB < -1 {
+		return badRequestf("memory swap limit must be -1 for unlimited swap or a positive number of megabytes")
+	}
+	if opts.MemorySwapMB != 0 {
+		if opts.MemoryMB == 0 {
+			return badRequestf("memory swap limit requires a memory limit")
+		}
+		if opts.MemorySwapMB > 0 && opts.MemorySwapMB < opts.MemoryMB {
+			return badRequestf("memory swap limit must be greater than or equal to the memory limit")
+		}
+	}
+	if opts.MemorySwappiness != nil && (*opts.MemorySwappiness < 0 || *opts.MemorySwappiness > 100) {
+		return badRequestf("memory swappiness must be between 0 and 100")
+	}
+	return nil
+}
+
+func validateNodeCPUs(opts NodeOptions) error {
+	if opts.CPUs < 0 || (opts.CPUs > 0 && opts.CPUs < 0.01) {
+		return badRequestf("cpu limit must be a number of CPUs of at least 0.01, such as 1.5")
+	}
+	if opts.CPUShares < 0 || opts.CPUShares == 1 {
+		return badRequestf("cpu shares must be a relative weight of at least 2, docker's default is 1024")
+	}
+	return nil
+}
+
+// checkNodeResourceSupport makes sure the docker host is able to enforce the requested memory and CPU limits
+func checkNodeResourceSupport(ctx context.Context, nodes []NodeOptions) error {
+	var needsMemoryLimit, needsSwapLimit bool
+	var maxCPUs float64
+	for _, node := range nodes {
+		if node.CPUs > maxCPUs {
+			maxCPUs = node.CPUs
+		}
+		if node.MemoryMB > 0 {
+			needsMemoryLimit = true
+		}
+		if node.MemorySwapMB != 0 || node.MemorySwappiness != nil {
+			needsSwapLimit = true
+		}
+	}
+	if !needsMemoryLimit && !needsSwapLimit && maxCPUs == 0 {
+		return nil
+	}
+
+	info, err := docker.Info(ctx)
+	if err != nil {
+		return countDockerError("info", err)
+	}
+	if needsMemoryLimit && !info.MemoryLimit {
+		return badRequestf("docker host does not support memory limits")
+	}
+	if needsSwapLimit && !info.SwapLimit {
+		return badRequestf("docker host does not support swap limits")
+	}
+	if maxCPUs > float64(info.NCPU) {
+		return badRequestf("cpu limit of %.2f CPUs exceeds the %d CPUs of the docker host", maxCPUs, info.NCPU)
+	}
+	return nil
+}
+
+// validateServerGroups makes sure either every node or no node has a server group, and that there are enough
+// groups for the replica of the bucket created during setup to be placed in a different group.
+func validateServerGroups(nodes []NodeOptions) error {
+	groups := make(map[string]bool)
+	var ungrouped int
+	for _, node := range nodes {
+		if node.ServerGroup == "" {
+			ungrouped++
+			continue
+		}
+		groups[node.ServerGroup] = true
+	}
+
+	if len(groups) == 0 {
+		return nil
+	}
+	if ungrouped > 0 {
+		return badRequestf("either every node or no nodes must specify a server group")
+	}
+	if len(groups) < 2 {
+		return badRequestf("at least 2 server groups are required for replicas to be placed across groups")
+	}
+	return nil
+}
+
+// serviceMinVersions are the services a node can be assigned, along with the first server version to support them
+var serviceMinVersions = map[string][2]int{
+	"kv":       {0, 0},
+	"index":    {4, 0},
+	"n1ql":     {4, 0},
+	"fts":      {5, 0},
+	"eventing": {5, 5},
+	"cbas":     {6, 0},
+	"backup":   {7, 0},
+}
+
+// serviceAliases maps the names services are known by in the UI and documentation to the names in
+// serviceMinVersions, which are those the REST API expects
+var serviceAliases = map[string]string{
+	"data":      "kv",
+	"query":     "n1ql",
+	"search":    "fts",
+	"analytics": "cbas",
+}
+
+// normalizeServices replaces any of the user-facing service names with the names the REST API expects
+func normalizeServices(services []string) []string {
+	var normalized []string
+	for _, service := range services {
+		if alias, ok := serviceAliases[service]; ok {
+			service = alias
+		}
+		normalized = append(normalized, service)
+	}
+	return normalized
+}
+
+// validateNodeServices makes sure each of the services assigned to a node exists in its server version
+func validateNodeServices(opts NodeOptions) error {
+	seen := make(map[string]bool)
+	for _, service := range opts.Services {
+		minVersion, ok := serviceMinVersions[service]
+		if !ok {
+			return badRequestf("node %s has unknown service %s", opts.Name, service)
+		}
+		if seen[service] {
+			return badRequestf("node %s has service %s more than once", opts.Name, service)
+		}
+		seen[service] = true
+
+		if opts.VersionInfo != nil && !opts.VersionInfo.atLeast(minVersion[0], minVersion[1]) {
+			return badRequestf("node %s cannot run %s, it requires server %d.%d or later", opts.Name, service,
+				minVersion[0], minVersion[1])
+		}
+	}
+	return nil
 }
 
 type NodeVersion struct {
@@ -37,6 +322,15 @@ type NodeVersion struct {
 	Flavor  string
 	Build   string
 	Edition Edition
+	// Registry is where the image is pulled from and pushed to, the daemon's docker-registry if empty
+	Registry string
+}
+
+func (nv *NodeVersion) registry() string {
+	if nv.Registry != "" {
+		return nv.Registry
+	}
+	return getConfig().dockerRegistry
 }
 
 func (nv *NodeVersion) toTagName() string {
@@ -47,7 +341,17 @@ func (nv *NodeVersion) toTagName() string {
 }
 
 func (nv *NodeVersion) toImageName() string {
-	return fmt.Sprintf("%s/dynclsr-couchbase_%s_%s", dockerRegistry, nv.Edition, nv.toTagName())
+	return fmt.Sprintf("%s/dynclsr-couchbase_%s_%s", nv.registry(), nv.Edition, nv.toTagName())
+}
+
+func (nv *NodeVersion) atLeast(major, minor int) bool {
+	versionSplit := strings.Split(nv.Version, ".")
+	nodeMajor, _ := strconv.Atoi(versionSplit[0])
+	nodeMinor := 0
+	if len(versionSplit) > 1 {
+		nodeMinor, _ = strconv.Atoi(versionSplit[1])
+	}
+	return nodeMajor > major || (nodeMajor == major && nodeMinor >= minor)
 }
 
 func (nv *NodeVersion) toPkgName() string {
@@ -77,12 +381,12 @@ func flavorFromVersion(version string) (string, error) {
 
 	major, err := strconv.Atoi(versionSplit[0])
 	if err != nil {
-		return "", errors.New("Could not convert version major to int")
+		return "", badRequestf("Could not convert version major to int")
 	}
 
 	minor, err := strconv.Atoi(versionSplit[1])
 	if err != nil {
-		return "", errors.New("Could not convert version minor to int")
+		return "", badRequestf("Could not convert version minor to int")
 	}
 
 	if minor >= 5 {
@@ -93,13 +397,33 @@ func flavorFromVersion(version string) (string, error) {
 
 	flavor, ok := versionToFlavor[major][minor]
 	if !ok {
-		return "", fmt.Errorf("%d.%d is not a recognised flavor", major, minor)
+		return "", badRequestf("%d.%d is not a recognised flavor", major, minor)
 	}
 
 	return flavor, nil
 }
 
-func parseServerVersion(version string, useCE bool) (*NodeVersion, error) {
+// parseEdition resolves a requested edition, which may also be asked for through the older community_edition flag,
+// defaulting to enterprise
+func parseEdition(edition string, useCE bool) (Edition, error) {
+	switch Edition(strings.ToLower(edition)) {
+	case "":
+		if useCE {
+			return Community, nil
+		}
+		return Enterprise, nil
+	case Enterprise:
+		if useCE {
+			return "", badRequestf("edition enterprise conflicts with community_edition")
+		}
+		return Enterprise, nil
+	case Community:
+		return Community, nil
+	}
+	return "", badRequestf("unknown edition `%s`, must be %s or %s", edition, Enterprise, Community)
+}
+
+func parseServerVersion(version string, edition Edition) (*NodeVersion, error) {
 	nodeVersion := NodeVersion{}
 	versionParts := strings.Split(version, "-")
 	flavor, err := flavorFromVersion(versionParts[0])
@@ -111,11 +435,7 @@ func parseServerVersion(version string, useCE bool) (*NodeVersion, error) {
 	if len(versionParts) > 1 {
 		nodeVersion.Build = versionParts[1]
 	}
-	if useCE {
-		nodeVersion.Edition = Community
-	} else {
-		nodeVersion.Edition = Enterprise
-	}
+	nodeVersion.Edition = edition
 
 	return &nodeVersion, nil
 }
@@ -146,105 +466,312 @@ func aliasServerVersion(version string) (string, error) {
 	}
 
 	if serverBuild == "" {
-		return "", fmt.Errorf("No build version found for %s", version)
+		return "", badRequestf("No build version found for %s", version)
 	}
 
 	log.Printf("Using %s version for %s -> %s", buildParts[1], buildParts[0], serverBuild)
 	return serverBuild, nil
 }
 
-func allocateNode(ctx context.Context, clusterID string, timeout time.Time, opts NodeOptions) (string, error) {
-	log.Printf("Allocating node for cluster %s (requested by: %s)", clusterID, ContextUser(ctx))
+func allocateNode(ctx context.Context, clusterID string, timeout time.Time, opts NodeOptions, preserveData bool) (string, error) {
+	log.Printf("Allocating node for cluster %s (requested by: %s)", clusterID, ContextRequester(ctx))
 
 	containerName := fmt.Sprintf("dynclsr-%s-%s", clusterID, opts.Name)
 	containerImage := opts.VersionInfo.toImageName()
 
-	var dns []string
-	if dnsSvcHost != "" {
-		dns = append(dns, dnsSvcHost)
-	}
-	createResult, err := docker.ContainerCreate(context.Background(), &container.Config{
-		Image: containerImage,
-		Labels: map[string]string{
-			"com.couchbase.dyncluster.creator":                ContextUser(ctx),
-			"com.couchbase.dyncluster.cluster_id":             clusterID,
-			"com.couchbase.dyncluster.node_name":              opts.Name,
-			"com.couchbase.dyncluster.initial_server_version": opts.ServerVersion,
-		},
+	dns, dnsSearch, dnsOptions := containerDNS(opts.DNS)
+
+	labels := clusterLabels(ctx, clusterID, timeout)
+	labels["com.couchbase.dyncluster.node_name"] = opts.Name
+	labels["com.couchbase.dyncluster.initial_server_version"] = opts.ServerVersion
+	labels["com.couchbase.dyncluster.edition"] = string(opts.Edition)
+	labels["com.couchbase.dyncluster.preserve_data"] = strconv.FormatBool(preserveData)
+	if opts.ServerGroup != "" {
+		labels["com.couchbase.dyncluster.server_group"] = opts.ServerGroup
+	}
+	if opts.Role != "" {
+		labels["com.couchbase.dyncluster.role"] = opts.Role
+	}
+	if len(opts.Services) > 0 {
+		labels["com.couchbase.dyncluster.services"] = strings.Join(opts.Services, ",")
+	}
+	if requestID := ContextRequestID(ctx); requestID != "" {
+		labels["com.couchbase.dyncluster.request_id"] = requestID
+	}
+	if seccompProfile != "" {
+		labels["com.couchbase.dyncluster.seccomp_profile"] = seccompProfile
+	}
+	if apparmorProfile != "" {
+		labels["com.couchbase.dyncluster.apparmor_profile"] = apparmorProfile
+	}
+	addDaemonLabels(labels)
+
+	// Each node gets its own directory beneath the requested host paths
+	var binds []string
+	mounts := opts.mounts()
+	for _, mount := range mounts {
+		binds = append(binds, fmt.Sprintf("%s:%s", path.Join(mount.hostPath, containerName), mount.containerPath))
+		labels[mount.label] = mount.containerPath
+	}
+	if opts.Init {
+		labels["com.couchbase.dyncluster.init"] = "true"
+	}
+	if opts.StopSignal != "" {
+		labels["com.couchbase.dyncluster.stop_signal"] = opts.StopSignal
+	}
+	if opts.ConfigFile != "" {
+		// The resolved path is mounted, as the symlinks may have changed since the request was validated
+		configFile, err := resolveNodeConfigFile(opts.ConfigFile)
+		if err != nil {
+			return "", err
+		}
+		binds = append(binds, fmt.Sprintf("%s:%s:ro", configFile, containerStaticConfigPath))
+		labels["com.couchbase.dyncluster.config_file"] = opts.ConfigFile
+	}
+
+	resources := container.Resources{
+		Memory:           opts.MemoryMB * 1024 * 1024,
+		MemorySwap:       opts.MemorySwapMB,
+		MemorySwappiness: opts.MemorySwappiness,
+		NanoCPUs:         int64(opts.CPUs * 1e9),
+		CPUShares:        opts.CPUShares,
+	}
+	if opts.MemorySwapMB > 0 {
+		resources.MemorySwap = opts.MemorySwapMB * 1024 * 1024
+	}
+
+	networkingConfig, releaseIP, err := reserveContainerIP(ctx)
+	if err != nil {
+		allocLogf(clusterID, "Failed to reserve an address for container %s: %s", containerName, err)
+		return "", err
+	}
+	defer releaseIP()
+
+	createResult, err := docker.ContainerCreate(ctx, &container.Config{
+		Image:      containerImage,
+		Labels:     labels,
+		StopSignal: opts.StopSignal,
 		// same effect as ntp
 		Volumes: map[string]struct{}{"/etc/localtime:/etc/localtime": {}},
 	}, &container.HostConfig{
 		AutoRemove:  true,
 		NetworkMode: container.NetworkMode(NetworkName),
 		DNS:         dns,
+		DNSSearch:   dnsSearch,
+		DNSOptions:  dnsOptions,
 		CapAdd:      []string{"NET_ADMIN"},
-	}, nil, containerName)
+		Binds:       binds,
+		Resources:   resources,
+		SecurityOpt: nodeSecurityOpts(),
+		Init:        &opts.Init,
+	}, networkingConfig, containerName)
 	if err != nil {
+		err = countDockerError("container_create", err)
+		allocLogf(clusterID, "Failed to create container %s: %s", containerName, err)
 		return "", err
 	}
+	allocLogf(clusterID, "Created container %s with id %s", containerName, createResult.ID[0:12])
+	for _, warning := range createResult.Warnings {
+		allocLogf(clusterID, "Docker warning for container %s: %s", containerName, warning)
+	}
 
-	err = docker.ContainerStart(context.Background(), createResult.ID, types.ContainerStartOptions{})
+	err = docker.ContainerStart(ctx, createResult.ID, types.ContainerStartOptions{})
 	if err != nil {
+		err = countDockerError("container_start", err)
+		allocLogf(clusterID, "Failed to start container %s: %s", containerName, err)
 		return "", err
 	}
-	containerJSON, err := docker.ContainerInspect(context.Background(), createResult.ID)
+
+	// Docker creates missing bind directories as root, couchbase needs to own them
+	for _, mount := range mounts {
+		_, err = execInContainer(ctx, createResult.ID, []string{"chown", "-R", "couchbase:couchbase", mount.containerPath})
+		if err != nil {
+			return "", err
+		}
+	}
+	containerJSON, err := docker.ContainerInspect(ctx, createResult.ID)
 	if err != nil {
+		err = countDockerError("container_inspect", err)
+		allocLogf(clusterID, "Failed to inspect container %s: %s", containerName, err)
 		return "", err
 	}
 	ipv4 := containerJSON.NetworkSettings.Networks[NetworkName].IPAddress
 	ipv6 := containerJSON.NetworkSettings.Networks[NetworkName].GlobalIPv6Address
-	containerHostName := containerName + ".couchbase.com"
+	allocLogf(clusterID, "Started container %s with IPv4 address %s and IPv6 address %s", containerName, ipv4, ipv6)
 
-	if dnsSvcHost != "" {
-		if ipv4 != "" {
-			glog.Infof("register %s => %s on %s\n", ipv4, containerHostName, dnsSvcHost)
-			body, err := registerDomainName(containerHostName, ipv4)
-			if err != nil {
-				glog.Warningf("Failed registering IPv4:%s, %s", err, body)
-			}
-		}
-
-		if ipv6 != "" {
-			glog.Infof("register %s => %s on %s\n", ipv6, containerHostName, dnsSvcHost)
-			body, err := registerDomainName(containerHostName, ipv6)
-			glog.Warningf("Failed registering IPv6:%s, %s", err, body)
-		}
-	}
+	registerNodeHostname(clusterID, containerName, ipv4, ipv6)
 
 	return createResult.ID, nil
 }
 
-// assign hostname to the IP in DNS server
-func registerDomainName(hostname, ip string) (string, error) {
-	restParam := &helper.RestCall{
-		ExpectedCode: 200,
-		ContentType:  "application/json",
-		Method:       "PUT",
-		Cred: &helper.Cred{
-			Hostname: dnsSvcHost,
-			Port:     80,
-		},
-		Path: helper.Domain + "/" + hostname,
-		Body: "{\"ips\":[\"" + ip + "\"]}",
+func inspectNode(ctx context.Context, clusterID string, nodeID string) ([]byte, error) {
+	cluster, node, err := getClusterNode(ctx, clusterID, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	_, raw, err := docker.ContainerInspectWithRaw(ctx, node.ContainerID, false)
+	if err != nil {
+		return nil, countDockerError("container_inspect", err)
 	}
-	return helper.RestRetryer(helper.RestRetry, restParam, helper.GetResponse)
+
+	return raw, nil
 }
 
-func killNode(ctx context.Context, containerID string) error {
-	log.Printf("Killing node %s (requested by: %s)", containerID, ContextUser(ctx))
+// nodeLogs opens the container logs of a node, tail limits them to the last lines ("all" or empty for every line)
+// and follow keeps the logs open to stream new lines as the container writes them
+func nodeLogs(ctx context.Context, clusterID string, nodeID string, tail string, follow bool) (io.ReadCloser, error) {
+	if tail == "" {
+		tail = "all"
+	} else if tail != "all" {
+		if lines, err := strconv.Atoi(tail); err != nil || lines < 0 {
+			return nil, badRequestf("tail must be a number of lines or `all`")
+		}
+	}
 
-	err := docker.ContainerStop(context.Background(), containerID, nil)
+	cluster, node, err := getClusterNode(ctx, clusterID, nodeID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// No need to kill the node, since we use `kill on stop` when creating the container
-	/*
-		err = docker.ContainerKill(context.Background(), containerID, "")
-		if err != nil {
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	logs, err := docker.ContainerLogs(ctx, node.ContainerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     follow,
+		Tail:       tail,
+	})
+	if err != nil {
+		return nil, countDockerError("container_logs", err)
+	}
+
+	return logs, nil
+}
+
+// hostPathWipeMount is where the parent of a storage path is mounted in the container which removes the path
+const hostPathWipeMount = "/mnt/cb-wipe"
+
+// wipeNodeData removes a node's storage paths from the docker host once the node's container is gone, so they
+// don't leak onto the host.  The daemon doesn't necessarily share a filesystem with the docker host, so each path
+// is removed by a short-lived container of the node's image which mounts the path's parent directory.
+func wipeNodeData(ctx context.Context, node *Node) error {
+	var paths []string
+	for _, p := range []string{node.DataPath, node.IndexPath, node.AnalyticsPath} {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	log.Printf("Wiping storage paths of node %s (requested by: %s)", node.ContainerID, ContextRequester(ctx))
+
+	for _, p := range paths {
+		if err := removeHostPath(ctx, node.Image, p); err != nil {
 			return err
 		}
-	*/
+	}
+	return nil
+}
+
+func removeHostPath(ctx context.Context, image string, hostPath string) error {
+	hostPath = path.Clean(hostPath)
+
+	createResult, err := docker.ContainerCreate(ctx, &container.Config{
+		Image:      image,
+		Entrypoint: []string{"rm", "-rf", path.Join(hostPathWipeMount, path.Base(hostPath))},
+	}, &container.HostConfig{
+		Binds: []string{fmt.Sprintf("%s:%s", path.Dir(hostPath), hostPathWipeMount)},
+	}, nil, "")
+	if err != nil {
+		return countDockerError("container_create", err)
+	}
+	defer docker.ContainerRemove(context.Background(), createResult.ID, types.ContainerRemoveOptions{Force: true})
 
+	if err := docker.ContainerStart(ctx, createResult.ID, types.ContainerStartOptions{}); err != nil {
+		return countDockerError("container_start", err)
+	}
+	exitCode, err := docker.ContainerWait(ctx, createResult.ID)
+	if err != nil {
+		return countDockerError("container_wait", err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("removing %s exited with code %d", hostPath, exitCode)
+	}
 	return nil
 }
+
+// stopRequestMargin is how much longer than stop-timeout a stop request may take before it is given up on, docker
+// only kills the container once stop-timeout is over so the request itself takes at least that long
+const stopRequestMargin = 15 * time.Second
+
+// isContainerGone checks whether a docker error means the container no longer exists or is already being removed
+func isContainerGone(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return client.IsErrNotFound(err) || strings.Contains(msg, "no such container") ||
+		strings.Contains(msg, "already in progress")
+}
+
+// killNode stops a node gracefully, giving it stop-timeout to exit.  A node which cannot be stopped in time is
+// wedged, so it is killed and removed forcefully instead.
+func killNode(ctx context.Context, containerID string) error {
+	log.Printf("Killing node %s (requested by: %s)", containerID, ContextRequester(ctx))
+
+	stopTimeout := getConfig().stopTimeout
+	err := retryTransient(ctx, fmt.Sprintf("stop node %s", containerID), func() error {
+		stopCtx, cancel := context.WithTimeout(context.Background(), stopTimeout+stopRequestMargin)
+		defer cancel()
+
+		timeout := stopTimeout
+		err := docker.ContainerStop(stopCtx, containerID, &timeout)
+		if err != nil && stopCtx.Err() == context.DeadlineExceeded {
+			// The deadline looks like a transient timeout, but a node which didn't stop in time won't stop if
+			// asked again, so it is killed forcefully straight away instead
+			return fmt.Errorf("node did not stop within %s", stopTimeout+stopRequestMargin)
+		}
+		return countDockerError("container_stop", err)
+	})
+	if err == nil {
+		// No need to remove the node, since we use `remove on stop` when creating the container
+		return nil
+	}
+	var dockerErr *DockerError
+	if errors.As(err, &dockerErr) && isContainerGone(dockerErr.Err) {
+		return err
+	}
+
+	log.Printf("Failed to stop node %s gracefully, killing it forcefully: %s", containerID, err)
+	return forceKillNode(ctx, containerID)
+}
+
+// forceKillNode kills a node with SIGKILL and removes its container without waiting for it to stop, a node which
+// is already gone is not an error
+func forceKillNode(ctx context.Context, containerID string) error {
+	log.Printf("Forcefully killing node %s (requested by: %s)", containerID, ContextRequester(ctx))
+
+	// Killing a container which is not running fails, removing it with force covers that case
+	if err := docker.ContainerKill(context.Background(), containerID, "SIGKILL"); err != nil && !isContainerGone(err) {
+		log.Printf("Failed to kill node %s, removing it regardless: %s", containerID, err)
+	}
+
+	return removeNodeContainer(ctx, containerID)
+}
+
+// removeNodeContainer removes a node's container, a container which is already gone is not an error
+func removeNodeContainer(ctx context.Context, containerID string) error {
+	return retryTransient(ctx, fmt.Sprintf("remove node %s", containerID), func() error {
+		err := docker.ContainerRemove(context.Background(), containerID, types.ContainerRemoveOptions{Force: true})
+		if err != nil && isContainerGone(err) {
+			return nil
+		}
+		return countDockerError("container_remove", err)
+	})
+}
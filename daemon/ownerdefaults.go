@@ -0,0 +1,32 @@
+package daemon
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// OwnerDefaults are the values used for an owner's requests when the request itself omits them, these are
+// configured in the config file under [owner-defaults."user@couchbase.com"]
+type OwnerDefaults struct {
+	ServerVersion string   `mapstructure:"server_version"`
+	Timeout       string   `mapstructure:"timeout"`
+	Services      []string `mapstructure:"services"`
+}
+
+func loadOwnerDefaults() (map[string]OwnerDefaults, error) {
+	defaults := make(map[string]OwnerDefaults)
+	if err := viper.UnmarshalKey("owner-defaults", &defaults); err != nil {
+		return nil, err
+	}
+
+	ownerDefaults := make(map[string]OwnerDefaults)
+	for owner, ownerDefault := range defaults {
+		ownerDefaults[strings.ToLower(owner)] = ownerDefault
+	}
+	return ownerDefaults, nil
+}
+
+func getOwnerDefaults(owner string) OwnerDefaults {
+	return getConfig().ownerDefaults[strings.ToLower(owner)]
+}
@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// OwnerLimits override the global limits for an owner, these are configured in the config file under
+// [owner-limits."user@couchbase.com"].  A team can be given limits by using its email domain, such as
+// [owner-limits."@couchbase.com"], which apply to any owner without limits of their own.
+type OwnerLimits struct {
+	MaxClusterTimeout string `mapstructure:"max_cluster_timeout"`
+}
+
+// loadOwnerLimits returns the max cluster timeouts of each owner with limits configured
+func loadOwnerLimits() (map[string]time.Duration, error) {
+	limits := make(map[string]OwnerLimits)
+	if err := viper.UnmarshalKey("owner-limits", &limits); err != nil {
+		return nil, err
+	}
+
+	ownerMaxClusterTimeouts := make(map[string]time.Duration)
+	for owner, ownerLimits := range limits {
+		if ownerLimits.MaxClusterTimeout == "" {
+			continue
+		}
+
+		maxTimeout, err := time.ParseDuration(ownerLimits.MaxClusterTimeout)
+		if err != nil || maxTimeout <= 0 {
+			log.Printf("Ignoring invalid max_cluster_timeout `%s` for %s", ownerLimits.MaxClusterTimeout, owner)
+			continue
+		}
+		ownerMaxClusterTimeouts[strings.ToLower(owner)] = maxTimeout
+	}
+	return ownerMaxClusterTimeouts, nil
+}
+
+// getMaxClusterTimeout returns the longest timeout an owner may give a cluster, an owner's own limit takes
+// precedence over their team's, falling back to max-cluster-timeout
+func getMaxClusterTimeout(owner string) time.Duration {
+	config := getConfig()
+	ownerMaxClusterTimeouts := config.ownerMaxClusterTimeouts
+	owner = strings.ToLower(owner)
+	if maxTimeout, ok := ownerMaxClusterTimeouts[owner]; ok {
+		return maxTimeout
+	}
+	if atIdx := strings.LastIndex(owner, "@"); atIdx >= 0 {
+		if maxTimeout, ok := ownerMaxClusterTimeouts[owner[atIdx:]]; ok {
+			return maxTimeout
+		}
+	}
+	return config.maxClusterTimeout
+}
+
+func checkClusterTimeout(owner string, timeout time.Duration) error {
+	if maxTimeout := getMaxClusterTimeout(owner); timeout > maxTimeout {
+		return badRequestf("cannot allocate clusters for longer than %s", maxTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// partitionChain is the iptables chain holding a node's partition rules, keeping them in their own chain means
+// healing a partition never touches any other rules in the container
+const partitionChain = "CBDYN-PARTITION"
+
+// NodePartition records the peers a node has been partitioned from
+type NodePartition struct {
+	ClusterID string    `json:"cluster_id"`
+	NodeID    string    `json:"node_id"`
+	Peers     []string  `json:"peers"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PartitionNodeOptions struct {
+	NodeID string
+	Peers  []string
+}
+
+// resolvePartitionPeers resolves each peer to an IP or subnet, peers may also be given as the container ID or
+// name of another node in the same cluster
+func resolvePartitionPeers(cluster *Cluster, peers []string) ([]string, error) {
+	if len(peers) == 0 {
+		return nil, badRequestf("must specify at least one peer")
+	}
+
+	nodeAddresses := make(map[string]string)
+	for _, node := range cluster.Nodes {
+		nodeAddresses[node.ContainerID] = node.IPv4Address
+		nodeAddresses[node.Name] = node.IPv4Address
+	}
+
+	var resolved []string
+	for _, peer := range peers {
+		if address, ok := nodeAddresses[peer]; ok {
+			resolved = append(resolved, address)
+			continue
+		}
+
+		if ip := net.ParseIP(peer); ip != nil && ip.To4() != nil {
+			resolved = append(resolved, peer)
+			continue
+		}
+
+		if ip, _, err := net.ParseCIDR(peer); err == nil && ip.To4() != nil {
+			resolved = append(resolved, peer)
+			continue
+		}
+
+		return nil, badRequestf("peer `%s` is not a node, IPv4 address or IPv4 subnet", peer)
+	}
+
+	sort.Strings(resolved)
+	return resolved, nil
+}
+
+// partitionScript builds a shell script which replaces the partition chain of a node with rules dropping all
+// traffic to and from the peers.  With no peers the chain is simply emptied, healing the partition.
+func partitionScript(peers []string) string {
+	commands := []string{
+		fmt.Sprintf("iptables -N %s 2>/dev/null || true", partitionChain),
+		fmt.Sprintf("iptables -F %s", partitionChain),
+		fmt.Sprintf("iptables -C INPUT -j %s 2>/dev/null || iptables -I INPUT -j %s", partitionChain, partitionChain),
+		fmt.Sprintf("iptables -C OUTPUT -j %s 2>/dev/null || iptables -I OUTPUT -j %s", partitionChain, partitionChain),
+	}
+	for _, peer := range peers {
+		commands = append(commands,
+			fmt.Sprintf("iptables -A %s -s %s -j DROP", partitionChain, peer),
+			fmt.Sprintf("iptables -A %s -d %s -j DROP", partitionChain, peer))
+	}
+	return strings.Join(commands, " && ")
+}
+
+func partitionNode(ctx context.Context, clusterID string, opts PartitionNodeOptions) (*NodePartition, error) {
+	log.Printf("Partitioning node %s of cluster %s from %s (requested by: %s)", opts.NodeID, clusterID,
+		strings.Join(opts.Peers, ", "), ContextRequester(ctx))
+
+	cluster, node, err := getClusterNode(ctx, clusterID, opts.NodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	peers, err := resolvePartitionPeers(cluster, opts.Peers)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := execInContainer(ctx, node.ContainerID, []string{"sh", "-c", partitionScript(peers)}); err != nil {
+		return nil, errors.Wrap(err, "failed to install partition rules")
+	}
+
+	partition := NodePartition{
+		ClusterID: clusterID,
+		NodeID:    node.ContainerID,
+		Peers:     peers,
+		CreatedAt: time.Now(),
+	}
+	if err := metaStore.PutPartition(partition); err != nil {
+		return nil, err
+	}
+
+	return &partition, nil
+}
+
+func healNode(ctx context.Context, clusterID string, nodeID string) error {
+	log.Printf("Healing partition of node %s of cluster %s (requested by: %s)", nodeID, clusterID, ContextRequester(ctx))
+
+	cluster, node, err := getClusterNode(ctx, clusterID, nodeID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return err
+	}
+
+	if _, err := execInContainer(ctx, node.ContainerID, []string{"sh", "-c", partitionScript(nil)}); err != nil {
+		return errors.Wrap(err, "failed to remove partition rules")
+	}
+
+	return metaStore.DeletePartition(clusterID, node.ContainerID)
+}
+
+func getPartitions(ctx context.Context, clusterID string) ([]NodePartition, error) {
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	return metaStore.GetPartitions(clusterID)
+}
@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"log"
+	"sync"
+)
+
+// pendingAllocations are the clusters this daemon is currently allocating.  A cluster's meta-data is marked as
+// pending until all of its containers are up, so a pending cluster which is not being allocated was left behind
+// by a daemon which crashed part way through allocating it.
+var pendingAllocations = make(map[string]bool)
+var pendingAllocationsLock sync.Mutex
+
+// trackPendingAllocation records that a cluster is being allocated, returning a func to call once it is done
+func trackPendingAllocation(clusterID string) func() {
+	pendingAllocationsLock.Lock()
+	pendingAllocations[clusterID] = true
+	pendingAllocationsLock.Unlock()
+
+	return func() {
+		pendingAllocationsLock.Lock()
+		delete(pendingAllocations, clusterID)
+		pendingAllocationsLock.Unlock()
+	}
+}
+
+func isAllocationInFlight(clusterID string) bool {
+	pendingAllocationsLock.Lock()
+	defer pendingAllocationsLock.Unlock()
+	return pendingAllocations[clusterID]
+}
+
+// createdByThisDaemon checks whether all of a cluster's containers are labelled with this daemon's instance ID
+func createdByThisDaemon(cluster *Cluster) bool {
+	if len(cluster.Nodes) == 0 {
+		return false
+	}
+	for _, node := range cluster.Nodes {
+		if node.InstanceID != instanceID {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcilePendingClusters kills the clusters whose allocation never completed, so their containers are not left
+// running untracked.  Like reapOrphanedContainers, only clusters whose containers are labelled with this daemon's
+// instance ID are killed, as another daemon sharing the docker host may still be allocating the others.
+func reconcilePendingClusters(clusters []*Cluster) error {
+	var killError error
+	for _, cluster := range clusters {
+		if !cluster.Pending || isAllocationInFlight(cluster.ID) || !createdByThisDaemon(cluster) {
+			continue
+		}
+
+		log.Printf("Killing cluster %s as its allocation never completed", cluster.ID)
+		err := killClusterWithReason(systemCtx, cluster.ID, KillReasonIncomplete)
+		if err != nil && killError == nil {
+			killError = err
+		}
+	}
+	return killError
+}
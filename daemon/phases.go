@@ -0,0 +1,40 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// AllocationPhasePull covers pulling, or building, the image for a cluster's nodes
+	AllocationPhasePull = "pull"
+	// AllocationPhaseStart covers creating and starting a cluster's containers
+	AllocationPhaseStart = "container-start"
+	// AllocationPhaseSetup covers initializing couchbase server on a cluster's nodes
+	AllocationPhaseSetup = "setup"
+)
+
+// PhaseTimeoutError is returned when a phase of allocating a cluster runs past its timeout
+type PhaseTimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+}
+
+func (e *PhaseTimeoutError) Error() string {
+	return fmt.Sprintf("%s phase timed out after %s", e.Phase, e.Timeout)
+}
+
+// runPhase runs fn with its own timeout, independent of the other phases.  fn is given a context which expires
+// with the timeout and must return promptly once it does.  runPhase always waits for fn to return, so that
+// callers cleaning up after a timed out phase don't race with work the phase is still doing.
+func runPhase(ctx context.Context, phase string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	phaseCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(phaseCtx)
+	if err != nil && phaseCtx.Err() == context.DeadlineExceeded {
+		return &PhaseTimeoutError{Phase: phase, Timeout: timeout}
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package daemon
+
+import (
+	"sort"
+	"strings"
+)
+
+// PlacementConstraints restrict which services may share a node.  Each group in Separate lists services which
+// must never run on the same node, each group in Colocate lists services which must always run together.
+type PlacementConstraints struct {
+	Separate [][]string `json:"separate,omitempty"`
+	Colocate [][]string `json:"colocate,omitempty"`
+}
+
+func validatePlacementConstraints(placement *PlacementConstraints) error {
+	if placement == nil {
+		return nil
+	}
+
+	for _, groups := range [][][]string{placement.Separate, placement.Colocate} {
+		for _, group := range groups {
+			if len(group) < 2 {
+				return badRequestf("placement groups must contain at least two services")
+			}
+			for _, service := range group {
+				if service == "" {
+					return badRequestf("placement groups must not contain empty services")
+				}
+			}
+		}
+	}
+
+	// Two services can't be required to be both apart and together
+	for _, separate := range placement.Separate {
+		for _, colocate := range placement.Colocate {
+			var shared []string
+			for _, service := range separate {
+				if containsString(colocate, service) {
+					shared = append(shared, service)
+				}
+			}
+			if len(shared) > 1 {
+				return badRequestf("services %s cannot be both separated and co-located", strings.Join(shared, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func splitServices(services string) []string {
+	var split []string
+	for _, service := range strings.Split(services, ",") {
+		if service = strings.TrimSpace(service); service != "" {
+			split = append(split, service)
+		}
+	}
+	return split
+}
+
+// validateServicePlacement checks the services assigned to each node against the cluster's placement constraints.
+// services holds the services of each node, in the same order as nodes.
+func validateServicePlacement(placement *PlacementConstraints, nodes []*Node, services []string) error {
+	if placement == nil {
+		return nil
+	}
+
+	for i, nodeServices := range services {
+		if i >= len(nodes) {
+			break
+		}
+		assigned := splitServices(nodeServices)
+
+		for _, group := range placement.Separate {
+			var found []string
+			for _, service := range group {
+				if containsString(assigned, service) {
+					found = append(found, service)
+				}
+			}
+			if len(found) > 1 {
+				return badRequestf("node %s runs %s which must be on separate nodes", nodes[i].Name, strings.Join(found, " and "))
+			}
+		}
+
+		for _, group := range placement.Colocate {
+			var missing []string
+			found := false
+			for _, service := range group {
+				if containsString(assigned, service) {
+					found = true
+				} else {
+					missing = append(missing, service)
+				}
+			}
+			if found && len(missing) > 0 {
+				return badRequestf("node %s must also run %s to co-locate %s", nodes[i].Name,
+					strings.Join(missing, ", "), strings.Join(group, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolvePlacement maps each service to the names of the nodes which run it
+func resolvePlacement(nodes []*Node, services []string) map[string][]string {
+	placement := make(map[string][]string)
+	for i, nodeServices := range services {
+		if i >= len(nodes) {
+			break
+		}
+		for _, service := range splitServices(nodeServices) {
+			placement[service] = append(placement[service], nodes[i].Name)
+		}
+	}
+	for _, nodeNames := range placement {
+		sort.Strings(nodeNames)
+	}
+	return placement
+}
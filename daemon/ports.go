@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"context"
+	"sort"
+	"strconv"
+)
+
+// couchbaseServicePorts maps the ports a couchbase server node listens on to the service behind them
+var couchbaseServicePorts = map[int]string{
+	8091:  "rest",
+	8092:  "views",
+	8093:  "query",
+	8094:  "fts",
+	8095:  "analytics",
+	8096:  "eventing",
+	11210: "kv",
+	18091: "rest_ssl",
+	18092: "views_ssl",
+	18093: "query_ssl",
+	18094: "fts_ssl",
+	18095: "analytics_ssl",
+	18096: "eventing_ssl",
+	11207: "kv_ssl",
+}
+
+type NodePort struct {
+	Service       string `json:"service,omitempty"`
+	ContainerPort int    `json:"container_port"`
+	Protocol      string `json:"protocol"`
+	HostIP        string `json:"host_ip"`
+	HostPort      int    `json:"host_port"`
+}
+
+// getNodePorts returns how each of a node's service ports can be reached.  Ports published to the docker host are
+// read from the container's port bindings, when nothing is published the node is reachable on its own IP so the
+// standard service ports are reported against it.
+func getNodePorts(ctx context.Context, node *Node) ([]NodePort, error) {
+	inspect, err := docker.ContainerInspect(ctx, node.ContainerID)
+	if err != nil {
+		return nil, countDockerError("container_inspect", err)
+	}
+
+	var ports []NodePort
+	if inspect.NetworkSettings != nil {
+		for port, bindings := range inspect.NetworkSettings.Ports {
+			for _, binding := range bindings {
+				hostPort, err := strconv.Atoi(binding.HostPort)
+				if err != nil || hostPort == 0 {
+					continue
+				}
+
+				ports = append(ports, NodePort{
+					Service:       couchbaseServicePorts[port.Int()],
+					ContainerPort: port.Int(),
+					Protocol:      port.Proto(),
+					HostIP:        binding.HostIP,
+					HostPort:      hostPort,
+				})
+			}
+		}
+	}
+
+	if len(ports) == 0 {
+		for port, service := range couchbaseServicePorts {
+			ports = append(ports, NodePort{
+				Service:       service,
+				ContainerPort: port,
+				Protocol:      "tcp",
+				HostIP:        node.IPv4Address,
+				HostPort:      port,
+			})
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].ContainerPort != ports[j].ContainerPort {
+			return ports[i].ContainerPort < ports[j].ContainerPort
+		}
+		return ports[i].HostPort < ports[j].HostPort
+	})
+
+	return ports, nil
+}
+
+func getNodeDetails(ctx context.Context, clusterID string, nodeID string) (*Node, []NodePort, error) {
+	cluster, node, err := getClusterNode(ctx, clusterID, nodeID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, nil, err
+	}
+
+	ports, err := getNodePorts(ctx, node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return node, ports, nil
+}
@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+const (
+	// ReadinessProbeTCP considers a node ready once its REST port accepts connections
+	ReadinessProbeTCP = "tcp"
+	// ReadinessProbeHTTP considers a node ready once its REST API responds to /pools
+	ReadinessProbeHTTP = "http"
+)
+
+type ReadinessOptions struct {
+	Probe    string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+func defaultReadinessOptions() ReadinessOptions {
+	return ReadinessOptions{
+		Probe:    getConfig().readinessProbe,
+		Interval: getConfig().readinessProbeInterval,
+		Timeout:  getConfig().readinessProbeTimeout,
+	}
+}
+
+func validateReadinessOptions(opts ReadinessOptions) error {
+	if opts.Probe != ReadinessProbeTCP && opts.Probe != ReadinessProbeHTTP {
+		return badRequestf("unknown readiness probe `%s`", opts.Probe)
+	}
+	if opts.Interval <= 0 {
+		return badRequestf("readiness probe interval must be positive")
+	}
+	if opts.Timeout <= 0 {
+		return badRequestf("readiness probe timeout must be positive")
+	}
+	return nil
+}
+
+func probeNode(opts ReadinessOptions, node *Node) error {
+	address := net.JoinHostPort(node.IPv4Address, fmt.Sprintf("%d", helper.RestPort))
+
+	switch opts.Probe {
+	case ReadinessProbeTCP:
+		conn, err := net.DialTimeout("tcp", address, opts.Interval)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case ReadinessProbeHTTP:
+		client := &http.Client{Timeout: opts.Interval}
+		resp, err := client.Get(fmt.Sprintf("http://%s%s", address, helper.PPools))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("%s returned %d", helper.PPools, resp.StatusCode)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown readiness probe `%s`", opts.Probe)
+}
+
+// waitForClusterReady polls every node of a cluster with the readiness probe until they are all ready, returning
+// how long it took for the cluster to become ready.
+func waitForClusterReady(ctx context.Context, clusterID string, opts ReadinessOptions) (time.Duration, error) {
+	log.Printf("Waiting for cluster %s to be ready (requested by: %s)", clusterID, ContextRequester(ctx))
+
+	startTime := time.Now()
+	deadline := startTime.Add(opts.Timeout)
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, node := range cluster.Nodes {
+		for {
+			err := probeNode(opts, node)
+			if err == nil {
+				break
+			}
+
+			if time.Now().Add(opts.Interval).After(deadline) {
+				return 0, fmt.Errorf("node %s was not ready after %s: %s", node.Name, opts.Timeout, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(opts.Interval):
+			}
+		}
+	}
+
+	return time.Since(startTime), nil
+}
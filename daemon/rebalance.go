@@ -0,0 +1,142 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+const rebalanceStatusRunning = "running"
+
+type RebalanceStatus struct {
+	// Status is "running" while a rebalance is in progress and "none" otherwise
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+	// ErrorMessage is the reason couchbase gives for the last rebalance failing, if it did
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+type poolsNodesJSON struct {
+	Nodes []struct {
+		OtpNode           string `json:"otpNode"`
+		Hostname          string `json:"hostname"`
+		ClusterMembership string `json:"clusterMembership"`
+	} `json:"nodes"`
+}
+
+func getNodeRebalanceStatus(node *Node) (*RebalanceStatus, error) {
+	var progress rebalanceProgressJSON
+	if err := getClusterRest(node, helper.PRebalanceProgress, &progress); err != nil {
+		return nil, err
+	}
+
+	status, percent := progress.parse()
+	errorMessage, _ := progress["errorMessage"].(string)
+	return &RebalanceStatus{
+		Status:       status,
+		Progress:     percent,
+		ErrorMessage: errorMessage,
+	}, nil
+}
+
+// postClusterRest sends a form to a node's REST port.  Couchbase explains why it rejected a request in the
+// response body, so that is returned as the error rather than the status code alone.
+func postClusterRest(node *Node, path string, form url.Values) error {
+	client := &http.Client{Timeout: helper.RestTimeout}
+	address := net.JoinHostPort(node.IPv4Address, fmt.Sprintf("%d", helper.RestPort))
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s%s", address, path), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(helper.RestUser, helper.RestPass)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if reason := strings.TrimSpace(string(body)); reason != "" {
+			return fmt.Errorf("%s returned %d: %s", path, resp.StatusCode, reason)
+		}
+		return fmt.Errorf("%s returned %d", path, resp.StatusCode)
+	}
+	return nil
+}
+
+func getClusterRebalance(ctx context.Context, clusterID string) (*RebalanceStatus, error) {
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	node, err := clusterTargetNode(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return getNodeRebalanceStatus(node)
+}
+
+// rebalanceCluster starts rebalancing every node which is part of the cluster, including those which were added
+// but not yet rebalanced in.  It returns as soon as couchbase has accepted the rebalance.
+func rebalanceCluster(ctx context.Context, clusterID string) error {
+	log.Printf("Rebalancing cluster %s (requested by: %s)", clusterID, ContextRequester(ctx))
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return err
+	}
+
+	node, err := clusterTargetNode(cluster)
+	if err != nil {
+		return err
+	}
+
+	status, err := getNodeRebalanceStatus(node)
+	if err != nil {
+		return err
+	}
+	if status.Status == rebalanceStatusRunning {
+		return &RebalanceRunningError{ClusterID: clusterID}
+	}
+
+	var poolsNodes poolsNodesJSON
+	if err := getClusterRest(node, helper.PPoolsNodes, &poolsNodes); err != nil {
+		return err
+	}
+
+	var knownNodes []string
+	for _, poolNode := range poolsNodes.Nodes {
+		knownNodes = append(knownNodes, poolNode.OtpNode)
+	}
+
+	err = postClusterRest(node, helper.PRebalance, url.Values{
+		"knownNodes":   {strings.Join(knownNodes, ",")},
+		"ejectedNodes": {""},
+	})
+	if err != nil {
+		return &RebalanceFailedError{ClusterID: clusterID, Reason: err.Error()}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"syscall"
+	"time"
+)
+
+type ReclaimOptions struct {
+	// FreeNodes is the number of node slots, out of max-host-nodes, which should be free
+	FreeNodes int
+	// FreeDiskMB is the amount of disk space which should be free in docker's root directory
+	FreeDiskMB int64
+	// Skip lists clusters which must never be killed
+	Skip []string
+}
+
+type ReclaimedCluster struct {
+	ID        string `json:"id"`
+	Owner     string `json:"owner"`
+	NumNodes  int    `json:"num_nodes"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ReclaimResult struct {
+	Killed     []ReclaimedCluster `json:"killed"`
+	TargetMet  bool               `json:"target_met"`
+	FreeNodes  int                `json:"free_nodes,omitempty"`
+	FreeDiskMB int64              `json:"free_disk_mb,omitempty"`
+}
+
+// isLocalDockerHost checks whether the docker host is the machine the daemon is running on, either through a unix
+// socket or over tcp to the loopback address
+func isLocalDockerHost() bool {
+	hostURI, err := url.Parse(dockerHost)
+	if err != nil {
+		return false
+	}
+	switch hostURI.Scheme {
+	case "", "unix":
+		return true
+	}
+	switch hostURI.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// getFreeDiskMB measures the free space in docker's root directory.  Docker does not report the free space of its
+// host, so this measures the directory directly and only works when the docker host is local.
+func getFreeDiskMB(ctx context.Context) (int64, error) {
+	if !isLocalDockerHost() {
+		return 0, fmt.Errorf("free disk can only be measured when the docker host is local, not %s", dockerHost)
+	}
+
+	info, err := docker.Info(ctx)
+	if err != nil {
+		return 0, countDockerError("info", err)
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(info.DockerRootDir, &stat); err != nil {
+		return 0, fmt.Errorf("failed to measure free disk in %s: %s", info.DockerRootDir, err)
+	}
+
+	return int64(uint64(stat.Bavail) * uint64(stat.Bsize) / 1024 / 1024), nil
+}
+
+func countNodes(clusters []*Cluster) int {
+	numNodes := 0
+	for _, cluster := range clusters {
+		numNodes += len(cluster.Nodes)
+	}
+	return numNodes
+}
+
+// reclaimCapacity kills clusters, oldest first, until the requested node slots and disk space are free.  Frozen
+// clusters and those in opts.Skip are never killed.  If the target can't be met the clusters which were killed are still reported.
+func reclaimCapacity(ctx context.Context, opts ReclaimOptions) (*ReclaimResult, error) {
+	log.Printf("Reclaiming capacity, target of %d free nodes and %dMB free disk (requested by: %s)", opts.FreeNodes, opts.FreeDiskMB, ContextRequester(ctx))
+
+	if !ContextIgnoreOwnership(ctx) {
+		return nil, forbiddenf("only admins can reclaim capacity")
+	}
+	if opts.FreeNodes <= 0 && opts.FreeDiskMB <= 0 {
+		return nil, badRequestf("must specify a target of free nodes or free disk")
+	}
+	if opts.FreeNodes > 0 && getConfig().maxHostNodes == 0 {
+		return nil, badRequestf("max-host-nodes must be configured to reclaim node slots")
+	}
+	if opts.FreeDiskMB > 0 && !isLocalDockerHost() {
+		return nil, badRequestf("free disk can only be reclaimed when the docker host is local, not %s", dockerHost)
+	}
+
+	clusters, err := getAllClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].CreatedAt.Before(clusters[j].CreatedAt)
+	})
+
+	skip := make(map[string]bool)
+	for _, clusterID := range opts.Skip {
+		skip[clusterID] = true
+	}
+
+	result := &ReclaimResult{
+		Killed: make([]ReclaimedCluster, 0),
+	}
+	usedNodes := countNodes(clusters)
+
+	targetMet := func() (bool, error) {
+		met := true
+		if opts.FreeNodes > 0 {
+			result.FreeNodes = getConfig().maxHostNodes - usedNodes
+			met = met && result.FreeNodes >= opts.FreeNodes
+		}
+		if opts.FreeDiskMB > 0 {
+			freeDiskMB, err := getFreeDiskMB(ctx)
+			if err != nil {
+				return false, err
+			}
+			result.FreeDiskMB = freeDiskMB
+			met = met && freeDiskMB >= opts.FreeDiskMB
+		}
+		return met, nil
+	}
+
+	for _, cluster := range clusters {
+		met, err := targetMet()
+		if err != nil {
+			return result, err
+		}
+		if met {
+			result.TargetMet = true
+			return result, nil
+		}
+
+		if skip[cluster.ID] || cluster.Frozen {
+			continue
+		}
+
+		if err := killClusterWithReason(ctx, cluster.ID, KillReasonReclaimed); err != nil {
+			log.Printf("Failed to kill cluster %s while reclaiming capacity: %s", cluster.ID, err)
+			continue
+		}
+
+		usedNodes -= len(cluster.Nodes)
+		result.Killed = append(result.Killed, ReclaimedCluster{
+			ID:        cluster.ID,
+			Owner:     cluster.Owner,
+			NumNodes:  len(cluster.Nodes),
+			CreatedAt: cluster.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	result.TargetMet, err = targetMet()
+	return result, err
+}
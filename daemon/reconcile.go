@@ -0,0 +1,163 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// Kinds of discrepancy found between the containers on the docker host and the meta-data store
+const (
+	// DiscrepancyUntracked is a container of a cluster which the meta-data store has no record of
+	DiscrepancyUntracked = "untracked"
+	// DiscrepancyIncomplete is a container of a cluster whose allocation never completed
+	DiscrepancyIncomplete = "incomplete"
+	// DiscrepancyExpired is a container of a cluster which has expired but not been cleaned up yet
+	DiscrepancyExpired = "expired"
+	// DiscrepancyOwnerMismatch is a container labelled with an owner who does not own its cluster
+	DiscrepancyOwnerMismatch = "owner_mismatch"
+)
+
+type ContainerDiscrepancy struct {
+	ClusterID     string `json:"cluster_id"`
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	Kind          string `json:"kind"`
+	// InstanceID is the daemon which created the container, empty for containers created before it was labelled
+	InstanceID string `json:"instance_id,omitempty"`
+}
+
+type ReconciliationReport struct {
+	CheckedAt     time.Time              `json:"checked_at"`
+	Containers    int                    `json:"containers"`
+	Discrepancies []ContainerDiscrepancy `json:"discrepancies"`
+}
+
+// listClusterContainers lists every container, running or not, which is labelled with a cluster
+func listClusterContainers(ctx context.Context) ([]types.Container, error) {
+	labelFilter := filters.NewArgs()
+	labelFilter.Add("label", "com.couchbase.dyncluster.cluster_id")
+
+	containers, err := docker.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: labelFilter,
+	})
+	if err != nil {
+		return nil, countDockerError("container_list", err)
+	}
+	return containers, nil
+}
+
+// reconcileContainers compares the containers on the docker host against the meta-data store, reporting any
+// container whose cluster the store does not know about or disagrees with
+func reconcileContainers(ctx context.Context) (*ReconciliationReport, error) {
+	containers, err := listClusterContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconciliationReport{
+		CheckedAt:     time.Now(),
+		Containers:    len(containers),
+		Discrepancies: []ContainerDiscrepancy{},
+	}
+
+	metas := make(map[string]*ClusterMeta)
+	for _, container := range containers {
+		clusterID := container.Labels["com.couchbase.dyncluster.cluster_id"]
+
+		// A cluster is only untracked if the store is sure it has no record of it, any other failure could be
+		// the store being unreachable
+		meta, checked := metas[clusterID]
+		if !checked {
+			clusterMeta, err := metaStore.GetClusterMeta(clusterID)
+			if err == nil {
+				meta = &clusterMeta
+			} else if err != errClusterMetaNotFound {
+				return nil, err
+			}
+			metas[clusterID] = meta
+		}
+
+		kind := ""
+		owner := container.Labels["com.couchbase.dyncluster.owner"]
+		switch {
+		case meta == nil:
+			kind = DiscrepancyUntracked
+		case meta.Pending && !isAllocationInFlight(clusterID):
+			kind = DiscrepancyIncomplete
+		case meta.Timeout.Before(report.CheckedAt):
+			kind = DiscrepancyExpired
+		case owner != "" && owner != meta.Owner && !containsString(meta.AuthorizedOwners, owner):
+			kind = DiscrepancyOwnerMismatch
+		}
+		if kind == "" {
+			continue
+		}
+
+		containerName := ""
+		if len(container.Names) > 0 {
+			containerName = container.Names[0]
+		}
+		report.Discrepancies = append(report.Discrepancies, ContainerDiscrepancy{
+			ClusterID:     clusterID,
+			ContainerID:   container.ID[0:12],
+			ContainerName: containerName,
+			Kind:          kind,
+			InstanceID:    container.Labels["com.couchbase.dyncluster.daemon_instance_id"],
+		})
+	}
+
+	return report, nil
+}
+
+// reapOrphanedContainers removes the containers of clusters which the meta-data store has no record of, such as
+// those left behind by a crashed allocation.  Only containers labelled with this daemon's instance ID are removed,
+// so orphans left behind before a restart are only reaped if instance-id is configured.
+func reapOrphanedContainers() error {
+	if !getConfig().reapOrphans {
+		return nil
+	}
+
+	report, err := reconcileContainers(systemCtx)
+	if err != nil {
+		return err
+	}
+
+	var reapError error
+	for _, discrepancy := range report.Discrepancies {
+		if discrepancy.Kind != DiscrepancyUntracked || discrepancy.InstanceID != instanceID {
+			continue
+		}
+
+		log.Printf("Reaping orphaned container %s (%s) of untracked cluster %s", discrepancy.ContainerID,
+			discrepancy.ContainerName, discrepancy.ClusterID)
+		err := retryTransient(systemCtx, fmt.Sprintf("remove container %s", discrepancy.ContainerID), func() error {
+			err := docker.ContainerRemove(systemCtx, discrepancy.ContainerID, types.ContainerRemoveOptions{Force: true})
+			if client.IsErrNotFound(err) {
+				return nil
+			}
+			return countDockerError("container_remove", err)
+		})
+		if err != nil {
+			log.Printf("Failed to reap orphaned container %s: %s", discrepancy.ContainerID, err)
+			if reapError == nil {
+				reapError = err
+			}
+		}
+	}
+	return reapError
+}
+
+func getReconciliationReport(ctx context.Context) (*ReconciliationReport, error) {
+	if !ContextIgnoreOwnership(ctx) {
+		return nil, forbiddenf("only admins can reconcile containers")
+	}
+
+	return reconcileContainers(ctx)
+}
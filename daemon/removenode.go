@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+	"github.com/pkg/errors"
+)
+
+// ejectClusterNode takes a node out of the couchbase cluster through another of its nodes.  Active nodes are hard
+// failed over first, since only failed over nodes and nodes which were never rebalanced in can be ejected.  A node
+// which is not part of the couchbase cluster, such as one of a cluster which was never set up, is left alone.
+func ejectClusterNode(epnode *Node, node *Node) error {
+	var poolsNodes poolsNodesJSON
+	if err := getClusterRest(epnode, helper.PPoolsNodes, &poolsNodes); err != nil {
+		return err
+	}
+
+	nodeHostname := strings.TrimPrefix(node.ContainerName, "/") + helper.DomainPostfix
+	for _, poolNode := range poolsNodes.Nodes {
+		host, _, err := net.SplitHostPort(poolNode.Hostname)
+		if err != nil {
+			host = poolNode.Hostname
+		}
+		if host != node.IPv4Address && host != nodeHostname {
+			continue
+		}
+
+		form := url.Values{"otpNode": {poolNode.OtpNode}}
+		if poolNode.ClusterMembership != "inactiveAdded" && poolNode.ClusterMembership != "inactiveFailed" {
+			if err := postClusterRest(epnode, helper.PFailover, form); err != nil {
+				return errors.Wrap(err, "failed to fail over node")
+			}
+		}
+		if err := postClusterRest(epnode, helper.PEject, form); err != nil {
+			return errors.Wrap(err, "failed to eject node")
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// removeClusterNode ejects a node from its couchbase cluster and kills its container.  The last node of a cluster
+// cannot be removed, the cluster should be killed instead.
+func removeClusterNode(ctx context.Context, clusterID string, nodeID string) error {
+	log.Printf("Removing node %s from cluster %s (requested by: %s)", nodeID, clusterID, ContextRequester(ctx))
+
+	cluster, node, err := getClusterNode(ctx, clusterID, nodeID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return err
+	}
+
+	if len(cluster.Nodes) <= 1 {
+		return badRequestf("cannot remove the only node of a cluster, kill the cluster instead")
+	}
+
+	// The node is ejected through one of the nodes which remain, preferring the orchestrator
+	var epnode *Node
+	for _, other := range cluster.Nodes {
+		if other.ContainerID == node.ContainerID || other.State != "running" {
+			continue
+		}
+		if epnode == nil || other.ContainerID == cluster.Orchestrator {
+			epnode = other
+		}
+	}
+	if epnode != nil {
+		if err := ejectClusterNode(epnode, node); err != nil {
+			return err
+		}
+	}
+
+	if err := killNode(ctx, node.ContainerID); err != nil {
+		return err
+	}
+	if node.Imported {
+		if err := removeNodeContainer(ctx, node.ContainerID); err != nil {
+			return err
+		}
+	}
+	if !node.PreserveData {
+		if err := wipeNodeData(ctx, node); err != nil {
+			log.Printf("Failed to wipe storage paths of node %s: %s", node.ContainerID, err)
+		}
+	}
+	deregisterNodeHostname(node)
+	forgetRegisteredHostname(clusterID, node)
+
+	err = metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		var startOrder []string
+		for _, name := range meta.StartOrder {
+			if name != node.Name {
+				startOrder = append(startOrder, name)
+			}
+		}
+		meta.StartOrder = startOrder
+		return meta, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := metaStore.DeletePartition(clusterID, node.ContainerID); err != nil {
+		log.Printf("Failed to delete partition of node %s: %s", node.ContainerID, err)
+	}
+	if err := metaStore.DeleteThrottle(clusterID, node.ContainerID); err != nil {
+		log.Printf("Failed to delete throttle of node %s: %s", node.ContainerID, err)
+	}
+	recordClusterHistory(ctx, clusterID, HistoryEventNodeRemoved, node.Name, "")
+
+	return nil
+}
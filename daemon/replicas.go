@@ -0,0 +1,86 @@
+package daemon
+
+import (
+	"fmt"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+type bucketVBucketsJSON struct {
+	ReplicaNumber    int `json:"replicaNumber"`
+	VBucketServerMap struct {
+		VBucketMap [][]int `json:"vBucketMap"`
+	} `json:"vBucketServerMap"`
+}
+
+func validateBucketReplicas(bucket *helper.BucketOption) error {
+	if bucket == nil || bucket.ReplicaCount == nil {
+		return nil
+	}
+	if *bucket.ReplicaCount < 0 || *bucket.ReplicaCount > 3 {
+		return badRequestf("replica count must be between 0 and 3")
+	}
+	return nil
+}
+
+// getEffectiveReplicas returns the number of replicas which every vbucket of a bucket actually has.  A bucket
+// can be configured with more replicas than the cluster has data nodes to hold, in which case some replicas
+// are silently never created.  Buckets without a vbucket map, such as memcached buckets, report the replicas they
+// are configured with as there are none known to be missing.
+func getEffectiveReplicas(node *Node, bucketName string) (int, error) {
+	var bucket bucketVBucketsJSON
+	if err := getClusterRest(node, helper.PBuckets+"/"+bucketName, &bucket); err != nil {
+		return 0, err
+	}
+
+	vbucketMap := bucket.VBucketServerMap.VBucketMap
+	effective := bucket.ReplicaNumber
+	if len(vbucketMap) == 0 {
+		return effective, nil
+	}
+
+	for _, servers := range vbucketMap {
+		// A vbucket without any servers has no active copy, let alone replicas
+		if len(servers) == 0 {
+			effective = 0
+			continue
+		}
+
+		replicas := 0
+		for _, server := range servers[1:] {
+			if server >= 0 {
+				replicas++
+			}
+		}
+		if replicas < effective {
+			effective = replicas
+		}
+	}
+
+	return effective, nil
+}
+
+// checkBucketReplicas compares the replicas a bucket was requested with against those it actually has
+// and returns a warning only if it has fewer than were requested
+func checkBucketReplicas(cluster *Cluster, bucket *helper.BucketOption) []string {
+	if bucket == nil || bucket.Name == "" || bucket.Type == "memcached" || len(cluster.Nodes) == 0 {
+		return nil
+	}
+
+	requested := bucket.Replicas()
+	node, err := clusterTargetNode(cluster)
+	if err != nil {
+		return []string{fmt.Sprintf("could not verify replicas of bucket %s: %s", bucket.Name, err)}
+	}
+	effective, err := getEffectiveReplicas(node, bucket.Name)
+	if err != nil {
+		return []string{fmt.Sprintf("could not verify replicas of bucket %s: %s", bucket.Name, err)}
+	}
+
+	if effective < requested {
+		return []string{fmt.Sprintf("bucket %s has %d effective replicas but %d were requested", bucket.Name,
+			effective, requested)}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// statusRecorder remembers the status a handler responded with so that it can be logged
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// requestIdentity returns who a request claims to be for logging, this is not authenticated unless the request
+// presented a valid bearer token
+func requestIdentity(r *http.Request) string {
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		if identity, ok := lookupAPIToken(token); ok {
+			return identity.User
+		}
+	}
+	return r.Header.Get("cbdn-user")
+}
+
+// requestLogMiddleware logs every request once it has been handled, along with its correlation ID so that the
+// request can be matched up with the logs of the work done for it
+func requestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		slog.Info("Handled request", "request_id", ContextRequestID(r.Context()), "method", r.Method,
+			"path", r.URL.Path, "status", recorder.status, "duration", time.Since(start), "user", requestIdentity(r))
+	})
+}
@@ -12,20 +12,26 @@ import (
 	"time"
 
 	"github.com/couchbaselabs/cbdynclusterd/helper"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var Version string
 
 type ErrorJSON struct {
 	Error struct {
-		Message string `json:"message"`
+		Message   string `json:"message"`
+		Code      string `json:"code,omitempty"`
+		ClusterID string `json:"cluster_id,omitempty"`
 	} `json:"error,omitempty"`
 }
 
 func jsonifyError(err error) ErrorJSON {
 	jsonErr := ErrorJSON{}
 	jsonErr.Error.Message = err.Error()
+	_, jsonErr.Error.Code, jsonErr.Error.ClusterID = classifyError(err)
 	return jsonErr
 }
 
@@ -34,13 +40,28 @@ type RefreshJSON struct {
 }
 
 type NodeJSON struct {
-	ID                   string `json:"id"`
-	ContainerName        string `json:"container_name"`
-	State                string `json:"state"`
-	Name                 string `json:"name"`
-	InitialServerVersion string `json:"initial_server_version"`
-	IPv4Address          string `json:"ipv4_address"`
-	IPv6Address          string `json:"ipv6_address"`
+	ID                   string   `json:"id"`
+	ContainerName        string   `json:"container_name"`
+	State                string   `json:"state"`
+	Name                 string   `json:"name"`
+	InitialServerVersion string   `json:"initial_server_version"`
+	Edition              string   `json:"edition,omitempty"`
+	IPv4Address          string   `json:"ipv4_address"`
+	IPv6Address          string   `json:"ipv6_address"`
+	DataPath             string   `json:"data_path,omitempty"`
+	IndexPath            string   `json:"index_path,omitempty"`
+	AnalyticsPath        string   `json:"analytics_path,omitempty"`
+	ServerGroup          string   `json:"server_group,omitempty"`
+	Role                 string   `json:"role,omitempty"`
+	Services             []string `json:"services,omitempty"`
+	SeccompProfile       string   `json:"seccomp_profile,omitempty"`
+	ApparmorProfile      string   `json:"apparmor_profile,omitempty"`
+	ConfigFile           string   `json:"config_file,omitempty"`
+	Init                 bool     `json:"init,omitempty"`
+	StopSignal           string   `json:"stop_signal,omitempty"`
+	PreserveData         bool     `json:"preserve_data,omitempty"`
+	Hostname             string   `json:"hostname,omitempty"`
+	Imported             bool     `json:"imported,omitempty"`
 }
 
 func jsonifyNode(node *Node) NodeJSON {
@@ -50,8 +71,23 @@ func jsonifyNode(node *Node) NodeJSON {
 		State:                node.State,
 		Name:                 node.Name,
 		InitialServerVersion: node.InitialServerVersion,
+		Edition:              node.Edition,
 		IPv4Address:          node.IPv4Address,
 		IPv6Address:          node.IPv6Address,
+		DataPath:             node.DataPath,
+		IndexPath:            node.IndexPath,
+		AnalyticsPath:        node.AnalyticsPath,
+		ServerGroup:          node.ServerGroup,
+		Role:                 node.Role,
+		Services:             node.Services,
+		SeccompProfile:       node.SeccompProfile,
+		ApparmorProfile:      node.ApparmorProfile,
+		ConfigFile:           node.ConfigFile,
+		Init:                 node.Init,
+		StopSignal:           node.StopSignal,
+		PreserveData:         node.PreserveData,
+		Hostname:             node.Hostname,
+		Imported:             node.Imported,
 	}
 }
 
@@ -62,8 +98,23 @@ func UnjsonifyNode(jsonNode *NodeJSON) *Node {
 		State:                jsonNode.State,
 		Name:                 jsonNode.Name,
 		InitialServerVersion: jsonNode.InitialServerVersion,
+		Edition:              jsonNode.Edition,
 		IPv4Address:          jsonNode.IPv4Address,
 		IPv6Address:          jsonNode.IPv6Address,
+		DataPath:             jsonNode.DataPath,
+		IndexPath:            jsonNode.IndexPath,
+		AnalyticsPath:        jsonNode.AnalyticsPath,
+		ServerGroup:          jsonNode.ServerGroup,
+		Role:                 jsonNode.Role,
+		Services:             jsonNode.Services,
+		SeccompProfile:       jsonNode.SeccompProfile,
+		ApparmorProfile:      jsonNode.ApparmorProfile,
+		ConfigFile:           jsonNode.ConfigFile,
+		Init:                 jsonNode.Init,
+		StopSignal:           jsonNode.StopSignal,
+		PreserveData:         jsonNode.PreserveData,
+		Hostname:             jsonNode.Hostname,
+		Imported:             jsonNode.Imported,
 	}
 }
 
@@ -76,22 +127,83 @@ type VersionJSON struct {
 	Version string `json:"version"`
 }
 
+type SyncGatewayJSON struct {
+	ID        string `json:"id"`
+	Version   string `json:"version"`
+	Bucket    string `json:"bucket"`
+	PublicURL string `json:"public_url"`
+	AdminURL  string `json:"admin_url"`
+}
+
 type ClusterJSON struct {
-	ID         string     `json:"id"`
-	Creator    string     `json:"creator"`
-	Owner      string     `json:"owner"`
-	Timeout    string     `json:"timeout"`
-	Nodes      []NodeJSON `json:"nodes"`
-	EntryPoint string     `json:"entry"`
+	ID                string                `json:"id"`
+	Creator           string                `json:"creator"`
+	Owner             string                `json:"owner"`
+	Timeout           string                `json:"timeout"`
+	Nodes             []NodeJSON            `json:"nodes"`
+	EntryPoint        string                `json:"entry"`
+	SyncGateway       *SyncGatewayJSON      `json:"sync_gateway,omitempty"`
+	StartDelay        string                `json:"start_delay,omitempty"`
+	StartOrder        []string              `json:"start_order,omitempty"`
+	GenerationID      string                `json:"generation_id,omitempty"`
+	AuthorizedOwners  []string              `json:"authorized_owners,omitempty"`
+	Name              string                `json:"name,omitempty"`
+	Placement         *PlacementConstraints `json:"placement,omitempty"`
+	ResolvedPlacement map[string][]string   `json:"resolved_placement,omitempty"`
+	RequestedNodes    int                   `json:"requested_nodes,omitempty"`
+	Tags              map[string]string     `json:"tags,omitempty"`
+	Orchestrator      string                `json:"orchestrator,omitempty"`
+	Registry          string                `json:"registry,omitempty"`
+	Namespace         string                `json:"namespace,omitempty"`
+	CreatedAt         string                `json:"created_at"`
+	Pending           bool                  `json:"pending,omitempty"`
+	MemoryQuotas      *MemoryQuotas         `json:"memory_quotas,omitempty"`
+	TerminateAt       string                `json:"terminate_at,omitempty"`
+	Frozen            bool                  `json:"frozen,omitempty"`
+}
+
+func jsonifySyncGateway(sg *SyncGateway) *SyncGatewayJSON {
+	if sg == nil {
+		return nil
+	}
+	return &SyncGatewayJSON{
+		ID:        sg.ContainerID,
+		Version:   sg.Version,
+		Bucket:    sg.Bucket,
+		PublicURL: sg.PublicURL(),
+		AdminURL:  sg.AdminURL(),
+	}
 }
 
 func jsonifyCluster(cluster *Cluster) ClusterJSON {
 	jsonCluster := ClusterJSON{
-		ID:         cluster.ID,
-		Creator:    cluster.Creator,
-		Owner:      cluster.Owner,
-		Timeout:    cluster.Timeout.Format(time.RFC3339),
-		EntryPoint: cluster.EntryPoint,
+		ID:                cluster.ID,
+		Creator:           cluster.Creator,
+		Owner:             cluster.Owner,
+		Timeout:           cluster.Timeout.Format(time.RFC3339),
+		EntryPoint:        cluster.EntryPoint,
+		SyncGateway:       jsonifySyncGateway(cluster.SyncGateway),
+		StartOrder:        cluster.StartOrder,
+		GenerationID:      cluster.GenerationID,
+		AuthorizedOwners:  cluster.AuthorizedOwners,
+		Name:              cluster.Name,
+		Placement:         cluster.Placement,
+		ResolvedPlacement: cluster.ResolvedPlacement,
+		RequestedNodes:    cluster.RequestedNodes,
+		Tags:              cluster.Tags,
+		Orchestrator:      cluster.Orchestrator,
+		Registry:          cluster.Registry,
+		Namespace:         cluster.Namespace,
+		CreatedAt:         cluster.CreatedAt.Format(time.RFC3339),
+		Pending:           cluster.Pending,
+		MemoryQuotas:      cluster.MemoryQuotas,
+		Frozen:            cluster.Frozen,
+	}
+	if cluster.StartDelay > 0 {
+		jsonCluster.StartDelay = cluster.StartDelay.String()
+	}
+	if !cluster.TerminateAt.IsZero() {
+		jsonCluster.TerminateAt = cluster.TerminateAt.Format(time.RFC3339)
 	}
 
 	for _, node := range cluster.Nodes {
@@ -129,34 +241,94 @@ func UnjsonifyCluster(jsonCluster *ClusterJSON) (*Cluster, error) {
 	}
 	cluster.Timeout = clusterTimeout
 
+	if jsonCluster.StartDelay != "" {
+		cluster.StartDelay, err = time.ParseDuration(jsonCluster.StartDelay)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cluster.StartOrder = jsonCluster.StartOrder
+	cluster.GenerationID = jsonCluster.GenerationID
+	cluster.AuthorizedOwners = jsonCluster.AuthorizedOwners
+	cluster.Name = jsonCluster.Name
+	cluster.Placement = jsonCluster.Placement
+	cluster.ResolvedPlacement = jsonCluster.ResolvedPlacement
+	cluster.RequestedNodes = jsonCluster.RequestedNodes
+	cluster.Tags = jsonCluster.Tags
+	cluster.Orchestrator = jsonCluster.Orchestrator
+	cluster.Registry = jsonCluster.Registry
+	cluster.Namespace = jsonCluster.Namespace
+	cluster.Pending = jsonCluster.Pending
+	cluster.MemoryQuotas = jsonCluster.MemoryQuotas
+	cluster.Frozen = jsonCluster.Frozen
+	if jsonCluster.CreatedAt != "" {
+		cluster.CreatedAt, err = time.Parse(time.RFC3339, jsonCluster.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if jsonCluster.TerminateAt != "" {
+		cluster.TerminateAt, err = time.Parse(time.RFC3339, jsonCluster.TerminateAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	for _, jsonNode := range jsonCluster.Nodes {
 		node := UnjsonifyNode(&jsonNode)
 		cluster.Nodes = append(cluster.Nodes, node)
 	}
 
+	if jsonCluster.SyncGateway != nil {
+		cluster.SyncGateway = &SyncGateway{
+			ContainerID: jsonCluster.SyncGateway.ID,
+			Version:     jsonCluster.SyncGateway.Version,
+			Bucket:      jsonCluster.SyncGateway.Bucket,
+		}
+		if sgURL, err := url.Parse(jsonCluster.SyncGateway.PublicURL); err == nil {
+			cluster.SyncGateway.IPv4Address = sgURL.Hostname()
+		}
+	}
+
 	return cluster, nil
 }
 
+// getHttpContext identifies the requester by their bearer token if they authenticated with one, in which case the
+// cbdn-user and cbdn-admin headers are ignored
 func getHttpContext(r *http.Request) (context.Context, error) {
-	userHeader := r.Header.Get("cbdn-user")
-	if userHeader == "" {
-		return nil, errors.New("must specify a user")
-	}
-	if !strings.HasSuffix(userHeader, "@couchbase.com") {
-		return nil, errors.New("your user must be your @couchbase.com email")
+	var user string
+	ignoreOwnership := false
+	if identity, ok := contextAuthIdentity(r.Context()); ok {
+		user = identity.User
+		ignoreOwnership = identity.Admin
+	} else {
+		userHeader := r.Header.Get("cbdn-user")
+		if userHeader == "" {
+			return nil, badRequestf("must specify a user")
+		}
+		if !strings.HasSuffix(userHeader, "@couchbase.com") {
+			return nil, badRequestf("your user must be your @couchbase.com email")
+		}
+		user = userHeader
+
+		adminHeader := r.Header.Get("cbdn-admin")
+		if adminHeader == "true" {
+			ignoreOwnership = true
+		}
 	}
-	user := userHeader
 
-	ignoreOwnership := false
-	adminHeader := r.Header.Get("cbdn-admin")
-	if adminHeader == "true" {
-		ignoreOwnership = true
+	namespace, err := resolveNamespace(user, r.Header.Get("cbdn-namespace"), ignoreOwnership)
+	if err != nil {
+		return nil, err
 	}
 
-	return NewContext(r.Context(), user, ignoreOwnership), nil
+	return WithNamespace(NewContext(r.Context(), user, ignoreOwnership), namespace), nil
 }
 
+// writeJSONError writes err with the status its error code maps to, every error returned by the REST API goes
+// through here so that they all have the same form
 func writeJSONError(w http.ResponseWriter, err error) {
+	status, _, _ := classifyError(err)
 	jsonErr := jsonifyError(err)
 
 	jsonBytes, err := json.Marshal(jsonErr)
@@ -167,11 +339,15 @@ func writeJSONError(w http.ResponseWriter, err error) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(400)
+	w.WriteHeader(status)
 	w.Write(jsonBytes)
 }
 
 func writeJsonResponse(w http.ResponseWriter, data interface{}) {
+	writeJsonResponseWithStatus(w, 200, data)
+}
+
+func writeJsonResponseWithStatus(w http.ResponseWriter, status int, data interface{}) {
 	jsonBytes, err := json.Marshal(data)
 	if err != nil {
 		log.Printf("Failed to marshal response JSON: %s", err)
@@ -180,141 +356,1900 @@ func writeJsonResponse(w http.ResponseWriter, data interface{}) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
+	w.WriteHeader(status)
 	w.Write(jsonBytes)
 }
 
 func readJsonRequest(r *http.Request, data interface{}) error {
 	jsonDec := json.NewDecoder(r.Body)
-	return jsonDec.Decode(data)
+	return badRequest(jsonDec.Decode(data))
 }
 
 func HttpRoot(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("This is the cbdyncluster daemon!\n"))
 }
 
-type GetClustersJSON []ClusterJSON
-
-func HttpGetClusters(w http.ResponseWriter, r *http.Request) {
+type GetClustersJSON []ClusterJSON
+
+func HttpGetClusters(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusters, err := getAllClusters(reqCtx)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	tagFilters := r.URL.Query()["tag"]
+
+	jsonClusters := make(GetClustersJSON, 0)
+
+	for _, cluster := range clusters {
+		if !matchesTagFilter(cluster.Tags, tagFilters) {
+			continue
+		}
+
+		jsonCluster := jsonifyCluster(cluster)
+		jsonClusters = append(jsonClusters, jsonCluster)
+	}
+
+	writeJsonResponse(w, jsonClusters)
+}
+
+type CreateClusterNodeJSON struct {
+	Name                string   `json:"name"`
+	Platform            string   `json:"platform"`
+	ServerVersion       string   `json:"server_version"`
+	UseCommunityEdition bool     `json:"community_edition"`
+	Edition             string   `json:"edition"`
+	DataPath            string   `json:"data_path"`
+	IndexPath           string   `json:"index_path"`
+	AnalyticsPath       string   `json:"analytics_path"`
+	ServerGroup         string   `json:"server_group"`
+	Role                string   `json:"role"`
+	Services            []string `json:"services"`
+	MemoryMB            int64    `json:"memory_mb"`
+	MemorySwapMB        int64    `json:"memory_swap_mb"`
+	MemorySwappiness    *int64   `json:"memory_swappiness"`
+	CPUs                float64  `json:"cpus"`
+	CPUShares           int64    `json:"cpu_shares"`
+	ConfigFile          string   `json:"config_file"`
+}
+
+type CreateClusterSetupJSON struct {
+	Services            []string             `json:"services"`
+	StorageMode         string               `json:"storage_mode"`
+	RamQuota            int                  `json:"ram_quota"`
+	UseHostname         bool                 `json:"use_hostname"`
+	UseIpv6             bool                 `json:"use_ipv6"`
+	Bucket              *helper.BucketOption `json:"bucket"`
+	User                *helper.UserOption   `json:"user"`
+	UseDeveloperPreview bool                 `json:"developer_preview"`
+	Trace               bool                 `json:"trace"`
+	SmokeTest           bool                 `json:"smoke_test"`
+	// Orchestrator is the name, role, ID or index of the node to initialize first, the first node if empty
+	Orchestrator string `json:"orchestrator"`
+}
+
+type CreateSyncGatewayJSON struct {
+	Version string `json:"version"`
+	Bucket  string `json:"bucket"`
+}
+
+type CreateClusterJSON struct {
+	Timeout          string                  `json:"timeout"`
+	Nodes            []CreateClusterNodeJSON `json:"nodes"`
+	Setup            CreateClusterNodeJSON   `json:"setup"`
+	SyncGateway      *CreateSyncGatewayJSON  `json:"sync_gateway"`
+	PreserveData     bool                    `json:"preserve_data"`
+	StartDelay       string                  `json:"start_delay"`
+	GenerationID     string                  `json:"generation_id"`
+	AuthorizedOwners []string                `json:"authorized_owners"`
+	Name             string                  `json:"name"`
+	Placement        *PlacementConstraints   `json:"placement"`
+	Init             *bool                   `json:"init"`
+	MinNodes         int                     `json:"min_nodes"`
+	StopSignal       string                  `json:"stop_signal"`
+	DNS              *DNSOptions             `json:"dns"`
+	Tags             map[string]string       `json:"tags"`
+	Registry         string                  `json:"registry"`
+	MemoryQuotas     *MemoryQuotas           `json:"memory_quotas"`
+}
+
+type EffectiveNodeOptionsJSON struct {
+	Name          string `json:"name,omitempty"`
+	ServerVersion string `json:"server_version"`
+	Edition       string `json:"edition"`
+}
+
+type EffectiveOptionsJSON struct {
+	Timeout     string                     `json:"timeout"`
+	Nodes       []EffectiveNodeOptionsJSON `json:"nodes"`
+	SyncGateway *CreateSyncGatewayJSON     `json:"sync_gateway,omitempty"`
+}
+
+func jsonifyEffectiveOptions(opts ClusterOptions) EffectiveOptionsJSON {
+	jsonOpts := EffectiveOptionsJSON{
+		Timeout: opts.Timeout.String(),
+	}
+	for _, node := range opts.Nodes {
+		jsonOpts.Nodes = append(jsonOpts.Nodes, EffectiveNodeOptionsJSON{
+			Name:          node.Name,
+			ServerVersion: node.ServerVersion,
+			Edition:       string(node.VersionInfo.Edition),
+		})
+	}
+	if opts.SyncGateway != nil {
+		jsonOpts.SyncGateway = &CreateSyncGatewayJSON{
+			Version: opts.SyncGateway.Version,
+			Bucket:  opts.SyncGateway.Bucket,
+		}
+	}
+	return jsonOpts
+}
+
+type EnsureClusterJSON struct {
+	ID       string      `json:"id"`
+	Created  bool        `json:"created"`
+	Cluster  ClusterJSON `json:"cluster"`
+	Warnings []string    `json:"warnings"`
+}
+
+func HttpEnsureCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	var reqData CreateClusterJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	reqData.Tags = applyEnvTags(r.Header, reqData.Tags)
+
+	clusterOpts, err := parseCreateClusterJSON(reqCtx, reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	cluster, created, warnings, err := ensureCluster(reqCtx, clusterOpts)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, EnsureClusterJSON{
+		ID:       cluster.ID,
+		Created:  created,
+		Cluster:  jsonifyCluster(cluster),
+		Warnings: jsonifyWarnings(warnings),
+	})
+}
+
+type DryRunClusterJSON struct {
+	EffectiveOptions EffectiveOptionsJSON `json:"effective_options"`
+	Plan             *AllocationPlan      `json:"plan"`
+	Warnings         []string             `json:"warnings"`
+}
+
+type ReadinessJSON struct {
+	Probe       string `json:"probe"`
+	Interval    string `json:"interval"`
+	Timeout     string `json:"timeout"`
+	TimeToReady string `json:"time_to_ready"`
+}
+
+// NewClusterJSON is the response to allocating a cluster.  Cluster is the complete cluster so that it can be used
+// without fetching it again, ID is kept for clients which only read that.
+type NewClusterJSON struct {
+	ID               string               `json:"id"`
+	Cluster          *ClusterJSON         `json:"cluster,omitempty"`
+	EffectiveOptions EffectiveOptionsJSON `json:"effective_options"`
+	Readiness        *ReadinessJSON       `json:"readiness,omitempty"`
+	NumNodes         int                  `json:"num_nodes"`
+	RequestedNodes   int                  `json:"requested_nodes"`
+	Warnings         []string             `json:"warnings"`
+}
+
+type ImportClusterJSON struct {
+	ContainerIDs []string          `json:"container_ids"`
+	Owner        string            `json:"owner"`
+	Timeout      string            `json:"timeout"`
+	Tags         map[string]string `json:"tags"`
+}
+
+func HttpImportCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	var reqData ImportClusterJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	opts := ImportClusterOptions{
+		ContainerIDs: reqData.ContainerIDs,
+		Owner:        reqData.Owner,
+		Tags:         applyEnvTags(r.Header, reqData.Tags),
+	}
+	if reqData.Timeout != "" {
+		opts.Timeout, err = time.ParseDuration(reqData.Timeout)
+		if err != nil {
+			writeJSONError(w, badRequestf("must specify a valid timeout for the cluster"))
+			return
+		}
+	}
+
+	clusterID, err := importCluster(reqCtx, opts)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	cluster, err := getCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, jsonifyCluster(cluster))
+}
+
+func parseReadinessOptions(r *http.Request) (ReadinessOptions, error) {
+	opts := defaultReadinessOptions()
+
+	query := r.URL.Query()
+	if probe := query.Get("probe"); probe != "" {
+		opts.Probe = probe
+	}
+	if interval := query.Get("probe_interval"); interval != "" {
+		parsedInterval, err := time.ParseDuration(interval)
+		if err != nil {
+			return opts, badRequest(err)
+		}
+		opts.Interval = parsedInterval
+	}
+	if timeout := query.Get("probe_timeout"); timeout != "" {
+		parsedTimeout, err := time.ParseDuration(timeout)
+		if err != nil {
+			return opts, badRequest(err)
+		}
+		opts.Timeout = parsedTimeout
+	}
+
+	return opts, validateReadinessOptions(opts)
+}
+
+// parseCreateClusterJSON resolves a cluster creation request into the options to allocate the cluster with,
+// filling in the requester's defaults and resolving server version aliases
+func parseCreateClusterJSON(ctx context.Context, reqData CreateClusterJSON) (ClusterOptions, error) {
+	clusterOpts := ClusterOptions{
+		Timeout:          getConfig().defaultClusterTimeout,
+		PreserveData:     reqData.PreserveData,
+		GenerationID:     reqData.GenerationID,
+		AuthorizedOwners: reqData.AuthorizedOwners,
+		Name:             reqData.Name,
+		Placement:        reqData.Placement,
+		Init:             reqData.Init,
+		MinNodes:         reqData.MinNodes,
+		StopSignal:       reqData.StopSignal,
+		DNS:              reqData.DNS,
+		Tags:             reqData.Tags,
+		Registry:         reqData.Registry,
+		MemoryQuotas:     reqData.MemoryQuotas,
+	}
+
+	defaults := getOwnerDefaults(ContextUser(ctx))
+	if reqData.Timeout == "" {
+		reqData.Timeout = defaults.Timeout
+	}
+
+	if reqData.Timeout != "" {
+		clusterTimeout, err := time.ParseDuration(reqData.Timeout)
+		if err != nil {
+			return ClusterOptions{}, badRequest(err)
+		}
+
+		clusterOpts.Timeout = clusterTimeout
+	}
+
+	if reqData.StartDelay != "" {
+		startDelay, err := time.ParseDuration(reqData.StartDelay)
+		if err != nil {
+			return ClusterOptions{}, badRequest(err)
+		}
+
+		clusterOpts.StartDelay = startDelay
+	}
+
+	//Get/refresh alias repo
+	if err := GetConfigRepo(); err != nil {
+		log.Printf("Get config failed: %v", err)
+	}
+
+	// The registry is checked before it is used to resolve versions, rather than only once the cluster is allocated
+	if err := validateRegistry(reqData.Registry); err != nil {
+		return ClusterOptions{}, err
+	}
+	resolver := newVersionResolver(reqData.Registry)
+	for _, node := range reqData.Nodes {
+		nodeOpts, err := parseCreateClusterNodeJSON(ctx, defaults, node, resolver)
+		if err != nil {
+			return ClusterOptions{}, err
+		}
+		clusterOpts.Nodes = append(clusterOpts.Nodes, nodeOpts)
+	}
+
+	if reqData.SyncGateway != nil {
+		clusterOpts.SyncGateway = &SyncGatewayOptions{
+			Version: reqData.SyncGateway.Version,
+			Bucket:  reqData.SyncGateway.Bucket,
+		}
+	}
+
+	return clusterOpts, nil
+}
+
+// parseCreateClusterNodeJSON resolves the server version and edition a node is requested with.  Stable and release
+// aliases are resolved against the config repo, which the caller is expected to have refreshed, while `latest` and
+// partial versions are resolved by resolver against the images in its registry.
+func parseCreateClusterNodeJSON(ctx context.Context, defaults OwnerDefaults, node CreateClusterNodeJSON, resolver *versionResolver) (NodeOptions, error) {
+	if node.ServerVersion == "" {
+		node.ServerVersion = defaults.ServerVersion
+	}
+	// The daemon's node limits apply unless the request sets its own
+	if node.MemoryMB == 0 {
+		node.MemoryMB = int64(getConfig().nodeMemoryMB)
+	}
+	if node.CPUs == 0 {
+		node.CPUs = getConfig().nodeCPUs
+	}
+	if node.CPUShares == 0 {
+		node.CPUShares = int64(getConfig().nodeCPUShares)
+	}
+
+	edition, err := parseEdition(node.Edition, node.UseCommunityEdition)
+	if err != nil {
+		return NodeOptions{}, err
+	}
+	finalVersion, err := aliasServerVersion(node.ServerVersion)
+	if err != nil {
+		return NodeOptions{}, err
+	}
+	finalVersion, err = resolver.resolve(ctx, finalVersion, edition)
+	if err != nil {
+		return NodeOptions{}, err
+	}
+	nodeVersion, err := parseServerVersion(finalVersion, edition)
+	if err != nil {
+		return NodeOptions{}, err
+	}
+
+	return NodeOptions{
+		Name:             node.Name,
+		Platform:         node.Platform,
+		ServerVersion:    finalVersion,
+		VersionInfo:      nodeVersion,
+		Edition:          edition,
+		DataPath:         node.DataPath,
+		IndexPath:        node.IndexPath,
+		AnalyticsPath:    node.AnalyticsPath,
+		ServerGroup:      node.ServerGroup,
+		Role:             node.Role,
+		Services:         normalizeServices(node.Services),
+		MemoryMB:         node.MemoryMB,
+		MemorySwapMB:     node.MemorySwapMB,
+		CPUs:             node.CPUs,
+		CPUShares:        node.CPUShares,
+		MemorySwappiness: node.MemorySwappiness,
+		ConfigFile:       node.ConfigFile,
+	}, nil
+}
+
+func HttpCreateCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	var reqData CreateClusterJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	reqData.Tags = applyEnvTags(r.Header, reqData.Tags)
+
+	clusterOpts, err := parseCreateClusterJSON(reqCtx, reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	wait := r.URL.Query().Get("wait") == "true"
+	readinessOpts, err := parseReadinessOptions(r)
+	if wait && err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("dry_run") == "true" || r.URL.Query().Get("dry-run") == "true" {
+		resolvedOpts, plan, warnings, err := previewCluster(reqCtx, clusterOpts)
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+
+		dryRunJson := DryRunClusterJSON{
+			EffectiveOptions: jsonifyEffectiveOptions(resolvedOpts),
+			Plan:             plan,
+			Warnings:         jsonifyWarnings(warnings),
+		}
+		writeJsonResponse(w, dryRunJson)
+		return
+	}
+
+	clusterID, warnings, err := allocateCluster(reqCtx, clusterOpts)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	newClusterJson := NewClusterJSON{
+		ID:               clusterID,
+		EffectiveOptions: jsonifyEffectiveOptions(clusterOpts),
+		NumNodes:         len(clusterOpts.Nodes),
+		RequestedNodes:   len(clusterOpts.Nodes),
+		Warnings:         jsonifyWarnings(warnings),
+	}
+
+	if wait {
+		timeToReady, err := waitForClusterReady(reqCtx, clusterID, readinessOpts)
+		if err != nil {
+			writeJSONError(w, &ClusterNotReadyError{ClusterID: clusterID, Err: err})
+			return
+		}
+
+		newClusterJson.Readiness = &ReadinessJSON{
+			Probe:       readinessOpts.Probe,
+			Interval:    readinessOpts.Interval.String(),
+			Timeout:     readinessOpts.Timeout.String(),
+			TimeToReady: timeToReady.String(),
+		}
+	}
+
+	cluster, err := getCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, &AllocatedClusterError{ClusterID: clusterID, Err: err})
+		return
+	}
+
+	clusterJson := jsonifyCluster(cluster)
+	newClusterJson.Cluster = &clusterJson
+
+	// Fewer nodes than requested may have been allocated to fit the docker host
+	newClusterJson.NumNodes = len(cluster.Nodes)
+	if len(cluster.Nodes) < len(newClusterJson.EffectiveOptions.Nodes) {
+		newClusterJson.EffectiveOptions.Nodes = newClusterJson.EffectiveOptions.Nodes[:len(cluster.Nodes)]
+	}
+
+	writeJsonResponse(w, newClusterJson)
+}
+
+type ScheduleClusterJSON struct {
+	CreateClusterJSON
+	StartAt string `json:"start_at"`
+}
+
+func HttpScheduleCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	var reqData ScheduleClusterJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	reqData.Tags = applyEnvTags(r.Header, reqData.Tags)
+
+	startAt, err := time.Parse(time.RFC3339, reqData.StartAt)
+	if err != nil {
+		writeJSONError(w, badRequestf("start_at must be an RFC3339 timestamp"))
+		return
+	}
+
+	schedule, err := scheduleCluster(reqCtx, startAt, reqData.CreateClusterJSON)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, schedule)
+}
+
+func HttpGetScheduledAllocations(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	schedules, err := getScheduledAllocations(reqCtx)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if schedules == nil {
+		schedules = make([]ScheduledAllocation, 0)
+	}
+	writeJsonResponse(w, schedules)
+}
+
+func HttpCancelScheduledAllocation(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	scheduleID := mux.Vars(r)["schedule_id"]
+
+	err = cancelScheduledAllocation(reqCtx, scheduleID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+type GetClusterJSON ClusterJSON
+
+func HttpGetCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	cluster, err := getCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if err := checkClusterOwnership(reqCtx, cluster); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	jsonCluster := jsonifyCluster(cluster)
+
+	writeJsonResponse(w, jsonCluster)
+}
+
+type UpdateClusterJSON struct {
+	Timeout string `json:"timeout"`
+}
+
+func HttpGetDockerHost(w http.ResponseWriter, r *http.Request) {
+	hostURI, err := url.Parse(dockerHost)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if hostURI.Scheme != "tcp" {
+		writeJSONError(w, errors.New("docker is not configured via tcp and cannot return the docker host"))
+		return
+	}
+
+	jsonResp := &DockerHostJSON{
+		Hostname: hostURI.Hostname(),
+		Port:     hostURI.Port(),
+	}
+	writeJsonResponse(w, jsonResp)
+	return
+}
+
+type LimitsJSON struct {
+	Owner             string `json:"owner"`
+	MaxClusterTimeout string `json:"max_cluster_timeout"`
+	MaxClusterNodes   int    `json:"max_cluster_nodes"`
+}
+
+func HttpGetLimits(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	owner := ContextUser(reqCtx)
+	writeJsonResponse(w, LimitsJSON{
+		Owner:             owner,
+		MaxClusterTimeout: getMaxClusterTimeout(owner).String(),
+		MaxClusterNodes:   getConfig().maxClusterNodes,
+	})
+}
+
+func HttpGetAuditReport(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	report, err := getAuditReport(reqCtx)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, report)
+}
+
+func HttpGetDaemonInternals(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	internals, err := getDaemonInternals(reqCtx)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, internals)
+}
+
+func HttpGetReconciliationReport(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	report, err := getReconciliationReport(reqCtx)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, report)
+}
+
+type ReclaimJSON struct {
+	FreeNodes  int      `json:"free_nodes"`
+	FreeDiskMB int64    `json:"free_disk_mb"`
+	Skip       []string `json:"skip"`
+	Confirm    bool     `json:"confirm"`
+}
+
+func HttpReclaim(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	var reqData ReclaimJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if !reqData.Confirm {
+		writeJSONError(w, badRequestf("reclaiming kills clusters, set confirm to true to proceed"))
+		return
+	}
+
+	result, err := reclaimCapacity(reqCtx, ReclaimOptions{
+		FreeNodes:  reqData.FreeNodes,
+		FreeDiskMB: reqData.FreeDiskMB,
+		Skip:       reqData.Skip,
+	})
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, result)
+}
+
+func HttpReloadConfig(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if !ContextIgnoreOwnership(reqCtx) {
+		writeJSONError(w, forbiddenf("only admins can reload the configuration"))
+		return
+	}
+
+	log.Printf("Reloading configuration (requested by: %s)", ContextRequester(reqCtx))
+
+	err = reloadConfig()
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func HttpGetVersion(w http.ResponseWriter, r *http.Request) {
+	jsonResp := &VersionJSON{
+		Version: Version,
+	}
+	writeJsonResponse(w, jsonResp)
+	return
+}
+
+func HttpSetupCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	var reqData CreateClusterSetupJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	cluster, err := getCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if len(reqData.Services) == 0 {
+		reqData.Services = assignedServices(cluster.Nodes)
+	}
+	if len(reqData.Services) == 0 {
+		reqData.Services = getOwnerDefaults(ContextUser(reqCtx)).Services
+	}
+	if len(cluster.Nodes) != len(reqData.Services) {
+		writeJSONError(w, badRequestf("services does not map to number of nodes"))
+		return
+	}
+	if err := validateBucketReplicas(reqData.Bucket); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	if err := validateServicePlacement(cluster.Placement, cluster.Nodes, reqData.Services); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	meta, err := metaStore.GetClusterMeta(clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	if meta.SyncGatewayID == "" {
+		if err := validateSyncGatewaySetup(meta.SyncGateway, reqData.Bucket); err != nil {
+			writeJSONError(w, err)
+			return
+		}
+	}
+	orchestrator, err := resolveOrchestrator(cluster.Nodes, reqData.Services, reqData.Orchestrator)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	// The data quota the cluster was allocated with applies unless the setup request gives its own
+	if reqData.RamQuota == 0 && cluster.MemoryQuotas != nil && cluster.MemoryQuotas.Data > 0 {
+		reqData.RamQuota = cluster.MemoryQuotas.Data
+	}
+
+	var trace *helper.RestTrace
+	if reqData.Trace {
+		trace = newSetupTrace(clusterID)
+	} else if getConfig().allocLogDir != "" {
+		// The setup calls are still traced for the allocation log, but not kept for the setup-trace endpoint
+		trace = &helper.RestTrace{}
+	}
+
+	allocLogf(clusterID, "Setting up cluster with services %v (requested by: %s)", reqData.Services, ContextRequester(reqCtx))
+
+	var epnode string
+	err = runPhase(reqCtx, AllocationPhaseSetup, getConfig().setupTimeout, func(ctx context.Context) error {
+		var err error
+		epnode, err = SetupCluster(&ClusterSetupOptions{
+			Ctx:          ctx,
+			Nodes:        cluster.Nodes,
+			Conf:         reqData,
+			Trace:        trace,
+			Orchestrator: orchestrator,
+			MemoryQuotas: cluster.MemoryQuotas,
+		})
+		return err
+	})
+	allocLogTrace(clusterID, trace)
+	if err != nil {
+		allocLogf(clusterID, "Setup failed: %s", err)
+		writeJSONError(w, err)
+		return
+	}
+	allocLogf(clusterID, "Setup completed with entry point %s", epnode)
+
+	cluster.EntryPoint = epnode
+
+	cluster.ResolvedPlacement = resolvePlacement(cluster.Nodes, reqData.Services)
+	cluster.Orchestrator = cluster.Nodes[orchestrator].ContainerID
+	if orchestratorNode, err := getOrchestratorNode(cluster.Nodes); err != nil {
+		log.Printf("Failed to get the orchestrator of cluster %s, recording the node initialized first: %s", clusterID, err)
+	} else {
+		cluster.Orchestrator = orchestratorNode.ContainerID
+	}
+	err = metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		meta.ResolvedPlacement = cluster.ResolvedPlacement
+		meta.Orchestrator = cluster.Orchestrator
+		return meta, nil
+	})
+	if err != nil {
+		log.Printf("Failed to record service placement of cluster %s: %s", clusterID, err)
+	}
+
+	// The sync gateway could not connect to its bucket until setup created it
+	if meta.SyncGateway != nil && meta.SyncGatewayID == "" {
+		if err := startSyncGateway(reqCtx, cluster, *meta.SyncGateway); err != nil {
+			allocLogf(clusterID, "Failed to start sync gateway: %s", err)
+			writeJSONError(w, fmt.Errorf("cluster was set up but its sync gateway failed to start: %s", err))
+			return
+		}
+		if started, err := getCluster(reqCtx, clusterID); err == nil {
+			cluster.SyncGateway = started.SyncGateway
+		}
+	}
+
+	setupJson := SetupClusterJSON{
+		ClusterJSON: jsonifyCluster(cluster),
+		Warnings:    jsonifyWarnings(checkBucketReplicas(cluster, reqData.Bucket)),
+	}
+
+	if !reqData.SmokeTest {
+		writeJsonResponse(w, setupJson)
+		return
+	}
+
+	setupJson.SmokeTest = runSmokeTest(reqCtx, cluster, reqData.Services)
+
+	// A failed smoke test is reported as an error, but the results are still included so the caller can see
+	// which step failed
+	if step := setupJson.SmokeTest.failedStep(); step != nil {
+		jsonErr := jsonifyError(fmt.Errorf("smoke test failed at %s: %s", step.Name, step.Error))
+		setupJson.ErrorJSON = &jsonErr
+		writeJsonResponseWithStatus(w, 400, setupJson)
+		return
+	}
+
+	writeJsonResponse(w, setupJson)
+}
+
+type SetupClusterJSON struct {
+	*ErrorJSON
+	ClusterJSON
+	SmokeTest *SmokeTestResult `json:"smoke_test,omitempty"`
+	Warnings  []string         `json:"warnings"`
+}
+
+type SetupTraceEntryJSON struct {
+	Time   string `json:"time"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+	Error  string `json:"error,omitempty"`
+}
+
+type SetupTraceJSON []SetupTraceEntryJSON
+
+func HttpGetSetupTrace(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	cluster, err := getCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if err := checkClusterOwnership(reqCtx, cluster); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	trace := getSetupTrace(clusterID)
+	if trace == nil {
+		writeJSONError(w, notFoundf("no setup trace was captured for this cluster"))
+		return
+	}
+
+	jsonTrace := make(SetupTraceJSON, 0)
+	for _, entry := range trace.Entries() {
+		jsonTrace = append(jsonTrace, SetupTraceEntryJSON{
+			Time:   entry.Time.Format(time.RFC3339Nano),
+			Method: entry.Method,
+			URL:    entry.URL,
+			Status: entry.Status,
+			Body:   entry.Body,
+			Error:  entry.Error,
+		})
+	}
+
+	writeJsonResponse(w, jsonTrace)
+}
+
+func HttpUpdateCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	var reqData UpdateClusterJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if reqData.Timeout != "" {
+		newTimeout, err := time.ParseDuration(reqData.Timeout)
+		if err != nil {
+			writeJSONError(w, badRequest(err))
+			return
+		}
+
+		err = refreshCluster(reqCtx, clusterID, newTimeout)
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+
+		w.WriteHeader(200)
+		return
+	}
+
+	writeJSONError(w, badRequestf("not sure what you wanted to do"))
+}
+
+type ExtendClusterJSON struct {
+	Duration string `json:"duration"`
+}
+
+type ExtendedClusterJSON struct {
+	ID      string `json:"id"`
+	Timeout string `json:"timeout"`
+}
+
+func HttpExtendCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	var reqData ExtendClusterJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	extension, err := time.ParseDuration(reqData.Duration)
+	if err != nil {
+		writeJSONError(w, badRequest(err))
+		return
+	}
+
+	newTimeout, err := extendCluster(reqCtx, clusterID, extension)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, ExtendedClusterJSON{
+		ID:      clusterID,
+		Timeout: newTimeout.Format(time.RFC3339),
+	})
+}
+
+func HttpDeleteCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	// Deleted clusters can be revived during termination-grace, unless they are forcibly killed
+	if getConfig().terminationGrace > 0 && r.URL.Query().Get("force") != "true" {
+		terminateAt, err := terminateCluster(reqCtx, clusterID)
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+
+		writeJsonResponseWithStatus(w, 202, TerminatingClusterJSON{
+			ID:          clusterID,
+			TerminateAt: terminateAt.Format(time.RFC3339),
+		})
+		return
+	}
+
+	// Forcing a delete also kills the cluster's containers rather than waiting for them to stop
+	if r.URL.Query().Get("force") == "true" {
+		err = forceKillClusterWithReason(reqCtx, clusterID, KillReasonRequested)
+	} else {
+		err = killCluster(reqCtx, clusterID)
+	}
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func HttpKillClusters(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	opts := BulkKillOptions{
+		Owner: r.URL.Query().Get("owner"),
+		Tags:  r.URL.Query()["tag"],
+		Force: r.URL.Query().Get("force") == "true",
+	}
+	if olderThan := r.URL.Query().Get("older_than"); olderThan != "" {
+		opts.OlderThan, err = time.ParseDuration(olderThan)
+		if err != nil {
+			writeJSONError(w, badRequestf("older_than must be a duration: %s", err))
+			return
+		}
+	}
+
+	summary, err := killClusters(reqCtx, opts)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, summary)
+}
+
+type TerminatingClusterJSON struct {
+	ID          string `json:"id"`
+	TerminateAt string `json:"terminate_at"`
+}
+
+func HttpReviveCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	err = reviveCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func HttpFreezeCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	err = setClusterFrozen(reqCtx, clusterID, r.Method != "DELETE")
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func HttpGetGeneration(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	generationID := mux.Vars(r)["generation_id"]
+
+	clusters, err := getGenerationClusters(reqCtx, generationID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	jsonClusters := make(GetClustersJSON, 0)
+	for _, cluster := range clusters {
+		jsonClusters = append(jsonClusters, jsonifyCluster(cluster))
+	}
+
+	writeJsonResponse(w, jsonClusters)
+}
+
+func HttpUpdateGeneration(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	generationID := mux.Vars(r)["generation_id"]
+
+	var reqData UpdateClusterJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if reqData.Timeout == "" {
+		writeJSONError(w, badRequestf("not sure what you wanted to do"))
+		return
+	}
+
+	newTimeout, err := time.ParseDuration(reqData.Timeout)
+	if err != nil {
+		writeJSONError(w, badRequest(err))
+		return
+	}
+
+	err = refreshGeneration(reqCtx, generationID, newTimeout)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func HttpDeleteGeneration(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	generationID := mux.Vars(r)["generation_id"]
+
+	err = killGeneration(reqCtx, generationID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+type ClusterOwnersJSON struct {
+	Owners []string `json:"owners"`
+}
+
+func HttpSetClusterOwners(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	var reqData ClusterOwnersJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	err = setClusterOwners(reqCtx, clusterID, reqData.Owners)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+type AddBucketJSON struct {
+	Name         string `json:"name"`
+	StorageMode  string `json:"storage_mode"`
+	RamQuota     int    `json:"ram_quota"`
+	UseHostname  bool   `json:"use_hostname"`
+	ReplicaCount int    `json:"replica_count"`
+	BucketType   string `json:"bucket_type"`
+}
+
+func HttpAddBucket(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	var reqData AddBucketJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	err = addBucket(reqCtx, clusterID, AddBucketOptions{
+		Conf: reqData,
+	})
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+type AddNodesJSON struct {
+	Nodes       []CreateClusterNodeJSON `json:"nodes"`
+	UseHostname bool                    `json:"use_hostname"`
+}
+
+type AddedNodesJSON struct {
+	Nodes []NodeJSON `json:"nodes"`
+}
+
+func HttpAddClusterNodes(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	var reqData AddNodesJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	//Get/refresh alias repo
+	if err := GetConfigRepo(); err != nil {
+		log.Printf("Get config failed: %v", err)
+	}
+
+	// Version aliases resolve against the registry the cluster's images come from
+	cluster, err := getCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	opts := AddNodesOptions{
+		UseHostname: reqData.UseHostname,
+	}
+	defaults := getOwnerDefaults(ContextUser(reqCtx))
+	resolver := newVersionResolver(cluster.Registry)
+	for _, node := range reqData.Nodes {
+		nodeOpts, err := parseCreateClusterNodeJSON(reqCtx, defaults, node, resolver)
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+		opts.Nodes = append(opts.Nodes, nodeOpts)
+	}
+
+	containerIDs, err := addClusterNodes(reqCtx, clusterID, opts)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	c, err := getCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	added := AddedNodesJSON{Nodes: []NodeJSON{}}
+	for _, containerID := range containerIDs {
+		for _, node := range c.Nodes {
+			if node.ContainerID == containerID {
+				added.Nodes = append(added.Nodes, jsonifyNode(node))
+			}
+		}
+	}
+
+	writeJsonResponse(w, added)
+}
+
+func HttpRemoveClusterNode(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+	nodeID := mux.Vars(r)["node_id"]
+
+	err = removeClusterNode(reqCtx, clusterID, nodeID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func HttpRebalanceCluster(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	err = rebalanceCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(202)
+}
+
+func HttpGetClusterRebalance(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	status, err := getClusterRebalance(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, status)
+}
+
+type ResizeBucketJSON struct {
+	RamQuota     int  `json:"ram_quota"`
+	ReplicaCount *int `json:"replica_count"`
+}
+
+type BucketSettingsJSON struct {
+	Name         string `json:"name"`
+	RamQuota     int    `json:"ram_quota"`
+	ReplicaCount int    `json:"replica_count"`
+}
+
+func HttpResizeBucket(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+	bucketName := mux.Vars(r)["bucket"]
+
+	var reqData ResizeBucketJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	settings, err := resizeBucket(reqCtx, clusterID, bucketName, ResizeBucketOptions{
+		RamQuota:     reqData.RamQuota,
+		ReplicaCount: reqData.ReplicaCount,
+	})
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, BucketSettingsJSON{
+		Name:         settings.Name,
+		RamQuota:     settings.RamQuota,
+		ReplicaCount: settings.ReplicaCount,
+	})
+}
+
+type AddSampleBucketJSON struct {
+	SampleBucket string `json:"sample_bucket"`
+	UseHostname  bool   `json:"use_hostname"`
+}
+
+func HttpAddSampleBucket(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	var reqData AddSampleBucketJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	err = addSampleBucket(reqCtx, clusterID, AddSampleOptions{
+		Conf: reqData,
+	})
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+type AddCollectionJSON struct {
+	Name        string `json:"name"`
+	ScopeName   string `json:"scope_name"`
+	BucketName  string `json:"bucket_name"`
+	UseHostname bool   `json:"use_hostname"`
+}
+
+func HttpAddCollection(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	var reqData AddCollectionJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	err = addCollection(reqCtx, clusterID, AddCollectionOptions{
+		Conf: reqData,
+	})
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+type SetupClientCertAuthJSON struct {
+	UserName  string `json:"user"`
+	UserEmail string `json:"email"`
+}
+
+type CertAuthResultJSON struct {
+	CACert     []byte `json:"cacert"`
+	ClientKey  []byte `json:"client_key"`
+	ClientCert []byte `json:"client_cert"`
+}
+
+func HttpSetupClientCertAuth(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	var reqData SetupClientCertAuthJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	cluster, err := getCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	certData, err := SetupCertAuth(SetupClientCertAuthOptions{
+		Nodes: cluster.Nodes,
+		Conf:  reqData,
+	})
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, CertAuthResultJSON{
+		CACert:     certData.CACert,
+		ClientKey:  certData.ClientKey,
+		ClientCert: certData.ClientCert,
+	})
+	return
+}
+
+type LatencyMeasurementJSON struct {
+	From  string  `json:"from"`
+	To    string  `json:"to"`
+	MinMs float64 `json:"min_ms"`
+	AvgMs float64 `json:"avg_ms"`
+	MaxMs float64 `json:"max_ms"`
+	Error string  `json:"error,omitempty"`
+}
+
+func durationToMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func HttpGetClusterLatency(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	measurements, err := getClusterLatency(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	jsonMeasurements := make([]LatencyMeasurementJSON, 0)
+	for _, measurement := range measurements {
+		jsonMeasurement := LatencyMeasurementJSON{
+			From:  measurement.From,
+			To:    measurement.To,
+			MinMs: durationToMillis(measurement.Min),
+			AvgMs: durationToMillis(measurement.Avg),
+			MaxMs: durationToMillis(measurement.Max),
+		}
+		if measurement.Err != nil {
+			jsonMeasurement.Error = measurement.Err.Error()
+		}
+		jsonMeasurements = append(jsonMeasurements, jsonMeasurement)
+	}
+
+	writeJsonResponse(w, jsonMeasurements)
+}
+
+type InjectLatencyJSON struct {
+	Node   string `json:"node"`
+	Delay  string `json:"delay"`
+	Jitter string `json:"jitter"`
+}
+
+func HttpInjectClusterLatency(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	var reqData InjectLatencyJSON
+	err = readJsonRequest(r, &reqData)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	opts := InjectLatencyOptions{
+		NodeID: reqData.Node,
+	}
+
+	opts.Delay, err = time.ParseDuration(reqData.Delay)
+	if err != nil {
+		writeJSONError(w, badRequest(err))
+		return
+	}
+
+	if reqData.Jitter != "" {
+		opts.Jitter, err = time.ParseDuration(reqData.Jitter)
+		if err != nil {
+			writeJSONError(w, badRequest(err))
+			return
+		}
+	}
+
+	err = injectClusterLatency(reqCtx, clusterID, opts)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func HttpResetClusterLatency(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	err = resetClusterLatency(reqCtx, clusterID, r.URL.Query().Get("node"))
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+type NodeDetailsJSON struct {
+	NodeJSON
+	Ports []NodePort `json:"ports"`
+}
+
+func HttpGetNode(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+	nodeID := mux.Vars(r)["node_id"]
+
+	node, ports, err := getNodeDetails(reqCtx, clusterID, nodeID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, NodeDetailsJSON{
+		NodeJSON: jsonifyNode(node),
+		Ports:    ports,
+	})
+}
+
+func HttpInspectNode(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+	nodeID := mux.Vars(r)["node_id"]
+
+	raw, err := inspectNode(reqCtx, clusterID, nodeID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeBoundedResponse(w, "application/json", raw)
+}
+
+func HttpGetNodeLogs(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+	nodeID := mux.Vars(r)["node_id"]
+	follow := r.URL.Query().Get("follow") == "true"
+
+	logs, err := nodeLogs(reqCtx, clusterID, nodeID, r.URL.Query().Get("tail"), follow)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(200)
+
+	// Containers run without a tty, so docker multiplexes stdout and stderr and they need separating again.
+	// Following ends when the client disconnects, which cancels the request context.
+	output := newFlushWriter(w)
+	_, err = stdcopy.StdCopy(output, output, logs)
+	if err != nil && reqCtx.Err() == nil {
+		log.Printf("Failed to stream logs of node %s in cluster %s: %s", nodeID, clusterID, err)
+	}
+}
+
+func HttpGetCouchbaseLogs(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	cluster, err := getCluster(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if err := checkClusterOwnership(reqCtx, cluster); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-couchbase-logs.zip\"", clusterID))
+	w.WriteHeader(200)
+
+	// The response has already started, so errors can only be logged and will truncate the zip
+	err = writeClusterCouchbaseLogs(reqCtx, newFlushWriter(w), cluster)
+	if err != nil {
+		log.Printf("Failed to write couchbase logs for cluster %s: %s", clusterID, err)
+	}
+}
+
+func HttpCollectDiagnostics(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	clusters, err := getAllClusters(reqCtx)
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	cluster, err := getCluster(reqCtx, clusterID)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	jsonClusters := make(GetClustersJSON, 0)
-
-	for _, cluster := range clusters {
-		jsonCluster := jsonifyCluster(cluster)
-		jsonClusters = append(jsonClusters, jsonCluster)
+	if err := checkClusterOwnership(reqCtx, cluster); err != nil {
+		writeJSONError(w, err)
+		return
 	}
 
-	writeJsonResponse(w, jsonClusters)
-}
-
-type CreateClusterNodeJSON struct {
-	Name                string `json:"name"`
-	Platform            string `json:"platform"`
-	ServerVersion       string `json:"server_version"`
-	UseCommunityEdition bool   `json:"community_edition"`
-}
-
-type CreateClusterSetupJSON struct {
-	Services            []string             `json:"services"`
-	StorageMode         string               `json:"storage_mode"`
-	RamQuota            int                  `json:"ram_quota"`
-	UseHostname         bool                 `json:"use_hostname"`
-	UseIpv6             bool                 `json:"use_ipv6"`
-	Bucket              *helper.BucketOption `json:"bucket"`
-	User                *helper.UserOption   `json:"user"`
-	UseDeveloperPreview bool                 `json:"developer_preview"`
-}
-
-type CreateClusterJSON struct {
-	Timeout string                  `json:"timeout"`
-	Nodes   []CreateClusterNodeJSON `json:"nodes"`
-	Setup   CreateClusterNodeJSON   `json:"setup"`
-}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-diagnostics.tar.gz\"", clusterID))
+	w.WriteHeader(200)
 
-type NewClusterJSON struct {
-	ID string `json:"id"`
+	// The response has already started, so errors can only be logged and will truncate the tarball
+	err = writeClusterDiagnostics(reqCtx, newFlushWriter(w), cluster)
+	if err != nil {
+		log.Printf("Failed to write diagnostics for cluster %s: %s", clusterID, err)
+	}
 }
 
-func HttpCreateCluster(w http.ResponseWriter, r *http.Request) {
+func HttpGetClusterHistory(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	var reqData CreateClusterJSON
-	err = readJsonRequest(r, &reqData)
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	history, err := getClusterHistory(reqCtx, clusterID)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	clusterOpts := ClusterOptions{
-		Timeout: 1 * time.Hour,
+	if history == nil {
+		history = make([]ClusterHistoryEntry, 0)
 	}
 
-	if reqData.Timeout != "" {
-		clusterTimeout, err := time.ParseDuration(reqData.Timeout)
-		if err != nil {
-			writeJSONError(w, err)
-			return
-		}
-
-		clusterOpts.Timeout = clusterTimeout
-	}
+	writeJsonResponse(w, history)
+}
 
-	//Get/refresh alias repo
-	if err := GetConfigRepo(); err != nil {
-		log.Printf("Get config failed: %v", err)
+func HttpGetConnectionConfig(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
 	}
 
-	for _, node := range reqData.Nodes {
-		finalVersion, err := aliasServerVersion(node.ServerVersion)
-		if err != nil {
-			writeJSONError(w, err)
-			return
-		}
-		nodeVersion, err := parseServerVersion(finalVersion, node.UseCommunityEdition)
-		if err != nil {
-			writeJSONError(w, err)
-			return
-		}
+	clusterID := mux.Vars(r)["cluster_id"]
 
-		nodeOpts := NodeOptions{
-			Name:          node.Name,
-			Platform:      node.Platform,
-			ServerVersion: finalVersion,
-			VersionInfo:   nodeVersion,
-		}
-		clusterOpts.Nodes = append(clusterOpts.Nodes, nodeOpts)
+	config, err := getConnectionConfig(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
 	}
 
-	clusterID, err := allocateCluster(reqCtx, clusterOpts)
+	configBytes, contentType, err := formatConnectionConfig(config, r.URL.Query().Get("format"))
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	newClusterJson := NewClusterJSON{
-		ID: clusterID,
-	}
-	writeJsonResponse(w, newClusterJson)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(200)
+	w.Write(configBytes)
 }
 
-type GetClusterJSON ClusterJSON
+type CreateCheckpointJSON struct {
+	Label string `json:"label"`
+}
 
-func HttpGetCluster(w http.ResponseWriter, r *http.Request) {
+type CheckpointJSON struct {
+	ClusterCheckpoint
+	Diff CheckpointDiff `json:"diff"`
+}
+
+type GetCheckpointsJSON struct {
+	Current     ClusterCheckpoint `json:"current"`
+	Checkpoints []CheckpointJSON  `json:"checkpoints"`
+}
+
+func HttpCreateCheckpoint(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
@@ -323,50 +2258,52 @@ func HttpGetCluster(w http.ResponseWriter, r *http.Request) {
 
 	clusterID := mux.Vars(r)["cluster_id"]
 
-	cluster, err := getCluster(reqCtx, clusterID)
+	var reqData CreateCheckpointJSON
+	err = readJsonRequest(r, &reqData)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	jsonCluster := jsonifyCluster(cluster)
-
-	writeJsonResponse(w, jsonCluster)
-}
+	checkpoint, err := createCheckpoint(reqCtx, clusterID, reqData.Label)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
 
-type UpdateClusterJSON struct {
-	Timeout string `json:"timeout"`
+	writeJsonResponse(w, checkpoint)
 }
 
-func HttpGetDockerHost(w http.ResponseWriter, r *http.Request) {
-	hostURI, err := url.Parse(dockerHost)
+func HttpGetCheckpoints(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	if hostURI.Scheme != "tcp" {
-		writeJSONError(w, errors.New("docker is not configured via tcp and cannot return the docker host"))
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	checkpoints, current, err := getCheckpoints(reqCtx, clusterID)
+	if err != nil {
+		writeJSONError(w, err)
 		return
 	}
 
-	jsonResp := &DockerHostJSON{
-		Hostname: hostURI.Hostname(),
-		Port:     hostURI.Port(),
+	jsonResp := GetCheckpointsJSON{
+		Current:     current,
+		Checkpoints: make([]CheckpointJSON, 0),
 	}
-	writeJsonResponse(w, jsonResp)
-	return
-}
-
-func HttpGetVersion(w http.ResponseWriter, r *http.Request) {
-	jsonResp := &VersionJSON{
-		Version: Version,
+	for _, checkpoint := range checkpoints {
+		jsonResp.Checkpoints = append(jsonResp.Checkpoints, CheckpointJSON{
+			ClusterCheckpoint: checkpoint,
+			Diff:              diffCheckpoints(checkpoint, current),
+		})
 	}
+
 	writeJsonResponse(w, jsonResp)
-	return
 }
 
-func HttpSetupCluster(w http.ResponseWriter, r *http.Request) {
+func HttpGetAllocLog(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
@@ -375,40 +2312,38 @@ func HttpSetupCluster(w http.ResponseWriter, r *http.Request) {
 
 	clusterID := mux.Vars(r)["cluster_id"]
 
-	var reqData CreateClusterSetupJSON
-	err = readJsonRequest(r, &reqData)
+	allocLog, err := getAllocLog(reqCtx, clusterID)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	cluster, err := getCluster(reqCtx, clusterID)
+	writeBoundedResponse(w, "text/plain", allocLog)
+}
+
+func HttpGetClusterDrift(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
-	if len(cluster.Nodes) != len(reqData.Services) {
-		writeJSONError(w, errors.New("services does not map to number of nodes"))
-		return
-	}
 
-	epnode, err := SetupCluster(&ClusterSetupOptions{
-		Nodes: cluster.Nodes,
-		Conf:  reqData,
-	})
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	drift, err := getClusterDrift(reqCtx, clusterID)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	cluster.EntryPoint = epnode
+	writeJsonResponse(w, drift)
+}
 
-	jsonCluster := jsonifyCluster(cluster)
-	writeJsonResponse(w, jsonCluster)
-	return
+type PartitionNodeJSON struct {
+	Peers []string `json:"peers"`
 }
 
-func HttpUpdateCluster(w http.ResponseWriter, r *http.Request) {
+func HttpPartitionNode(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
@@ -416,31 +2351,28 @@ func HttpUpdateCluster(w http.ResponseWriter, r *http.Request) {
 	}
 
 	clusterID := mux.Vars(r)["cluster_id"]
+	nodeID := mux.Vars(r)["node_id"]
 
-	var reqData UpdateClusterJSON
+	var reqData PartitionNodeJSON
 	err = readJsonRequest(r, &reqData)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	if reqData.Timeout != "" {
-		newTimeout, err := time.ParseDuration(reqData.Timeout)
-		if err != nil {
-			writeJSONError(w, err)
-			return
-		}
-
-		refreshCluster(reqCtx, clusterID, newTimeout)
-
-		w.WriteHeader(200)
+	partition, err := partitionNode(reqCtx, clusterID, PartitionNodeOptions{
+		NodeID: nodeID,
+		Peers:  reqData.Peers,
+	})
+	if err != nil {
+		writeJSONError(w, err)
 		return
 	}
 
-	writeJSONError(w, errors.New("not sure what you wanted to do"))
+	writeJsonResponse(w, partition)
 }
 
-func HttpDeleteCluster(w http.ResponseWriter, r *http.Request) {
+func HttpHealNode(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
@@ -448,8 +2380,9 @@ func HttpDeleteCluster(w http.ResponseWriter, r *http.Request) {
 	}
 
 	clusterID := mux.Vars(r)["cluster_id"]
+	nodeID := mux.Vars(r)["node_id"]
 
-	err = killCluster(reqCtx, clusterID)
+	err = healNode(reqCtx, clusterID, nodeID)
 	if err != nil {
 		writeJSONError(w, err)
 		return
@@ -458,16 +2391,7 @@ func HttpDeleteCluster(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
 
-type AddBucketJSON struct {
-	Name         string `json:"name"`
-	StorageMode  string `json:"storage_mode"`
-	RamQuota     int    `json:"ram_quota"`
-	UseHostname  bool   `json:"use_hostname"`
-	ReplicaCount int    `json:"replica_count"`
-	BucketType   string `json:"bucket_type"`
-}
-
-func HttpAddBucket(w http.ResponseWriter, r *http.Request) {
+func HttpGetPartitions(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
@@ -476,64 +2400,48 @@ func HttpAddBucket(w http.ResponseWriter, r *http.Request) {
 
 	clusterID := mux.Vars(r)["cluster_id"]
 
-	var reqData AddBucketJSON
-	err = readJsonRequest(r, &reqData)
+	partitions, err := getPartitions(reqCtx, clusterID)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	err = addBucket(reqCtx, clusterID, AddBucketOptions{
-		Conf: reqData,
-	})
-	if err != nil {
-		writeJSONError(w, err)
-		return
+	if partitions == nil {
+		partitions = make([]NodePartition, 0)
 	}
 
-	w.WriteHeader(200)
-}
-
-type AddSampleBucketJSON struct {
-	SampleBucket string `json:"sample_bucket"`
-	UseHostname  bool   `json:"use_hostname"`
+	writeJsonResponse(w, partitions)
 }
 
-func HttpAddSampleBucket(w http.ResponseWriter, r *http.Request) {
+func HttpGetClusterStatuses(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	clusterID := mux.Vars(r)["cluster_id"]
-
-	var reqData AddSampleBucketJSON
-	err = readJsonRequest(r, &reqData)
+	var clusterIDs []string
+	err = readJsonRequest(r, &clusterIDs)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	err = addSampleBucket(reqCtx, clusterID, AddSampleOptions{
-		Conf: reqData,
-	})
+	statuses, err := getClusterStatuses(reqCtx, clusterIDs)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	w.WriteHeader(200)
+	writeJsonResponse(w, statuses)
 }
 
-type AddCollectionJSON struct {
-	Name        string `json:"name"`
-	ScopeName   string `json:"scope_name"`
-	BucketName  string `json:"bucket_name"`
-	UseHostname bool   `json:"use_hostname"`
+type ThrottleNodeJSON struct {
+	CPUs     float64 `json:"cpus"`
+	MemoryMB int64   `json:"memory_mb"`
 }
 
-func HttpAddCollection(w http.ResponseWriter, r *http.Request) {
+func HttpThrottleNode(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
@@ -541,37 +2449,29 @@ func HttpAddCollection(w http.ResponseWriter, r *http.Request) {
 	}
 
 	clusterID := mux.Vars(r)["cluster_id"]
+	nodeID := mux.Vars(r)["node_id"]
 
-	var reqData AddCollectionJSON
+	var reqData ThrottleNodeJSON
 	err = readJsonRequest(r, &reqData)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	err = addCollection(reqCtx, clusterID, AddCollectionOptions{
-		Conf: reqData,
+	throttle, err := throttleNode(reqCtx, clusterID, ThrottleNodeOptions{
+		NodeID:   nodeID,
+		CPUs:     reqData.CPUs,
+		MemoryMB: reqData.MemoryMB,
 	})
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	w.WriteHeader(200)
-}
-
-type SetupClientCertAuthJSON struct {
-	UserName  string `json:"user"`
-	UserEmail string `json:"email"`
-}
-
-type CertAuthResultJSON struct {
-	CACert     []byte `json:"cacert"`
-	ClientKey  []byte `json:"client_key"`
-	ClientCert []byte `json:"client_cert"`
+	writeJsonResponse(w, throttle)
 }
 
-func HttpSetupClientCertAuth(w http.ResponseWriter, r *http.Request) {
+func HttpUnthrottleNode(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
@@ -579,46 +2479,69 @@ func HttpSetupClientCertAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	clusterID := mux.Vars(r)["cluster_id"]
+	nodeID := mux.Vars(r)["node_id"]
 
-	var reqData SetupClientCertAuthJSON
-	err = readJsonRequest(r, &reqData)
+	err = unthrottleNode(reqCtx, clusterID, nodeID)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	cluster, err := getCluster(reqCtx, clusterID)
+	w.WriteHeader(200)
+}
+
+func HttpGetThrottles(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	certData, err := SetupCertAuth(SetupClientCertAuthOptions{
-		Nodes: cluster.Nodes,
-		Conf:  reqData,
-	})
+	clusterID := mux.Vars(r)["cluster_id"]
+
+	throttles, err := getThrottles(reqCtx, clusterID)
 	if err != nil {
 		writeJSONError(w, err)
 		return
 	}
 
-	writeJsonResponse(w, CertAuthResultJSON{
-		CACert:     certData.CACert,
-		ClientKey:  certData.ClientKey,
-		ClientCert: certData.ClientCert,
-	})
-	return
+	if throttles == nil {
+		throttles = make([]NodeThrottle, 0)
+	}
+
+	writeJsonResponse(w, throttles)
 }
 
 type BuildImageJSON struct {
 	ServerVersion       string `json:"server_version"`
 	UseCommunityEdition bool   `json:"community_edition"`
+	Edition             string `json:"edition"`
 }
 
 type BuildImageResponseJSON struct {
 	ImageName string `json:"image_name"`
 }
 
+type CachedImagesJSON struct {
+	Hosts map[string]map[string][]CachedImage `json:"hosts"`
+}
+
+func HttpGetCachedImages(w http.ResponseWriter, r *http.Request) {
+	reqCtx, err := getHttpContext(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	hosts, err := getCachedServerVersions(reqCtx)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	writeJsonResponse(w, CachedImagesJSON{Hosts: hosts})
+}
+
 func HttpBuildImage(w http.ResponseWriter, r *http.Request) {
 	reqCtx, err := getHttpContext(r)
 	if err != nil {
@@ -633,7 +2556,13 @@ func HttpBuildImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	nodeVersion, err := parseServerVersion(reqData.ServerVersion, reqData.UseCommunityEdition)
+	edition, err := parseEdition(reqData.Edition, reqData.UseCommunityEdition)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	nodeVersion, err := parseServerVersion(reqData.ServerVersion, edition)
 	if err != nil {
 		writeJSONError(w, err)
 		return
@@ -653,19 +2582,112 @@ func HttpBuildImage(w http.ResponseWriter, r *http.Request) {
 
 func createRESTRouter() *mux.Router {
 	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jsonErr := ErrorJSON{}
+		jsonErr.Error.Message = fmt.Sprintf("no route for %s", r.URL.Path)
+		jsonErr.Error.Code = ErrorCodeNotFound
+		writeJsonResponseWithStatus(w, 404, jsonErr)
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jsonErr := ErrorJSON{}
+		jsonErr.Error.Message = fmt.Sprintf("%s is not allowed for %s", r.Method, r.URL.Path)
+		jsonErr.Error.Code = ErrorCodeNotAllowed
+		writeJsonResponseWithStatus(w, 405, jsonErr)
+	})
 	r.HandleFunc("/", HttpRoot)
 	r.HandleFunc("/docker-host", HttpGetDockerHost).Methods("GET")
 	r.HandleFunc("/version", HttpGetVersion).Methods("GET")
+	r.HandleFunc("/healthz", HttpLiveness).Methods("GET")
+	r.HandleFunc("/readyz", HttpReadiness).Methods("GET")
+	// Metrics are served without authentication so that they can be scraped.  Compression is left to gzipMiddleware.
+	r.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+		DisableCompression: true,
+	})).Methods("GET")
+	r.HandleFunc("/limits", HttpGetLimits).Methods("GET")
+	r.HandleFunc("/config/reload", HttpReloadConfig).Methods("POST")
+	r.HandleFunc("/admin/reclaim", HttpReclaim).Methods("POST")
+	r.HandleFunc("/admin/audit", HttpGetAuditReport).Methods("GET")
+	r.HandleFunc("/admin/internals", HttpGetDaemonInternals).Methods("GET")
+	r.HandleFunc("/admin/reconcile", HttpGetReconciliationReport).Methods("GET")
 	r.HandleFunc("/clusters", HttpGetClusters).Methods("GET")
-	r.HandleFunc("/clusters", HttpCreateCluster).Methods("POST")
+	r.HandleFunc("/clusters", drainableHandler(HttpCreateCluster)).Methods("POST")
+	r.HandleFunc("/clusters", HttpKillClusters).Methods("DELETE")
+	r.HandleFunc("/clusters/ensure", drainableHandler(HttpEnsureCluster)).Methods("POST")
+	r.HandleFunc("/clusters/import", drainableHandler(HttpImportCluster)).Methods("POST")
+	r.HandleFunc("/clusters/status", HttpGetClusterStatuses).Methods("POST")
+	r.HandleFunc("/clusters/schedule", HttpGetScheduledAllocations).Methods("GET")
+	r.HandleFunc("/clusters/schedule", HttpScheduleCluster).Methods("POST")
+	r.HandleFunc("/clusters/schedule/{schedule_id}", HttpCancelScheduledAllocation).Methods("DELETE")
+	r.HandleFunc("/clusters/{cluster_id}", HttpGetCluster).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/buckets", HttpAddBucket).Methods("POST")
+	r.HandleFunc("/clusters/{cluster_id}/nodes", drainableHandler(HttpAddClusterNodes)).Methods("POST")
+	r.HandleFunc("/clusters/{cluster_id}/nodes/{node_id}", HttpRemoveClusterNode).Methods("DELETE")
+	r.HandleFunc("/clusters/{cluster_id}/nodes/{node_id}/logs", HttpGetNodeLogs).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/rebalance", HttpRebalanceCluster).Methods("POST")
+	r.HandleFunc("/clusters/{cluster_id}/collect", HttpCollectDiagnostics).Methods("POST")
+	r.HandleFunc("/clusters/{cluster_id}/rebalance", HttpGetClusterRebalance).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/nodes/{node_id}/throttle", HttpThrottleNode).Methods("POST")
+	r.HandleFunc("/clusters/{cluster_id}/nodes/{node_id}/throttle", HttpUnthrottleNode).Methods("DELETE")
+	r.HandleFunc("/clusters/{cluster_id}/throttles", HttpGetThrottles).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/extend", HttpExtendCluster).Methods("POST")
+	r.HandleFunc("/clusters/{cluster_id}/freeze", HttpFreezeCluster).Methods("POST", "DELETE")
+	r.HandleFunc("/clusters/{cluster_id}/nodes/{node_id}", HttpGetNode).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/nodes/{node_id}/partition", HttpPartitionNode).Methods("POST")
+	r.HandleFunc("/clusters/{cluster_id}/nodes/{node_id}/partition", HttpHealNode).Methods("DELETE")
+	r.HandleFunc("/clusters/{cluster_id}/partitions", HttpGetPartitions).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/buckets/{bucket}", HttpResizeBucket).Methods("PATCH")
+	r.HandleFunc("/clusters/{cluster_id}/nodes/{node_id}/inspect", HttpInspectNode).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/topology/latency", HttpGetClusterLatency).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/topology/latency", HttpInjectClusterLatency).Methods("POST")
+	r.HandleFunc("/clusters/{cluster_id}/topology/latency", HttpResetClusterLatency).Methods("DELETE")
+	r.HandleFunc("/clusters/{cluster_id}/alloc-log", HttpGetAllocLog).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/checkpoint", HttpCreateCheckpoint).Methods("POST")
+	r.HandleFunc("/clusters/{cluster_id}/checkpoints", HttpGetCheckpoints).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/history", HttpGetClusterHistory).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/drift", HttpGetClusterDrift).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/couchbase-logs", HttpGetCouchbaseLogs).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/setup-trace", HttpGetSetupTrace).Methods("GET")
+	r.HandleFunc("/clusters/{cluster_id}/config", HttpGetConnectionConfig).Methods("GET")
 	r.HandleFunc("/cluster/{cluster_id}", HttpGetCluster).Methods("GET")
 	r.HandleFunc("/cluster/{cluster_id}", HttpUpdateCluster).Methods("PUT")
 	r.HandleFunc("/cluster/{cluster_id}/setup", HttpSetupCluster).Methods("POST")
+	r.HandleFunc("/cluster/{cluster_id}/extend", HttpExtendCluster).Methods("POST")
+	r.HandleFunc("/cluster/{cluster_id}/setup-trace", HttpGetSetupTrace).Methods("GET")
 	r.HandleFunc("/cluster/{cluster_id}", HttpDeleteCluster).Methods("DELETE")
+	r.HandleFunc("/cluster/{cluster_id}/revive", HttpReviveCluster).Methods("POST")
+	r.HandleFunc("/cluster/{cluster_id}/freeze", HttpFreezeCluster).Methods("POST", "DELETE")
+	r.HandleFunc("/cluster/{cluster_id}/owners", HttpSetClusterOwners).Methods("PUT")
 	r.HandleFunc("/cluster/{cluster_id}/add-bucket", HttpAddBucket).Methods("POST")
+	r.HandleFunc("/cluster/{cluster_id}/bucket/{bucket}", HttpResizeBucket).Methods("PATCH")
 	r.HandleFunc("/cluster/{cluster_id}/add-sample-bucket", HttpAddSampleBucket).Methods("POST")
 	r.HandleFunc("/cluster/{cluster_id}/add-collection", HttpAddCollection).Methods("POST")
 	r.HandleFunc("/cluster/{cluster_id}/setup-cert-auth", HttpSetupClientCertAuth).Methods("POST")
+	r.HandleFunc("/cluster/{cluster_id}/topology/latency", HttpGetClusterLatency).Methods("GET")
+	r.HandleFunc("/cluster/{cluster_id}/topology/latency", HttpInjectClusterLatency).Methods("POST")
+	r.HandleFunc("/cluster/{cluster_id}/topology/latency", HttpResetClusterLatency).Methods("DELETE")
+	r.HandleFunc("/cluster/{cluster_id}/node/{node_id}", HttpGetNode).Methods("GET")
+	r.HandleFunc("/cluster/{cluster_id}/node/{node_id}/inspect", HttpInspectNode).Methods("GET")
+	r.HandleFunc("/cluster/{cluster_id}/node/{node_id}/partition", HttpPartitionNode).Methods("POST")
+	r.HandleFunc("/cluster/{cluster_id}/node/{node_id}/partition", HttpHealNode).Methods("DELETE")
+	r.HandleFunc("/cluster/{cluster_id}/partitions", HttpGetPartitions).Methods("GET")
+	r.HandleFunc("/cluster/{cluster_id}/node/{node_id}/throttle", HttpThrottleNode).Methods("POST")
+	r.HandleFunc("/cluster/{cluster_id}/node/{node_id}/throttle", HttpUnthrottleNode).Methods("DELETE")
+	r.HandleFunc("/cluster/{cluster_id}/throttles", HttpGetThrottles).Methods("GET")
+	r.HandleFunc("/cluster/{cluster_id}/couchbase-logs", HttpGetCouchbaseLogs).Methods("GET")
+	r.HandleFunc("/cluster/{cluster_id}/history", HttpGetClusterHistory).Methods("GET")
+	r.HandleFunc("/cluster/{cluster_id}/alloc-log", HttpGetAllocLog).Methods("GET")
+	r.HandleFunc("/cluster/{cluster_id}/drift", HttpGetClusterDrift).Methods("GET")
+	r.HandleFunc("/cluster/{cluster_id}/config", HttpGetConnectionConfig).Methods("GET")
+	r.HandleFunc("/cluster/{cluster_id}/checkpoint", HttpCreateCheckpoint).Methods("POST")
+	r.HandleFunc("/cluster/{cluster_id}/checkpoints", HttpGetCheckpoints).Methods("GET")
+	r.HandleFunc("/generation/{generation_id}", HttpGetGeneration).Methods("GET")
+	r.HandleFunc("/generation/{generation_id}", HttpUpdateGeneration).Methods("PUT")
+	r.HandleFunc("/generation/{generation_id}", HttpDeleteGeneration).Methods("DELETE")
 	r.HandleFunc("/images", HttpBuildImage).Methods("POST")
+	r.HandleFunc("/images/cached", HttpGetCachedImages).Methods("GET")
+	r.Use(requestIDMiddleware)
+	r.Use(requestLogMiddleware)
+	r.Use(authMiddleware)
+	r.Use(gzipMiddleware)
 	return r
 }
@@ -0,0 +1,182 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+)
+
+// scheduleCheckInterval is how often the scheduler looks for scheduled allocations which are due
+const scheduleCheckInterval = 30 * time.Second
+
+// ScheduledAllocation is a cluster which will be allocated at StartAt.  The original request is kept rather than
+// the parsed options so that owner defaults and the timeout are applied when the cluster is actually allocated.
+// Once it has run, RanAt is set along with either the allocated ClusterID or the Error it failed with.
+type ScheduledAllocation struct {
+	ID        string            `json:"id"`
+	Owner     string            `json:"owner"`
+	Admin     bool              `json:"admin,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	StartAt   time.Time         `json:"start_at"`
+	CreatedAt time.Time         `json:"created_at"`
+	Request   CreateClusterJSON `json:"request"`
+	RanAt     *time.Time        `json:"ran_at,omitempty"`
+	ClusterID string            `json:"cluster_id,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+func scheduleCluster(ctx context.Context, startAt time.Time, reqData CreateClusterJSON) (*ScheduledAllocation, error) {
+	log.Printf("Scheduling cluster allocation at %s (requested by: %s)", startAt.Format(time.RFC3339), ContextRequester(ctx))
+
+	if !startAt.After(time.Now()) {
+		return nil, badRequestf("scheduled start must be in the future")
+	}
+
+	// Catch invalid options now rather than when nobody is around to see the allocation fail
+	opts, err := parseCreateClusterJSON(ctx, reqData)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateClusterOptions(ctx, opts); err != nil {
+		return nil, err
+	}
+
+	schedule := ScheduledAllocation{
+		ID:        newRandomClusterID(),
+		Owner:     ContextUser(ctx),
+		Admin:     ContextIgnoreOwnership(ctx),
+		Namespace: ContextNamespace(ctx),
+		StartAt:   startAt,
+		CreatedAt: time.Now(),
+		Request:   reqData,
+	}
+	if err := metaStore.PutScheduledAllocation(schedule); err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+func getScheduledAllocations(ctx context.Context) ([]ScheduledAllocation, error) {
+	schedules, err := metaStore.GetScheduledAllocations()
+	if err != nil {
+		return nil, err
+	}
+
+	var ownSchedules []ScheduledAllocation
+	for _, schedule := range schedules {
+		if ContextIgnoreOwnership(ctx) || (schedule.Owner == ContextUser(ctx) && (schedule.Namespace == "" || schedule.Namespace == ContextNamespace(ctx))) {
+			ownSchedules = append(ownSchedules, schedule)
+		}
+	}
+
+	sort.Slice(ownSchedules, func(i, j int) bool {
+		return ownSchedules[i].StartAt.Before(ownSchedules[j].StartAt)
+	})
+
+	return ownSchedules, nil
+}
+
+func cancelScheduledAllocation(ctx context.Context, scheduleID string) error {
+	log.Printf("Cancelling scheduled allocation %s (requested by: %s)", scheduleID, ContextRequester(ctx))
+
+	schedule, err := metaStore.GetScheduledAllocation(scheduleID)
+	if err != nil {
+		return err
+	}
+
+	if !ContextIgnoreOwnership(ctx) && schedule.Owner != ContextUser(ctx) {
+		return forbiddenf("scheduled allocation %s is owned by %s", scheduleID, schedule.Owner)
+	}
+
+	return metaStore.DeleteScheduledAllocation(scheduleID)
+}
+
+// runScheduledAllocation allocates a scheduled cluster as the user who scheduled it.  There is no request to report
+// the outcome to, so the allocated cluster or the error is recorded on the schedule for its owner to look up.
+func runScheduledAllocation(schedule ScheduledAllocation) {
+	ctx := WithNamespace(NewContext(context.Background(), schedule.Owner, schedule.Admin), schedule.Namespace)
+
+	clusterID, err := allocateScheduledCluster(ctx, schedule)
+	if err != nil {
+		log.Printf("Failed to allocate scheduled allocation %s: %s", schedule.ID, err)
+		schedule.Error = err.Error()
+		var failed *AllocationFailedError
+		if errors.As(err, &failed) {
+			clusterID = failed.ClusterID
+		}
+	} else {
+		log.Printf("Allocated cluster %s for scheduled allocation %s", clusterID, schedule.ID)
+	}
+	schedule.ClusterID = clusterID
+
+	if err := metaStore.PutScheduledAllocation(schedule); err != nil {
+		log.Printf("Failed to record the outcome of scheduled allocation %s: %s", schedule.ID, err)
+	}
+}
+
+func allocateScheduledCluster(ctx context.Context, schedule ScheduledAllocation) (string, error) {
+	opts, err := parseCreateClusterJSON(ctx, schedule.Request)
+	if err != nil {
+		return "", err
+	}
+
+	clusterID, warnings, err := allocateCluster(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+
+	for _, warning := range warnings {
+		log.Printf("Scheduled allocation %s warning: %s", schedule.ID, warning)
+	}
+	return clusterID, nil
+}
+
+// runDueScheduledAllocations starts the allocation of every scheduled cluster whose start time has passed.  Each
+// schedule is marked as run before it is allocated so it is never allocated twice, and schedules which have run
+// are removed once they are older than the tombstone retention.
+func runDueScheduledAllocations() error {
+	schedules, err := metaStore.GetScheduledAllocations()
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		if schedule.RanAt != nil {
+			retention := getConfig().tombstoneRetention
+			if retention > 0 && schedule.RanAt.Before(time.Now().Add(-retention)) {
+				if err := metaStore.DeleteScheduledAllocation(schedule.ID); err != nil {
+					log.Printf("Failed to remove scheduled allocation %s: %s", schedule.ID, err)
+				}
+			}
+			continue
+		}
+		if schedule.StartAt.After(time.Now()) {
+			continue
+		}
+
+		// Due allocations are left scheduled while draining, to be run once the daemon is back
+		done, err := beginClusterOperation()
+		if err != nil {
+			return nil
+		}
+
+		ranAt := time.Now()
+		schedule.RanAt = &ranAt
+		if err := metaStore.PutScheduledAllocation(schedule); err != nil {
+			log.Printf("Failed to mark scheduled allocation %s as run: %s", schedule.ID, err)
+			done()
+			continue
+		}
+
+		log.Printf("Starting scheduled allocation %s for %s", schedule.ID, schedule.Owner)
+		go func(schedule ScheduledAllocation) {
+			defer done()
+			runScheduledAllocation(schedule)
+		}(schedule)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// seccompProfileJSON is the contents of the seccomp profile, docker expects the profile itself rather than a
+// path to it
+var seccompProfileJSON string
+
+// loadSecurityProfiles reads and validates the configured seccomp profile so that misconfiguration is caught at
+// startup rather than on the first allocation
+func loadSecurityProfiles() error {
+	if seccompProfile == "" {
+		return nil
+	}
+
+	profileBytes, err := ioutil.ReadFile(seccompProfile)
+	if err != nil {
+		return fmt.Errorf("failed to read seccomp profile: %s", err)
+	}
+
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, profileBytes); err != nil {
+		return fmt.Errorf("seccomp profile %s is not valid JSON: %s", seccompProfile, err)
+	}
+
+	seccompProfileJSON = compacted.String()
+	return nil
+}
+
+func nodeSecurityOpts() []string {
+	var securityOpts []string
+	if seccompProfileJSON != "" {
+		securityOpts = append(securityOpts, "seccomp="+seccompProfileJSON)
+	}
+	if apparmorProfile != "" {
+		securityOpts = append(securityOpts, "apparmor="+apparmorProfile)
+	}
+	return securityOpts
+}
@@ -1,23 +1,124 @@
 package daemon
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/couchbaselabs/cbdynclusterd/cluster"
 	"github.com/couchbaselabs/cbdynclusterd/helper"
 )
 
 type ClusterSetupOptions struct {
+	// Ctx cancels the setup requests to the nodes when it is done
+	Ctx   context.Context
 	Nodes []*Node
 	Conf  CreateClusterSetupJSON
+	Trace *helper.RestTrace
+	// Orchestrator is the index of the node which is initialized first and becomes the orchestrator
+	Orchestrator int
+	// MemoryQuotas are the service memory quotas the cluster was allocated with, if any
+	MemoryQuotas *MemoryQuotas
+}
+
+// assignedServices returns the services each node was allocated with, in the form setup expects them.  Nodes are
+// only set up with their assigned services if every node has some.
+func assignedServices(nodes []*Node) []string {
+	var services []string
+	for _, node := range nodes {
+		if len(node.Services) == 0 {
+			return nil
+		}
+		services = append(services, strings.Join(node.Services, ","))
+	}
+	return services
+}
+
+// resolveOrchestrator returns the index of the node matching orchestrator by name, role, ID or index.  The node
+// must run the data service as the orchestrator is where the cluster is initialized.
+func resolveOrchestrator(nodes []*Node, services []string, orchestrator string) (int, error) {
+	if orchestrator == "" {
+		return 0, nil
+	}
+
+	index := -1
+	for i, node := range nodes {
+		if node.Name == orchestrator || node.ContainerID == orchestrator || (node.Role != "" && node.Role == orchestrator) {
+			if index != -1 {
+				return 0, badRequestf("orchestrator %s matches more than one node", orchestrator)
+			}
+			index = i
+		}
+	}
+	if index == -1 {
+		i, err := strconv.Atoi(orchestrator)
+		if err != nil || i < 0 || i >= len(nodes) {
+			return 0, badRequestf("orchestrator %s does not match any node", orchestrator)
+		}
+		index = i
+	}
+
+	if index >= len(services) || !containsString(splitServices(services[index]), "kv") {
+		return 0, badRequestf("orchestrator %s must run the kv service", nodes[index].Name)
+	}
+	return index, nil
+}
+
+type terseClusterInfoJSON struct {
+	Orchestrator string `json:"orchestrator"`
+}
+
+// getOrchestratorNode asks the cluster which of its nodes is the orchestrator.  The node initialized first is
+// only the initial orchestrator, couchbase may elect another one once the rest of the nodes have joined.
+func getOrchestratorNode(nodes []*Node) (*Node, error) {
+	var lastErr error
+	for _, node := range nodes {
+		if node.State != "running" {
+			continue
+		}
+
+		var info terseClusterInfoJSON
+		if err := getClusterRest(node, helper.PTerseClusterInfo, &info); err != nil {
+			lastErr = err
+			continue
+		}
+
+		// The orchestrator is reported by its otp node name, ns_1@<hostname>
+		host := info.Orchestrator
+		if i := strings.LastIndex(host, "@"); i != -1 {
+			host = host[i+1:]
+		}
+		for _, candidate := range nodes {
+			if host == candidate.IPv4Address || host == candidate.IPv6Address ||
+				host == strings.TrimPrefix(candidate.ContainerName, "/")+helper.DomainPostfix {
+				return candidate, nil
+			}
+		}
+		return nil, fmt.Errorf("orchestrator %s is not a node of the cluster", info.Orchestrator)
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no nodes are running")
+	}
+	return nil, lastErr
 }
 
 func SetupCluster(opts *ClusterSetupOptions) (string, error) {
 	services := opts.Conf.Services
 
+	// The first node is initialized and the rest join it, so the orchestrator is moved to the front
+	order := []int{opts.Orchestrator}
+	for i := range services {
+		if i != opts.Orchestrator {
+			order = append(order, i)
+		}
+	}
+
 	initialNodes := opts.Nodes
 	var nodes []*cluster.Node
-	for i := 0; i < len(services); i++ {
+	for _, i := range order {
 		ipv4 := initialNodes[i].IPv4Address
 		hostname := ipv4
 		if opts.Conf.UseHostname {
@@ -27,13 +128,17 @@ func SetupCluster(opts *ClusterSetupOptions) (string, error) {
 		}
 
 		nodeHost := &cluster.Node{
-			HostName:  hostname,
-			Port:      strconv.Itoa(helper.RestPort),
-			SshLogin:  &helper.Cred{Username: helper.SshUser, Password: helper.SshPass, Hostname: ipv4, Port: helper.SshPort},
-			RestLogin: &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: ipv4, Port: helper.RestPort},
-			N1qlLogin: &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: ipv4, Port: helper.N1qlPort},
-			FtsLogin:  &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: ipv4, Port: helper.FtsPort},
-			Services:  services[i],
+			HostName:      hostname,
+			Port:          strconv.Itoa(helper.RestPort),
+			SshLogin:      &helper.Cred{Username: helper.SshUser, Password: helper.SshPass, Hostname: ipv4, Port: helper.SshPort},
+			RestLogin:     &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: ipv4, Port: helper.RestPort, Trace: opts.Trace, Ctx: opts.Ctx},
+			N1qlLogin:     &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: ipv4, Port: helper.N1qlPort, Trace: opts.Trace, Ctx: opts.Ctx},
+			FtsLogin:      &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: ipv4, Port: helper.FtsPort, Trace: opts.Trace, Ctx: opts.Ctx},
+			Services:      services[i],
+			DataPath:      initialNodes[i].DataPath,
+			IndexPath:     initialNodes[i].IndexPath,
+			AnalyticsPath: initialNodes[i].AnalyticsPath,
+			ServerGroup:   initialNodes[i].ServerGroup,
 		}
 		nodes = append(nodes, nodeHost)
 	}
@@ -45,6 +150,8 @@ func SetupCluster(opts *ClusterSetupOptions) (string, error) {
 		Bucket:        opts.Conf.Bucket,
 		UseHostname:   opts.Conf.UseHostname,
 		UseDevPreview: opts.Conf.UseDeveloperPreview,
+		// The data quota is already in MemoryQuota
+		ServiceMemoryQuotas: opts.MemoryQuotas.restParams(),
 	}
 
 	clusterManager := &cluster.Manager{
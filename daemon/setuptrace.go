@@ -0,0 +1,34 @@
+package daemon
+
+import (
+	"sync"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+// Setup traces are only kept in memory, they are lost when the daemon restarts
+var setupTracesLock sync.Mutex
+var setupTraces = make(map[string]*helper.RestTrace)
+
+func newSetupTrace(clusterID string) *helper.RestTrace {
+	trace := &helper.RestTrace{}
+
+	setupTracesLock.Lock()
+	setupTraces[clusterID] = trace
+	setupTracesLock.Unlock()
+
+	return trace
+}
+
+func getSetupTrace(clusterID string) *helper.RestTrace {
+	setupTracesLock.Lock()
+	defer setupTracesLock.Unlock()
+
+	return setupTraces[clusterID]
+}
+
+func deleteSetupTrace(clusterID string) {
+	setupTracesLock.Lock()
+	delete(setupTraces, clusterID)
+	setupTracesLock.Unlock()
+}
@@ -0,0 +1,173 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbaselabs/cbdynclusterd/cluster"
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+	"github.com/pkg/errors"
+)
+
+const (
+	smokeTestBucket     = "cbdyncluster-smoke-test"
+	smokeTestRamQuotaMB = 100
+)
+
+type SmokeTestStep struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+type SmokeTestResult struct {
+	Passed bool            `json:"passed"`
+	Steps  []SmokeTestStep `json:"steps"`
+}
+
+// failedStep returns the first step which did not pass, or nil if every step passed
+func (result *SmokeTestResult) failedStep() *SmokeTestStep {
+	for i := range result.Steps {
+		if !result.Steps[i].Passed && !result.Steps[i].Skipped {
+			return &result.Steps[i]
+		}
+	}
+	return nil
+}
+
+func (result *SmokeTestResult) run(name string, fn func() error) bool {
+	startTime := time.Now()
+	err := fn()
+
+	step := SmokeTestStep{
+		Name:     name,
+		Passed:   err == nil,
+		Duration: time.Since(startTime).String(),
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+
+	result.Steps = append(result.Steps, step)
+	return err == nil
+}
+
+func (result *SmokeTestResult) skip(name string, reason string) {
+	result.Steps = append(result.Steps, SmokeTestStep{
+		Name:     name,
+		Skipped:  true,
+		Duration: time.Duration(0).String(),
+		Error:    reason,
+	})
+}
+
+func smokeTestNode(node *Node) *cluster.Node {
+	ipv4 := node.IPv4Address
+	return &cluster.Node{
+		HostName:  ipv4,
+		Port:      strconv.Itoa(helper.RestPort),
+		SshLogin:  &helper.Cred{Username: helper.SshUser, Password: helper.SshPass, Hostname: ipv4, Port: helper.SshPort},
+		RestLogin: &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: ipv4, Port: helper.RestPort},
+		N1qlLogin: &helper.Cred{Username: helper.RestUser, Password: helper.RestPass, Hostname: ipv4, Port: helper.N1qlPort},
+	}
+}
+
+func smokeTestQuery(node *cluster.Node) error {
+	restParam := &helper.RestCall{
+		ExpectedCode: 200,
+		Method:       "POST",
+		Path:         helper.PN1ql,
+		Cred:         node.N1qlLogin,
+		Body:         fmt.Sprintf("statement=%s", url.QueryEscape("SELECT 1")),
+		Header:       map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+	}
+	_, err := helper.GetResponse(restParam)
+	return err
+}
+
+// runSmokeTest exercises a freshly set up cluster by creating a temporary bucket, writing and reading a document
+// and running a trivial N1QL query.  services holds the services of each node, in the same order as the cluster's
+// nodes, and is used to find a query node.  The temporary bucket is always removed once it has been created, even
+// if a later step fails.
+func runSmokeTest(ctx context.Context, c *Cluster, services []string) *SmokeTestResult {
+	log.Printf("Running smoke test against cluster %s (requested by: %s)", c.ID, ContextRequester(ctx))
+
+	result := &SmokeTestResult{}
+	if len(c.Nodes) == 0 {
+		result.run("create_bucket", func() error {
+			return errors.New("no nodes available")
+		})
+		return result
+	}
+
+	runSmokeTestSteps(result, c, services)
+
+	result.Passed = result.failedStep() == nil
+	if !result.Passed {
+		log.Printf("Smoke test against cluster %s failed at %s: %s", c.ID, result.failedStep().Name, result.failedStep().Error)
+	}
+
+	return result
+}
+
+func runSmokeTestSteps(result *SmokeTestResult, c *Cluster, services []string) {
+	epnode := smokeTestNode(c.Nodes[0])
+
+	bucketExists := false
+	defer func() {
+		if bucketExists {
+			result.run("delete_bucket", func() error {
+				return epnode.DeleteBucket(smokeTestBucket)
+			})
+		}
+	}()
+
+	bucketCreated := result.run("create_bucket", func() error {
+		if err := epnode.CreateBucket(&cluster.Bucket{
+			Name:         smokeTestBucket,
+			Type:         helper.BucketCouchbase,
+			ReplicaCount: 0,
+			RamQuotaMB:   strconv.Itoa(smokeTestRamQuotaMB),
+		}); err != nil {
+			return err
+		}
+		bucketExists = true
+		return epnode.WaitForBucketReady()
+	})
+
+	if bucketCreated {
+		result.run("set_get", func() error {
+			bucket, err := helper.LoadData(smokeTestBucket, c.Nodes[0].IPv4Address, helper.RestUser, helper.RestPass, 1)
+			if err != nil {
+				return err
+			}
+			defer bucket.Close()
+			return helper.Get(bucket, 0)
+		})
+
+		var queryNode *Node
+		for i, nodeServices := range services {
+			if i < len(c.Nodes) && strings.Contains(nodeServices, "n1ql") {
+				queryNode = c.Nodes[i]
+				break
+			}
+		}
+		if queryNode == nil {
+			result.skip("n1ql_query", "no node is running the query service")
+		} else {
+			result.run("n1ql_query", func() error {
+				return smokeTestQuery(smokeTestNode(queryNode))
+			})
+		}
+	} else {
+		result.skip("set_get", "bucket could not be created")
+		result.skip("n1ql_query", "bucket could not be created")
+	}
+}
@@ -0,0 +1,152 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+)
+
+// statusProbeTimeout bounds how long each node is given to respond when fetching cluster statuses, so one
+// unresponsive cluster does not hold up the statuses of all the others
+const statusProbeTimeout = 2 * time.Second
+
+const (
+	ClusterStateRunning  = "running"
+	ClusterStateDegraded = "degraded"
+	ClusterStateStopped  = "stopped"
+)
+
+// ClusterStatus is a compact summary of a cluster, cheap enough to fetch for many clusters at once
+type ClusterStatus struct {
+	State      string `json:"state"`
+	ReadyNodes int    `json:"ready_nodes"`
+	TotalNodes int    `json:"total_nodes"`
+	Expiry     string `json:"expiry"`
+	// RebalanceStatus is empty if the cluster could not be queried, such as before it has been set up
+	RebalanceStatus   string `json:"rebalance_status,omitempty"`
+	RebalanceProgress int    `json:"rebalance_progress,omitempty"`
+}
+
+type rebalanceProgressJSON map[string]interface{}
+
+func getRebalanceProgress(node *Node) (string, int, error) {
+	var progress rebalanceProgressJSON
+	if err := getClusterRest(node, helper.PRebalanceProgress, &progress); err != nil {
+		return "", 0, err
+	}
+
+	status, percent := progress.parse()
+	return status, percent, nil
+}
+
+// parse returns the status of the rebalance along with how far through it is, as a percentage
+func (progress rebalanceProgressJSON) parse() (string, int) {
+	status, _ := progress["status"].(string)
+
+	// While running, the progress of each node is reported beneath its own key
+	var total float64
+	var count int
+	for key, value := range progress {
+		if key == "status" {
+			continue
+		}
+		if nodeProgress, ok := value.(map[string]interface{}); ok {
+			if fraction, ok := nodeProgress["progress"].(float64); ok {
+				total += fraction
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return status, 0
+	}
+	return status, int(total * 100 / float64(count))
+}
+
+func getClusterStatus(cluster *Cluster) ClusterStatus {
+	status := ClusterStatus{
+		TotalNodes: len(cluster.Nodes),
+		Expiry:     cluster.Timeout.Format(time.RFC3339),
+	}
+
+	probeOpts := ReadinessOptions{
+		Probe:    getConfig().readinessProbe,
+		Interval: statusProbeTimeout,
+	}
+
+	var runningNodes int
+	var readyNode *Node
+	for _, node := range cluster.Nodes {
+		if node.State != "running" {
+			continue
+		}
+		runningNodes++
+
+		if err := probeNode(probeOpts, node); err == nil {
+			status.ReadyNodes++
+			if readyNode == nil {
+				readyNode = node
+			}
+		}
+	}
+
+	if runningNodes == 0 {
+		status.State = ClusterStateStopped
+	} else if runningNodes < len(cluster.Nodes) {
+		status.State = ClusterStateDegraded
+	} else {
+		status.State = ClusterStateRunning
+	}
+
+	if readyNode != nil {
+		rebalanceStatus, progress, err := getRebalanceProgress(readyNode)
+		if err == nil {
+			status.RebalanceStatus = rebalanceStatus
+			status.RebalanceProgress = progress
+		}
+	}
+
+	return status
+}
+
+// getClusterStatuses returns the status of each of the requested clusters.  Clusters which do not exist or which
+// the requester may not see are left out.
+func getClusterStatuses(ctx context.Context, clusterIDs []string) (map[string]ClusterStatus, error) {
+	log.Printf("Fetching status of %d clusters (requested by: %s)", len(clusterIDs), ContextRequester(ctx))
+
+	clusters, err := getAllClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clustersByID := make(map[string]*Cluster)
+	for _, cluster := range clusters {
+		clustersByID[cluster.ID] = cluster
+	}
+
+	statuses := make(map[string]ClusterStatus)
+	var statusesLock sync.Mutex
+	var wg sync.WaitGroup
+	for _, clusterID := range clusterIDs {
+		cluster, ok := clustersByID[clusterID]
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(cluster *Cluster) {
+			defer wg.Done()
+			status := getClusterStatus(cluster)
+
+			statusesLock.Lock()
+			statuses[cluster.ID] = status
+			statusesLock.Unlock()
+		}(cluster)
+	}
+	wg.Wait()
+
+	return statuses, nil
+}
@@ -0,0 +1,47 @@
+package daemon
+
+import (
+	"net/http"
+)
+
+// truncatedHeader is set on responses which were cut short because they exceeded max-response-size
+const truncatedHeader = "X-Cbdyncluster-Truncated"
+
+// flushWriter flushes the response after every write so large responses are streamed to the client in chunks
+// rather than being buffered
+type flushWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	flusher, _ := w.(http.Flusher)
+	return &flushWriter{w: w, flusher: flusher}
+}
+
+func (fw *flushWriter) Write(data []byte) (int, error) {
+	n, err := fw.w.Write(data)
+	if fw.flusher != nil {
+		fw.flusher.Flush()
+	}
+	return n, err
+}
+
+// writeBoundedResponse writes a response which is held in memory, keeping it within max-response-size.  Plain
+// text is truncated and marked with the truncated header, anything else would no longer parse once truncated so
+// it is rejected with 413 instead.
+func writeBoundedResponse(w http.ResponseWriter, contentType string, data []byte) {
+	maxResponseSize := getConfig().maxResponseSize
+	if len(data) > maxResponseSize {
+		if contentType != "text/plain" {
+			writeJSONError(w, &ResponseTooLargeError{Size: len(data), Limit: maxResponseSize})
+			return
+		}
+		data = data[:maxResponseSize]
+		w.Header().Set(truncatedHeader, "true")
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(200)
+	w.Write(data)
+}
@@ -0,0 +1,220 @@
+package daemon
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/couchbaselabs/cbdynclusterd/helper"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/pkg/errors"
+)
+
+const (
+	syncGatewayImage          = "couchbase/sync-gateway"
+	syncGatewayDefaultVersion = "2.8.0-enterprise"
+	syncGatewayConfigDir      = "/etc/sync_gateway"
+	syncGatewayConfigFile     = "config.json"
+	syncGatewayPublicPort     = 4984
+	syncGatewayAdminPort      = 4985
+	syncGatewayDatabase       = "db"
+)
+
+type SyncGatewayOptions struct {
+	Version string      `json:"version"`
+	Bucket  string      `json:"bucket"`
+	DNS     *DNSOptions `json:"dns,omitempty"`
+}
+
+type SyncGateway struct {
+	ContainerID string
+	Version     string
+	Bucket      string
+	IPv4Address string
+}
+
+func (sg *SyncGateway) PublicURL() string {
+	return fmt.Sprintf("http://%s:%d", sg.IPv4Address, syncGatewayPublicPort)
+}
+
+func (sg *SyncGateway) AdminURL() string {
+	return fmt.Sprintf("http://%s:%d", sg.IPv4Address, syncGatewayAdminPort)
+}
+
+type syncGatewayDatabaseConfig struct {
+	Server           string                           `json:"server"`
+	Bucket           string                           `json:"bucket"`
+	Username         string                           `json:"username"`
+	Password         string                           `json:"password"`
+	NumIndexReplicas int                              `json:"num_index_replicas"`
+	Users            map[string]syncGatewayUserConfig `json:"users"`
+}
+
+type syncGatewayUserConfig struct {
+	Disabled      bool     `json:"disabled"`
+	AdminChannels []string `json:"admin_channels"`
+}
+
+type syncGatewayConfig struct {
+	Interface      string                               `json:"interface"`
+	AdminInterface string                               `json:"adminInterface"`
+	Databases      map[string]syncGatewayDatabaseConfig `json:"databases"`
+}
+
+func buildSyncGatewayConfig(serverIP, bucket string) ([]byte, error) {
+	config := syncGatewayConfig{
+		Interface:      fmt.Sprintf(":%d", syncGatewayPublicPort),
+		AdminInterface: fmt.Sprintf(":%d", syncGatewayAdminPort),
+		Databases: map[string]syncGatewayDatabaseConfig{
+			syncGatewayDatabase: {
+				Server:   fmt.Sprintf("couchbase://%s", serverIP),
+				Bucket:   bucket,
+				Username: helper.RestUser,
+				Password: helper.RestPass,
+				Users: map[string]syncGatewayUserConfig{
+					"GUEST": {Disabled: false, AdminChannels: []string{"*"}},
+				},
+			},
+		},
+	}
+
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// tarSingleFile wraps a single file in a tar stream suitable for CopyToContainer
+func tarSingleFile(name string, data []byte) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: int64(len(data)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// validateSyncGatewaySetup checks that setup creates the bucket the cluster's sync gateway connects to, as the
+// sync gateway is only started once setup has created it
+func validateSyncGatewaySetup(opts *SyncGatewayOptions, bucket *helper.BucketOption) error {
+	if opts == nil {
+		return nil
+	}
+	if bucket == nil || bucket.Name != opts.Bucket {
+		return badRequestf("setup must create bucket %s for the cluster's sync gateway", opts.Bucket)
+	}
+	return nil
+}
+
+// startSyncGateway starts the sync gateway of a cluster which has been set up, connecting it to every node
+func startSyncGateway(ctx context.Context, cluster *Cluster, opts SyncGatewayOptions) error {
+	var nodeIPs []string
+	for _, node := range cluster.Nodes {
+		nodeIPs = append(nodeIPs, node.IPv4Address)
+	}
+
+	containerID, err := allocateSyncGateway(ctx, cluster.ID, cluster.Timeout, strings.Join(nodeIPs, ","), opts)
+	if err != nil {
+		return err
+	}
+	allocLogf(cluster.ID, "Started sync gateway container %s", containerID[0:12])
+
+	return metaStore.UpdateClusterMeta(cluster.ID, func(meta ClusterMeta) (ClusterMeta, error) {
+		meta.SyncGatewayID = containerID[0:12]
+		return meta, nil
+	})
+}
+
+func allocateSyncGateway(ctx context.Context, clusterID string, timeout time.Time, serverIP string, opts SyncGatewayOptions) (string, error) {
+	log.Printf("Allocating sync gateway for cluster %s (requested by: %s)", clusterID, ContextRequester(ctx))
+
+	if opts.Bucket == "" {
+		return "", badRequestf("must specify a bucket for sync gateway")
+	}
+	if opts.Version == "" {
+		opts.Version = syncGatewayDefaultVersion
+	}
+
+	containerName := fmt.Sprintf("dynclsr-%s-sync_gateway", clusterID)
+	containerImage := fmt.Sprintf("%s:%s", syncGatewayImage, opts.Version)
+
+	err := imagePull(ctx, containerImage, getConfig().dockerRegistry)
+	if err != nil {
+		return "", err
+	}
+
+	configBytes, err := buildSyncGatewayConfig(serverIP, opts.Bucket)
+	if err != nil {
+		return "", err
+	}
+
+	dns, dnsSearch, dnsOptions := containerDNS(opts.DNS)
+	labels := clusterLabels(ctx, clusterID, timeout)
+	labels["com.couchbase.dyncluster.sidecar"] = "sync_gateway"
+	labels["com.couchbase.dyncluster.sync_gateway_version"] = opts.Version
+	labels["com.couchbase.dyncluster.sync_gateway_bucket"] = opts.Bucket
+	if requestID := ContextRequestID(ctx); requestID != "" {
+		labels["com.couchbase.dyncluster.request_id"] = requestID
+	}
+	addDaemonLabels(labels)
+
+	networkingConfig, releaseIP, err := reserveContainerIP(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer releaseIP()
+
+	createResult, err := docker.ContainerCreate(context.Background(), &container.Config{
+		Image:  containerImage,
+		Cmd:    []string{syncGatewayConfigDir + "/" + syncGatewayConfigFile},
+		Labels: labels,
+	}, &container.HostConfig{
+		AutoRemove:  true,
+		NetworkMode: container.NetworkMode(NetworkName),
+		DNS:         dns,
+		DNSSearch:   dnsSearch,
+		DNSOptions:  dnsOptions,
+	}, networkingConfig, containerName)
+	if err != nil {
+		return "", countDockerError("container_create", err)
+	}
+
+	// The container has not been started yet so AutoRemove won't clean it up for us
+	removeContainer := func() {
+		docker.ContainerRemove(context.Background(), createResult.ID, types.ContainerRemoveOptions{Force: true})
+	}
+
+	configTar, err := tarSingleFile(syncGatewayConfigFile, configBytes)
+	if err != nil {
+		removeContainer()
+		return "", err
+	}
+	err = docker.CopyToContainer(context.Background(), createResult.ID, syncGatewayConfigDir, configTar, types.CopyToContainerOptions{})
+	if err != nil {
+		removeContainer()
+		return "", errors.Wrap(countDockerError("copy_to_container", err), "could not copy sync gateway config")
+	}
+
+	err = docker.ContainerStart(context.Background(), createResult.ID, types.ContainerStartOptions{})
+	if err != nil {
+		err = countDockerError("container_start", err)
+		removeContainer()
+		return "", err
+	}
+
+	return createResult.ID, nil
+}
@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// envTagsHeader carries the client's environment variables, as comma separated NAME=value pairs, so that the
+// daemon can tag clusters from them.  Only variables mapped in the env-tags config are used.
+const envTagsHeader = "X-Cbdyncluster-Env"
+
+var tagKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// loadEnvTags returns the map of environment variable names to the tag they are applied as, these are configured
+// in the config file under [env-tags], such as BRANCH = "branch"
+func loadEnvTags() (map[string]string, error) {
+	tags := make(map[string]string)
+	if err := viper.UnmarshalKey("env-tags", &tags); err != nil {
+		return nil, err
+	}
+
+	envTags := make(map[string]string)
+	for envName, tag := range tags {
+		// viper lower cases keys, environment variable names are conventionally upper case
+		envTags[strings.ToUpper(envName)] = tag
+	}
+	return envTags, nil
+}
+
+func validateTags(tags map[string]string) error {
+	for key := range tags {
+		if !tagKeyRegexp.MatchString(key) {
+			return badRequestf("tag `%s` must only contain letters, numbers, '_', '.' and '-'", key)
+		}
+	}
+	return nil
+}
+
+// applyEnvTags adds tags from the environment variables a client sent in the env header to tags.  Tags which
+// were requested explicitly take precedence over those from the environment.
+func applyEnvTags(header http.Header, tags map[string]string) map[string]string {
+	envTags := getConfig().envTags
+	for _, envHeader := range header[http.CanonicalHeaderKey(envTagsHeader)] {
+		for _, pair := range strings.Split(envHeader, ",") {
+			parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			tag, ok := envTags[strings.ToUpper(parts[0])]
+			if !ok {
+				continue
+			}
+			if _, ok := tags[tag]; ok {
+				continue
+			}
+
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[tag] = parts[1]
+		}
+	}
+	return tags
+}
+
+// matchesTagFilter checks a cluster's tags against a list of key=value filters, all of which must match
+func matchesTagFilter(tags map[string]string, filters []string) bool {
+	for _, filter := range filters {
+		parts := strings.SplitN(filter, "=", 2)
+		value, ok := tags[parts[0]]
+		if !ok || (len(parts) == 2 && value != parts[1]) {
+			return false
+		}
+	}
+	return true
+}
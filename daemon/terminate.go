@@ -0,0 +1,123 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// terminateCluster marks a cluster for deletion once termination-grace has passed rather than killing it, so that
+// it can still be revived in the meantime.  The cluster keeps running until cleanup finalizes its deletion.
+func terminateCluster(ctx context.Context, clusterID string) (time.Time, error) {
+	log.Printf("Terminating cluster %s in %s (requested by: %s)", clusterID, getConfig().terminationGrace, ContextRequester(ctx))
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return time.Time{}, err
+	}
+
+	unlock := lockClusterExpiry(clusterID)
+	defer unlock()
+
+	var terminateAt time.Time
+	err = metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		// Deleting a terminating cluster again does not push its deletion back
+		if meta.TerminateAt.IsZero() {
+			meta.TerminateAt = time.Now().Add(getConfig().terminationGrace)
+			meta.TerminatedBy = ContextUser(ctx)
+		}
+		terminateAt = meta.TerminateAt
+		return meta, nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	recordClusterHistory(ctx, clusterID, HistoryEventTerminating, "", terminateAt.Format(time.RFC3339))
+	allocLogf(clusterID, "Terminating cluster at %s (requested by: %s)", terminateAt.Format(time.RFC3339),
+		ContextRequester(ctx))
+	return terminateAt, nil
+}
+
+// reviveCluster cancels the pending deletion of a terminating cluster
+func reviveCluster(ctx context.Context, clusterID string) error {
+	log.Printf("Reviving cluster %s (requested by: %s)", clusterID, ContextRequester(ctx))
+
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return err
+	}
+
+	unlock := lockClusterExpiry(clusterID)
+	defer unlock()
+
+	var terminateAt time.Time
+	err = metaStore.UpdateClusterMeta(clusterID, func(meta ClusterMeta) (ClusterMeta, error) {
+		if meta.TerminateAt.IsZero() {
+			return meta, badRequestf("cluster is not terminating")
+		}
+		terminateAt = meta.TerminateAt
+		meta.TerminateAt = time.Time{}
+		meta.TerminatedBy = ""
+		return meta, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	recordClusterHistory(ctx, clusterID, HistoryEventRevived, terminateAt.Format(time.RFC3339), "")
+	return nil
+}
+
+// finalizeTerminatedClusters kills the terminating clusters whose grace period is over, on behalf of whoever
+// deleted them
+func finalizeTerminatedClusters(clusters []*Cluster) error {
+	var finalizeError error
+	for _, cluster := range clusters {
+		if cluster.TerminateAt.IsZero() || cluster.TerminateAt.After(time.Now()) {
+			continue
+		}
+
+		if err := finalizeTerminatedCluster(cluster.ID); err != nil {
+			log.Printf("Failed to kill terminated cluster %s: %s", cluster.ID, err)
+			if finalizeError == nil {
+				finalizeError = err
+			}
+		}
+	}
+	return finalizeError
+}
+
+func finalizeTerminatedCluster(clusterID string) error {
+	unlock := lockClusterExpiry(clusterID)
+	defer unlock()
+
+	// The cluster may have been revived since the cluster list was fetched
+	meta, err := metaStore.GetClusterMeta(clusterID)
+	if err != nil {
+		return err
+	}
+	if meta.TerminateAt.IsZero() || meta.TerminateAt.After(time.Now()) {
+		return nil
+	}
+
+	terminatedBy := meta.TerminatedBy
+	if terminatedBy == "" {
+		terminatedBy = ContextUser(systemCtx)
+	}
+	ctx := NewContext(context.Background(), terminatedBy, true)
+	if err := killClusterWithReason(ctx, clusterID, KillReasonRequested); err != nil {
+		return err
+	}
+
+	forgetClusterExpiryLock(clusterID)
+	return nil
+}
@@ -0,0 +1,176 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/pkg/errors"
+)
+
+// NodeThrottle records the reduced resources of a node along with the limits it had before, so it can be restored
+type NodeThrottle struct {
+	ClusterID string    `json:"cluster_id"`
+	NodeID    string    `json:"node_id"`
+	CPUs      float64   `json:"cpus,omitempty"`
+	MemoryMB  int64     `json:"memory_mb,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// OriginalNanoCPUs and OriginalMemory are the container's limits before it was first throttled, 0 is unlimited
+	OriginalNanoCPUs int64 `json:"original_nano_cpus"`
+	OriginalMemory   int64 `json:"original_memory"`
+}
+
+type ThrottleNodeOptions struct {
+	NodeID   string
+	CPUs     float64
+	MemoryMB int64
+}
+
+func validateThrottleNodeOptions(opts ThrottleNodeOptions) error {
+	if opts.CPUs < 0 || opts.MemoryMB < 0 {
+		return badRequestf("throttled cpus and memory cannot be negative")
+	}
+	if opts.CPUs == 0 && opts.MemoryMB == 0 {
+		return badRequestf("must specify cpus or memory to throttle the node to")
+	}
+	if opts.MemoryMB > 0 && opts.MemoryMB < 6 {
+		return badRequestf("memory cannot be throttled below 6MB")
+	}
+	return nil
+}
+
+func findNodeThrottle(clusterID string, nodeID string) (*NodeThrottle, error) {
+	throttles, err := metaStore.GetThrottles(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range throttles {
+		if throttles[i].NodeID == nodeID {
+			return &throttles[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func updateContainerResources(ctx context.Context, containerID string, resources container.Resources) error {
+	_, err := docker.ContainerUpdate(ctx, containerID, container.UpdateConfig{
+		Resources: resources,
+	})
+	return countDockerError("container_update", err)
+}
+
+func throttleNode(ctx context.Context, clusterID string, opts ThrottleNodeOptions) (*NodeThrottle, error) {
+	log.Printf("Throttling node %s of cluster %s to %.2f cpus and %dMB (requested by: %s)", opts.NodeID, clusterID,
+		opts.CPUs, opts.MemoryMB, ContextRequester(ctx))
+
+	if err := validateThrottleNodeOptions(opts); err != nil {
+		return nil, err
+	}
+
+	cluster, node, err := getClusterNode(ctx, clusterID, opts.NodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	throttle, err := findNodeThrottle(clusterID, node.ContainerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Throttling a throttled node again keeps the limits from before it was first throttled
+	if throttle == nil {
+		inspect, err := docker.ContainerInspect(ctx, node.ContainerID)
+		if err != nil {
+			return nil, countDockerError("container_inspect", err)
+		}
+
+		throttle = &NodeThrottle{
+			ClusterID:        clusterID,
+			NodeID:           node.ContainerID,
+			OriginalNanoCPUs: inspect.HostConfig.NanoCPUs,
+			OriginalMemory:   inspect.HostConfig.Memory,
+		}
+	}
+	throttle.CPUs = opts.CPUs
+	throttle.MemoryMB = opts.MemoryMB
+	throttle.CreatedAt = time.Now()
+
+	resources := container.Resources{
+		NanoCPUs: int64(opts.CPUs * 1e9),
+		Memory:   opts.MemoryMB * 1024 * 1024,
+	}
+	if err := updateContainerResources(ctx, node.ContainerID, resources); err != nil {
+		return nil, errors.Wrap(err, "failed to throttle node")
+	}
+
+	if err := metaStore.PutThrottle(*throttle); err != nil {
+		return nil, err
+	}
+
+	return throttle, nil
+}
+
+// unthrottleNode restores the limits a node had before it was throttled.  Docker cannot remove a limit from a
+// running container, so a node which had no limit is given the docker host's total CPUs or memory instead.
+func unthrottleNode(ctx context.Context, clusterID string, nodeID string) error {
+	log.Printf("Restoring resources of node %s of cluster %s (requested by: %s)", nodeID, clusterID, ContextRequester(ctx))
+
+	cluster, node, err := getClusterNode(ctx, clusterID, nodeID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return err
+	}
+
+	throttle, err := findNodeThrottle(clusterID, node.ContainerID)
+	if err != nil {
+		return err
+	}
+	if throttle == nil {
+		return badRequestf("node is not throttled")
+	}
+
+	resources := container.Resources{
+		NanoCPUs: throttle.OriginalNanoCPUs,
+		Memory:   throttle.OriginalMemory,
+	}
+	if (throttle.CPUs > 0 && resources.NanoCPUs == 0) || (throttle.MemoryMB > 0 && resources.Memory == 0) {
+		info, err := docker.Info(ctx)
+		if err != nil {
+			return countDockerError("info", err)
+		}
+		if throttle.CPUs > 0 && resources.NanoCPUs == 0 {
+			resources.NanoCPUs = int64(info.NCPU) * 1e9
+		}
+		if throttle.MemoryMB > 0 && resources.Memory == 0 {
+			resources.Memory = info.MemTotal
+		}
+	}
+
+	if err := updateContainerResources(ctx, node.ContainerID, resources); err != nil {
+		return errors.Wrap(err, "failed to restore node resources")
+	}
+
+	return metaStore.DeleteThrottle(clusterID, node.ContainerID)
+}
+
+func getThrottles(ctx context.Context, clusterID string) ([]NodeThrottle, error) {
+	cluster, err := getCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterOwnership(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	return metaStore.GetThrottles(clusterID)
+}
@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	KillReasonRequested        = "requested"
+	KillReasonExpired          = "expired"
+	KillReasonAllocationFailed = "allocation_failed"
+	KillReasonReclaimed        = "reclaimed"
+	KillReasonIncomplete       = "incomplete"
+)
+
+type ClusterTombstone struct {
+	ClusterID string    `json:"cluster_id"`
+	Owner     string    `json:"owner"`
+	KilledBy  string    `json:"killed_by"`
+	Reason    string    `json:"reason"`
+	KilledAt  time.Time `json:"killed_at"`
+}
+
+func recordTombstone(cluster *Cluster, killedBy, reason string) {
+	tombstone := ClusterTombstone{
+		ClusterID: cluster.ID,
+		Owner:     cluster.Owner,
+		KilledBy:  killedBy,
+		Reason:    reason,
+		KilledAt:  time.Now(),
+	}
+
+	err := metaStore.PutTombstone(tombstone)
+	if err != nil {
+		log.Printf("Failed to record tombstone for cluster %s: %s", cluster.ID, err)
+	}
+}
+
+// getClusterTombstone returns the tombstone of a killed cluster, or nil if it has none
+func getClusterTombstone(clusterID string) (*ClusterTombstone, error) {
+	tombstones, err := metaStore.GetTombstones()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tombstones {
+		if tombstones[i].ClusterID == clusterID {
+			return &tombstones[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func archiveTombstones(path string, tombstones []ClusterTombstone) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, tombstone := range tombstones {
+		if err := enc.Encode(tombstone); err != nil {
+			return err
+		}
+	}
+
+	return f.Sync()
+}
+
+// sweepTombstones removes tombstones older than the configured retention, archiving them first if an archive
+// path is configured.  A zero retention keeps tombstones forever.
+func sweepTombstones() error {
+	if getConfig().tombstoneRetention <= 0 {
+		return nil
+	}
+
+	tombstones, err := metaStore.GetTombstones()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-getConfig().tombstoneRetention)
+	var expired []ClusterTombstone
+	for _, tombstone := range tombstones {
+		if tombstone.KilledAt.Before(cutoff) {
+			expired = append(expired, tombstone)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	if getConfig().tombstoneArchivePath != "" {
+		// If archival fails we keep the tombstones so that they can be archived on the next sweep
+		if err := archiveTombstones(getConfig().tombstoneArchivePath, expired); err != nil {
+			return err
+		}
+	}
+
+	for _, tombstone := range expired {
+		// The history of a killed cluster is kept for as long as its tombstone
+		if err := metaStore.DeleteClusterHistory(tombstone.ClusterID); err != nil {
+			return err
+		}
+		if err := metaStore.DeleteTombstone(tombstone.ClusterID); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Swept %d expired tombstones", len(expired))
+	return nil
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+)
+
+// transientErrorMessages are fragments of errors caused by infrastructure blips rather than the request itself
+var transientErrorMessages = []string{
+	"connection reset",
+	"connection refused",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"service unavailable",
+	"too many requests",
+	"request canceled",
+}
+
+// permanentErrorMessages are fragments of errors which will fail the same way however often they are retried.
+// These take precedence over transient messages, as a permanent failure may mention a transient cause.
+var permanentErrorMessages = []string{
+	"no such image",
+	"no such container",
+	"manifest unknown",
+	"not found",
+	"unauthorized",
+	"authentication required",
+	"permission denied",
+	"is already in use",
+}
+
+// dockerRetryBackoff is how long to wait before retrying a docker call which failed transiently, this doubles
+// with each retry
+const dockerRetryBackoff = 1 * time.Second
+
+// parseErrorMessages parses the comma separated error fragments of the transient-errors and permanent-errors
+// configs
+func parseErrorMessages(list string) []string {
+	var messages []string
+	for _, message := range strings.Split(list, ",") {
+		message = strings.ToLower(strings.TrimSpace(message))
+		if message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+func containsErrorMessage(msg string, fragments []string) bool {
+	for _, fragment := range fragments {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTransientError classifies whether a failure, such as a docker API error, is likely to succeed if retried.
+// The built in messages are extended by the transient-errors and permanent-errors configs.
+func isTransientError(err error) bool {
+	cause := errors.Cause(err)
+	msg := strings.ToLower(cause.Error())
+
+	if client.IsErrNotFound(cause) || containsErrorMessage(msg, permanentErrorMessages) ||
+		containsErrorMessage(msg, parseErrorMessages(getConfig().permanentErrors)) {
+		return false
+	}
+
+	if client.IsErrConnectionFailed(cause) {
+		return true
+	}
+
+	if netErr, ok := cause.(net.Error); ok && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+
+	return containsErrorMessage(msg, transientErrorMessages) ||
+		containsErrorMessage(msg, parseErrorMessages(getConfig().transientErrors))
+}
+
+// retryTransient calls fn until it succeeds, fails permanently or has been retried docker-retries times
+func retryTransient(ctx context.Context, operation string, fn func() error) error {
+	backoff := dockerRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= getConfig().dockerRetries || !isTransientError(err) {
+			return err
+		}
+
+		log.Printf("Failed to %s with a transient error, retrying in %s: %s", operation, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,277 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// registryCatalogTimeout bounds each page of listing the repositories in a registry
+	registryCatalogTimeout = 10 * time.Second
+	// registryCatalogPageSize is how many repositories are asked for per page of the catalog
+	registryCatalogPageSize = 1000
+)
+
+// partialVersionRegexp matches a major or major.minor version, which resolves to the newest matching version
+var partialVersionRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+var catalogNextRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// isRegistryVersionAlias checks whether a server version is resolved against the available images rather than
+// used as is.  These are `latest`, a partial version such as `7` or `7.2`, or `M.m.p-latest` for the newest
+// build of a version.  The `M.m-stable` and `M.m-release` aliases are resolved from the products repo instead.
+func isRegistryVersionAlias(version string) bool {
+	return version == "latest" || strings.HasSuffix(version, "-latest") || partialVersionRegexp.MatchString(version)
+}
+
+type availableVersion struct {
+	version []int
+	build   int
+	tag     string
+}
+
+func parseAvailableVersion(tag string) (availableVersion, bool) {
+	versionParts := strings.SplitN(tag, "-", 2)
+	available := availableVersion{tag: tag, build: -1}
+	for _, part := range strings.Split(versionParts[0], ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return availableVersion{}, false
+		}
+		available.version = append(available.version, n)
+	}
+	if len(versionParts) > 1 {
+		build, err := strconv.Atoi(versionParts[1])
+		if err != nil {
+			return availableVersion{}, false
+		}
+		available.build = build
+	}
+	return available, true
+}
+
+// newerThan orders versions numerically, then by build
+func (v availableVersion) newerThan(other availableVersion) bool {
+	for i := 0; i < len(v.version) && i < len(other.version); i++ {
+		if v.version[i] != other.version[i] {
+			return v.version[i] > other.version[i]
+		}
+	}
+	if len(v.version) != len(other.version) {
+		return len(v.version) > len(other.version)
+	}
+	return v.build > other.build
+}
+
+// matchesAlias checks whether a version is one an alias could resolve to
+func (v availableVersion) matchesAlias(alias string) bool {
+	if alias == "latest" {
+		return true
+	}
+	if strings.HasSuffix(alias, "-latest") {
+		return v.build != -1 && strings.TrimSuffix(v.tag, fmt.Sprintf("-%d", v.build)) == strings.TrimSuffix(alias, "-latest")
+	}
+
+	prefix, ok := parseAvailableVersion(alias)
+	if !ok || len(prefix.version) > len(v.version) {
+		return false
+	}
+	for i, n := range prefix.version {
+		if v.version[i] != n {
+			return false
+		}
+	}
+	return true
+}
+
+func getCatalogPage(ctx context.Context, client *http.Client, pageURL string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req.WithContext(ctx))
+}
+
+// readCatalogPage reads the repositories listed on a page of a registry's catalog, along with the path of the
+// next page if there is one
+func readCatalogPage(registry string, resp *http.Response) ([]string, string, error) {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, "", fmt.Errorf("registry %s returned %d for its catalog", registry, resp.StatusCode)
+	}
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+		return nil, "", fmt.Errorf("failed to read the catalog of registry %s: %s", registry, err)
+	}
+
+	next := ""
+	if matches := catalogNextRegexp.FindStringSubmatch(resp.Header.Get("Link")); matches != nil {
+		next = matches[1]
+	}
+	return catalog.Repositories, next, nil
+}
+
+// listRegistryServerVersions lists the server versions of an edition which have images in a registry.  The
+// version of a node image is part of its repository name, so these come from the registry's catalog.  Registries
+// are tried over HTTPS first, then over plain HTTP as internal registries often do not use TLS.
+func listRegistryServerVersions(ctx context.Context, registry string, edition Edition) ([]string, error) {
+	client := &http.Client{Timeout: registryCatalogTimeout}
+
+	var resp *http.Response
+	var baseURL string
+	var err error
+	for _, scheme := range []string{"https", "http"} {
+		baseURL = fmt.Sprintf("%s://%s", scheme, registry)
+		resp, err = getCatalogPage(ctx, client, fmt.Sprintf("%s/v2/_catalog?n=%d", baseURL, registryCatalogPageSize))
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for {
+		repositories, next, err := readCatalogPage(registry, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repository := range repositories {
+			repositoryEdition, version, ok := parseServerImageTag(repository)
+			if ok && repositoryEdition == edition {
+				versions = append(versions, version)
+			}
+		}
+
+		if next == "" {
+			return versions, nil
+		}
+		resp, err = getCatalogPage(ctx, client, baseURL+next)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// listCachedServerVersions lists the server versions of an edition which have images cached on the docker host
+func listCachedServerVersions(ctx context.Context, edition Edition) ([]string, error) {
+	cached, err := getCachedServerVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, hostVersions := range cached {
+		for version, images := range hostVersions {
+			for _, image := range images {
+				if Edition(image.Edition) == edition {
+					versions = append(versions, version)
+					break
+				}
+			}
+		}
+	}
+	return versions, nil
+}
+
+// listAvailableServerVersions lists the server versions of an edition with an image either in the registry or
+// cached on the docker host
+func listAvailableServerVersions(ctx context.Context, alias string, edition Edition, registry string) ([]string, error) {
+	var tags []string
+	if registry != "" {
+		registryVersions, err := listRegistryServerVersions(ctx, registry, edition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve server version `%s` from registry %s: %s", alias, registry, err)
+		}
+		tags = append(tags, registryVersions...)
+	}
+	cachedVersions, err := listCachedServerVersions(ctx, edition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve server version `%s` from the cached images: %s", alias, err)
+	}
+	return append(tags, cachedVersions...), nil
+}
+
+// newestMatchingVersion picks the newest of the available versions an alias could resolve to.  Releases are
+// preferred over builds unless the alias asks for the newest build of a version.
+func newestMatchingVersion(alias string, edition Edition, registry string, tags []string) (string, error) {
+	var newestRelease, newestBuild *availableVersion
+	for _, tag := range tags {
+		available, ok := parseAvailableVersion(tag)
+		if !ok || !available.matchesAlias(alias) {
+			continue
+		}
+		if available.build == -1 && (newestRelease == nil || available.newerThan(*newestRelease)) {
+			newestRelease = &available
+		}
+		if available.build != -1 && (newestBuild == nil || available.newerThan(*newestBuild)) {
+			newestBuild = &available
+		}
+	}
+
+	newest := newestRelease
+	if newest == nil {
+		newest = newestBuild
+	}
+	if newest == nil {
+		source := "on the docker host"
+		if registry != "" {
+			source = fmt.Sprintf("in registry %s or on the docker host", registry)
+		}
+		return "", badRequestf("no %s server image matches version `%s` %s", edition, alias, source)
+	}
+
+	log.Printf("Resolved server version %s -> %s", alias, newest.tag)
+	return newest.tag, nil
+}
+
+// versionResolver resolves the version aliases of a single request to the newest concrete version with an image
+// either in its registry or cached on the docker host.  The available versions are only listed once per edition,
+// so that nodes share a single crawl of the registry's catalog rather than crawling it once per node.
+type versionResolver struct {
+	registry  string
+	available map[Edition][]string
+}
+
+// newVersionResolver creates a resolver for a request's registry, or the daemon's docker-registry if empty
+func newVersionResolver(registry string) *versionResolver {
+	if registry == "" {
+		registry = getConfig().dockerRegistry
+	}
+	return &versionResolver{
+		registry:  registry,
+		available: make(map[Edition][]string),
+	}
+}
+
+// resolve resolves a version alias, versions which are not aliases are returned as they are
+func (resolver *versionResolver) resolve(ctx context.Context, alias string, edition Edition) (string, error) {
+	if !isRegistryVersionAlias(alias) {
+		return alias, nil
+	}
+
+	tags, ok := resolver.available[edition]
+	if !ok {
+		var err error
+		tags, err = listAvailableServerVersions(ctx, alias, edition, resolver.registry)
+		if err != nil {
+			return "", err
+		}
+		resolver.available[edition] = tags
+	}
+
+	return newestMatchingVersion(alias, edition, resolver.registry, tags)
+}
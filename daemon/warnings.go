@@ -0,0 +1,23 @@
+package daemon
+
+import "fmt"
+
+// Warnings report non-fatal issues with a request, they are returned alongside a successful response rather than
+// as an error so that clients can tell "succeeded with caveats" apart from "failed".
+
+// allocationWarnings returns the warnings about allocating a cluster with already validated and fitted options
+func allocationWarnings(opts ClusterOptions) []string {
+	var warnings []string
+	if opts.RequestedNodes > 0 {
+		warnings = append(warnings, fmt.Sprintf("only %d of the %d requested nodes fit on the docker host", len(opts.Nodes), opts.RequestedNodes))
+	}
+	return warnings
+}
+
+// jsonifyWarnings makes sure warnings are always encoded as an array, even when there are none
+func jsonifyWarnings(warnings []string) []string {
+	if warnings == nil {
+		return make([]string, 0)
+	}
+	return warnings
+}
@@ -1,6 +1,7 @@
 package helper
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"flag"
@@ -65,12 +66,17 @@ const (
 	PNodesSelf         = "/nodes/self"
 	PRebalance         = "/controller/rebalance"
 	PRebalanceProgress = "/pools/default/rebalanceProgress"
+	PTasks             = "/pools/default/tasks"
 	PSettingsIndexes   = "/settings/indexes"
 	PN1ql              = "/query"
 	PFts               = "/api/index"
 	PRename            = "/node/controller/rename"
 	PDeveloperPreview  = "/settings/developerPreview"
 	PSampleBucket      = "/sampleBuckets/install"
+	PNodeSettings      = "/nodes/self/controller/settings"
+	PServerGroups      = "/pools/default/serverGroups"
+	PCertificate       = "/pools/default/certificate"
+	PTerseClusterInfo  = "/pools/default/terseClusterInfo"
 
 	Domain        = "/domain"
 	DomainPostfix = ".couchbase.com"
@@ -89,9 +95,18 @@ type UserOption struct {
 }
 
 type BucketOption struct {
-	Name     string
-	Type     string
-	Password string
+	Name         string
+	Type         string
+	Password     string
+	ReplicaCount *int `json:"replica_count"`
+}
+
+// Replicas returns the number of replicas requested for the bucket, buckets have a single replica by default
+func (b *BucketOption) Replicas() int {
+	if b.ReplicaCount == nil {
+		return 1
+	}
+	return *b.ReplicaCount
 }
 
 type stop struct {
@@ -123,6 +138,9 @@ type Cred struct {
 	Hostname string
 	Port     int
 	Roles    *[]string
+	Trace    *RestTrace
+	// Ctx cancels the requests made with the credentials when it is done, if set
+	Ctx context.Context
 }
 
 type RestCall struct {
@@ -264,7 +282,7 @@ func FtsWorkload(bucket *gocb.Bucket, ftsIndexName string, numItems int, chErr c
 			}
 
 			if len(res.Hits()) != 1 {
-				msg += fmt.Sprintf("%s:Hits expected 1 but was %d", str, res.Hits())
+				msg += fmt.Sprintf("%s:Hits expected 1 but was %d", str, len(res.Hits()))
 			}
 			chErr <- errors.New("Error from FTS:" + msg)
 			return
@@ -307,7 +325,7 @@ func RestRetryer(retry int, params *RestCall, fn func(*RestCall) (string, error)
 		}
 
 		if retry--; retry > 0 {
-			glog.Infof("Retrying %v %d more times in 1 sec", fn, retry)
+			glog.Infof("Retrying %s %d more times in 1 sec", params.Path, retry)
 			time.Sleep(restInterval)
 			return RestRetryer(retry, params, fn)
 		}
@@ -344,6 +362,9 @@ func GetResponse(params *RestCall) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if login.Ctx != nil {
+		req = req.WithContext(login.Ctx)
+	}
 	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(login.Username+":"+login.Password)))
 	contentType := "application/x-www-form-urlencoded"
 	if params.ContentType != "" {
@@ -358,6 +379,7 @@ func GetResponse(params *RestCall) (string, error) {
 	res, err := client.Do(req)
 	if err != nil {
 		glog.Infof("Server might not be ready yet.:%s", err)
+		login.Trace.Record(method, url, 0, "", err)
 		return "", err
 	}
 	defer res.Body.Close()
@@ -367,6 +389,7 @@ func GetResponse(params *RestCall) (string, error) {
 	case s == expected:
 		glog.Infof("%s returned %d", url, s)
 		respBody, err := ioutil.ReadAll(res.Body)
+		login.Trace.Record(method, url, s, string(respBody), err)
 		if err != nil {
 			return "", err
 		}
@@ -374,10 +397,12 @@ func GetResponse(params *RestCall) (string, error) {
 	case s == retryOnCode: // expected response when server is not ready for this request yet
 		glog.Infof("%s returned %d which is expected when server is not ready yet", url, s)
 		respBody, _ := ioutil.ReadAll(res.Body)
+		login.Trace.Record(method, url, s, string(respBody), nil)
 		return "", errors.New(string(respBody))
 	default:
 		respBody, err := ioutil.ReadAll(res.Body)
 		glog.Infof("respBody=%s, err=%s", string(respBody), err)
+		login.Trace.Record(method, url, s, string(respBody), err)
 		return "", stop{fmt.Errorf("Request:%v,PostBody:%s,Response:%d:%s", req, postBody, s, string(respBody))}
 	}
 }
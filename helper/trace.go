@@ -0,0 +1,60 @@
+package helper
+
+import (
+	"sync"
+	"time"
+)
+
+const maxTraceBodyLen = 1024
+
+type RestTraceEntry struct {
+	Time   time.Time
+	Method string
+	URL    string
+	Status int
+	Body   string
+	Error  string
+}
+
+// RestTrace records the REST calls made with a Cred, it is safe for concurrent use
+type RestTrace struct {
+	lock    sync.Mutex
+	entries []RestTraceEntry
+}
+
+func truncateTraceBody(body string) string {
+	if len(body) > maxTraceBodyLen {
+		return body[:maxTraceBodyLen] + "...(truncated)"
+	}
+	return body
+}
+
+func (t *RestTrace) Record(method, url string, status int, body string, err error) {
+	if t == nil {
+		return
+	}
+
+	entry := RestTraceEntry{
+		Time:   time.Now(),
+		Method: method,
+		URL:    url,
+		Status: status,
+		Body:   truncateTraceBody(body),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	t.lock.Lock()
+	t.entries = append(t.entries, entry)
+	t.lock.Unlock()
+}
+
+func (t *RestTrace) Entries() []RestTraceEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	entries := make([]RestTraceEntry, len(t.entries))
+	copy(entries, t.entries)
+	return entries
+}